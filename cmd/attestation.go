@@ -0,0 +1,103 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/server/attestation"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var verifyAttestationCmdConfig struct {
+	KeyPath         string
+	SHA             string
+	AllowUnapproved bool
+}
+
+var AttestationCmd = &cobra.Command{
+	Use:   "attestation",
+	Short: "Works with attestations for merged pull requests.",
+}
+
+var VerifyAttestationCmd = &cobra.Command{
+	Use:   "verify [flags] attestation.json",
+	Short: "Verifies a signed attestation for a merged pull request.",
+	Long: "Verifies that an attestation was signed by the private key matching the public key, " +
+		"optionally that it is for a specific merge commit, and that the pull request was approved by its policy.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: verifyAttestationCmd,
+}
+
+func verifyAttestationCmd(cmd *cobra.Command, args []string) error {
+	pemKey, err := os.ReadFile(verifyAttestationCmdConfig.KeyPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read public key: %s", verifyAttestationCmdConfig.KeyPath)
+	}
+	pub, err := attestation.ParsePublicKey(pemKey)
+	if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		return errors.Wrapf(err, "failed to read attestation: %s", args[0])
+	}
+
+	var env attestation.Envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return errors.Wrap(err, "failed to parse attestation")
+	}
+
+	st, err := attestation.Verify(&env, pub)
+	if err != nil {
+		return errors.Wrap(err, "attestation is invalid")
+	}
+
+	sha := st.CommitSHA()
+	if want := verifyAttestationCmdConfig.SHA; want != "" && want != sha {
+		return errors.Errorf("attestation is for commit %s, not %s", sha, want)
+	}
+
+	p := st.Predicate
+	fmt.Printf("Verified attestation for commit %s\n", sha)
+	fmt.Printf("  Pull request: %s#%d (merged by %s at %s)\n", p.Repository, p.PullRequest, p.MergedBy, p.MergedAt.Format(time.RFC3339))
+	fmt.Printf("  Policy: %s: %s (%s)\n", p.Policy.Source, p.Policy.Path, p.Policy.SHA)
+	fmt.Printf("  Status: %s: %s\n", p.Status, p.StatusDescription)
+	for _, a := range p.Approvers {
+		fmt.Printf("  Approved by %s (%s) for %q at %s\n", a.User, a.Type, a.Rule, a.CreatedAt.Format(time.RFC3339))
+	}
+
+	if p.Status != common.StatusApproved.String() && !verifyAttestationCmdConfig.AllowUnapproved {
+		return errors.Errorf("pull request was merged with policy status %s", p.Status)
+	}
+	return nil
+}
+
+func init() {
+	VerifyAttestationCmd.Flags().StringVarP(&verifyAttestationCmdConfig.KeyPath, "key", "k", "", "path to the PEM-encoded public key")
+	VerifyAttestationCmd.Flags().StringVar(&verifyAttestationCmdConfig.SHA, "sha", "", "require the attestation to be for this merge commit")
+	VerifyAttestationCmd.Flags().BoolVar(&verifyAttestationCmdConfig.AllowUnapproved, "allow-unapproved", false, "do not fail if the pull request was not approved")
+	_ = VerifyAttestationCmd.MarkFlagRequired("key")
+
+	AttestationCmd.AddCommand(VerifyAttestationCmd)
+	RootCmd.AddCommand(AttestationCmd)
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/version"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var coverageCmdConfig struct {
+	Path           string
+	Format         string
+	Output         string
+	Concurrency    int
+	FailOnFindings bool
+}
+
+var CoverageCmd = &cobra.Command{
+	Use:   "coverage [flags] owner",
+	Short: "Reports policy coverage for the repositories in an organization.",
+	Long: "Checks every repository in the organization's installation for a missing or invalid policy " +
+		"and for default and protected branches that do not require the policy-bot status. " +
+		"Uses the GitHub App credentials and policy options from the server configuration.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: coverageCmd,
+}
+
+func coverageCmd(cmd *cobra.Command, args []string) error {
+	owner := args[0]
+
+	format := coverageCmdConfig.Format
+	if format != "json" && format != "csv" {
+		return errors.Errorf("invalid format %q, must be json or csv", format)
+	}
+
+	cfg, err := readServerConfig(coverageCmdConfig.Path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read server config")
+	}
+
+	cc, err := githubapp.NewDefaultCachingClientCreator(
+		cfg.Github,
+		githubapp.WithClientUserAgent(fmt.Sprintf("policy-bot/%s", version.GetVersion())),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize client creator")
+	}
+
+	appClient, err := cc.NewAppClient()
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize Github app client")
+	}
+
+	ctx := context.Background()
+	installation, err := githubapp.NewInstallationsService(appClient).GetByOwner(ctx, owner)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get installation for %s", owner)
+	}
+
+	reporter := &handler.CoverageReporter{
+		ClientCreator: cc,
+		ConfigFetcher: handler.NewConfigFetcher(&cfg.Options),
+		PullOpts:      &cfg.Options,
+		Concurrency:   coverageCmdConfig.Concurrency,
+	}
+
+	report, err := reporter.Report(ctx, installation.ID, owner)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if coverageCmdConfig.Output != "" {
+		f, err := os.Create(coverageCmdConfig.Output)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create output file: %s", coverageCmdConfig.Output)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+
+	if format == "csv" {
+		err = report.WriteCSV(out)
+	} else {
+		err = report.WriteJSON(out)
+	}
+	if err != nil {
+		return err
+	}
+
+	if coverageCmdConfig.FailOnFindings && report.HasFindings() {
+		return errors.New("coverage report contains findings")
+	}
+	return nil
+}
+
+func init() {
+	CoverageCmd.Flags().StringVarP(&coverageCmdConfig.Path, "config", "c", "config/policy-bot.yml", "configuration file for policy-bot")
+	CoverageCmd.Flags().StringVarP(&coverageCmdConfig.Format, "format", "f", "json", "output format: json or csv")
+	CoverageCmd.Flags().StringVarP(&coverageCmdConfig.Output, "output", "o", "", "write the report to this file instead of stdout")
+	CoverageCmd.Flags().IntVar(&coverageCmdConfig.Concurrency, "concurrency", handler.DefaultCoverageConcurrency, "maximum number of repositories to check at the same time")
+	CoverageCmd.Flags().BoolVar(&coverageCmdConfig.FailOnFindings, "fail-on-findings", false, "exit with an error if any repository has findings")
+
+	RootCmd.AddCommand(CoverageCmd)
+}
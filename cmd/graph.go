@@ -0,0 +1,141 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/graph"
+	"github.com/palantir/policy-bot/server/handler"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var graphCmdConfig struct {
+	Format string
+	Output string
+	Result string
+}
+
+var GraphCmd = &cobra.Command{
+	Use:   "graph [flags] policy-file",
+	Short: "Draws the approval policy as a Mermaid or DOT graph.",
+	Long: "Writes the approval policy in a policy file as a graph of rules and the \"and\" and \"or\" " +
+		"requirements that combine them, in Mermaid or Graphviz DOT format. Set a result file with the " +
+		"JSON response of the simulation API for the same policy to color the graph by status.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: graphCmd,
+}
+
+func graphCmd(cmd *cobra.Command, args []string) error {
+	format := graphCmdConfig.Format
+	if format != "mermaid" && format != "dot" {
+		return errors.Errorf("invalid format %q, must be mermaid or dot", format)
+	}
+
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		return errors.Wrapf(err, "failed to read policy file: %s", args[0])
+	}
+
+	var config policy.Config
+	if err := yaml.UnmarshalStrict(b, &config); err != nil {
+		return errors.Wrapf(err, "failed to parse policy file: %s", args[0])
+	}
+
+	var result *common.Result
+	if graphCmdConfig.Result != "" {
+		if result, err = readGraphResult(graphCmdConfig.Result); err != nil {
+			return err
+		}
+	}
+
+	root, err := graph.Build(&config, result)
+	if err != nil {
+		return errors.Wrapf(err, "invalid policy file: %s", args[0])
+	}
+
+	var out io.Writer = os.Stdout
+	if graphCmdConfig.Output != "" {
+		f, err := os.Create(graphCmdConfig.Output)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create output file: %s", graphCmdConfig.Output)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+
+	if format == "dot" {
+		return graph.WriteDOT(out, root)
+	}
+	return graph.WriteMermaid(out, root)
+}
+
+// readGraphResult reads a response from the simulation API.
+func readGraphResult(path string) (*common.Result, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read result file: %s", path)
+	}
+
+	var res handler.SimulationResponse
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse result file: %s", path)
+	}
+	return newGraphResult(&res)
+}
+
+func newGraphResult(res *handler.SimulationResponse) (*common.Result, error) {
+	result := &common.Result{Name: res.Name}
+	if res.Error != "" {
+		result.Error = errors.New(res.Error)
+	}
+
+	switch res.Status {
+	case common.StatusSkipped.String():
+		result.Status = common.StatusSkipped
+	case common.StatusPending.String():
+		result.Status = common.StatusPending
+	case common.StatusApproved.String():
+		result.Status = common.StatusApproved
+	case common.StatusDisapproved.String():
+		result.Status = common.StatusDisapproved
+	default:
+		return nil, errors.Errorf("invalid status %q in result %q", res.Status, res.Name)
+	}
+
+	for _, c := range res.Children {
+		child, err := newGraphResult(c)
+		if err != nil {
+			return nil, err
+		}
+		result.Children = append(result.Children, child)
+	}
+	return result, nil
+}
+
+func init() {
+	GraphCmd.Flags().StringVarP(&graphCmdConfig.Format, "format", "f", "mermaid", "output format: mermaid or dot")
+	GraphCmd.Flags().StringVarP(&graphCmdConfig.Output, "output", "o", "", "write the graph to this file instead of stdout")
+	GraphCmd.Flags().StringVarP(&graphCmdConfig.Result, "result", "r", "", "color the graph using a response from the simulation API")
+
+	RootCmd.AddCommand(GraphCmd)
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/lint"
+	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/version"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var lintCmdConfig struct {
+	Path           string
+	Repository     string
+	Ref            string
+	Format         string
+	FailOnWarnings bool
+}
+
+var LintCmd = &cobra.Command{
+	Use:   "lint [flags] policy-file",
+	Short: "Reports possible problems in a policy file.",
+	Long: "Validates a policy file and reports rules that are unused, unreachable, or can never be approved, " +
+		"deprecated fields, and redundant permissions. If a repository is set, also reports file patterns " +
+		"that do not match any file in the repository at the ref, using the GitHub App credentials from " +
+		"the server configuration.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: lintCmd,
+}
+
+func lintCmd(cmd *cobra.Command, args []string) error {
+	format := lintCmdConfig.Format
+	if format != "text" && format != "json" {
+		return errors.Errorf("invalid format %q, must be text or json", format)
+	}
+
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		return errors.Wrapf(err, "failed to read policy file: %s", args[0])
+	}
+
+	var config policy.Config
+	if err := yaml.UnmarshalStrict(b, &config); err != nil {
+		return errors.Wrapf(err, "failed to parse policy file: %s", args[0])
+	}
+	if _, err := policy.ParsePolicy(&config); err != nil {
+		return errors.Wrapf(err, "invalid policy file: %s", args[0])
+	}
+
+	var opts lint.Options
+	if lintCmdConfig.Repository != "" {
+		files, err := listLintFiles(context.Background(), lintCmdConfig.Repository, lintCmdConfig.Ref)
+		switch {
+		case err == handler.ErrTreeTruncated:
+			fmt.Fprintf(os.Stderr, "warning: %s has too many files to check file patterns\n", lintCmdConfig.Repository)
+		case err != nil:
+			return err
+		}
+		opts.Files = files
+	}
+
+	warnings := lint.Lint(&config, opts)
+
+	if format == "json" {
+		if warnings == nil {
+			warnings = []lint.Warning{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(warnings); err != nil {
+			return errors.Wrap(err, "failed to write warnings")
+		}
+	} else {
+		for _, w := range warnings {
+			fmt.Println(w.String())
+		}
+	}
+
+	if lintCmdConfig.FailOnWarnings && len(warnings) > 0 {
+		return errors.Errorf("policy file has %d warning(s)", len(warnings))
+	}
+	return nil
+}
+
+func listLintFiles(ctx context.Context, repository, ref string) ([]string, error) {
+	owner, repo, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || repo == "" {
+		return nil, errors.Errorf("invalid repository %q, must be in owner/repo format", repository)
+	}
+
+	cfg, err := readServerConfig(lintCmdConfig.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read server config")
+	}
+
+	cc, err := githubapp.NewDefaultCachingClientCreator(
+		cfg.Github,
+		githubapp.WithClientUserAgent(fmt.Sprintf("policy-bot/%s", version.GetVersion())),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize client creator")
+	}
+
+	appClient, err := cc.NewAppClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Github app client")
+	}
+
+	installation, err := githubapp.NewInstallationsService(appClient).GetByOwner(ctx, owner)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get installation for %s", owner)
+	}
+
+	client, err := cc.NewInstallationClient(installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create installation client")
+	}
+
+	return handler.ListRepositoryFiles(ctx, client, owner, repo, ref)
+}
+
+func init() {
+	LintCmd.Flags().StringVarP(&lintCmdConfig.Path, "config", "c", "config/policy-bot.yml", "configuration file for policy-bot, used with --repository")
+	LintCmd.Flags().StringVarP(&lintCmdConfig.Repository, "repository", "r", "", "check file patterns against the files in this repository, in owner/repo format")
+	LintCmd.Flags().StringVar(&lintCmdConfig.Ref, "ref", "", "the ref to list files at, defaults to the default branch of the repository")
+	LintCmd.Flags().StringVarP(&lintCmdConfig.Format, "format", "f", "text", "output format: text or json")
+	LintCmd.Flags().BoolVar(&lintCmdConfig.FailOnWarnings, "fail-on-warnings", false, "exit with an error if there are any warnings")
+
+	RootCmd.AddCommand(LintCmd)
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server"
+	"github.com/palantir/policy-bot/server/replay"
+	"github.com/palantir/policy-bot/version"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var replayCmdConfig struct {
+	Path         string
+	Policy       string
+	Since        string
+	Until        string
+	Limit        int
+	State        string
+	Format       string
+	Output       string
+	MinRateLimit int
+	Verbose      bool
+}
+
+var ReplayCmd = &cobra.Command{
+	Use:   "replay [flags] owner/repo",
+	Short: "Evaluates a policy against merged pull requests.",
+	Long: "Evaluates a candidate policy file against the pull requests merged in a repository in a time range " +
+		"and reports which pull requests the policy would have blocked. Uses the GitHub App credentials from " +
+		"the server configuration. Set a state file to save results as they are computed; running the " +
+		"command again with the same state file skips pull requests that were already evaluated.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: replayCmd,
+}
+
+func replayCmd(cmd *cobra.Command, args []string) error {
+	owner, repo, ok := strings.Cut(args[0], "/")
+	if !ok || owner == "" || repo == "" {
+		return errors.Errorf("invalid repository %q, must be in owner/repo format", args[0])
+	}
+
+	format := replayCmdConfig.Format
+	if format != "table" && format != "json" && format != "csv" {
+		return errors.Errorf("invalid format %q, must be table, json, or csv", format)
+	}
+
+	q := replay.Query{
+		Owner: owner,
+		Repo:  repo,
+		Limit: replayCmdConfig.Limit,
+	}
+	var err error
+	if q.Since, err = parseReplayTime(replayCmdConfig.Since); err != nil {
+		return errors.Wrap(err, "invalid since time")
+	}
+	if q.Until, err = parseReplayTime(replayCmdConfig.Until); err != nil {
+		return errors.Wrap(err, "invalid until time")
+	}
+
+	if replayCmdConfig.Policy == "" {
+		return errors.New("a policy file is required")
+	}
+	b, err := os.ReadFile(replayCmdConfig.Policy)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read policy file: %s", replayCmdConfig.Policy)
+	}
+
+	var config policy.Config
+	if err := yaml.UnmarshalStrict(b, &config); err != nil {
+		return errors.Wrapf(err, "failed to parse policy file: %s", replayCmdConfig.Policy)
+	}
+	evaluator, err := policy.ParsePolicy(&config)
+	if err != nil {
+		return errors.Wrapf(err, "invalid policy file: %s", replayCmdConfig.Policy)
+	}
+
+	cfg, err := readServerConfig(replayCmdConfig.Path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read server config")
+	}
+
+	cc, err := githubapp.NewDefaultCachingClientCreator(
+		cfg.Github,
+		githubapp.WithClientUserAgent(fmt.Sprintf("policy-bot/%s", version.GetVersion())),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize client creator")
+	}
+
+	appClient, err := cc.NewAppClient()
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize Github app client")
+	}
+
+	level := zerolog.InfoLevel
+	if replayCmdConfig.Verbose {
+		level = zerolog.DebugLevel
+	}
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(level).With().Timestamp().Logger()
+	ctx := logger.WithContext(context.Background())
+
+	installation, err := githubapp.NewInstallationsService(appClient).GetByOwner(ctx, owner)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get installation for %s", owner)
+	}
+
+	client, err := cc.NewInstallationClient(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create installation client")
+	}
+	v4client, err := cc.NewInstallationV4Client(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create installation v4 client")
+	}
+
+	globalCache, err := pull.NewLRUGlobalCache(server.DefaultPushedAtCacheSize)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize global cache")
+	}
+
+	replayer := &replay.Replayer{
+		Client:       client,
+		V4Client:     v4client,
+		GlobalCache:  globalCache,
+		Evaluator:    evaluator,
+		MinRateLimit: replayCmdConfig.MinRateLimit,
+	}
+
+	var state io.Writer
+	var previous map[int]*replay.PullResult
+	if path := replayCmdConfig.State; path != "" {
+		previous, err = readReplayState(path)
+		if err != nil {
+			return err
+		}
+		if len(previous) > 0 {
+			logger.Info().Msgf("Loaded %d previous results from %s", len(previous), path)
+		}
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open state file: %s", path)
+		}
+		defer func() { _ = f.Close() }()
+		state = f
+	}
+
+	replayer.OnResult = func(res *replay.PullResult) error {
+		logger.Info().Msgf("Evaluated pull request #%d: %s", res.Number, res.Status)
+		if state != nil {
+			return replay.WriteResult(state, res)
+		}
+		return nil
+	}
+
+	report, err := replayer.Replay(ctx, q, previous)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if replayCmdConfig.Output != "" {
+		f, err := os.Create(replayCmdConfig.Output)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create output file: %s", replayCmdConfig.Output)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "csv":
+		return report.WriteCSV(out)
+	default:
+		return report.WriteTable(out)
+	}
+}
+
+// parseReplayTime parses a time in RFC 3339 format or a date in YYYY-MM-DD
+// format, which is interpreted as midnight UTC. An empty value returns the
+// zero time.
+func parseReplayTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, errors.New("must be a date (YYYY-MM-DD) or a time in RFC 3339 format")
+	}
+	return t, nil
+}
+
+func readReplayState(path string) (map[int]*replay.PullResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to open state file: %s", path)
+	}
+	defer func() { _ = f.Close() }()
+
+	previous, err := replay.ReadResults(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read state file: %s", path)
+	}
+	return previous, nil
+}
+
+func init() {
+	ReplayCmd.Flags().StringVarP(&replayCmdConfig.Path, "config", "c", "config/policy-bot.yml", "configuration file for policy-bot")
+	ReplayCmd.Flags().StringVarP(&replayCmdConfig.Policy, "policy", "p", "", "policy file to evaluate")
+	ReplayCmd.Flags().StringVar(&replayCmdConfig.Since, "since", "", "only replay pull requests merged at or after this date or time")
+	ReplayCmd.Flags().StringVar(&replayCmdConfig.Until, "until", "", "only replay pull requests merged before this date or time")
+	ReplayCmd.Flags().IntVar(&replayCmdConfig.Limit, "limit", 0, "replay at most this many of the most recently merged pull requests")
+	ReplayCmd.Flags().StringVar(&replayCmdConfig.State, "state", "", "file to save results in so an interrupted replay can resume")
+	ReplayCmd.Flags().StringVarP(&replayCmdConfig.Format, "format", "f", "table", "output format: table, json, or csv")
+	ReplayCmd.Flags().StringVarP(&replayCmdConfig.Output, "output", "o", "", "write the report to this file instead of stdout")
+	ReplayCmd.Flags().IntVar(&replayCmdConfig.MinRateLimit, "min-rate-limit", replay.DefaultMinRateLimit, "wait for the rate limit to reset when fewer than this many requests remain")
+	ReplayCmd.Flags().BoolVarP(&replayCmdConfig.Verbose, "verbose", "v", false, "enable debug logging")
+
+	RootCmd.AddCommand(ReplayCmd)
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/palantir/policy-bot/policy/schema"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var schemaCmdConfig struct {
+	Output string
+}
+
+var SchemaCmd = &cobra.Command{
+	Use:   "schema [flags]",
+	Short: "Prints the JSON Schema for policy files.",
+	Long: "Prints a JSON Schema that editors and other tools can use to validate policy files. " +
+		"The schema checks the structure of a policy, but not that the rules it references exist.",
+	Args: cobra.NoArgs,
+
+	RunE: schemaCmd,
+}
+
+func schemaCmd(cmd *cobra.Command, args []string) error {
+	s, err := schema.Generate()
+	if err != nil {
+		return errors.Wrap(err, "failed to generate schema")
+	}
+
+	var out io.Writer = os.Stdout
+	if schemaCmdConfig.Output != "" {
+		f, err := os.Create(schemaCmdConfig.Output)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create output file: %s", schemaCmdConfig.Output)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(s), "failed to write schema")
+}
+
+func init() {
+	SchemaCmd.Flags().StringVarP(&schemaCmdConfig.Output, "output", "o", "", "write the schema to this file instead of stdout")
+
+	RootCmd.AddCommand(SchemaCmd)
+}
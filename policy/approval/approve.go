@@ -26,6 +26,7 @@ import (
 	"github.com/palantir/policy-bot/pull"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Rule struct {
@@ -101,6 +102,10 @@ func (r *Rule) Trigger() common.Trigger {
 }
 
 func (r *Rule) Evaluate(ctx context.Context, prctx pull.Context) (res common.Result) {
+	ctx, span := common.StartSpan(ctx, "approval.Rule", attribute.String("policybot.rule", r.Name))
+	defer func() { common.EndResultSpan(span, &res) }()
+	defer pull.BindContext(prctx, ctx)()
+
 	log := zerolog.Ctx(ctx)
 
 	res.Name = r.Name
@@ -112,7 +117,7 @@ func (r *Rule) Evaluate(ctx context.Context, prctx pull.Context) (res common.Res
 	var predicateResults []*common.PredicateResult
 
 	for _, p := range r.Predicates.Predicates() {
-		result, err := p.Evaluate(ctx, prctx)
+		result, err := predicate.Evaluate(ctx, p, prctx)
 		if err != nil {
 			res.Error = errors.Wrap(err, "failed to evaluate predicate")
 			return
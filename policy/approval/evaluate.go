@@ -52,6 +52,11 @@ type RuleRequirement struct {
 	rule *Rule
 }
 
+// Rule returns the rule that must be approved.
+func (r *RuleRequirement) Rule() *Rule {
+	return r.rule
+}
+
 func (r *RuleRequirement) Trigger() common.Trigger {
 	return r.rule.Trigger()
 }
@@ -72,6 +77,11 @@ type OrRequirement struct {
 	requirements []common.Evaluator
 }
 
+// Requirements returns the requirements, one of which must be approved.
+func (r *OrRequirement) Requirements() []common.Evaluator {
+	return r.requirements
+}
+
 func (r *OrRequirement) Trigger() common.Trigger {
 	var t common.Trigger
 	for _, child := range r.requirements {
@@ -132,6 +142,11 @@ type AndRequirement struct {
 	requirements []common.Evaluator
 }
 
+// Requirements returns the requirements, all of which must be approved.
+func (r *AndRequirement) Requirements() []common.Evaluator {
+	return r.requirements
+}
+
 func (r *AndRequirement) Trigger() common.Trigger {
 	var t common.Trigger
 	for _, child := range r.requirements {
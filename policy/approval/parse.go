@@ -24,10 +24,20 @@ import (
 type Policy []interface{}
 
 func (p Policy) Parse(rules map[string]*Rule) (common.Evaluator, error) {
-	eval := &evaluator{}
+	root, err := p.ParseRequirements(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &evaluator{root: root}, nil
+}
 
+// ParseRequirements returns the root of the requirement tree for the policy.
+// The root is an *AndRequirement whose descendants are *AndRequirement,
+// *OrRequirement, and *RuleRequirement values. If the policy is empty, the
+// root is nil.
+func (p Policy) ParseRequirements(rules map[string]*Rule) (common.Evaluator, error) {
 	if len(p) == 0 {
-		return eval, nil
+		return nil, nil
 	}
 
 	// assume "and" for the list of rules
@@ -35,13 +45,7 @@ func (p Policy) Parse(rules map[string]*Rule) (common.Evaluator, error) {
 		"and": []interface{}(p),
 	}
 
-	and, err := parsePolicyR(root, rules, 0)
-	if err != nil {
-		return nil, err
-	}
-
-	eval.root = and
-	return eval, nil
+	return parsePolicyR(root, rules, 0)
 }
 
 func parsePolicyR(policy interface{}, rules map[string]*Rule, depth int) (common.Evaluator, error) {
@@ -104,6 +104,10 @@ func (p *Policy) Trigger() common.Trigger {
 }
 
 func (p *Policy) Evaluate(ctx context.Context, prctx pull.Context) (res common.Result) {
+	ctx, span := common.StartSpan(ctx, "disapproval.Policy")
+	defer func() { common.EndResultSpan(span, &res) }()
+	defer pull.BindContext(prctx, ctx)()
+
 	log := zerolog.Ctx(ctx)
 
 	res.Name = "disapproval"
@@ -113,7 +117,7 @@ func (p *Policy) Evaluate(ctx context.Context, prctx pull.Context) (res common.R
 	var predicateResults []*common.PredicateResult
 
 	for _, p := range p.Predicates.Predicates() {
-		result, err := p.Evaluate(ctx, prctx)
+		result, err := predicate.Evaluate(ctx, p, prctx)
 		if err != nil {
 			res.Error = errors.Wrap(err, "failed to evaluate predicate")
 			return
@@ -0,0 +1,369 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graph draws the approval policy as a graph of rules and the "and"
+// and "or" requirements that combine them.
+//
+// A graph is built from a policy and, optionally, the result of evaluating
+// the policy, in which case each node has the status of its result. Graphs
+// can be written as Mermaid or Graphviz DOT diagrams.
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/pkg/errors"
+)
+
+// maxLineLength is the maximum length of a line in a node label. Longer lines
+// are truncated.
+const maxLineLength = 60
+
+type Kind string
+
+const (
+	KindAnd  Kind = "and"
+	KindOr   Kind = "or"
+	KindRule Kind = "rule"
+)
+
+// StatusError is the status of a node whose result has an error. Other
+// statuses are the string values of common.EvaluationStatus.
+const StatusError = "error"
+
+// Node is a requirement in the approval policy.
+type Node struct {
+	ID    string
+	Kind  Kind
+	Label string
+
+	// Details describes the predicates and requirements of a rule, one line
+	// per item.
+	Details []string
+
+	// Status is the status of the node's result or empty if the graph does
+	// not include results.
+	Status string
+
+	Children []*Node
+}
+
+// Lines returns the label and details of the node.
+func (n *Node) Lines() []string {
+	return append([]string{n.Label}, n.Details...)
+}
+
+// Build returns the graph for the approval policy in config. The root is the
+// implicit "and" of the items in the approval policy and is labeled
+// "approval". If result is not nil, it must be the result of evaluating the
+// policy or its "approval" child and is used to set the status of each node.
+func Build(config *policy.Config, result *common.Result) (*Node, error) {
+	b := &builder{}
+	n, err := b.approval(config, "approval")
+	if err != nil {
+		return nil, err
+	}
+
+	if result != nil {
+		setStatus(n, findApprovalResult(result))
+	}
+	return n, nil
+}
+
+// BuildEnforced returns the graph for a repository policy combined with an
+// enforced policy by policy.ParseEnforcedPolicy. The root is labeled "policy"
+// and its children are the approval policy of the repository, if config is
+// not nil, and the approval policy of the enforced policy, labeled
+// policy.EnforcedResultName. If result is not nil, it must be the result of
+// evaluating the combined policy and is used to set the status of each node.
+func BuildEnforced(config, enforced *policy.Config, result *common.Result) (*Node, error) {
+	b := &builder{}
+	root := b.node(KindAnd, "policy")
+
+	if config != nil {
+		n, err := b.approval(config, "approval")
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			setStatus(n, findApprovalResult(result))
+		}
+		root.Children = append(root.Children, n)
+	}
+
+	n, err := b.approval(enforced, policy.EnforcedResultName)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid enforced policy")
+	}
+	if result != nil {
+		root.Status = resultStatus(result)
+		for _, c := range result.Children {
+			if c.Name == policy.EnforcedResultName {
+				setStatus(n, findApprovalResult(c))
+			}
+		}
+	}
+	root.Children = append(root.Children, n)
+
+	return root, nil
+}
+
+type builder struct {
+	next int
+}
+
+// approval returns the graph for the approval policy in config. The root is
+// the implicit "and" of the items in the approval policy and has the label.
+func (b *builder) approval(config *policy.Config, label string) (*Node, error) {
+	rules := make(map[string]*approval.Rule)
+	for _, r := range config.ApprovalRules {
+		rules[r.Name] = r
+	}
+
+	root, err := config.Policy.Approval.ParseRequirements(rules)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to parse approval policy")
+	}
+
+	if root == nil {
+		return b.node(KindAnd, label), nil
+	}
+
+	n, err := b.build(root)
+	if err != nil {
+		return nil, err
+	}
+	n.Label = label
+	return n, nil
+}
+
+func (b *builder) node(kind Kind, label string) *Node {
+	n := &Node{
+		ID:    fmt.Sprintf("n%d", b.next),
+		Kind:  kind,
+		Label: label,
+	}
+	b.next++
+	return n
+}
+
+func (b *builder) build(req common.Evaluator) (*Node, error) {
+	var n *Node
+	var children []common.Evaluator
+
+	switch req := req.(type) {
+	case *approval.AndRequirement:
+		n = b.node(KindAnd, "and")
+		children = req.Requirements()
+	case *approval.OrRequirement:
+		n = b.node(KindOr, "or")
+		children = req.Requirements()
+	case *approval.RuleRequirement:
+		r := req.Rule()
+		n = b.node(KindRule, r.Name)
+		n.Details = describeRule(r)
+	default:
+		return nil, errors.Errorf("unknown requirement type %T", req)
+	}
+
+	for _, c := range children {
+		cn, err := b.build(c)
+		if err != nil {
+			return nil, err
+		}
+		n.Children = append(n.Children, cn)
+	}
+	return n, nil
+}
+
+func findApprovalResult(result *common.Result) *common.Result {
+	if result.Name == "approval" {
+		return result
+	}
+	for _, c := range result.Children {
+		if c.Name == "approval" {
+			return c
+		}
+	}
+	return nil
+}
+
+// setStatus sets the status of the nodes from a result with the same
+// structure as the graph. The results of requirements are in the same order
+// as the requirements in the policy.
+func setStatus(n *Node, result *common.Result) {
+	if result == nil {
+		return
+	}
+
+	n.Status = resultStatus(result)
+
+	if len(n.Children) == len(result.Children) {
+		for i, c := range n.Children {
+			setStatus(c, result.Children[i])
+		}
+	}
+}
+
+func resultStatus(result *common.Result) string {
+	if result.Error != nil {
+		return StatusError
+	}
+	return result.Status.String()
+}
+
+func describeRule(r *approval.Rule) []string {
+	var lines []string
+
+	v := reflect.ValueOf(r.Predicates)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.IsNil() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if desc := describePredicate(f.Interface()); desc != "" {
+			lines = append(lines, truncate(fmt.Sprintf("if %s: %s", name, desc)))
+		} else {
+			lines = append(lines, truncate("if "+name))
+		}
+	}
+
+	switch {
+	case r.Requires.Count <= 0:
+		lines = append(lines, "requires no approval")
+	case r.Requires.Actors.IsEmpty():
+		lines = append(lines, truncate(fmt.Sprintf("requires %d from nobody", r.Requires.Count)))
+	default:
+		lines = append(lines, truncate(fmt.Sprintf("requires %d from %s", r.Requires.Count, describeActors(&r.Requires.Actors))))
+	}
+
+	return lines
+}
+
+func describePredicate(p interface{}) string {
+	switch p := p.(type) {
+	case *predicate.ChangedFiles:
+		desc := describeRegexps(p.Paths)
+		if len(p.IgnorePaths) > 0 {
+			desc += " ignoring " + describeRegexps(p.IgnorePaths)
+		}
+		return desc
+	case *predicate.OnlyChangedFiles:
+		return describeRegexps(p.Paths)
+	case *predicate.HasAuthorIn:
+		return describeActors(&p.Actors)
+	case *predicate.HasContributorIn:
+		return describeActors(&p.Actors)
+	case *predicate.OnlyHasContributorsIn:
+		return describeActors(&p.Actors)
+	case *predicate.HasValidSignaturesBy:
+		return describeActors(&p.Actors)
+	case *predicate.AuthorIsOnlyContributor:
+		return fmt.Sprint(bool(*p))
+	case *predicate.HasValidSignatures:
+		return fmt.Sprint(bool(*p))
+	case *predicate.HasValidSignaturesByKeys:
+		return strings.Join(p.KeyIDs, ", ")
+	case *predicate.TargetsBranch:
+		return p.Pattern.String()
+	case *predicate.FromBranch:
+		return p.Pattern.String()
+	case *predicate.ModifiedLines:
+		var parts []string
+		for _, e := range []struct {
+			name string
+			expr predicate.ComparisonExpr
+		}{{"additions", p.Additions}, {"deletions", p.Deletions}, {"total", p.Total}} {
+			if !e.expr.IsEmpty() {
+				parts = append(parts, e.name+" "+e.expr.String())
+			}
+		}
+		return strings.Join(parts, ", ")
+	case *predicate.HasSuccessfulStatus:
+		return strings.Join(*p, ", ")
+	case *predicate.HasLabels:
+		return joinNonEmpty(strings.Join(p.Labels, ", "), describeRegexps(p.Patterns))
+	case *predicate.NotHasLabels:
+		return joinNonEmpty(strings.Join(p.Labels, ", "), describeRegexps(p.Patterns))
+	case *predicate.Repository:
+		return describeMatches(p.Matches, p.NotMatches)
+	case *predicate.Title:
+		return describeMatches(p.Matches, p.NotMatches)
+	}
+	return ""
+}
+
+func describeActors(a *common.Actors) string {
+	var parts []string
+	add := func(name string, values []string) {
+		if len(values) > 0 {
+			parts = append(parts, name+" "+strings.Join(values, ", "))
+		}
+	}
+
+	var perms []string
+	for _, p := range a.GetPermissions() {
+		perms = append(perms, p.String())
+	}
+
+	add("users", a.Users)
+	add("teams", a.Teams)
+	add("organizations", a.Organizations)
+	add("permissions", perms)
+	return strings.Join(parts, "; ")
+}
+
+func describeRegexps(rs []common.Regexp) string {
+	var s []string
+	for _, r := range rs {
+		s = append(s, r.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+func describeMatches(matches, notMatches []common.Regexp) string {
+	var parts []string
+	if len(matches) > 0 {
+		parts = append(parts, "matches "+describeRegexps(matches))
+	}
+	if len(notMatches) > 0 {
+		parts = append(parts, "not matches "+describeRegexps(notMatches))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func joinNonEmpty(values ...string) string {
+	var parts []string
+	for _, v := range values {
+		if v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func truncate(s string) string {
+	if r := []rune(s); len(r) > maxLineLength {
+		return string(r[:maxLineLength-3]) + "..."
+	}
+	return s
+}
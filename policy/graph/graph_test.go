@@ -0,0 +1,249 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/pull/pulltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const testPolicy = `
+policy:
+  approval:
+    - or:
+      - always
+      - labeled
+    - review
+approval_rules:
+  - name: always
+  - name: labeled
+    if:
+      has_labels: ["ready"]
+      changed_files:
+        paths: ["^docs/.*"]
+        ignore: ["\\.tmp$"]
+    requires:
+      count: 1
+      teams: ["org/docs"]
+  - name: review
+    requires:
+      count: 2
+      users: ["alice", "bob"]
+      permissions: ["write"]
+`
+
+func parseTestPolicy(t *testing.T) *policy.Config {
+	var config policy.Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(testPolicy), &config))
+	return &config
+}
+
+func TestBuild(t *testing.T) {
+	config := parseTestPolicy(t)
+
+	t.Run("withoutResult", func(t *testing.T) {
+		root, err := Build(config, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, "approval", root.Label)
+		assert.Equal(t, KindAnd, root.Kind)
+		require.Len(t, root.Children, 2)
+
+		or := root.Children[0]
+		assert.Equal(t, KindOr, or.Kind)
+		require.Len(t, or.Children, 2)
+
+		assert.Equal(t, "always", or.Children[0].Label)
+		assert.Equal(t, []string{"requires no approval"}, or.Children[0].Details)
+
+		assert.Equal(t, "labeled", or.Children[1].Label)
+		assert.Equal(t, []string{
+			`if changed_files: ^docs/.* ignoring \.tmp$`,
+			"if has_labels: ready",
+			"requires 1 from teams org/docs",
+		}, or.Children[1].Details)
+
+		review := root.Children[1]
+		assert.Equal(t, KindRule, review.Kind)
+		assert.Equal(t, []string{"requires 2 from users alice, bob; permissions write"}, review.Details)
+
+		walk(root, func(n *Node) {
+			assert.Empty(t, n.Status, "node %s has a status", n.Label)
+		})
+	})
+
+	t.Run("withResult", func(t *testing.T) {
+		evaluator, err := policy.ParsePolicy(config)
+		require.NoError(t, err)
+
+		result := evaluator.Evaluate(context.Background(), &pulltest.Context{
+			AuthorValue: "mhaypenny",
+		})
+		require.NoError(t, result.Error)
+
+		root, err := Build(config, &result)
+		require.NoError(t, err)
+
+		assert.Equal(t, "pending", root.Status)
+		assert.Equal(t, "approved", root.Children[0].Status)
+		assert.Equal(t, "approved", root.Children[0].Children[0].Status)
+		assert.Equal(t, "skipped", root.Children[0].Children[1].Status)
+		assert.Equal(t, "pending", root.Children[1].Status)
+	})
+
+	t.Run("emptyPolicy", func(t *testing.T) {
+		root, err := Build(&policy.Config{}, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, "approval", root.Label)
+		assert.Empty(t, root.Children)
+	})
+
+	t.Run("undefinedRule", func(t *testing.T) {
+		config := &policy.Config{}
+		config.Policy.Approval = []interface{}{"missing"}
+
+		_, err := Build(config, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestBuildEnforced(t *testing.T) {
+	config := parseTestPolicy(t)
+
+	var enforced policy.Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`
+policy:
+  approval:
+    - security
+approval_rules:
+  - name: security
+    requires:
+      count: 1
+      teams: ["org/security"]
+`), &enforced))
+
+	t.Run("withResult", func(t *testing.T) {
+		evaluator, err := policy.ParseEnforcedPolicy(config, &enforced)
+		require.NoError(t, err)
+
+		result := evaluator.Evaluate(context.Background(), &pulltest.Context{
+			AuthorValue: "mhaypenny",
+		})
+		require.NoError(t, result.Error)
+
+		root, err := BuildEnforced(config, &enforced, &result)
+		require.NoError(t, err)
+
+		assert.Equal(t, "policy", root.Label)
+		assert.Equal(t, "pending", root.Status)
+		require.Len(t, root.Children, 2)
+
+		assert.Equal(t, "approval", root.Children[0].Label)
+		assert.Equal(t, "pending", root.Children[0].Status)
+		assert.Equal(t, "approved", root.Children[0].Children[0].Status)
+
+		enforcedRoot := root.Children[1]
+		assert.Equal(t, policy.EnforcedResultName, enforcedRoot.Label)
+		assert.Equal(t, "pending", enforcedRoot.Status)
+		require.Len(t, enforcedRoot.Children, 1)
+		assert.Equal(t, "security", enforcedRoot.Children[0].Label)
+		assert.Equal(t, "pending", enforcedRoot.Children[0].Status)
+
+		ids := make(map[string]bool)
+		walk(root, func(n *Node) {
+			assert.False(t, ids[n.ID], "duplicate node ID %s", n.ID)
+			ids[n.ID] = true
+		})
+	})
+
+	t.Run("noRepositoryPolicy", func(t *testing.T) {
+		root, err := BuildEnforced(nil, &enforced, nil)
+		require.NoError(t, err)
+
+		require.Len(t, root.Children, 1)
+		assert.Equal(t, policy.EnforcedResultName, root.Children[0].Label)
+	})
+}
+
+func TestWriteMermaid(t *testing.T) {
+	root := testGraph(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteMermaid(&buf, root))
+
+	assert.Equal(t, `flowchart LR
+  n0(["approval"])
+  n1(["or"])
+  n2["always<br/>requires no approval"]
+  n3["labeled<br/>if has_labels: #quot;ready#quot;, #35;1<br/>requires 1 from teams org/docs"]
+  n4["review<br/>if modified_lines: total #gt; 10"]
+  n0 --> n1
+  n0 --> n4
+  n1 --> n2
+  n1 --> n3
+  classDef approved fill:#ffffff,stroke:#238551,stroke-width:2px
+  class n1,n2 approved
+  classDef pending fill:#ffffff,stroke:#c87619,stroke-width:2px
+  class n0,n4 pending
+  classDef skipped fill:#f6f7f9,stroke:#8f99a8,stroke-width:2px
+  class n3 skipped
+`, buf.String())
+}
+
+func TestWriteDOT(t *testing.T) {
+	root := testGraph(t)
+	root.Children[1].Status = ""
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDOT(&buf, root))
+
+	assert.Equal(t, `digraph policy {
+  rankdir=LR;
+  node [fontname="monospace", fontsize=10];
+  n0 [label="approval", shape=ellipse, style=filled, fillcolor="#ffffff", color="#c87619", penwidth=2];
+  n1 [label="or", shape=ellipse, style=filled, fillcolor="#ffffff", color="#238551", penwidth=2];
+  n2 [label="always\lrequires no approval\l", shape=box, style=filled, fillcolor="#ffffff", color="#238551", penwidth=2];
+  n3 [label="labeled\lif has_labels: \"ready\", #1\lrequires 1 from teams org/docs\l", shape=box, style=filled, fillcolor="#f6f7f9", color="#8f99a8", penwidth=2];
+  n4 [label="review\lif modified_lines: total > 10\l", shape=box];
+  n0 -> n1;
+  n0 -> n4;
+  n1 -> n2;
+  n1 -> n3;
+}
+`, buf.String())
+}
+
+// testGraph returns a graph with labels that require escaping.
+func testGraph(t *testing.T) *Node {
+	root := &Node{ID: "n0", Kind: KindAnd, Label: "approval", Status: "pending"}
+	or := &Node{ID: "n1", Kind: KindOr, Label: "or", Status: "approved"}
+	or.Children = []*Node{
+		{ID: "n2", Kind: KindRule, Label: "always", Details: []string{"requires no approval"}, Status: "approved"},
+		{ID: "n3", Kind: KindRule, Label: "labeled", Details: []string{`if has_labels: "ready", #1`, "requires 1 from teams org/docs"}, Status: "skipped"},
+	}
+	root.Children = []*Node{
+		or,
+		{ID: "n4", Kind: KindRule, Label: "review", Details: []string{"if modified_lines: total > 10"}, Status: "pending"},
+	}
+	return root
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Colors are the fill and stroke colors of nodes with a status.
+type Colors struct {
+	Fill   string
+	Stroke string
+}
+
+var (
+	defaultColors = Colors{Fill: "#ffffff", Stroke: "#404854"}
+
+	statusColors = map[string]Colors{
+		"approved":    {Fill: "#ffffff", Stroke: "#238551"},
+		"pending":     {Fill: "#ffffff", Stroke: "#c87619"},
+		"disapproved": {Fill: "#ffffff", Stroke: "#cd4246"},
+		"skipped":     {Fill: "#f6f7f9", Stroke: "#8f99a8"},
+		StatusError:   {Fill: "#ffffff", Stroke: "#cd4246"},
+	}
+
+	// statusOrder is the order of class definitions in Mermaid diagrams
+	statusOrder = []string{"approved", "pending", "disapproved", "skipped", StatusError}
+)
+
+// ColorsFor returns the colors for a node with the status.
+func ColorsFor(status string) Colors {
+	if c, ok := statusColors[status]; ok {
+		return c
+	}
+	return defaultColors
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart.
+func WriteMermaid(w io.Writer, root *Node) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "flowchart LR")
+
+	statuses := make(map[string][]string)
+	walk(root, func(n *Node) {
+		label := mermaidEscape(n.Lines())
+		if n.Kind == KindRule {
+			fmt.Fprintf(bw, "  %s[\"%s\"]\n", n.ID, label)
+		} else {
+			fmt.Fprintf(bw, "  %s([\"%s\"])\n", n.ID, label)
+		}
+		if n.Status != "" {
+			statuses[n.Status] = append(statuses[n.Status], n.ID)
+		}
+	})
+	walk(root, func(n *Node) {
+		for _, c := range n.Children {
+			fmt.Fprintf(bw, "  %s --> %s\n", n.ID, c.ID)
+		}
+	})
+	for _, s := range statusOrder {
+		if ids := statuses[s]; len(ids) > 0 {
+			c := ColorsFor(s)
+			fmt.Fprintf(bw, "  classDef %s fill:%s,stroke:%s,stroke-width:2px\n", s, c.Fill, c.Stroke)
+			fmt.Fprintf(bw, "  class %s %s\n", strings.Join(ids, ","), s)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteDOT writes the graph as a Graphviz DOT digraph.
+func WriteDOT(w io.Writer, root *Node) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph policy {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+	fmt.Fprintln(bw, `  node [fontname="monospace", fontsize=10];`)
+
+	walk(root, func(n *Node) {
+		attrs := []string{fmt.Sprintf(`label="%s"`, dotLabel(n))}
+		if n.Kind == KindRule {
+			attrs = append(attrs, "shape=box")
+		} else {
+			attrs = append(attrs, "shape=ellipse")
+		}
+		if n.Status != "" {
+			c := ColorsFor(n.Status)
+			attrs = append(attrs, "style=filled", fmt.Sprintf(`fillcolor="%s"`, c.Fill), fmt.Sprintf(`color="%s"`, c.Stroke), "penwidth=2")
+		}
+		fmt.Fprintf(bw, "  %s [%s];\n", n.ID, strings.Join(attrs, ", "))
+	})
+	walk(root, func(n *Node) {
+		for _, c := range n.Children {
+			fmt.Fprintf(bw, "  %s -> %s;\n", n.ID, c.ID)
+		}
+	})
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// walk calls fn for each node in the graph in depth-first order.
+func walk(n *Node, fn func(*Node)) {
+	fn(n)
+	for _, c := range n.Children {
+		walk(c, fn)
+	}
+}
+
+var mermaidReplacer = strings.NewReplacer(
+	"#", "#35;",
+	`"`, "#quot;",
+	"<", "#lt;",
+	">", "#gt;",
+)
+
+func mermaidEscape(lines []string) string {
+	escaped := make([]string, len(lines))
+	for i, l := range lines {
+		escaped[i] = mermaidReplacer.Replace(l)
+	}
+	return strings.Join(escaped, "<br/>")
+}
+
+var dotReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+)
+
+// dotLabel returns the label of a node. Lines of rules are left-justified.
+func dotLabel(n *Node) string {
+	lines := n.Lines()
+	if n.Kind != KindRule {
+		return dotReplacer.Replace(strings.Join(lines, " "))
+	}
+
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(dotReplacer.Replace(l))
+		b.WriteString(`\l`)
+	}
+	return b.String()
+}
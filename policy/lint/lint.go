@@ -0,0 +1,397 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint finds problems in policies that parse successfully but
+// probably do not do what the author intended, like rules that are never
+// used or that can never be approved.
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
+)
+
+// Code identifies the kind of a warning. Codes are stable and may be used to
+// filter or suppress warnings in tools that call the linter.
+type Code string
+
+const (
+	// CodeDuplicateRule is used when more than one rule has the same name.
+	// Only the last rule with a name is used by the policy.
+	CodeDuplicateRule Code = "duplicate-rule"
+
+	// CodeUnusedRule is used when a rule is not referenced by the approval
+	// policy or the retroactive approval policy of an override.
+	CodeUnusedRule Code = "unused-rule"
+
+	// CodeUnreachableRule is used when the conditions of a rule can never
+	// match, so the rule is always skipped.
+	CodeUnreachableRule Code = "unreachable-rule"
+
+	// CodeShadowedRule is used when a rule is in an "or" with a rule that
+	// is always approved, so the rule never changes the result.
+	CodeShadowedRule Code = "shadowed-rule"
+
+	// CodeNoActors is used when a rule requires approvals but does not
+	// allow any actors to approve.
+	CodeNoActors Code = "no-actors"
+
+	// CodeCountExceedsActors is used when a rule requires more approvals
+	// than the number of users who are allowed to approve.
+	CodeCountExceedsActors Code = "count-exceeds-actors"
+
+	// CodeRedundantPermissions is used when a list of actors includes a
+	// permission that is implied by a less permissive permission.
+	CodeRedundantPermissions Code = "redundant-permissions"
+
+	// CodeDeprecatedField is used when a policy uses a deprecated field.
+	CodeDeprecatedField Code = "deprecated-field"
+
+	// CodePatternMatchesNoFiles is used when a file pattern does not match
+	// any file in the repository. It is only reported if the linter has the
+	// list of files in the repository.
+	CodePatternMatchesNoFiles Code = "pattern-matches-no-files"
+)
+
+// Warning is a possible problem found in a policy.
+type Warning struct {
+	Code Code `json:"code"`
+
+	// Rule is the name of the rule with the problem or empty if the problem
+	// is not in an approval rule.
+	Rule string `json:"rule,omitempty"`
+
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	if w.Rule != "" {
+		return fmt.Sprintf("%s: rule %q: %s", w.Code, w.Rule, w.Message)
+	}
+	return fmt.Sprintf("%s: %s", w.Code, w.Message)
+}
+
+// Options configures optional checks.
+type Options struct {
+	// Files is the list of files in the repository. If nil, file patterns
+	// are not checked.
+	Files []string
+}
+
+// Lint returns the warnings for a policy. The policy should already be valid
+// according to policy.ParsePolicy; Lint does not report parsing errors.
+func Lint(config *policy.Config, opts Options) []Warning {
+	l := &linter{opts: opts}
+
+	l.checkRuleNames(config)
+	l.checkReferences(config)
+
+	for _, r := range config.ApprovalRules {
+		if r == nil {
+			continue
+		}
+		l.checkPredicates(r.Name, "", &r.Predicates)
+		l.checkRequires(r)
+		l.checkActors(r.Name, "", r)
+	}
+
+	if d := config.Policy.Disapproval; d != nil {
+		l.checkPredicates("", "disapproval policy", &d.Predicates)
+		l.checkActors("", "disapproval policy", d)
+	}
+	if o := config.Policy.Override; o != nil {
+		l.checkActors("", "override policy", o)
+	}
+
+	return l.warnings
+}
+
+type linter struct {
+	opts     Options
+	warnings []Warning
+}
+
+func (l *linter) warn(code Code, rule string, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, Warning{
+		Code:    code,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) checkRuleNames(config *policy.Config) {
+	counts := make(map[string]int)
+	for _, r := range config.ApprovalRules {
+		if r != nil {
+			counts[r.Name]++
+		}
+	}
+
+	var names []string
+	for name, n := range counts {
+		if n > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		l.warn(CodeDuplicateRule, name, "%d rules have this name; only the last one is used", counts[name])
+	}
+}
+
+func (l *linter) checkReferences(config *policy.Config) {
+	rules := make(map[string]*approval.Rule)
+	for _, r := range config.ApprovalRules {
+		if r != nil {
+			rules[r.Name] = r
+		}
+	}
+
+	used := make(map[string]bool)
+	l.walkPolicy(config.Policy.Approval, rules, used)
+	if o := config.Policy.Override; o != nil {
+		l.walkPolicy(o.Options.RetroactiveApproval, rules, used)
+	}
+
+	reported := make(map[string]bool)
+	for _, r := range config.ApprovalRules {
+		if r == nil || used[r.Name] || reported[r.Name] {
+			continue
+		}
+		reported[r.Name] = true
+		l.warn(CodeUnusedRule, r.Name, "rule is not used by the approval policy")
+	}
+}
+
+// walkPolicy records the rules used by an approval policy and checks the
+// rules in each "or" for rules that are always approved.
+func (l *linter) walkPolicy(p approval.Policy, rules map[string]*approval.Rule, used map[string]bool) {
+	for _, v := range p {
+		l.walkPolicyR(v, rules, used)
+	}
+}
+
+func (l *linter) walkPolicyR(p interface{}, rules map[string]*approval.Rule, used map[string]bool) {
+	switch v := p.(type) {
+	case string:
+		used[v] = true
+	case map[interface{}]interface{}:
+		for op, values := range v {
+			subpolicies, ok := values.([]interface{})
+			if !ok {
+				continue
+			}
+			for _, sub := range subpolicies {
+				l.walkPolicyR(sub, rules, used)
+			}
+			if op == "or" {
+				l.checkOr(subpolicies, rules)
+			}
+		}
+	}
+}
+
+func (l *linter) checkOr(subpolicies []interface{}, rules map[string]*approval.Rule) {
+	var always string
+	for _, sub := range subpolicies {
+		if name, ok := sub.(string); ok && isAlwaysApproved(rules[name]) {
+			always = name
+			break
+		}
+	}
+	if always == "" {
+		return
+	}
+
+	for _, sub := range subpolicies {
+		if name, ok := sub.(string); ok && name != always {
+			l.warn(CodeShadowedRule, name, "rule is in an \"or\" with rule %q, which is always approved", always)
+		}
+	}
+}
+
+// isAlwaysApproved returns true if the rule applies to all pull requests and
+// does not require any approvals.
+func isAlwaysApproved(r *approval.Rule) bool {
+	return r != nil && r.Requires.Count <= 0 && len(r.Predicates.Predicates()) == 0
+}
+
+func (l *linter) checkPredicates(rule, location string, p *predicate.Predicates) {
+	if p.HasLabels != nil && p.NotHasLabels != nil {
+		for _, label := range p.HasLabels.Labels {
+			if forbidsLabel(p.NotHasLabels, label) {
+				l.warn(CodeUnreachableRule, rule, "%sconditions require and forbid the label %q", prefix(location), label)
+			}
+		}
+	}
+
+	if l.opts.Files == nil {
+		return
+	}
+	if p.ChangedFiles != nil {
+		l.checkPatterns(rule, location, "changed_files.paths", p.ChangedFiles.Paths)
+		l.checkPatterns(rule, location, "changed_files.ignore", p.ChangedFiles.IgnorePaths)
+	}
+	if p.OnlyChangedFiles != nil {
+		l.checkPatterns(rule, location, "only_changed_files.paths", p.OnlyChangedFiles.Paths)
+	}
+}
+
+func forbidsLabel(pred *predicate.NotHasLabels, label string) bool {
+	for _, l := range pred.Labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	for _, p := range pred.Patterns {
+		if p.Matches(strings.ToLower(label)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) checkPatterns(rule, location, field string, patterns []common.Regexp) {
+	for _, pattern := range patterns {
+		if !matchesAny(pattern, l.opts.Files) {
+			l.warn(CodePatternMatchesNoFiles, rule, "%spattern %q in %s does not match any files in the repository", prefix(location), pattern.String(), field)
+		}
+	}
+}
+
+func matchesAny(pattern common.Regexp, files []string) bool {
+	for _, f := range files {
+		if pattern.Matches(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) checkRequires(r *approval.Rule) {
+	count := r.Requires.Count
+	actors := &r.Requires.Actors
+	if count <= 0 {
+		return
+	}
+
+	if actors.IsEmpty() {
+		l.warn(CodeNoActors, r.Name, "rule requires %d approval(s) but does not allow any actors to approve", count)
+		return
+	}
+
+	if len(actors.Teams) == 0 && len(actors.Organizations) == 0 && len(actors.GetPermissions()) == 0 {
+		users := make(map[string]bool)
+		for _, u := range actors.Users {
+			users[u] = true
+		}
+		if count > len(users) {
+			l.warn(CodeCountExceedsActors, r.Name, "rule requires %d approval(s) but only allows %d user(s) to approve", count, len(users))
+		}
+	}
+}
+
+// checkActors checks all of the actors in a value, including the actors in
+// requirements, options, and predicates.
+func (l *linter) checkActors(rule, location string, v interface{}) {
+	walkActors(reflect.ValueOf(v), func(field string, a *common.Actors) {
+		if a.Admins {
+			l.warn(CodeDeprecatedField, rule, "%s%s.admins is deprecated, use permissions: [\"admin\"]", prefix(location), field)
+		}
+		if a.WriteCollaborators {
+			l.warn(CodeDeprecatedField, rule, "%s%s.write_collaborators is deprecated, use permissions: [\"write\"]", prefix(location), field)
+		}
+
+		// Permissions are ordered from most to least permissive and users
+		// with a permission also have all less permissive permissions
+		perms := a.GetPermissions()
+		if len(perms) > 1 {
+			lowest := perms[len(perms)-1]
+			for _, p := range perms[:len(perms)-1] {
+				l.warn(CodeRedundantPermissions, rule, "%s%s permission %q is redundant because %q includes it", prefix(location), field, p, lowest)
+			}
+		}
+	})
+}
+
+var actorsType = reflect.TypeOf(common.Actors{})
+
+func walkActors(v reflect.Value, fn func(field string, a *common.Actors)) {
+	walkActorsR(v, "", fn)
+}
+
+func walkActorsR(v reflect.Value, field string, fn func(string, *common.Actors)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walkActorsR(v.Elem(), field, fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkActorsR(v.Index(i), field, fn)
+		}
+	case reflect.Struct:
+		if v.Type() == actorsType {
+			a := v.Interface().(common.Actors)
+			fn(field, &a)
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			walkActorsR(v.Field(i), joinField(field, f), fn)
+		}
+	}
+}
+
+// joinField returns the YAML path to a field, skipping inline fields.
+func joinField(parent string, f reflect.StructField) string {
+	name, inline := yamlName(f)
+	switch {
+	case inline:
+		return parent
+	case parent == "":
+		return name
+	default:
+		return parent + "." + name
+	}
+}
+
+func yamlName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("yaml")
+	if tag == "" {
+		return f.Name, f.Anonymous
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+	return name, slices.Contains(strings.Split(opts, ","), "inline")
+}
+
+func prefix(location string) string {
+	if location == "" {
+		return ""
+	}
+	return location + ": "
+}
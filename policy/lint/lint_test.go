@@ -0,0 +1,250 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"testing"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestLint(t *testing.T) {
+	tests := map[string]struct {
+		Policy   string
+		Files    []string
+		Expected []Warning
+	}{
+		"noWarnings": {
+			Policy: `
+policy:
+  approval:
+    - review
+approval_rules:
+  - name: review
+    requires:
+      count: 1
+      permissions: ["write"]
+`,
+		},
+		"unusedRule": {
+			Policy: `
+policy:
+  approval:
+    - review
+approval_rules:
+  - name: review
+    requires:
+      count: 1
+      teams: ["org/team"]
+  - name: unused
+    requires:
+      count: 1
+      teams: ["org/team"]
+`,
+			Expected: []Warning{
+				{Code: CodeUnusedRule, Rule: "unused", Message: "rule is not used by the approval policy"},
+			},
+		},
+		"retroactiveApprovalUsesRule": {
+			Policy: `
+policy:
+  approval:
+    - review
+  override:
+    requires:
+      teams: ["org/admins"]
+    options:
+      retroactive_approval:
+        - retroactive
+approval_rules:
+  - name: review
+    requires:
+      count: 1
+      teams: ["org/team"]
+  - name: retroactive
+    requires:
+      count: 1
+      teams: ["org/team"]
+`,
+		},
+		"duplicateRule": {
+			Policy: `
+policy:
+  approval:
+    - review
+approval_rules:
+  - name: review
+    requires:
+      count: 1
+      teams: ["org/team"]
+  - name: review
+    requires:
+      count: 1
+      teams: ["org/other"]
+`,
+			Expected: []Warning{
+				{Code: CodeDuplicateRule, Rule: "review", Message: "2 rules have this name; only the last one is used"},
+			},
+		},
+		"shadowedRule": {
+			Policy: `
+policy:
+  approval:
+    - or:
+      - always
+      - review
+approval_rules:
+  - name: always
+  - name: review
+    requires:
+      count: 1
+      teams: ["org/team"]
+`,
+			Expected: []Warning{
+				{Code: CodeShadowedRule, Rule: "review", Message: `rule is in an "or" with rule "always", which is always approved`},
+			},
+		},
+		"unreachableRule": {
+			Policy: `
+policy:
+  approval:
+    - labeled
+approval_rules:
+  - name: labeled
+    if:
+      has_labels: ["Ready"]
+      not_has_labels:
+        patterns: ["^read"]
+    requires:
+      count: 1
+      teams: ["org/team"]
+`,
+			Expected: []Warning{
+				{Code: CodeUnreachableRule, Rule: "labeled", Message: `conditions require and forbid the label "Ready"`},
+			},
+		},
+		"noActors": {
+			Policy: `
+policy:
+  approval:
+    - review
+approval_rules:
+  - name: review
+    requires:
+      count: 1
+`,
+			Expected: []Warning{
+				{Code: CodeNoActors, Rule: "review", Message: "rule requires 1 approval(s) but does not allow any actors to approve"},
+			},
+		},
+		"countExceedsActors": {
+			Policy: `
+policy:
+  approval:
+    - review
+approval_rules:
+  - name: review
+    requires:
+      count: 3
+      users: ["alice", "bob", "alice"]
+`,
+			Expected: []Warning{
+				{Code: CodeCountExceedsActors, Rule: "review", Message: "rule requires 3 approval(s) but only allows 2 user(s) to approve"},
+			},
+		},
+		"deprecatedAndRedundant": {
+			Policy: `
+policy:
+  approval:
+    - review
+  disapproval:
+    requires:
+      write_collaborators: true
+approval_rules:
+  - name: review
+    if:
+      has_author_in:
+        permissions: ["admin", "write"]
+    requires:
+      count: 1
+      admins: true
+`,
+			Expected: []Warning{
+				{Code: CodeRedundantPermissions, Rule: "review", Message: `if.has_author_in permission "admin" is redundant because "write" includes it`},
+				{Code: CodeDeprecatedField, Rule: "review", Message: `requires.admins is deprecated, use permissions: ["admin"]`},
+				{Code: CodeDeprecatedField, Message: `disapproval policy: requires.write_collaborators is deprecated, use permissions: ["write"]`},
+			},
+		},
+		"patternsWithoutFiles": {
+			Policy: `
+policy:
+  approval:
+    - docs
+approval_rules:
+  - name: docs
+    if:
+      changed_files:
+        paths: ["^missing/.*"]
+    requires:
+      count: 1
+      teams: ["org/team"]
+`,
+		},
+		"patternsWithFiles": {
+			Policy: `
+policy:
+  approval:
+    - docs
+  disapproval:
+    if:
+      only_changed_files:
+        paths: ["^vendor/.*"]
+    requires:
+      teams: ["org/team"]
+approval_rules:
+  - name: docs
+    if:
+      changed_files:
+        paths: ["^docs/.*", "^missing/.*"]
+        ignore: ["\\.tmp$"]
+    requires:
+      count: 1
+      teams: ["org/team"]
+`,
+			Files: []string{"README.md", "docs/index.md"},
+			Expected: []Warning{
+				{Code: CodePatternMatchesNoFiles, Rule: "docs", Message: `pattern "^missing/.*" in changed_files.paths does not match any files in the repository`},
+				{Code: CodePatternMatchesNoFiles, Rule: "docs", Message: `pattern "\\.tmp$" in changed_files.ignore does not match any files in the repository`},
+				{Code: CodePatternMatchesNoFiles, Message: `disapproval policy: pattern "^vendor/.*" in only_changed_files.paths does not match any files in the repository`},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var config policy.Config
+			require.NoError(t, yaml.UnmarshalStrict([]byte(test.Policy), &config))
+
+			_, err := policy.ParsePolicy(&config)
+			require.NoError(t, err, "test policy is not valid")
+
+			warnings := Lint(&config, Options{Files: test.Files})
+			assert.Equal(t, test.Expected, warnings)
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package override
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Command is the comment prefix that requests an override. The rest of
+	// the first line of the comment is the justification for the override.
+	Command = "/policy-bot override"
+
+	// ResultName is the name of the result produced by the override policy.
+	ResultName = "override"
+)
+
+type Policy struct {
+	Options  Options  `yaml:"options"`
+	Requires Requires `yaml:"requires"`
+}
+
+type Options struct {
+	// RetroactiveApproval is an approval policy, using the same syntax as the
+	// top-level approval policy, that should be satisfied after an override.
+	// It does not block the override, but its status is reported alongside it.
+	RetroactiveApproval approval.Policy `yaml:"retroactive_approval"`
+}
+
+// Requires is redefined instead of using common.Requires because overrides
+// do not support required counts; a single allowed actor is sufficient.
+type Requires struct {
+	common.Actors `yaml:",inline"`
+}
+
+// ParseComment returns the justification for the override if the comment body
+// is an override command. Commands without a justification are not valid.
+func ParseComment(body string) (string, bool) {
+	line, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	line = strings.TrimSpace(line)
+
+	if line != Command && !strings.HasPrefix(line, Command+" ") {
+		return "", false
+	}
+
+	reason := strings.TrimSpace(strings.TrimPrefix(line, Command))
+	return reason, reason != ""
+}
+
+// Parse creates an evaluator for the override policy, resolving any rules
+// referenced by the retroactive approval policy.
+func (p *Policy) Parse(rules map[string]*approval.Rule) (common.Evaluator, error) {
+	eval := &evaluator{policy: p}
+
+	if len(p.Options.RetroactiveApproval) > 0 {
+		retroactive, err := p.Options.RetroactiveApproval.Parse(rules)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to parse retroactive approval policy")
+		}
+		eval.retroactive = retroactive
+	}
+
+	return eval, nil
+}
+
+type evaluator struct {
+	policy      *Policy
+	retroactive common.Evaluator
+}
+
+func (eval *evaluator) Trigger() common.Trigger {
+	if eval.policy.Requires.IsEmpty() {
+		return common.TriggerStatic
+	}
+
+	t := common.TriggerCommit | common.TriggerComment
+	if eval.retroactive != nil {
+		t |= eval.retroactive.Trigger()
+	}
+	return t
+}
+
+func (eval *evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common.Result) {
+	log := zerolog.Ctx(ctx)
+
+	res.Name = ResultName
+	res.Description = fmt.Sprintf("Comment \"%s <reason>\" to approve this pull request in an emergency", Command)
+	res.Status = common.StatusSkipped
+	res.Requires = common.Requires{Count: 1, Actors: eval.policy.Requires.Actors}
+
+	if eval.policy.Requires.IsEmpty() {
+		log.Debug().Msg("no users are allowed to override; skipping")
+
+		res.StatusDescription = "No override policy is specified or the policy is empty"
+		return
+	}
+
+	override, dismissals, err := eval.findOverride(ctx, prctx)
+	if err != nil {
+		res.Error = errors.WithMessage(err, "failed to find override")
+		return
+	}
+	res.Dismissals = dismissals
+
+	if override == nil {
+		res.StatusDescription = "No overrides"
+		return
+	}
+
+	res.Status = common.StatusApproved
+	res.StatusDescription = fmt.Sprintf("Overridden by %s: %s", override.Candidate.User, override.Reason)
+	res.Approvers = []*common.Candidate{override.Candidate}
+
+	// Errors in the retroactive approval are only reported on its result so
+	// that a broken rule cannot block an emergency override
+	if eval.retroactive != nil {
+		retroactive := eval.retroactive.Evaluate(ctx, prctx)
+		retroactive.Name = "retroactive approval"
+		res.Children = []*common.Result{&retroactive}
+	}
+	return
+}
+
+// Override is a valid override request.
+type Override struct {
+	Candidate *common.Candidate
+	Reason    string
+}
+
+// findOverride returns the most recent valid override and any overrides that
+// were discarded because they were edited or invalidated by a push.
+func (eval *evaluator) findOverride(ctx context.Context, prctx pull.Context) (*Override, []*common.Dismissal, error) {
+	log := zerolog.Ctx(ctx)
+
+	comments, err := prctx.Comments()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list comments")
+	}
+
+	var overrides []*Override
+	for _, c := range comments {
+		reason, ok := ParseComment(c.Body)
+		if !ok {
+			continue
+		}
+
+		isActor, err := eval.policy.Requires.IsActor(ctx, prctx, c.Author)
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "failed to check override actor")
+		}
+		if !isActor {
+			log.Debug().Str("user", c.Author).Msg("ignoring override by non-allowed user")
+			continue
+		}
+
+		overrides = append(overrides, &Override{
+			Candidate: &common.Candidate{
+				Type:         common.CommentCandidate,
+				User:         c.Author,
+				CreatedAt:    c.CreatedAt,
+				LastEditedAt: c.LastEditedAt,
+			},
+			Reason: reason,
+		})
+	}
+	if len(overrides) == 0 {
+		return nil, nil, nil
+	}
+
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return overrides[i].Candidate.CreatedAt.Before(overrides[j].Candidate.CreatedAt)
+	})
+
+	head := prctx.HeadSHA()
+	pushedAt, err := prctx.PushedAt(head)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get last push timestamp")
+	}
+
+	var valid *Override
+	var dismissals []*common.Dismissal
+	for _, o := range overrides {
+		switch {
+		case !o.Candidate.LastEditedAt.IsZero():
+			dismissals = append(dismissals, &common.Dismissal{
+				Candidate: o.Candidate,
+				Reason:    "Override comment was edited",
+			})
+		case !o.Candidate.CreatedAt.After(pushedAt):
+			dismissals = append(dismissals, &common.Dismissal{
+				Candidate: o.Candidate,
+				Reason:    fmt.Sprintf("Invalidated by push of %.7s", head),
+			})
+		default:
+			valid = o
+		}
+	}
+
+	log.Debug().Msgf("found %d override candidates, discarded %d", len(overrides), len(dismissals))
+	return valid, dismissals, nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package override
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseComment(t *testing.T) {
+	tests := map[string]struct {
+		Body   string
+		Reason string
+		OK     bool
+	}{
+		"valid": {
+			Body:   "/policy-bot override INC-1234 outage in prod",
+			Reason: "INC-1234 outage in prod",
+			OK:     true,
+		},
+		"surroundingWhitespace": {
+			Body:   "  /policy-bot override   hotfix  \n\nmore details",
+			Reason: "hotfix",
+			OK:     true,
+		},
+		"missingReason": {
+			Body: "/policy-bot override",
+		},
+		"missingReasonWithSpaces": {
+			Body: "/policy-bot override   \nreason on next line",
+		},
+		"notCommand": {
+			Body: "please /policy-bot override this",
+		},
+		"otherCommand": {
+			Body: "/policy-bot overrides everything",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reason, ok := ParseComment(test.Body)
+			assert.Equal(t, test.OK, ok)
+			assert.Equal(t, test.Reason, reason)
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	logger := zerolog.New(os.Stdout)
+	ctx := logger.WithContext(context.Background())
+
+	basePullContext := func() *pulltest.Context {
+		return &pulltest.Context{
+			AuthorValue:  "mhaypenny",
+			HeadSHAValue: "97d5ea26da319a987d80f6db0b7ef759f2f2e441",
+			PushedAtValue: map[string]time.Time{
+				"97d5ea26da319a987d80f6db0b7ef759f2f2e441": date(10),
+			},
+			CommentsValue: []*pull.Comment{
+				{
+					Author:    "ttest",
+					Body:      "/policy-bot override prod is down",
+					CreatedAt: date(5),
+				},
+				{
+					Author:    "mhaypenny",
+					Body:      "/policy-bot override I really want this merged",
+					CreatedAt: date(20),
+				},
+				{
+					Author:    "bkeyes",
+					Body:      "/policy-bot override INC-1234",
+					CreatedAt: date(30),
+				},
+			},
+			OrgMemberships: map[string][]string{
+				"mhaypenny": {"everyone"},
+				"ttest":     {"everyone", "incident-commanders"},
+				"bkeyes":    {"everyone", "incident-commanders"},
+			},
+			CollaboratorsValue: []*pull.Collaborator{
+				{Name: "review-approver", Permissions: []pull.CollaboratorPermission{{Permission: pull.PermissionWrite}}},
+			},
+			ReviewsValue: []*pull.Review{
+				{
+					Author:    "review-approver",
+					State:     pull.ReviewApproved,
+					CreatedAt: date(40),
+				},
+			},
+		}
+	}
+
+	policy := &Policy{
+		Requires: Requires{
+			Actors: common.Actors{
+				Organizations: []string{"incident-commanders"},
+			},
+		},
+	}
+
+	assertEvaluate := func(t *testing.T, p *Policy, prctx pull.Context) common.Result {
+		eval, err := p.Parse(map[string]*approval.Rule{
+			"retroactive review": {
+				Name: "retroactive review",
+				Requires: common.Requires{
+					Count: 1,
+					Actors: common.Actors{
+						Permissions: []pull.Permission{pull.PermissionWrite},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		res := eval.Evaluate(ctx, prctx)
+		require.NoError(t, res.Error)
+		assert.Equal(t, ResultName, res.Name)
+		return res
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		res := assertEvaluate(t, &Policy{}, basePullContext())
+
+		assert.Equal(t, common.StatusSkipped, res.Status)
+		assert.Equal(t, "No override policy is specified or the policy is empty", res.StatusDescription)
+	})
+
+	t.Run("noOverrides", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommentsValue = prctx.CommentsValue[:2]
+
+		res := assertEvaluate(t, policy, prctx)
+
+		assert.Equal(t, common.StatusSkipped, res.Status)
+		assert.Equal(t, "No overrides", res.StatusDescription)
+		if assert.Len(t, res.Dismissals, 1) {
+			assert.Equal(t, "ttest", res.Dismissals[0].Candidate.User)
+			assert.Equal(t, "Invalidated by push of 97d5ea2", res.Dismissals[0].Reason)
+		}
+	})
+
+	t.Run("overridden", func(t *testing.T) {
+		res := assertEvaluate(t, policy, basePullContext())
+
+		assert.Equal(t, common.StatusApproved, res.Status)
+		assert.Equal(t, "Overridden by bkeyes: INC-1234", res.StatusDescription)
+		if assert.Len(t, res.Approvers, 1) {
+			assert.Equal(t, "bkeyes", res.Approvers[0].User)
+		}
+		assert.Empty(t, res.Children)
+	})
+
+	t.Run("ignoresEditedComments", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommentsValue[2].LastEditedAt = date(31)
+
+		res := assertEvaluate(t, policy, prctx)
+
+		assert.Equal(t, common.StatusSkipped, res.Status)
+		if assert.Len(t, res.Dismissals, 2) {
+			assert.Equal(t, "Override comment was edited", res.Dismissals[1].Reason)
+		}
+	})
+
+	t.Run("retroactiveApproval", func(t *testing.T) {
+		p := *policy
+		p.Options.RetroactiveApproval = approval.Policy{"retroactive review"}
+
+		prctx := basePullContext()
+		res := assertEvaluate(t, &p, prctx)
+
+		assert.Equal(t, common.StatusApproved, res.Status)
+		if assert.Len(t, res.Children, 1) {
+			assert.Equal(t, "retroactive approval", res.Children[0].Name)
+			assert.Equal(t, common.StatusApproved, res.Children[0].Status)
+		}
+
+		prctx.ReviewsValue = nil
+		res = assertEvaluate(t, &p, prctx)
+
+		assert.Equal(t, common.StatusApproved, res.Status)
+		if assert.Len(t, res.Children, 1) {
+			assert.Equal(t, common.StatusPending, res.Children[0].Status)
+		}
+	})
+
+	t.Run("retroactiveApprovalError", func(t *testing.T) {
+		p := *policy
+		p.Options.RetroactiveApproval = approval.Policy{"retroactive review"}
+
+		prctx := basePullContext()
+		prctx.ReviewsError = errors.New("reviews unavailable")
+
+		res := assertEvaluate(t, &p, prctx)
+
+		assert.Equal(t, common.StatusApproved, res.Status)
+		if assert.Len(t, res.Children, 1) {
+			assert.Error(t, res.Children[0].Error)
+		}
+	})
+
+	t.Run("invalidRetroactiveApproval", func(t *testing.T) {
+		p := *policy
+		p.Options.RetroactiveApproval = approval.Policy{"missing rule"}
+
+		_, err := p.Parse(map[string]*approval.Rule{})
+		assert.Error(t, err)
+	})
+}
+
+func TestTrigger(t *testing.T) {
+	p := &Policy{}
+	eval, err := p.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, common.TriggerStatic, eval.Trigger())
+
+	p.Requires.Users = []string{"bkeyes"}
+	eval, err = p.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, common.TriggerCommit|common.TriggerComment, eval.Trigger())
+}
+
+func date(hour int) time.Time {
+	return time.Date(2024, 4, 1, hour, 0, 0, 0, time.UTC)
+}
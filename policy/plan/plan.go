@@ -0,0 +1,572 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plan finds the approvals that would satisfy a pending policy.
+//
+// An analysis starts from the result of evaluating a policy. Each pending rule
+// becomes a requirement for a number of approvals from a set of actors, and
+// the requirements are combined following the "and" and "or" structure of
+// the policy into plans, where each plan is a set of requirements that
+// together approve the pull request. Requirements with the same actors are
+// merged and requirements whose actors are a subset of another requirement's
+// actors satisfy that requirement too, so plans report the fewest approvals
+// that the analysis can prove are sufficient.
+//
+// The analysis does not know about rule options that reject some approvers,
+// like the rules that ban the author and contributors of the pull request.
+package plan
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/override"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxPlans is the maximum number of plans in an analysis.
+	MaxPlans = 10
+
+	// maxIntermediatePlans limits the number of plans kept while combining
+	// the plans of the children of an "and" requirement.
+	maxIntermediatePlans = 100
+
+	disapprovalResultName = "disapproval"
+)
+
+// ErrOrganizationActors is returned by ContextUserLister for actors that
+// include organizations. Organizations may have too many members to list for
+// each analysis, so callers should analyze the result without users instead.
+var ErrOrganizationActors = errors.New("organization members are not listed")
+
+// Requirement is a number of approvals needed from a set of actors.
+type Requirement struct {
+	// Rules are the names of the pending rules that the approvals satisfy.
+	Rules []string `json:"rules"`
+
+	Count  int           `json:"count"`
+	Actors common.Actors `json:"actors"`
+
+	// Users are the users who may approve, if the analysis expanded actors
+	// to users. Users who already approved the rules are not included.
+	Users []string `json:"users,omitempty"`
+}
+
+func (r *Requirement) key() string {
+	var perms []string
+	for _, p := range r.Actors.Permissions {
+		perms = append(perms, p.String())
+	}
+	return strings.Join([]string{
+		strings.Join(r.Actors.Users, ","),
+		strings.Join(r.Actors.Teams, ","),
+		strings.Join(r.Actors.Organizations, ","),
+		strings.Join(perms, ","),
+	}, "|")
+}
+
+func (r *Requirement) clone() *Requirement {
+	c := *r
+	c.Rules = slices.Clone(r.Rules)
+	c.Users = slices.Clone(r.Users)
+	return &c
+}
+
+// Plan is a set of requirements that together approve the pull request.
+type Plan struct {
+	Requirements []*Requirement `json:"requirements"`
+
+	// Approvals is the number of additional approvals the plan needs. If
+	// Approvers is empty, this may be more than necessary when requirements
+	// have overlapping actors that are not subsets of each other.
+	Approvals int `json:"approvals"`
+
+	// Approvers is a set of users who satisfy every requirement in the plan
+	// if they all approve. It is only set if the analysis expanded actors to
+	// users.
+	Approvers []string `json:"approvers,omitempty"`
+
+	// reqs are the requirements before removing those that are satisfied by
+	// the approvals for other requirements.
+	reqs []*Requirement
+}
+
+func (p *Plan) key() string {
+	keys := make([]string, len(p.reqs))
+	for i, r := range p.reqs {
+		keys[i] = fmt.Sprintf("%d:%s", r.Count, r.key())
+	}
+	return strings.Join(keys, ";")
+}
+
+// covers returns true if every requirement in p is also a requirement of
+// other with at least the same count, meaning that any approvals that
+// satisfy other also satisfy p.
+func (p *Plan) covers(other *Plan) bool {
+	for _, r := range p.reqs {
+		i := slices.IndexFunc(other.reqs, func(o *Requirement) bool {
+			return o.key() == r.key() && o.Count >= r.Count
+		})
+		if i < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Analysis describes the approvals that would satisfy a policy.
+type Analysis struct {
+	Status      string `json:"status"`
+	Description string `json:"description"`
+
+	// Plans are the alternative ways to approve the pull request, ordered
+	// from fewest to most approvals. Any one plan is sufficient.
+	Plans []*Plan `json:"plans"`
+}
+
+// UserLister returns the users who are one of the actors.
+type UserLister func(actors *common.Actors) ([]string, error)
+
+// Analyze finds the plans that would approve the pull request with the
+// result. If users is non-nil, it is used to expand actors to users, which
+// finds more overlap between requirements and suggests specific approvers.
+func Analyze(result *common.Result, users UserLister) (*Analysis, error) {
+	a := &Analysis{Status: result.Status.String(), Plans: []*Plan{}}
+
+	switch {
+	case result.Error != nil:
+		a.Status = "error"
+		a.Description = "The policy could not be evaluated, so the required approvals are unknown"
+		return a, nil
+	case result.Status == common.StatusApproved:
+		a.Description = "The pull request is approved and needs no more approvals"
+		return a, nil
+	case result.Status == common.StatusDisapproved:
+		a.Description = "The pull request is disapproved and approvals cannot satisfy the policy until the disapproval is resolved"
+		return a, nil
+	case result.Status == common.StatusSkipped:
+		a.Description = "All rules were skipped, so approvals cannot satisfy the policy"
+		return a, nil
+	}
+
+	an := &analyzer{users: users, cache: make(map[string][]string)}
+
+	plans, _, err := an.collect(result)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Plans = append(a.Plans, an.minimize(plans, MaxPlans)...)
+	switch len(a.Plans) {
+	case 0:
+		a.Description = "No combination of approvals can satisfy the policy"
+	case 1:
+		a.Description = "The pull request is approved by the following plan"
+	default:
+		a.Description = "The pull request is approved by any one of the following plans"
+	}
+	return a, nil
+}
+
+type analyzer struct {
+	users UserLister
+	cache map[string][]string
+}
+
+// collect returns the plans that approve the result. If the result is
+// neutral, meaning it does not affect the approval of its parent, skipped is
+// true. If skipped is false and there are no plans, approvals cannot satisfy
+// the result.
+func (an *analyzer) collect(r *common.Result) (plans []*Plan, skipped bool, err error) {
+	switch {
+	case r.Name == disapprovalResultName:
+		return nil, r.Status != common.StatusDisapproved, nil
+	case r.Name == override.ResultName:
+		// emergency overrides are not a normal way to approve pull requests
+		return nil, true, nil
+	case r.Error != nil:
+		return nil, false, nil
+	case r.Methods != nil:
+		return an.collectRule(r)
+	case r.Name == "or":
+		return an.collectOr(r)
+	default:
+		return an.collectAnd(r)
+	}
+}
+
+func (an *analyzer) collectRule(r *common.Result) ([]*Plan, bool, error) {
+	switch r.Status {
+	case common.StatusApproved:
+		return []*Plan{an.finish(nil)}, false, nil
+	case common.StatusSkipped:
+		return nil, true, nil
+	case common.StatusPending:
+	default:
+		return nil, false, nil
+	}
+
+	actors := r.Requires.Actors
+	if actors.IsEmpty() {
+		// no user can approve the rule
+		return nil, false, nil
+	}
+
+	req := &Requirement{
+		Rules: []string{r.Name},
+		Count: max(r.Requires.Count-len(r.Approvers), 1),
+		Actors: common.Actors{
+			Users:         sortedCopy(actors.Users),
+			Teams:         sortedCopy(actors.Teams),
+			Organizations: sortedCopy(actors.Organizations),
+			Permissions:   actors.GetPermissions(),
+		},
+	}
+
+	if an.users != nil {
+		users, err := an.listUsers(&req.Actors)
+		if err != nil {
+			return nil, false, err
+		}
+
+		req.Users = []string{}
+		for _, u := range users {
+			if !slices.ContainsFunc(r.Approvers, func(c *common.Candidate) bool { return c.User == u }) {
+				req.Users = append(req.Users, u)
+			}
+		}
+	}
+
+	return []*Plan{an.finish([]*Requirement{req})}, false, nil
+}
+
+func (an *analyzer) collectOr(r *common.Result) ([]*Plan, bool, error) {
+	var plans []*Plan
+	skipped := true
+	for _, c := range r.Children {
+		childPlans, childSkipped, err := an.collect(c)
+		if err != nil {
+			return nil, false, err
+		}
+		if childSkipped {
+			continue
+		}
+		skipped = false
+		plans = append(plans, childPlans...)
+	}
+	if skipped {
+		return nil, true, nil
+	}
+	return an.minimize(plans, maxIntermediatePlans), false, nil
+}
+
+func (an *analyzer) collectAnd(r *common.Result) ([]*Plan, bool, error) {
+	plans := []*Plan{an.finish(nil)}
+	skipped := true
+	for _, c := range r.Children {
+		childPlans, childSkipped, err := an.collect(c)
+		if err != nil {
+			return nil, false, err
+		}
+		if childSkipped {
+			continue
+		}
+		skipped = false
+
+		var combined []*Plan
+		for _, p := range plans {
+			for _, cp := range childPlans {
+				combined = append(combined, an.finish(append(slices.Clone(p.reqs), cp.reqs...)))
+			}
+		}
+		plans = an.minimize(combined, maxIntermediatePlans)
+	}
+	if skipped {
+		return nil, true, nil
+	}
+	return plans, false, nil
+}
+
+// finish creates a plan from requirements. Requirements with the same actors
+// are merged and requirements that are satisfied by the approvals for other
+// requirements are removed.
+func (an *analyzer) finish(reqs []*Requirement) *Plan {
+	merged := make(map[string]*Requirement)
+	for _, r := range reqs {
+		k := r.key()
+		if m, ok := merged[k]; ok {
+			m.Count = max(m.Count, r.Count)
+			m.Rules = mergeSorted(m.Rules, r.Rules)
+			if m.Users != nil {
+				m.Users = slices.DeleteFunc(m.Users, func(u string) bool { return !slices.Contains(r.Users, u) })
+			}
+		} else {
+			merged[k] = r.clone()
+		}
+	}
+
+	p := &Plan{}
+	for _, r := range merged {
+		p.reqs = append(p.reqs, r)
+	}
+	sort.Slice(p.reqs, func(i, j int) bool { return p.reqs[i].key() < p.reqs[j].key() })
+
+	// For each requirement, find the requirement with the largest count
+	// whose approvers also satisfy it. Ties between requirements with the
+	// same approvers are broken by order so the relation has no cycles.
+	dominator := make([]int, len(p.reqs))
+	for i, r := range p.reqs {
+		dominator[i] = -1
+		for j, o := range p.reqs {
+			if i == j || !an.isSubset(o, r) || (an.isSubset(r, o) && j > i) {
+				continue
+			}
+			if dominator[i] < 0 || o.Count > p.reqs[dominator[i]].Count {
+				dominator[i] = j
+			}
+		}
+	}
+
+	remaining := make([]*Requirement, len(p.reqs))
+	for i, r := range p.reqs {
+		remaining[i] = r.clone()
+		if d := dominator[i]; d >= 0 {
+			remaining[i].Count -= p.reqs[d].Count
+		}
+	}
+	for i := range remaining {
+		if remaining[i].Count > 0 {
+			continue
+		}
+		// the rules are satisfied by the approvals for the dominator
+		d := dominator[i]
+		for remaining[d].Count <= 0 {
+			d = dominator[d]
+		}
+		remaining[d].Rules = mergeSorted(remaining[d].Rules, remaining[i].Rules)
+	}
+
+	p.Requirements = []*Requirement{}
+	for _, r := range remaining {
+		if r.Count > 0 {
+			p.Requirements = append(p.Requirements, r)
+			p.Approvals += r.Count
+		}
+	}
+
+	if an.users != nil {
+		if approvers, ok := selectApprovers(p.reqs); ok {
+			p.Approvers = approvers
+			p.Approvals = len(approvers)
+		}
+	}
+	return p
+}
+
+// isSubset returns true if every user who is one of the actors of a is also
+// one of the actors of b.
+func (an *analyzer) isSubset(a, b *Requirement) bool {
+	if an.users != nil {
+		return len(a.Users) > 0 && isSubset(a.Users, b.Users)
+	}
+
+	if !isSubset(a.Actors.Users, b.Actors.Users) ||
+		!isSubset(a.Actors.Teams, b.Actors.Teams) ||
+		!isSubset(a.Actors.Organizations, b.Actors.Organizations) {
+		return false
+	}
+	if len(a.Actors.Permissions) == 0 {
+		return true
+	}
+	if len(b.Actors.Permissions) == 0 {
+		return false
+	}
+
+	// permissions are sorted from most to least permissive and users with a
+	// permission also satisfy all lesser permissions
+	return slices.Min(a.Actors.Permissions) >= slices.Min(b.Actors.Permissions)
+}
+
+func (an *analyzer) listUsers(actors *common.Actors) ([]string, error) {
+	k := (&Requirement{Actors: *actors}).key()
+	if users, ok := an.cache[k]; ok {
+		return users, nil
+	}
+
+	users, err := an.users(actors)
+	if err != nil {
+		return nil, err
+	}
+
+	users = sortedCopy(users)
+	users = slices.Compact(users)
+	an.cache[k] = users
+	return users, nil
+}
+
+// minimize removes duplicate plans and plans that need a superset of the
+// approvals of another plan, then returns at most n plans with the fewest
+// approvals.
+func (an *analyzer) minimize(plans []*Plan, n int) []*Plan {
+	var unique []*Plan
+	seen := make(map[string]bool)
+	for _, p := range plans {
+		if k := p.key(); !seen[k] {
+			seen[k] = true
+			unique = append(unique, p)
+		}
+	}
+
+	var minimal []*Plan
+	for i, p := range unique {
+		dominated := slices.ContainsFunc(unique, func(o *Plan) bool {
+			return o != p && o.covers(p) && o.Approvals <= p.Approvals
+		})
+		if !dominated {
+			minimal = append(minimal, unique[i])
+		}
+	}
+
+	sort.SliceStable(minimal, func(i, j int) bool {
+		if minimal[i].Approvals != minimal[j].Approvals {
+			return minimal[i].Approvals < minimal[j].Approvals
+		}
+		if len(minimal[i].reqs) != len(minimal[j].reqs) {
+			return len(minimal[i].reqs) < len(minimal[j].reqs)
+		}
+		return minimal[i].key() < minimal[j].key()
+	})
+
+	if len(minimal) > n {
+		minimal = minimal[:n]
+	}
+	return minimal
+}
+
+// selectApprovers picks users who satisfy every requirement, preferring users
+// who satisfy the most outstanding requirements. It returns false if there
+// are not enough users.
+func selectApprovers(reqs []*Requirement) ([]string, bool) {
+	remaining := make([]int, len(reqs))
+	for i, r := range reqs {
+		remaining[i] = r.Count
+	}
+
+	var approvers []string
+	for {
+		best, bestCount := "", 0
+		for i, r := range reqs {
+			if remaining[i] <= 0 {
+				continue
+			}
+			for _, u := range r.Users {
+				if slices.Contains(approvers, u) {
+					continue
+				}
+				count := 0
+				for k, o := range reqs {
+					if remaining[k] > 0 && slices.Contains(o.Users, u) {
+						count++
+					}
+				}
+				if count > bestCount || (count == bestCount && u < best) {
+					best, bestCount = u, count
+				}
+			}
+		}
+
+		if bestCount == 0 {
+			break
+		}
+
+		approvers = append(approvers, best)
+		for i, r := range reqs {
+			if slices.Contains(r.Users, best) {
+				remaining[i]--
+			}
+		}
+	}
+
+	for _, n := range remaining {
+		if n > 0 {
+			return nil, false
+		}
+	}
+	sort.Strings(approvers)
+	return approvers, true
+}
+
+// ContextUserLister returns a UserLister that lists users with the pull
+// request context. Users with permissions are the repository collaborators
+// with at least the least permissive of the permissions. Members of
+// organizations are not listed; see ErrOrganizationActors.
+func ContextUserLister(prctx pull.Context) UserLister {
+	return func(actors *common.Actors) ([]string, error) {
+		if len(actors.Organizations) > 0 {
+			return nil, ErrOrganizationActors
+		}
+
+		users := slices.Clone(actors.Users)
+
+		for _, team := range actors.Teams {
+			members, err := prctx.TeamMembers(team)
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, members...)
+		}
+
+		if perms := actors.GetPermissions(); len(perms) > 0 {
+			collaborators, err := prctx.RepositoryCollaborators()
+			if err != nil {
+				return nil, err
+			}
+
+			minPerm := slices.Min(perms)
+			for _, c := range collaborators {
+				if slices.ContainsFunc(c.Permissions, func(p pull.CollaboratorPermission) bool { return p.Permission >= minPerm }) {
+					users = append(users, c.Name)
+				}
+			}
+		}
+
+		return users, nil
+	}
+}
+
+func isSubset(a, b []string) bool {
+	for _, v := range a {
+		if !slices.Contains(b, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeSorted(a, b []string) []string {
+	merged := append(slices.Clone(a), b...)
+	sort.Strings(merged)
+	return slices.Compact(merged)
+}
+
+func sortedCopy(s []string) []string {
+	c := slices.Clone(s)
+	sort.Strings(c)
+	return c
+}
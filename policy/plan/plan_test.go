@@ -0,0 +1,264 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyze(t *testing.T) {
+	teamA := rule("team-a approval", common.StatusPending, 1, common.Actors{Teams: []string{"org/team-a"}})
+	security := rule("security approval", common.StatusPending, 1, common.Actors{Teams: []string{"org/security"}})
+
+	t.Run("and", func(t *testing.T) {
+		a := analyze(t, policyResult(and(teamA, security)), nil)
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, 2, a.Plans[0].Approvals)
+		assert.Equal(t, []*Requirement{
+			{Rules: []string{"security approval"}, Count: 1, Actors: common.Actors{Teams: []string{"org/security"}, Permissions: []pull.Permission{}}},
+			{Rules: []string{"team-a approval"}, Count: 1, Actors: common.Actors{Teams: []string{"org/team-a"}, Permissions: []pull.Permission{}}},
+		}, a.Plans[0].Requirements)
+	})
+
+	t.Run("or", func(t *testing.T) {
+		a := analyze(t, policyResult(or(teamA, security)), nil)
+
+		require.Len(t, a.Plans, 2)
+		assert.Equal(t, []string{"security approval"}, planRules(a.Plans[0]))
+		assert.Equal(t, []string{"team-a approval"}, planRules(a.Plans[1]))
+		assert.Equal(t, "The pull request is approved by any one of the following plans", a.Description)
+	})
+
+	t.Run("redundant plans", func(t *testing.T) {
+		a := analyze(t, policyResult(or(and(teamA, security), teamA)), nil)
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, []string{"team-a approval"}, planRules(a.Plans[0]))
+	})
+
+	t.Run("approved branch", func(t *testing.T) {
+		approved := rule("approved", common.StatusApproved, 1, common.Actors{Users: []string{"mhaypenny"}})
+		a := analyze(t, policyResult(and(security, or(teamA, approved))), nil)
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, 1, a.Plans[0].Approvals)
+		assert.Equal(t, []string{"security approval"}, planRules(a.Plans[0]))
+	})
+
+	t.Run("subset actors satisfy both rules", func(t *testing.T) {
+		alice := rule("alice", common.StatusPending, 1, common.Actors{Users: []string{"alice"}})
+		maintainers := rule("maintainers", common.StatusPending, 1, common.Actors{Users: []string{"bob", "alice"}})
+
+		a := analyze(t, policyResult(and(alice, maintainers)), nil)
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, 1, a.Plans[0].Approvals)
+		require.Len(t, a.Plans[0].Requirements, 1)
+		assert.Equal(t, []string{"alice", "maintainers"}, a.Plans[0].Requirements[0].Rules)
+		assert.Equal(t, []string{"alice"}, a.Plans[0].Requirements[0].Actors.Users)
+	})
+
+	t.Run("subset actors reduce count", func(t *testing.T) {
+		alice := rule("alice", common.StatusPending, 1, common.Actors{Users: []string{"alice"}})
+		maintainers := rule("maintainers", common.StatusPending, 2, common.Actors{Users: []string{"alice", "bob", "carol"}})
+
+		a := analyze(t, policyResult(and(alice, maintainers)), nil)
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, 2, a.Plans[0].Approvals)
+		require.Len(t, a.Plans[0].Requirements, 2)
+		assert.Equal(t, []string{"maintainers"}, a.Plans[0].Requirements[0].Rules)
+		assert.Equal(t, 1, a.Plans[0].Requirements[0].Count)
+		assert.Equal(t, []string{"alice"}, a.Plans[0].Requirements[1].Rules)
+	})
+
+	t.Run("same actors", func(t *testing.T) {
+		first := rule("first", common.StatusPending, 1, common.Actors{Teams: []string{"org/team-a"}})
+		second := rule("second", common.StatusPending, 2, common.Actors{Teams: []string{"org/team-a"}})
+
+		a := analyze(t, policyResult(and(first, second)), nil)
+
+		require.Len(t, a.Plans, 1)
+		require.Len(t, a.Plans[0].Requirements, 1)
+		assert.Equal(t, 2, a.Plans[0].Requirements[0].Count)
+		assert.Equal(t, []string{"first", "second"}, a.Plans[0].Requirements[0].Rules)
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		admins := rule("admins", common.StatusPending, 1, common.Actors{Permissions: []pull.Permission{pull.PermissionAdmin}})
+		writers := rule("writers", common.StatusPending, 1, common.Actors{Permissions: []pull.Permission{pull.PermissionWrite}})
+
+		a := analyze(t, policyResult(and(admins, writers)), nil)
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, 1, a.Plans[0].Approvals)
+		assert.Equal(t, []string{"admins", "writers"}, a.Plans[0].Requirements[0].Rules)
+	})
+
+	t.Run("existing approvals", func(t *testing.T) {
+		r := rule("two approvals", common.StatusPending, 2, common.Actors{Users: []string{"alice", "bob", "carol"}})
+		r.Approvers = []*common.Candidate{{User: "alice"}}
+
+		a := analyze(t, policyResult(r), ContextUserLister(&pulltest.Context{}))
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, 1, a.Plans[0].Requirements[0].Count)
+		assert.Equal(t, []string{"bob", "carol"}, a.Plans[0].Requirements[0].Users)
+		assert.Equal(t, []string{"bob"}, a.Plans[0].Approvers)
+	})
+
+	t.Run("skipped and error rules", func(t *testing.T) {
+		skipped := rule("skipped", common.StatusSkipped, 1, common.Actors{Users: []string{"alice"}})
+		failed := rule("failed", common.StatusPending, 1, common.Actors{Users: []string{"bob"}})
+		failed.Error = assert.AnError
+
+		a := analyze(t, policyResult(and(skipped, or(failed, teamA))), nil)
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, []string{"team-a approval"}, planRules(a.Plans[0]))
+	})
+
+	t.Run("no actors", func(t *testing.T) {
+		impossible := rule("impossible", common.StatusPending, 1, common.Actors{})
+
+		a := analyze(t, policyResult(impossible), nil)
+		assert.Empty(t, a.Plans)
+		assert.Equal(t, "No combination of approvals can satisfy the policy", a.Description)
+	})
+
+	t.Run("final statuses", func(t *testing.T) {
+		for status, description := range map[common.EvaluationStatus]string{
+			common.StatusApproved:    "The pull request is approved and needs no more approvals",
+			common.StatusDisapproved: "The pull request is disapproved and approvals cannot satisfy the policy until the disapproval is resolved",
+			common.StatusSkipped:     "All rules were skipped, so approvals cannot satisfy the policy",
+		} {
+			result := policyResult(teamA)
+			result.Status = status
+
+			a := analyze(t, result, nil)
+			assert.Equal(t, status.String(), a.Status)
+			assert.Equal(t, description, a.Description)
+			assert.Empty(t, a.Plans)
+		}
+	})
+}
+
+func TestAnalyzeExpandUsers(t *testing.T) {
+	prctx := &pulltest.Context{
+		TeamMemberships: map[string][]string{
+			"alice": {"org/team-a", "org/security"},
+			"bob":   {"org/team-a"},
+			"carol": {"org/security"},
+		},
+		CollaboratorsValue: []*pull.Collaborator{
+			{Name: "dave", Permissions: []pull.CollaboratorPermission{{Permission: pull.PermissionAdmin, ViaRepo: true}}},
+			{Name: "erin", Permissions: []pull.CollaboratorPermission{{Permission: pull.PermissionRead, ViaRepo: true}}},
+		},
+	}
+
+	teamA := rule("team-a approval", common.StatusPending, 1, common.Actors{Teams: []string{"org/team-a"}})
+	security := rule("security approval", common.StatusPending, 1, common.Actors{Teams: []string{"org/security"}})
+
+	t.Run("one user satisfies both rules", func(t *testing.T) {
+		a := analyze(t, policyResult(and(teamA, security)), ContextUserLister(prctx))
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, 1, a.Plans[0].Approvals)
+		assert.Equal(t, []string{"alice"}, a.Plans[0].Approvers)
+		require.Len(t, a.Plans[0].Requirements, 2)
+		assert.Equal(t, []string{"alice", "carol"}, a.Plans[0].Requirements[0].Users)
+		assert.Equal(t, []string{"alice", "bob"}, a.Plans[0].Requirements[1].Users)
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		writers := rule("writers", common.StatusPending, 1, common.Actors{Permissions: []pull.Permission{pull.PermissionWrite}})
+
+		a := analyze(t, policyResult(writers), ContextUserLister(prctx))
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, []string{"dave"}, a.Plans[0].Requirements[0].Users)
+	})
+
+	t.Run("not enough users", func(t *testing.T) {
+		many := rule("many", common.StatusPending, 3, common.Actors{Teams: []string{"org/team-a"}})
+
+		a := analyze(t, policyResult(many), ContextUserLister(prctx))
+
+		require.Len(t, a.Plans, 1)
+		assert.Equal(t, 3, a.Plans[0].Approvals)
+		assert.Empty(t, a.Plans[0].Approvers)
+	})
+
+	t.Run("organizations", func(t *testing.T) {
+		org := rule("org", common.StatusPending, 1, common.Actors{Organizations: []string{"org"}})
+
+		_, err := Analyze(policyResult(org), ContextUserLister(prctx))
+		assert.ErrorIs(t, err, ErrOrganizationActors)
+	})
+
+	t.Run("list error", func(t *testing.T) {
+		_, err := Analyze(policyResult(teamA), ContextUserLister(&pulltest.Context{TeamMembershipError: assert.AnError}))
+		assert.Error(t, err)
+	})
+}
+
+func analyze(t *testing.T, result *common.Result, users UserLister) *Analysis {
+	a, err := Analyze(result, users)
+	require.NoError(t, err)
+	return a
+}
+
+func planRules(p *Plan) []string {
+	var rules []string
+	for _, r := range p.Requirements {
+		rules = append(rules, r.Rules...)
+	}
+	return rules
+}
+
+func rule(name string, status common.EvaluationStatus, count int, actors common.Actors) *common.Result {
+	return &common.Result{
+		Name:     name,
+		Status:   status,
+		Requires: common.Requires{Count: count, Actors: actors},
+		Methods:  &common.Methods{},
+	}
+}
+
+func and(children ...*common.Result) *common.Result {
+	return &common.Result{Name: "and", Status: common.StatusPending, Children: children}
+}
+
+func or(children ...*common.Result) *common.Result {
+	return &common.Result{Name: "or", Status: common.StatusPending, Children: children}
+}
+
+func policyResult(approval *common.Result) *common.Result {
+	return &common.Result{
+		Name:   "policy",
+		Status: common.StatusPending,
+		Children: []*common.Result{
+			{Name: "approval", Status: common.StatusPending, Children: []*common.Result{approval}},
+			{Name: "disapproval", Status: common.StatusSkipped},
+		},
+	}
+}
@@ -16,10 +16,12 @@ package policy
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/palantir/policy-bot/policy/approval"
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/policy/disapproval"
+	"github.com/palantir/policy-bot/policy/override"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/pkg/errors"
 )
@@ -42,6 +44,7 @@ type Config struct {
 type Policy struct {
 	Approval    approval.Policy     `yaml:"approval"`
 	Disapproval *disapproval.Policy `yaml:"disapproval"`
+	Override    *override.Policy    `yaml:"override"`
 }
 
 func ParsePolicy(c *Config) (common.Evaluator, error) {
@@ -60,19 +63,35 @@ func ParsePolicy(c *Config) (common.Evaluator, error) {
 		evalDisapproval = &disapproval.Policy{}
 	}
 
+	var evalOverride common.Evaluator
+	if c.Policy.Override != nil {
+		evalOverride, err = c.Policy.Override.Parse(rulesByName)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to parse override policy")
+		}
+	}
+
 	return evaluator{
 		approval:    evalApproval,
 		disapproval: evalDisapproval,
+		override:    evalOverride,
 	}, nil
 }
 
 type evaluator struct {
 	approval    common.Evaluator
 	disapproval common.Evaluator
+
+	// override is nil if the policy does not allow overrides
+	override common.Evaluator
 }
 
 func (e evaluator) Trigger() common.Trigger {
-	return e.approval.Trigger() | e.disapproval.Trigger()
+	t := e.approval.Trigger() | e.disapproval.Trigger()
+	if e.override != nil {
+		t |= e.override.Trigger()
+	}
+	return t
 }
 
 func (e evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common.Result) {
@@ -82,6 +101,13 @@ func (e evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common
 	res.Name = "policy"
 	res.Children = []*common.Result{&approval, &disapproval}
 
+	var override *common.Result
+	if e.override != nil {
+		r := e.override.Evaluate(ctx, prctx)
+		override = &r
+		res.Children = append(res.Children, override)
+	}
+
 	for _, r := range res.Children {
 		if r.Error != nil {
 			res.Error = r.Error
@@ -93,9 +119,100 @@ func (e evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common
 	case disapproval.Status == common.StatusDisapproved:
 		res.Status = common.StatusDisapproved
 		res.StatusDescription = disapproval.StatusDescription
+	case override != nil && override.Status == common.StatusApproved && approval.Status != common.StatusApproved:
+		res.Status = common.StatusApproved
+		res.StatusDescription = fmt.Sprintf("Emergency override by %s", override.Approvers[0].User)
 	default:
 		res.Status = approval.Status
 		res.StatusDescription = approval.StatusDescription
 	}
 	return
 }
+
+// EnforcedResultName is the name of the result produced by the enforced
+// policy when it is combined with a repository policy.
+const EnforcedResultName = "enforced policy"
+
+// ParseEnforcedPolicy creates an evaluator that requires approval from both a
+// repository policy and an enforced policy that applies to all repositories.
+// The repository policy may be nil, in which case only the enforced policy
+// applies. Rules in the two policies are resolved independently, and it is an
+// error for the repository policy to define a rule with the same name as a
+// rule in the enforced policy.
+func ParseEnforcedPolicy(c, enforced *Config) (common.Evaluator, error) {
+	evalEnforced, err := ParsePolicy(enforced)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to parse enforced policy")
+	}
+
+	var evalRepository common.Evaluator
+	if c != nil {
+		enforcedRules := make(map[string]bool)
+		for _, r := range enforced.ApprovalRules {
+			enforcedRules[r.Name] = true
+		}
+		for _, r := range c.ApprovalRules {
+			if enforcedRules[r.Name] {
+				return nil, errors.Errorf("approval rule %q has the same name as a rule in the enforced policy", r.Name)
+			}
+		}
+
+		evalRepository, err = ParsePolicy(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return enforcedEvaluator{
+		repository: evalRepository,
+		enforced:   evalEnforced,
+	}, nil
+}
+
+type enforcedEvaluator struct {
+	// repository is nil if the repository does not define a policy
+	repository common.Evaluator
+	enforced   common.Evaluator
+}
+
+func (e enforcedEvaluator) Trigger() common.Trigger {
+	t := e.enforced.Trigger()
+	if e.repository != nil {
+		t |= e.repository.Trigger()
+	}
+	return t
+}
+
+func (e enforcedEvaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common.Result) {
+	enforced := e.enforced.Evaluate(ctx, prctx)
+	enforced.Name = EnforcedResultName
+
+	if e.repository != nil {
+		res = e.repository.Evaluate(ctx, prctx)
+	} else {
+		res.Name = "policy"
+		res.Status = common.StatusSkipped
+	}
+	res.Children = append(res.Children, &enforced)
+
+	if res.Error == nil && enforced.Error != nil {
+		res.Error = enforced.Error
+	}
+
+	switch {
+	case res.Error != nil:
+	case res.Status == common.StatusDisapproved:
+	case enforced.Status == common.StatusDisapproved:
+		res.Status = common.StatusDisapproved
+		res.StatusDescription = "Enforced policy: " + enforced.StatusDescription
+	case enforced.Status == common.StatusSkipped && e.repository == nil:
+		res.Status = common.StatusApproved
+		res.StatusDescription = "The enforced policy does not apply to this pull request"
+	case enforced.Status == common.StatusSkipped:
+		// the enforced policy does not apply to this pull request
+	case res.Status == common.StatusSkipped || enforced.Status == common.StatusPending:
+		res.Status = enforced.Status
+		res.StatusDescription = "Enforced policy: " + enforced.StatusDescription
+	}
+	return
+}
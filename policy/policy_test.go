@@ -19,6 +19,7 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/palantir/policy-bot/policy/approval"
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/palantir/policy-bot/pull/pulltest"
@@ -76,6 +77,53 @@ func TestEvaluator(t *testing.T) {
 		assert.Equal(t, "2 approvals needed", r.StatusDescription)
 	})
 
+	t.Run("overrideApproves", func(t *testing.T) {
+		eval := evaluator{
+			approval: &StaticEvaluator{
+				Status:            common.StatusPending,
+				StatusDescription: "2 approvals needed",
+			},
+			disapproval: &StaticEvaluator{
+				Status: common.StatusSkipped,
+			},
+			override: &StaticEvaluator{
+				Status:    common.StatusApproved,
+				Approvers: []*common.Candidate{{User: "incident-commander"}},
+			},
+		}
+
+		r := eval.Evaluate(ctx, prctx)
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusApproved, r.Status)
+		assert.Equal(t, "Emergency override by incident-commander", r.StatusDescription)
+		if assert.Len(t, r.Children, 3) {
+			assert.Equal(t, castToResult(eval.override), r.Children[2])
+		}
+	})
+
+	t.Run("disapprovalWinsOverOverride", func(t *testing.T) {
+		eval := evaluator{
+			approval: &StaticEvaluator{
+				Status: common.StatusPending,
+			},
+			disapproval: &StaticEvaluator{
+				Status:            common.StatusDisapproved,
+				StatusDescription: "disapproved by test",
+			},
+			override: &StaticEvaluator{
+				Status:    common.StatusApproved,
+				Approvers: []*common.Candidate{{User: "incident-commander"}},
+			},
+		}
+
+		r := eval.Evaluate(ctx, prctx)
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusDisapproved, r.Status)
+		assert.Equal(t, "disapproved by test", r.StatusDescription)
+	})
+
 	t.Run("propagateError", func(t *testing.T) {
 		eval := evaluator{
 			approval: &StaticEvaluator{
@@ -116,3 +164,98 @@ func TestEvaluator(t *testing.T) {
 func castToResult(e common.Evaluator) *common.Result {
 	return (*common.Result)(e.(*StaticEvaluator))
 }
+
+func TestEnforcedEvaluator(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{}
+
+	tests := map[string]struct {
+		Repository        *StaticEvaluator
+		Enforced          *StaticEvaluator
+		Status            common.EvaluationStatus
+		StatusDescription string
+	}{
+		"bothApproved": {
+			Repository:        &StaticEvaluator{Status: common.StatusApproved, StatusDescription: "repository"},
+			Enforced:          &StaticEvaluator{Status: common.StatusApproved, StatusDescription: "enforced"},
+			Status:            common.StatusApproved,
+			StatusDescription: "repository",
+		},
+		"enforcedPending": {
+			Repository:        &StaticEvaluator{Status: common.StatusApproved, StatusDescription: "repository"},
+			Enforced:          &StaticEvaluator{Status: common.StatusPending, StatusDescription: "enforced"},
+			Status:            common.StatusPending,
+			StatusDescription: "Enforced policy: enforced",
+		},
+		"repositoryPending": {
+			Repository:        &StaticEvaluator{Status: common.StatusPending, StatusDescription: "repository"},
+			Enforced:          &StaticEvaluator{Status: common.StatusApproved, StatusDescription: "enforced"},
+			Status:            common.StatusPending,
+			StatusDescription: "repository",
+		},
+		"enforcedDisapproved": {
+			Repository:        &StaticEvaluator{Status: common.StatusApproved, StatusDescription: "repository"},
+			Enforced:          &StaticEvaluator{Status: common.StatusDisapproved, StatusDescription: "enforced"},
+			Status:            common.StatusDisapproved,
+			StatusDescription: "Enforced policy: enforced",
+		},
+		"enforcedSkipped": {
+			Repository:        &StaticEvaluator{Status: common.StatusPending, StatusDescription: "repository"},
+			Enforced:          &StaticEvaluator{Status: common.StatusSkipped, StatusDescription: "enforced"},
+			Status:            common.StatusPending,
+			StatusDescription: "repository",
+		},
+		"noRepositoryPolicy": {
+			Enforced:          &StaticEvaluator{Status: common.StatusPending, StatusDescription: "enforced"},
+			Status:            common.StatusPending,
+			StatusDescription: "Enforced policy: enforced",
+		},
+		"noRepositoryPolicySkipped": {
+			Enforced:          &StaticEvaluator{Status: common.StatusSkipped, StatusDescription: "enforced"},
+			Status:            common.StatusApproved,
+			StatusDescription: "The enforced policy does not apply to this pull request",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			eval := enforcedEvaluator{enforced: test.Enforced}
+			if test.Repository != nil {
+				eval.repository = test.Repository
+			}
+
+			r := eval.Evaluate(ctx, prctx)
+			require.NoError(t, r.Error)
+
+			assert.Equal(t, test.Status, r.Status)
+			assert.Equal(t, test.StatusDescription, r.StatusDescription)
+			if assert.NotEmpty(t, r.Children) {
+				assert.Equal(t, EnforcedResultName, r.Children[len(r.Children)-1].Name)
+			}
+		})
+	}
+}
+
+func TestParseEnforcedPolicy(t *testing.T) {
+	enforced := &Config{
+		Policy: Policy{
+			Approval: approval.Policy{"release approval"},
+		},
+		ApprovalRules: []*approval.Rule{
+			{Name: "release approval"},
+		},
+	}
+
+	_, err := ParseEnforcedPolicy(nil, enforced)
+	assert.NoError(t, err)
+
+	_, err = ParseEnforcedPolicy(&Config{
+		Policy: Policy{
+			Approval: approval.Policy{"release approval"},
+		},
+		ApprovalRules: []*approval.Rule{
+			{Name: "release approval"},
+		},
+	}, enforced)
+	assert.EqualError(t, err, `approval rule "release approval" has the same name as a rule in the enforced policy`)
+}
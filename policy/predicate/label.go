@@ -16,6 +16,7 @@ package predicate
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/palantir/policy-bot/policy/common"
@@ -23,40 +24,218 @@ import (
 	"github.com/pkg/errors"
 )
 
-type HasLabels []string
+// HasLabels is satisfied if the pull request has all of the listed labels and
+// at least one label matching each pattern. Labels are lowercase when matching
+// patterns. If AppliedBy is set, only labels
+// most recently applied by one of the actors are considered.
+type HasLabels struct {
+	Labels    []string        `yaml:"labels"`
+	Patterns  []common.Regexp `yaml:"patterns"`
+	AppliedBy common.Actors   `yaml:"applied_by"`
+}
+
+var _ Predicate = &HasLabels{}
 
-var _ Predicate = HasLabels([]string{})
+// UnmarshalYAML supports both the full form of the predicate and the original
+// form, which is a list of label names.
+func (pred *HasLabels) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var labels []string
+	if err := unmarshal(&labels); err == nil {
+		*pred = HasLabels{Labels: labels}
+		return nil
+	}
 
-func (pred HasLabels) Evaluate(ctx context.Context, prctx pull.Context) (*common.PredicateResult, error) {
+	type rawHasLabels HasLabels
+	var raw rawHasLabels
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	*pred = HasLabels(raw)
+	return nil
+}
 
+func (pred *HasLabels) Evaluate(ctx context.Context, prctx pull.Context) (*common.PredicateResult, error) {
 	predicateResult := common.PredicateResult{
 		ValuePhrase:     "labels",
 		ConditionPhrase: "contain the labels",
 	}
-	if len(pred) > 0 {
+
+	if len(pred.Labels) > 0 || len(pred.Patterns) > 0 {
 		labels, err := prctx.Labels()
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to list pull request labels")
 		}
 		predicateResult.Values = labels
-		for _, requiredLabel := range pred {
-			if !contains(labels, strings.ToLower(requiredLabel)) {
+
+		allowed, err := pred.allowedLabels(ctx, prctx, labels)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, requiredLabel := range pred.Labels {
+			label := strings.ToLower(requiredLabel)
+			if !contains(allowed, label) {
 				predicateResult.ConditionValues = []string{requiredLabel}
 				predicateResult.Description = "Missing label: " + requiredLabel
+				if contains(labels, label) {
+					predicateResult.Description = fmt.Sprintf("Label %s was not applied by an allowed user", requiredLabel)
+				}
+				predicateResult.Satisfied = false
+				return &predicateResult, nil
+			}
+		}
+
+		for _, pattern := range pred.Patterns {
+			if !anyLabelMatches(pattern, allowed) {
+				predicateResult.ConditionValues = []string{pattern.String()}
+				predicateResult.Description = "Missing label matching pattern: " + pattern.String()
+				if anyLabelMatches(pattern, labels) {
+					predicateResult.Description = fmt.Sprintf("No label matching pattern %s was applied by an allowed user", pattern.String())
+				}
 				predicateResult.Satisfied = false
 				return &predicateResult, nil
 			}
 		}
 	}
-	predicateResult.ConditionValues = pred
+
+	predicateResult.ConditionValues = labelConditionValues(pred.Labels, pred.Patterns)
 	predicateResult.Satisfied = true
 	return &predicateResult, nil
 }
 
-func (pred HasLabels) Trigger() common.Trigger {
+// allowedLabels returns the labels that were applied by an allowed actor.
+func (pred *HasLabels) allowedLabels(ctx context.Context, prctx pull.Context, labels []string) ([]string, error) {
+	if pred.AppliedBy.IsEmpty() {
+		return labels, nil
+	}
+
+	actors, err := prctx.LabelActors()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list label actors")
+	}
+
+	var allowed []string
+	for _, label := range labels {
+		user, ok := actors[label]
+		if !ok || user == "" {
+			continue
+		}
+
+		isActor, err := pred.AppliedBy.IsActor(ctx, prctx, user)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to check label actor")
+		}
+		if isActor {
+			allowed = append(allowed, label)
+		}
+	}
+	return allowed, nil
+}
+
+// IsProtected returns true if the predicate only considers labels applied by
+// specific actors and the label is one of the labels it considers.
+func (pred *HasLabels) IsProtected(label string) bool {
+	if pred.AppliedBy.IsEmpty() {
+		return false
+	}
+	label = strings.ToLower(label)
+	for _, l := range pred.Labels {
+		if strings.ToLower(l) == label {
+			return true
+		}
+	}
+	return anyMatches(pred.Patterns, label)
+}
+
+func (pred *HasLabels) Trigger() common.Trigger {
 	return common.TriggerLabel
 }
 
+// NotHasLabels is satisfied if the pull request has none of the listed labels
+// and no labels matching any of the patterns.
+type NotHasLabels struct {
+	Labels   []string        `yaml:"labels"`
+	Patterns []common.Regexp `yaml:"patterns"`
+}
+
+var _ Predicate = &NotHasLabels{}
+
+// UnmarshalYAML supports both the full form of the predicate and the short
+// form, which is a list of label names.
+func (pred *NotHasLabels) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var labels []string
+	if err := unmarshal(&labels); err == nil {
+		*pred = NotHasLabels{Labels: labels}
+		return nil
+	}
+
+	type rawNotHasLabels NotHasLabels
+	var raw rawNotHasLabels
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	*pred = NotHasLabels(raw)
+	return nil
+}
+
+func (pred *NotHasLabels) Evaluate(ctx context.Context, prctx pull.Context) (*common.PredicateResult, error) {
+	predicateResult := common.PredicateResult{
+		ValuePhrase:     "labels",
+		ConditionPhrase: "do not contain the labels",
+	}
+
+	if len(pred.Labels) > 0 || len(pred.Patterns) > 0 {
+		labels, err := prctx.Labels()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list pull request labels")
+		}
+		predicateResult.Values = labels
+
+		for _, excludedLabel := range pred.Labels {
+			if contains(labels, strings.ToLower(excludedLabel)) {
+				predicateResult.ConditionValues = []string{excludedLabel}
+				predicateResult.Description = "Has excluded label: " + excludedLabel
+				predicateResult.Satisfied = false
+				return &predicateResult, nil
+			}
+		}
+
+		for _, pattern := range pred.Patterns {
+			if anyLabelMatches(pattern, labels) {
+				predicateResult.ConditionValues = []string{pattern.String()}
+				predicateResult.Description = "Has label matching excluded pattern: " + pattern.String()
+				predicateResult.Satisfied = false
+				return &predicateResult, nil
+			}
+		}
+	}
+
+	predicateResult.ConditionValues = labelConditionValues(pred.Labels, pred.Patterns)
+	predicateResult.Satisfied = true
+	return &predicateResult, nil
+}
+
+func (pred *NotHasLabels) Trigger() common.Trigger {
+	return common.TriggerLabel
+}
+
+func anyLabelMatches(pattern common.Regexp, labels []string) bool {
+	for _, label := range labels {
+		if pattern.Matches(label) {
+			return true
+		}
+	}
+	return false
+}
+
+func labelConditionValues(labels []string, patterns []common.Regexp) []string {
+	values := append([]string(nil), labels...)
+	for _, p := range patterns {
+		values = append(values, p.String())
+	}
+	return values
+}
+
 func contains(elements []string, value string) bool {
 	for _, element := range elements {
 		if element == value {
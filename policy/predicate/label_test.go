@@ -16,16 +16,19 @@ package predicate
 
 import (
 	"context"
+	"regexp"
 	"testing"
 
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/palantir/policy-bot/pull/pulltest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
 func TestHasLabels(t *testing.T) {
-	p := HasLabels([]string{"foo", "bar"})
+	p := &HasLabels{Labels: []string{"foo", "bar"}}
 
 	runLabelsTestCase(t, p, []HasLabelsTestCase{
 		{
@@ -64,6 +67,196 @@ func TestHasLabels(t *testing.T) {
 	})
 }
 
+func TestHasLabelsPatterns(t *testing.T) {
+	p := &HasLabels{
+		Labels:   []string{"foo"},
+		Patterns: []common.Regexp{common.NewCompiledRegexp(regexp.MustCompile("^team/"))},
+	}
+
+	runLabelsTestCase(t, p, []HasLabelsTestCase{
+		{
+			"matches pattern",
+			&pulltest.Context{
+				LabelsValue: []string{"foo", "team/platform"},
+			},
+			&common.PredicateResult{
+				Satisfied:       true,
+				Values:          []string{"foo", "team/platform"},
+				ConditionValues: []string{"foo", "^team/"},
+			},
+		},
+		{
+			"missing pattern",
+			&pulltest.Context{
+				LabelsValue: []string{"foo", "platform"},
+			},
+			&common.PredicateResult{
+				Satisfied:       false,
+				Values:          []string{"foo", "platform"},
+				ConditionValues: []string{"^team/"},
+			},
+		},
+	})
+}
+
+func TestHasLabelsAppliedBy(t *testing.T) {
+	p := &HasLabels{
+		Labels:   []string{"skip-review"},
+		Patterns: []common.Regexp{common.NewCompiledRegexp(regexp.MustCompile("^approved/"))},
+		AppliedBy: common.Actors{
+			Teams: []string{"testorg/release-managers"},
+		},
+	}
+
+	teams := map[string][]string{
+		"mhaypenny": {"testorg/release-managers"},
+	}
+
+	runLabelsTestCase(t, p, []HasLabelsTestCase{
+		{
+			"applied by allowed user",
+			&pulltest.Context{
+				LabelsValue: []string{"skip-review", "approved/security"},
+				LabelActorsValue: map[string]string{
+					"skip-review":       "mhaypenny",
+					"approved/security": "mhaypenny",
+				},
+				TeamMemberships: teams,
+			},
+			&common.PredicateResult{
+				Satisfied:       true,
+				Values:          []string{"skip-review", "approved/security"},
+				ConditionValues: []string{"skip-review", "^approved/"},
+			},
+		},
+		{
+			"label applied by other user",
+			&pulltest.Context{
+				LabelsValue: []string{"skip-review", "approved/security"},
+				LabelActorsValue: map[string]string{
+					"skip-review":       "ttest",
+					"approved/security": "mhaypenny",
+				},
+				TeamMemberships: teams,
+			},
+			&common.PredicateResult{
+				Satisfied:       false,
+				Values:          []string{"skip-review", "approved/security"},
+				ConditionValues: []string{"skip-review"},
+			},
+		},
+		{
+			"pattern applied by other user",
+			&pulltest.Context{
+				LabelsValue: []string{"skip-review", "approved/security"},
+				LabelActorsValue: map[string]string{
+					"skip-review":       "mhaypenny",
+					"approved/security": "ttest",
+				},
+				TeamMemberships: teams,
+			},
+			&common.PredicateResult{
+				Satisfied:       false,
+				Values:          []string{"skip-review", "approved/security"},
+				ConditionValues: []string{"^approved/"},
+			},
+		},
+		{
+			"unknown actor",
+			&pulltest.Context{
+				LabelsValue:      []string{"skip-review", "approved/security"},
+				LabelActorsValue: map[string]string{},
+				TeamMemberships:  teams,
+			},
+			&common.PredicateResult{
+				Satisfied:       false,
+				Values:          []string{"skip-review", "approved/security"},
+				ConditionValues: []string{"skip-review"},
+			},
+		},
+	})
+}
+
+func TestHasLabelsIsProtected(t *testing.T) {
+	p := &HasLabels{
+		Labels:   []string{"Skip-Review"},
+		Patterns: []common.Regexp{common.NewCompiledRegexp(regexp.MustCompile("^approved/"))},
+	}
+	assert.False(t, p.IsProtected("skip-review"), "label without actors is protected")
+
+	p.AppliedBy.Users = []string{"mhaypenny"}
+	assert.True(t, p.IsProtected("skip-review"))
+	assert.True(t, p.IsProtected("approved/security"))
+	assert.False(t, p.IsProtected("bug"))
+}
+
+func TestNotHasLabels(t *testing.T) {
+	p := &NotHasLabels{
+		Labels:   []string{"do-not-merge"},
+		Patterns: []common.Regexp{common.NewCompiledRegexp(regexp.MustCompile("^wip"))},
+	}
+
+	runLabelsTestCase(t, p, []HasLabelsTestCase{
+		{
+			"no excluded labels",
+			&pulltest.Context{
+				LabelsValue: []string{"foo"},
+			},
+			&common.PredicateResult{
+				Satisfied:       true,
+				Values:          []string{"foo"},
+				ConditionValues: []string{"do-not-merge", "^wip"},
+			},
+		},
+		{
+			"excluded label",
+			&pulltest.Context{
+				LabelsValue: []string{"foo", "do-not-merge"},
+			},
+			&common.PredicateResult{
+				Satisfied:       false,
+				Values:          []string{"foo", "do-not-merge"},
+				ConditionValues: []string{"do-not-merge"},
+			},
+		},
+		{
+			"excluded pattern",
+			&pulltest.Context{
+				LabelsValue: []string{"wip-needs-tests"},
+			},
+			&common.PredicateResult{
+				Satisfied:       false,
+				Values:          []string{"wip-needs-tests"},
+				ConditionValues: []string{"^wip"},
+			},
+		},
+	})
+}
+
+func TestLabelsUnmarshalYAML(t *testing.T) {
+	var list HasLabels
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`["foo", "bar"]`), &list))
+	assert.Equal(t, []string{"foo", "bar"}, list.Labels)
+	assert.True(t, list.AppliedBy.IsEmpty())
+
+	var full HasLabels
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`
+labels: ["foo"]
+patterns: ["^team/"]
+applied_by:
+  users: ["mhaypenny"]
+`), &full))
+	assert.Equal(t, []string{"foo"}, full.Labels)
+	if assert.Len(t, full.Patterns, 1) {
+		assert.Equal(t, "^team/", full.Patterns[0].String())
+	}
+	assert.Equal(t, []string{"mhaypenny"}, full.AppliedBy.Users)
+
+	var not NotHasLabels
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`["do-not-merge"]`), &not))
+	assert.Equal(t, []string{"do-not-merge"}, not.Labels)
+}
+
 type HasLabelsTestCase struct {
 	name                    string
 	context                 pull.Context
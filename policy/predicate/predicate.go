@@ -16,9 +16,14 @@ package predicate
 
 import (
 	"context"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Predicate interface {
@@ -27,3 +32,56 @@ type Predicate interface {
 	// Evaluate determines if the predicate is satisfied.
 	Evaluate(ctx context.Context, prctx pull.Context) (*common.PredicateResult, error)
 }
+
+// Observer is called after each predicate evaluated by Evaluate with the name
+// of the predicate and the duration of the evaluation.
+type Observer func(name string, d time.Duration, err error)
+
+type observerCtxKey struct{}
+
+// WithObserver returns a context that reports predicate evaluations to obs.
+func WithObserver(ctx context.Context, obs Observer) context.Context {
+	return context.WithValue(ctx, observerCtxKey{}, obs)
+}
+
+// Evaluate evaluates the predicate in a tracing span and reports the
+// evaluation to the Observer in the context, if one exists.
+func Evaluate(ctx context.Context, p Predicate, prctx pull.Context) (*common.PredicateResult, error) {
+	name := Name(p)
+
+	ctx, span := common.StartSpan(ctx, "predicate."+name)
+	start := time.Now()
+
+	restore := pull.BindContext(prctx, ctx)
+	res, err := p.Evaluate(ctx, prctx)
+	restore()
+	if res != nil {
+		span.SetAttributes(attribute.Bool("policybot.satisfied", res.Satisfied))
+	}
+	common.EndSpan(span, err)
+
+	if obs, ok := ctx.Value(observerCtxKey{}).(Observer); ok {
+		obs(name, time.Since(start), err)
+	}
+	return res, err
+}
+
+// Name returns the name used for the predicate in policy files.
+func Name(p Predicate) string {
+	t := reflect.TypeOf(p)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var b strings.Builder
+	for i, r := range t.Name() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
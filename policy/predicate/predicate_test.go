@@ -15,12 +15,34 @@
 package predicate
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull/pulltest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func TestName(t *testing.T) {
+	assert.Equal(t, "has_valid_signatures_by_keys", Name(&HasValidSignaturesByKeys{}))
+	assert.Equal(t, "title", Name(Title{}))
+}
+
+func TestEvaluateObserver(t *testing.T) {
+	var names []string
+	ctx := WithObserver(context.Background(), func(name string, d time.Duration, err error) {
+		names = append(names, name)
+	})
+
+	p := &HasAuthorIn{}
+	_, err := Evaluate(ctx, p, &pulltest.Context{AuthorValue: "mhaypenny"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"has_author_in"}, names)
+}
+
 func assertPredicateResult(t *testing.T, expected, actual *common.PredicateResult) {
 	assert.Equal(t, expected.Satisfied, actual.Satisfied, "predicate was not correct")
 	assert.Equal(t, expected.Values, actual.Values, "values were not correct")
@@ -30,7 +30,8 @@ type Predicates struct {
 
 	HasSuccessfulStatus *HasSuccessfulStatus `yaml:"has_successful_status"`
 
-	HasLabels *HasLabels `yaml:"has_labels"`
+	HasLabels    *HasLabels    `yaml:"has_labels"`
+	NotHasLabels *NotHasLabels `yaml:"not_has_labels"`
 
 	Repository *Repository `yaml:"repository"`
 	Title      *Title      `yaml:"title"`
@@ -81,6 +82,9 @@ func (p *Predicates) Predicates() []Predicate {
 	if p.HasLabels != nil {
 		ps = append(ps, Predicate(p.HasLabels))
 	}
+	if p.NotHasLabels != nil {
+		ps = append(ps, Predicate(p.NotHasLabels))
+	}
 
 	if p.Repository != nil {
 		ps = append(ps, Predicate(p.Repository))
@@ -0,0 +1,327 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema generates a JSON Schema for policy files from the Go types
+// that policy files are parsed into.
+//
+// Most of the schema comes from the structure and YAML tags of the types.
+// Types that implement custom parsing, like regular expressions and
+// permissions, have hand-written schemas in customTypes.
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Draft is the version of JSON Schema used by the generated schema.
+	Draft = "https://json-schema.org/draft/2020-12/schema"
+
+	remoteRefDef = "RemoteRef"
+)
+
+// Schema is a JSON Schema. Only the keywords used by the generated schema
+// are supported.
+type Schema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type    string        `json:"type,omitempty"`
+	Enum    []interface{} `json:"enum,omitempty"`
+	Format  string        `json:"format,omitempty"`
+	Pattern string        `json:"pattern,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+
+	OneOf []*Schema `json:"oneOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+
+	Defs map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// customTypes contains schemas for types that implement custom parsing. The
+// generator does not inspect the fields of these types, but custom schemas
+// may call the generator for the type itself.
+var customTypes map[reflect.Type]func(g *generator, t reflect.Type) (*Schema, error)
+
+func init() {
+	customTypes = map[reflect.Type]func(g *generator, t reflect.Type) (*Schema, error){
+		reflect.TypeOf(common.Regexp{}): func(g *generator, t reflect.Type) (*Schema, error) {
+			// Go regular expressions are not valid ECMA 262 regular expressions,
+			// which is what the "regex" format requires
+			return &Schema{Type: "string", Description: "A regular expression in Go (RE2) syntax."}, nil
+		},
+		reflect.TypeOf(predicate.ComparisonExpr{}): func(g *generator, t reflect.Type) (*Schema, error) {
+			return &Schema{
+				Type:        "string",
+				Description: `A comparison with an integer, like "< 100" or "> 10".`,
+				Pattern:     `^\s*([<>=]\s*-?[0-9]+)?\s*$`,
+			}, nil
+		},
+		reflect.TypeOf(pull.Permission(0)): func(g *generator, t reflect.Type) (*Schema, error) {
+			// permissions are parsed without case, which enums cannot express
+			return &Schema{
+				Type: "string",
+				Pattern: caseInsensitivePattern(
+					pull.PermissionAdmin.String(),
+					pull.PermissionMaintain.String(),
+					pull.PermissionWrite.String(),
+					pull.PermissionTriage.String(),
+					pull.PermissionRead.String(),
+				),
+			}, nil
+		},
+		reflect.TypeOf(common.RequestMode("")): func(g *generator, t reflect.Type) (*Schema, error) {
+			return &Schema{
+				Type: "string",
+				Enum: []interface{}{
+					string(common.RequestModeAllUsers),
+					string(common.RequestModeRandomUsers),
+					string(common.RequestModeTeams),
+				},
+			}, nil
+		},
+		reflect.TypeOf(approval.Policy{}): func(g *generator, t reflect.Type) (*Schema, error) {
+			const item = "approval.PolicyItem"
+			conjunction := func(op string) *Schema {
+				return &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						op: {Type: "array", Items: ref(item), MinItems: intPtr(1)},
+					},
+					Required:             []string{op},
+					AdditionalProperties: boolPtr(false),
+				}
+			}
+			g.defs[item] = &Schema{
+				Description: `The name of a rule or an "and" or "or" of other items.`,
+				OneOf:       []*Schema{{Type: "string"}, conjunction("and"), conjunction("or")},
+			}
+			return &Schema{Type: "array", Items: ref(item)}, nil
+		},
+		reflect.TypeOf(predicate.HasLabels{}):    labelsSchema,
+		reflect.TypeOf(predicate.NotHasLabels{}): labelsSchema,
+	}
+}
+
+// caseInsensitivePattern returns a pattern that matches any of the values,
+// ignoring case. Patterns cannot set flags, so each letter is a class of its
+// lower and upper case forms.
+func caseInsensitivePattern(values ...string) string {
+	alternatives := make([]string, len(values))
+	for i, v := range values {
+		var b strings.Builder
+		for _, r := range v {
+			lower, upper := unicode.ToLower(r), unicode.ToUpper(r)
+			if lower == upper {
+				b.WriteRune(r)
+			} else {
+				b.WriteString("[" + string(lower) + string(upper) + "]")
+			}
+		}
+		alternatives[i] = b.String()
+	}
+	return "^(" + strings.Join(alternatives, "|") + ")$"
+}
+
+// labelsSchema allows the full and the short form of the label predicates.
+func labelsSchema(g *generator, t reflect.Type) (*Schema, error) {
+	full, err := g.structSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{
+		OneOf: []*Schema{
+			{Type: "array", Items: &Schema{Type: "string"}},
+			full,
+		},
+	}, nil
+}
+
+// Generate returns the schema for policy files. The schema accepts both
+// policies and references to remote policies.
+func Generate() (*Schema, error) {
+	g := &generator{defs: make(map[string]*Schema)}
+
+	config, err := g.schema(reflect.TypeOf(policy.Config{}))
+	if err != nil {
+		return nil, err
+	}
+
+	g.defs[remoteRefDef] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"remote": {Type: "string", Description: `The repository with the policy, in "owner/repo" format.`},
+			"path":   {Type: "string", Description: "The path to the policy in the repository."},
+			"ref":    {Type: "string", Description: "The branch, tag, or commit with the policy."},
+		},
+		Required:             []string{"remote"},
+		AdditionalProperties: boolPtr(false),
+	}
+
+	return &Schema{
+		Schema: Draft,
+		Title:  "policy-bot policy file",
+		AnyOf:  []*Schema{config, ref(remoteRefDef)},
+		Defs:   g.defs,
+	}, nil
+}
+
+type generator struct {
+	defs map[string]*Schema
+}
+
+func (g *generator) schema(t reflect.Type) (*Schema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if custom, ok := customTypes[t]; ok {
+		return g.define(t, func() (*Schema, error) {
+			return custom(g, t)
+		})
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Slice:
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Struct:
+		return g.define(t, func() (*Schema, error) {
+			return g.structSchema(t)
+		})
+	}
+	return nil, errors.Errorf("unsupported type %s", t)
+}
+
+// define adds the schema for a named type to the definitions and returns a
+// reference to it. Types are only generated once.
+func (g *generator) define(t reflect.Type, fn func() (*Schema, error)) (*Schema, error) {
+	name := t.String()
+	if t.Name() == "" {
+		return fn()
+	}
+	if _, ok := g.defs[name]; !ok {
+		// reserve the name to support recursive types
+		g.defs[name] = nil
+		s, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		g.defs[name] = s
+	}
+	return ref(name), nil
+}
+
+// structSchema returns the schema for the fields of a struct. Policy files
+// are parsed strictly, so the schema does not allow unknown properties.
+func (g *generator) structSchema(t reflect.Type) (*Schema, error) {
+	s := &Schema{
+		Type:                 "object",
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: boolPtr(false),
+	}
+	if err := g.addFields(s, t); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (g *generator) addFields(s *Schema, t reflect.Type) error {
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || len(f.Index) > 1 {
+			continue
+		}
+
+		name, inline := FieldName(f)
+		switch {
+		case name == "-":
+			continue
+		case inline:
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if err := g.addFields(s, ft); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fs, err := g.schema(f.Type)
+		if err != nil {
+			return errors.Wrapf(err, "field %s.%s", t, f.Name)
+		}
+		s.Properties[name] = fs
+	}
+	return nil
+}
+
+// FieldName returns the name of a struct field in a policy file and whether
+// the fields of the field are inlined in the parent.
+func FieldName(f reflect.StructField) (string, bool) {
+	tag, ok := f.Tag.Lookup("yaml")
+	if !ok {
+		return strings.ToLower(f.Name), false
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "inline" {
+			return name, true
+		}
+	}
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name, false
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/$defs/" + name}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func intPtr(i int) *int {
+	return &i
+}
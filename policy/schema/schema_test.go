@@ -0,0 +1,242 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// TestGenerateCoversFields fails if a field or type that can appear in a
+// policy file is missing from the schema. Types with custom parsing must
+// have a schema in customTypes.
+func TestGenerateCoversFields(t *testing.T) {
+	s, err := Generate()
+	require.NoError(t, err)
+
+	seen := make(map[reflect.Type]bool)
+
+	var walk func(t reflect.Type)
+	walk = func(typ reflect.Type) {
+		for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+			typ = typ.Elem()
+		}
+		if seen[typ] {
+			return
+		}
+		seen[typ] = true
+
+		if _, ok := customTypes[typ]; ok {
+			return
+		}
+		ptr := reflect.PointerTo(typ)
+		if ptr.Implements(yamlUnmarshalerType) || ptr.Implements(textUnmarshalerType) {
+			t.Errorf("type %s has custom parsing but no schema in customTypes", typ)
+			return
+		}
+		if typ.Kind() != reflect.Struct {
+			return
+		}
+
+		def := s.Defs[typ.String()]
+		if !assert.NotNil(t, def, "type %s has no schema definition", typ) {
+			return
+		}
+
+		var checkFields func(typ reflect.Type)
+		checkFields = func(typ reflect.Type) {
+			for i := 0; i < typ.NumField(); i++ {
+				f := typ.Field(i)
+				if !f.IsExported() {
+					continue
+				}
+
+				name, inline := FieldName(f)
+				switch {
+				case name == "-":
+					continue
+				case inline:
+					checkFields(f.Type)
+				default:
+					assert.Contains(t, def.Properties, name, "field %s.%s is not in the schema", typ, f.Name)
+				}
+				walk(f.Type)
+			}
+		}
+		checkFields(typ)
+	}
+	walk(reflect.TypeOf(policy.Config{}))
+}
+
+func TestSchemaValidatesPolicies(t *testing.T) {
+	schema := compileSchema(t)
+
+	files, err := filepath.Glob("../../config/policy-examples/*.yml")
+	require.NoError(t, err)
+	files = append(files, "../../.policy.yml")
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			b, err := os.ReadFile(file)
+			require.NoError(t, err)
+
+			assert.NoError(t, schema.Validate(yamlToJSON(t, b)))
+		})
+	}
+
+	valid := map[string]string{
+		"remoteReference": `
+remote: org/repo
+path: policy.yml
+ref: develop
+`,
+		"labelsShortForm": `
+approval_rules:
+  - name: labels
+    if:
+      has_labels: ["a", "b"]
+      not_has_labels:
+        patterns: ["^wip"]
+      modified_lines:
+        additions: "> 100"
+`,
+		"goRegexpAndPermissionCase": `
+approval_rules:
+  - name: rule
+    if:
+      title:
+        matches: ["(?i)^fix"]
+    requires:
+      permissions: ["Write"]
+`,
+		"nestedPolicy": `
+policy:
+  approval:
+    - a
+    - or:
+      - b
+      - and:
+        - c
+        - d
+  override:
+    requires:
+      permissions: ["maintain"]
+`,
+	}
+	for name, p := range valid {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, schema.Validate(yamlToJSON(t, []byte(p))))
+		})
+	}
+
+	invalid := map[string]string{
+		"unknownField": `
+approval_rules:
+  - name: rule
+    requires:
+      count: 1
+      user: ["alice"]
+`,
+		"invalidPermission": `
+approval_rules:
+  - name: rule
+    requires:
+      permissions: ["owner"]
+`,
+		"invalidComparison": `
+approval_rules:
+  - name: rule
+    if:
+      modified_lines:
+        total: "100"
+`,
+		"invalidConjunction": `
+policy:
+  approval:
+    - xor:
+      - a
+      - b
+`,
+	}
+	for name, p := range invalid {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, schema.Validate(yamlToJSON(t, []byte(p))))
+		})
+	}
+}
+
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	s, err := Generate()
+	require.NoError(t, err)
+
+	b, err := json.Marshal(s)
+	require.NoError(t, err)
+
+	c := jsonschema.NewCompiler()
+	c.AssertFormat = true
+	require.NoError(t, c.AddResource("policy.json", bytes.NewReader(b)))
+
+	schema, err := c.Compile("policy.json")
+	require.NoError(t, err)
+	return schema
+}
+
+// yamlToJSON converts YAML to the values produced by decoding JSON, which
+// is what the validator expects.
+func yamlToJSON(t *testing.T, b []byte) interface{} {
+	var v interface{}
+	require.NoError(t, yaml.Unmarshal(b, &v))
+
+	var convert func(v interface{}) interface{}
+	convert = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case map[interface{}]interface{}:
+			m := make(map[string]interface{}, len(v))
+			for k, val := range v {
+				m[fmt.Sprint(k)] = convert(val)
+			}
+			return m
+		case []interface{}:
+			for i := range v {
+				v[i] = convert(v[i])
+			}
+			return v
+		case int:
+			return json.Number(fmt.Sprint(v))
+		case float64:
+			return json.Number(fmt.Sprint(v))
+		}
+		return v
+	}
+	return convert(v)
+}
@@ -16,6 +16,7 @@ package simulated
 
 import (
 	"context"
+	"time"
 
 	"github.com/palantir/policy-bot/pull"
 )
@@ -27,7 +28,19 @@ type Context struct {
 }
 
 func NewContext(ctx context.Context, pullContext pull.Context, options Options) *Context {
-	return &Context{Context: pullContext, options: options}
+	return &Context{Context: pullContext, ctx: ctx, options: options}
+}
+
+// BindContext uses ctx for requests made by this context and the wrapped
+// context until the returned function is called.
+func (c *Context) BindContext(ctx context.Context) func() {
+	prev := c.ctx
+	c.ctx = ctx
+	restore := pull.BindContext(c.Context, ctx)
+	return func() {
+		c.ctx = prev
+		restore()
+	}
 }
 
 func (c *Context) Comments() ([]*pull.Comment, error) {
@@ -130,3 +143,142 @@ func (c *Context) Branches() (string, string) {
 
 	return base, head
 }
+
+func (c *Context) Title() string {
+	if c.options.Title != nil {
+		return *c.options.Title
+	}
+
+	return c.Context.Title()
+}
+
+func (c *Context) Body() (*pull.Body, error) {
+	body, err := c.Context.Body()
+	if err != nil || c.options.Body == nil {
+		return body, err
+	}
+
+	simulated := pull.Body{LastEditedAt: c.EvaluationTimestamp()}
+	if body != nil {
+		simulated = *body
+		simulated.LastEditedAt = c.EvaluationTimestamp()
+	}
+	simulated.Body = *c.options.Body
+	return &simulated, nil
+}
+
+func (c *Context) Author() string {
+	if c.options.Author != "" {
+		return c.options.Author
+	}
+
+	return c.Context.Author()
+}
+
+func (c *Context) IsDraft() bool {
+	if c.options.Draft != nil {
+		return *c.options.Draft
+	}
+
+	return c.Context.IsDraft()
+}
+
+func (c *Context) Labels() ([]string, error) {
+	labels, err := c.Context.Labels()
+	if err != nil {
+		return nil, err
+	}
+
+	var simulated []string
+	for _, label := range labels {
+		if !c.isRemovedLabel(label) {
+			simulated = append(simulated, label)
+		}
+	}
+
+	for _, label := range c.options.AddLabels {
+		if !contains(simulated, label) {
+			simulated = append(simulated, label)
+		}
+	}
+
+	return simulated, nil
+}
+
+func (c *Context) LabelActors() (map[string]string, error) {
+	actors, err := c.Context.LabelActors()
+	if err != nil || len(c.options.RemoveLabels) == 0 {
+		return actors, err
+	}
+
+	simulated := make(map[string]string, len(actors))
+	for label, actor := range actors {
+		if !c.isRemovedLabel(label) {
+			simulated[label] = actor
+		}
+	}
+	return simulated, nil
+}
+
+func (c *Context) isRemovedLabel(label string) bool {
+	return contains(c.options.RemoveLabels, label) && !contains(c.options.AddLabels, label)
+}
+
+func (c *Context) ChangedFiles() ([]*pull.File, error) {
+	if c.options.ChangedFiles == nil {
+		return c.Context.ChangedFiles()
+	}
+
+	files := make([]*pull.File, len(c.options.ChangedFiles))
+	for i, file := range c.options.ChangedFiles {
+		files[i] = file.toPullFile()
+	}
+	return files, nil
+}
+
+func (c *Context) Commits() ([]*pull.Commit, error) {
+	if c.options.Commits == nil {
+		return c.Context.Commits()
+	}
+
+	commits := make([]*pull.Commit, len(c.options.Commits))
+	for i, commit := range c.options.Commits {
+		commits[i] = commit.toPullCommit()
+	}
+	return commits, nil
+}
+
+func (c *Context) PushedAt(sha string) (time.Time, error) {
+	for _, commit := range c.options.Commits {
+		if commit.SHA == sha && commit.PushedAt != nil {
+			return *commit.PushedAt, nil
+		}
+	}
+
+	return c.Context.PushedAt(sha)
+}
+
+func (c *Context) LatestStatuses() (map[string]string, error) {
+	statuses, err := c.Context.LatestStatuses()
+	if err != nil || len(c.options.Statuses) == 0 {
+		return statuses, err
+	}
+
+	simulated := make(map[string]string, len(statuses)+len(c.options.Statuses))
+	for name, status := range statuses {
+		simulated[name] = status
+	}
+	for name, status := range c.options.Statuses {
+		simulated[name] = status
+	}
+	return simulated, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -15,8 +15,10 @@
 package simulated
 
 import (
+	"context"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
@@ -340,3 +342,206 @@ func TestBranches(t *testing.T) {
 		assert.Equal(t, test.ExpectedHead, head, message)
 	}
 }
+
+func TestLabels(t *testing.T) {
+	tests := map[string]struct {
+		Labels         []string
+		Options        Options
+		ExpectedLabels []string
+		ExpectedActors map[string]string
+	}{
+		"use default labels": {
+			Labels:         []string{"bug", "hotfix"},
+			ExpectedLabels: []string{"bug", "hotfix"},
+			ExpectedActors: map[string]string{"bug": "mhaypenny", "hotfix": "ttest"},
+		},
+		"add labels": {
+			Labels: []string{"bug"},
+			Options: Options{
+				AddLabels: []string{"Hotfix", "bug"},
+			},
+			ExpectedLabels: []string{"bug", "hotfix"},
+			ExpectedActors: map[string]string{"bug": "mhaypenny", "hotfix": "ttest"},
+		},
+		"remove labels": {
+			Labels: []string{"bug", "hotfix"},
+			Options: Options{
+				RemoveLabels: []string{"HOTFIX"},
+			},
+			ExpectedLabels: []string{"bug"},
+			ExpectedActors: map[string]string{"bug": "mhaypenny"},
+		},
+		"add takes precedence over remove": {
+			Labels: []string{"bug"},
+			Options: Options{
+				AddLabels:    []string{"hotfix"},
+				RemoveLabels: []string{"hotfix", "bug"},
+			},
+			ExpectedLabels: []string{"hotfix"},
+			ExpectedActors: map[string]string{"hotfix": "ttest"},
+		},
+	}
+
+	for message, test := range tests {
+		test.Options.setDefaults()
+		simCtx := Context{
+			Context: &pulltest.Context{
+				LabelsValue:      test.Labels,
+				LabelActorsValue: map[string]string{"bug": "mhaypenny", "hotfix": "ttest"},
+			},
+			options: test.Options,
+		}
+
+		labels, err := simCtx.Labels()
+		require.NoError(t, err, message)
+		sort.Strings(labels)
+		assert.Equal(t, test.ExpectedLabels, labels, message)
+
+		actors, err := simCtx.LabelActors()
+		require.NoError(t, err, message)
+		for label := range actors {
+			if !contains(labels, label) {
+				delete(actors, label)
+			}
+		}
+		assert.Equal(t, test.ExpectedActors, actors, message)
+	}
+}
+
+func TestPullRequestOverrides(t *testing.T) {
+	prctx := &pulltest.Context{
+		TitleValue:  "Fix bug",
+		AuthorValue: "mhaypenny",
+		BodyValue: &pull.Body{
+			Body:   "The body",
+			Author: "mhaypenny",
+		},
+		Draft: true,
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		simCtx := NewContext(context.Background(), prctx, Options{})
+
+		body, err := simCtx.Body()
+		require.NoError(t, err)
+
+		assert.Equal(t, "Fix bug", simCtx.Title())
+		assert.Equal(t, "mhaypenny", simCtx.Author())
+		assert.Equal(t, "The body", body.Body)
+		assert.True(t, simCtx.IsDraft())
+	})
+
+	t.Run("simulated", func(t *testing.T) {
+		title, bodyText, draft := "hotfix: fix bug", "Simulated body", false
+		simCtx := NewContext(context.Background(), prctx, Options{
+			Title:  &title,
+			Body:   &bodyText,
+			Author: "ttest",
+			Draft:  &draft,
+		})
+
+		body, err := simCtx.Body()
+		require.NoError(t, err)
+
+		assert.Equal(t, "hotfix: fix bug", simCtx.Title())
+		assert.Equal(t, "ttest", simCtx.Author())
+		assert.Equal(t, "Simulated body", body.Body)
+		assert.Equal(t, "mhaypenny", body.Author)
+		assert.False(t, simCtx.IsDraft())
+		assert.Equal(t, "The body", prctx.BodyValue.Body, "simulated body modified the original body")
+	})
+}
+
+func TestChangedFilesAndCommits(t *testing.T) {
+	pushedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	prctx := &pulltest.Context{
+		ChangedFilesValue: []*pull.File{
+			{Filename: "app.go", Status: pull.FileModified},
+		},
+		CommitsValue: []*pull.Commit{
+			{SHA: "abc123", Author: "mhaypenny"},
+		},
+		PushedAtValue: map[string]time.Time{
+			"abc123": pushedAt.Add(-time.Hour),
+		},
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		simCtx := NewContext(context.Background(), prctx, Options{})
+
+		files, err := simCtx.ChangedFiles()
+		require.NoError(t, err)
+		assert.Equal(t, prctx.ChangedFilesValue, files)
+
+		commits, err := simCtx.Commits()
+		require.NoError(t, err)
+		assert.Equal(t, prctx.CommitsValue, commits)
+	})
+
+	t.Run("simulated", func(t *testing.T) {
+		options := Options{
+			ChangedFiles: []File{
+				{Filename: "docs/index.md", Status: "added", Additions: 10},
+				{Filename: "old.go", Status: "deleted", Deletions: 5},
+			},
+			Commits: []Commit{
+				{SHA: "def456", Author: "ttest", PushedAt: &pushedAt},
+				{Author: "ttest", Committer: "web-flow", CommittedViaWeb: true},
+			},
+		}
+		options.setDefaults()
+		simCtx := NewContext(context.Background(), prctx, options)
+
+		files, err := simCtx.ChangedFiles()
+		require.NoError(t, err)
+		assert.Equal(t, []*pull.File{
+			{Filename: "docs/index.md", Status: pull.FileAdded, Additions: 10},
+			{Filename: "old.go", Status: pull.FileDeleted, Deletions: 5},
+		}, files)
+
+		commits, err := simCtx.Commits()
+		require.NoError(t, err)
+		require.Len(t, commits, 2)
+		assert.Equal(t, "def456", commits[0].SHA)
+		assert.Equal(t, "simulated-commitSHA-1", commits[1].SHA)
+		assert.True(t, commits[1].CommittedViaWeb)
+
+		simulatedPushedAt, err := simCtx.PushedAt("def456")
+		require.NoError(t, err)
+		assert.Equal(t, pushedAt, simulatedPushedAt)
+
+		defaultPushedAt, err := simCtx.PushedAt("abc123")
+		require.NoError(t, err)
+		assert.Equal(t, pushedAt.Add(-time.Hour), defaultPushedAt)
+	})
+
+	t.Run("no files", func(t *testing.T) {
+		simCtx := NewContext(context.Background(), prctx, Options{ChangedFiles: []File{}})
+
+		files, err := simCtx.ChangedFiles()
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+}
+
+func TestLatestStatuses(t *testing.T) {
+	simCtx := NewContext(context.Background(), &pulltest.Context{
+		LatestStatusesValue: map[string]string{
+			"ci/build": "failure",
+			"ci/lint":  "success",
+		},
+	}, Options{
+		Statuses: map[string]string{
+			"ci/build":  "success",
+			"ci/deploy": "pending",
+		},
+	})
+
+	statuses, err := simCtx.LatestStatuses()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"ci/build":  "success",
+		"ci/lint":   "success",
+		"ci/deploy": "pending",
+	}, statuses)
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/palantir/policy-bot/policy/common"
@@ -32,6 +33,29 @@ type Options struct {
 	AddComments    []Comment      `json:"add_comments"`
 	AddReviews     []Review       `json:"add_reviews"`
 	BaseBranch     string         `json:"base_branch"`
+
+	// Title, Body, Author, and Draft replace the corresponding properties of
+	// the pull request if they are set.
+	Title  *string `json:"title"`
+	Body   *string `json:"body"`
+	Author string  `json:"author"`
+	Draft  *bool   `json:"draft"`
+
+	AddLabels    []string `json:"add_labels"`
+	RemoveLabels []string `json:"remove_labels"`
+
+	// ChangedFiles and Commits replace the files and commits of the pull
+	// request if they are non-nil, including if they are empty.
+	ChangedFiles []File   `json:"changed_files"`
+	Commits      []Commit `json:"commits"`
+
+	// Statuses sets the latest status of each context, overriding any
+	// existing status for the same context.
+	Statuses map[string]string `json:"statuses"`
+
+	// Policy is a policy document to evaluate instead of the policy file from
+	// the base branch. If an enforced policy is configured, it still applies.
+	Policy string `json:"policy"`
 }
 
 func NewOptionsFromRequest(r *http.Request) (Options, error) {
@@ -44,10 +68,26 @@ func NewOptionsFromRequest(r *http.Request) (Options, error) {
 		return o, errors.Wrap(err, "failed to unmarshal body into options")
 	}
 
+	if err := o.validate(); err != nil {
+		return o, err
+	}
+
 	o.setDefaults()
 	return o, nil
 }
 
+func (o *Options) validate() error {
+	for _, f := range o.ChangedFiles {
+		if f.Filename == "" {
+			return errors.New("changed files must have a filename")
+		}
+		if _, ok := fileStatuses[f.Status]; !ok {
+			return errors.Errorf("invalid status %q for changed file %s", f.Status, f.Filename)
+		}
+	}
+	return nil
+}
+
 // setDefaults sets any values for the options that were not intentionally set in the request body but which should have
 // consistent values for the length of the simulation, such as the created time for a comment or review.
 func (o *Options) setDefaults() {
@@ -63,6 +103,18 @@ func (o *Options) setDefaults() {
 		comment.setDefaults()
 		o.AddComments[i] = comment
 	}
+
+	for i, commit := range o.Commits {
+		commit.setDefaults(fmt.Sprintf("simulated-commitSHA-%d", i))
+		o.Commits[i] = commit
+	}
+
+	for i, label := range o.AddLabels {
+		o.AddLabels[i] = strings.ToLower(label)
+	}
+	for i, label := range o.RemoveLabels {
+		o.RemoveLabels[i] = strings.ToLower(label)
+	}
 }
 
 type Comment struct {
@@ -131,3 +183,57 @@ func (r *Review) toPullReview() *pull.Review {
 		Teams:        r.Teams,
 	}
 }
+
+var fileStatuses = map[string]pull.FileStatus{
+	"":         pull.FileModified,
+	"modified": pull.FileModified,
+	"added":    pull.FileAdded,
+	"deleted":  pull.FileDeleted,
+}
+
+type File struct {
+	Filename  string `json:"filename"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+func (f *File) toPullFile() *pull.File {
+	return &pull.File{
+		Filename:  f.Filename,
+		Status:    fileStatuses[f.Status],
+		Additions: f.Additions,
+		Deletions: f.Deletions,
+	}
+}
+
+type Commit struct {
+	SHA             string     `json:"sha"`
+	Parents         []string   `json:"parents"`
+	Author          string     `json:"author"`
+	Committer       string     `json:"committer"`
+	CommittedViaWeb bool       `json:"committed_via_web"`
+	PushedAt        *time.Time `json:"pushed_at"`
+}
+
+// setDefaults sets the SHA to sha and the pushedAt value to time.Now() if they are otherwise unset
+func (c *Commit) setDefaults(sha string) {
+	if c.SHA == "" {
+		c.SHA = sha
+	}
+
+	if c.PushedAt == nil {
+		now := time.Now()
+		c.PushedAt = &now
+	}
+}
+
+func (c *Commit) toPullCommit() *pull.Commit {
+	return &pull.Commit{
+		SHA:             c.SHA,
+		Parents:         c.Parents,
+		Author:          c.Author,
+		Committer:       c.Committer,
+		CommittedViaWeb: c.CommittedViaWeb,
+	}
+}
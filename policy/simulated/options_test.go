@@ -90,3 +90,58 @@ func TestOptionDefaults(t *testing.T) {
 		assert.False(t, review.LastEditedAt.IsZero())
 	}
 }
+
+func TestOptionsFromRequestOverrides(t *testing.T) {
+	body := `
+	{
+		"title":"hotfix: fix bug",
+		"body":"",
+		"author":"ttest",
+		"draft":false,
+		"add_labels":["Hotfix"],
+		"remove_labels":["WIP"],
+		"changed_files":[
+			{"filename":"docs/index.md", "status":"added", "additions":10}
+		],
+		"commits":[
+			{"sha":"abc123", "author":"ttest"}
+		],
+		"statuses":{"ci/build":"success"},
+		"policy":"policy:\n  approval:\n    - hotfix\n"
+	}`
+
+	opt, err := NewOptionsFromRequest(httptest.NewRequest(http.MethodPost, "http:", bytes.NewBuffer([]byte(body))))
+	require.NoError(t, err)
+
+	require.NotNil(t, opt.Title)
+	assert.Equal(t, "hotfix: fix bug", *opt.Title)
+	require.NotNil(t, opt.Body)
+	assert.Equal(t, "", *opt.Body)
+	assert.Equal(t, "ttest", opt.Author)
+	require.NotNil(t, opt.Draft)
+	assert.False(t, *opt.Draft)
+
+	assert.Equal(t, []string{"hotfix"}, opt.AddLabels)
+	assert.Equal(t, []string{"wip"}, opt.RemoveLabels)
+
+	assert.Equal(t, []File{{Filename: "docs/index.md", Status: "added", Additions: 10}}, opt.ChangedFiles)
+
+	require.Len(t, opt.Commits, 1)
+	assert.Equal(t, "abc123", opt.Commits[0].SHA)
+	assert.NotNil(t, opt.Commits[0].PushedAt)
+
+	assert.Equal(t, map[string]string{"ci/build": "success"}, opt.Statuses)
+	assert.Equal(t, "policy:\n  approval:\n    - hotfix\n", opt.Policy)
+
+	t.Run("invalid file status", func(t *testing.T) {
+		body := `{"changed_files":[{"filename":"app.go", "status":"renamed"}]}`
+		_, err := NewOptionsFromRequest(httptest.NewRequest(http.MethodPost, "http:", bytes.NewBuffer([]byte(body))))
+		assert.EqualError(t, err, `invalid status "renamed" for changed file app.go`)
+	})
+
+	t.Run("missing filename", func(t *testing.T) {
+		body := `{"changed_files":[{"status":"added"}]}`
+		_, err := NewOptionsFromRequest(httptest.NewRequest(http.MethodPost, "http:", bytes.NewBuffer([]byte(body))))
+		assert.EqualError(t, err, "changed files must have a filename")
+	})
+}
@@ -0,0 +1,390 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/override"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxConditionalRules is the maximum number of rules with conditions
+	// for which FindWeakenings compares the structure of approval policies.
+	// Each combination of skipped rules is compared separately.
+	maxConditionalRules = 8
+
+	// maxApprovalSets is the maximum number of sets of rules that approve an
+	// approval policy for which FindWeakenings compares its structure.
+	maxApprovalSets = 1024
+)
+
+// FindWeakenings compares two policies and returns a description of each
+// change in head that may make it less strict than base. The comparison is
+// conservative: changes that cannot be easily classified, like modifications
+// to rule predicates, are reported as weakenings. A nil head config is treated
+// as the removal of the policy.
+//
+// Changes to the structure of the approval policy are weakenings if the rules
+// that approve head do not also approve base, for example when a rule is
+// removed, an "and" becomes an "or", or a rule moves into an "or". Rules are
+// compared by name, so changes to the rules themselves are reported
+// separately. Because rules with conditions may be skipped, the structures
+// are compared for every combination of skipped rules, except those where all
+// of base is skipped, which never approves.
+func FindWeakenings(base, head *Config) []string {
+	if base == nil {
+		return nil
+	}
+	if head == nil {
+		return []string{"The policy was removed"}
+	}
+
+	var changes []string
+
+	if !reflect.DeepEqual(base.Policy.Approval, head.Policy.Approval) {
+		stricter, ok := isStricterApproval(base, head)
+		switch {
+		case !ok:
+			changes = append(changes, "The approval policy was modified")
+		case !stricter:
+			changes = append(changes, "The approval policy was modified to require fewer rules")
+		}
+	}
+
+	headRules := make(map[string]*approval.Rule)
+	for _, r := range head.ApprovalRules {
+		headRules[r.Name] = r
+	}
+	for _, r := range base.ApprovalRules {
+		if hr, ok := headRules[r.Name]; ok {
+			changes = append(changes, findRuleWeakenings(r, hr)...)
+		} else {
+			changes = append(changes, fmt.Sprintf("Rule %q was removed", r.Name))
+		}
+	}
+
+	baseDisapproval, headDisapproval := base.Policy.Disapproval, head.Policy.Disapproval
+	switch {
+	case baseDisapproval != nil && headDisapproval == nil:
+		changes = append(changes, "The disapproval policy was removed")
+	case baseDisapproval != nil && !reflect.DeepEqual(baseDisapproval, headDisapproval):
+		changes = append(changes, "The disapproval policy was modified")
+	}
+
+	changes = append(changes, findOverrideWeakenings(base.Policy.Override, head.Policy.Override)...)
+	return changes
+}
+
+func findRuleWeakenings(base, head *approval.Rule) []string {
+	var changes []string
+	addChange := func(format string, args ...interface{}) {
+		changes = append(changes, fmt.Sprintf("Rule %q ", base.Name)+fmt.Sprintf(format, args...))
+	}
+
+	if head.Requires.Count < base.Requires.Count {
+		addChange("requires fewer approvals (%d instead of %d)", head.Requires.Count, base.Requires.Count)
+	}
+	if base.Requires.Count > 0 && isWiderActors(&base.Requires.Actors, &head.Requires.Actors) {
+		addChange("allows additional approvers")
+	}
+	if !reflect.DeepEqual(base.Predicates, head.Predicates) {
+		addChange("has modified conditions")
+	}
+
+	bo, ho := base.Options, head.Options
+	if ho.AllowAuthor && !bo.AllowAuthor {
+		addChange("allows approval by the author")
+	}
+	if ho.AllowContributor && !bo.AllowContributor {
+		addChange("allows approval by contributors")
+	}
+	if ho.AllowNonAuthorContributor && !bo.AllowNonAuthorContributor {
+		addChange("allows approval by non-author contributors")
+	}
+	if bo.InvalidateOnPush && !ho.InvalidateOnPush {
+		addChange("no longer invalidates approvals on push")
+	}
+	if bo.IgnoreEditedComments && !ho.IgnoreEditedComments {
+		addChange("no longer ignores edited comments")
+	}
+	if ho.IgnoreUpdateMerges && !bo.IgnoreUpdateMerges {
+		addChange("ignores update merges")
+	}
+	if isWiderActors(&bo.IgnoreCommitsBy, &ho.IgnoreCommitsBy) {
+		addChange("ignores commits by additional users")
+	}
+	if !reflect.DeepEqual(bo.Methods, ho.Methods) {
+		addChange("has modified approval methods")
+	}
+
+	return changes
+}
+
+func findOverrideWeakenings(base, head *override.Policy) []string {
+	switch {
+	case head == nil || head.Requires.IsEmpty():
+		return nil
+	case base == nil || base.Requires.IsEmpty():
+		return []string{"An override policy was added"}
+	}
+
+	var changes []string
+	if isWiderActors(&base.Requires.Actors, &head.Requires.Actors) {
+		changes = append(changes, "The override policy allows additional users")
+	}
+	if !reflect.DeepEqual(base.Options, head.Options) {
+		changes = append(changes, "The override policy options were modified")
+	}
+	return changes
+}
+
+// isWiderActors returns true if head contains any actors that are not in
+// base. Because group membership is not known statically, adding any user,
+// team, organization, or permission is treated as widening the set.
+func isWiderActors(base, head *common.Actors) bool {
+	if base.IsEmpty() {
+		return !head.IsEmpty()
+	}
+
+	if !isSubset(base.Users, head.Users) || !isSubset(base.Teams, head.Teams) || !isSubset(base.Organizations, head.Organizations) {
+		return true
+	}
+
+	basePerms := base.GetPermissions()
+	for _, p := range head.GetPermissions() {
+		// a lower permission allows more users than any higher permission
+		if len(basePerms) == 0 || p < basePerms[len(basePerms)-1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isSubset(base, head []string) bool {
+	values := make(map[string]bool, len(base))
+	for _, v := range base {
+		values[v] = true
+	}
+	for _, v := range head {
+		if !values[v] {
+			return false
+		}
+	}
+	return true
+}
+
+// approvalExpr is the approval policy as a boolean expression of rule names.
+type approvalExpr struct {
+	// op is "and" or "or", or empty if the expression is a rule
+	op       string
+	rule     string
+	children []*approvalExpr
+}
+
+// isStricterApproval returns true if every set of rules that approves the
+// approval policy of head also approves the approval policy of base. If the
+// policies are too complex to compare or cannot be parsed, ok is false.
+func isStricterApproval(base, head *Config) (stricter bool, ok bool) {
+	baseExpr, err := parseApprovalExpr(base)
+	if err != nil {
+		return false, false
+	}
+	headExpr, err := parseApprovalExpr(head)
+	if err != nil {
+		return false, false
+	}
+
+	conditional := make(map[string]bool)
+	for _, c := range []*Config{base, head} {
+		for _, r := range c.ApprovalRules {
+			if len(r.Predicates.Predicates()) > 0 {
+				conditional[r.Name] = true
+			}
+		}
+	}
+
+	var skippable []string
+	for _, e := range []*approvalExpr{baseExpr, headExpr} {
+		e.walk(func(e *approvalExpr) {
+			if e.op == "" && conditional[e.rule] && !slices.Contains(skippable, e.rule) {
+				skippable = append(skippable, e.rule)
+			}
+		})
+	}
+	if len(skippable) > maxConditionalRules {
+		return false, false
+	}
+
+	for mask := 0; mask < 1<<len(skippable); mask++ {
+		skipped := make(map[string]bool)
+		for i, r := range skippable {
+			if mask&(1<<i) != 0 {
+				skipped[r] = true
+			}
+		}
+
+		b, h := baseExpr.without(skipped), headExpr.without(skipped)
+		if b == nil || h == nil {
+			// a policy where every rule is skipped never approves
+			continue
+		}
+
+		sets, ok := h.approvalSets()
+		if !ok {
+			return false, false
+		}
+		for _, set := range sets {
+			if !b.approvedBy(set) {
+				return false, true
+			}
+		}
+	}
+	return true, true
+}
+
+// parseApprovalExpr returns the approval policy of the config or nil if the
+// approval policy is empty.
+func parseApprovalExpr(c *Config) (*approvalExpr, error) {
+	rules := make(map[string]*approval.Rule)
+	for _, r := range c.ApprovalRules {
+		rules[r.Name] = r
+	}
+
+	root, err := c.Policy.Approval.ParseRequirements(rules)
+	if err != nil || root == nil {
+		return nil, err
+	}
+	return newApprovalExpr(root)
+}
+
+func newApprovalExpr(req common.Evaluator) (*approvalExpr, error) {
+	var e approvalExpr
+	var children []common.Evaluator
+
+	switch req := req.(type) {
+	case *approval.AndRequirement:
+		e.op = "and"
+		children = req.Requirements()
+	case *approval.OrRequirement:
+		e.op = "or"
+		children = req.Requirements()
+	case *approval.RuleRequirement:
+		e.rule = req.Rule().Name
+	default:
+		return nil, errors.Errorf("unknown requirement type %T", req)
+	}
+
+	for _, c := range children {
+		ce, err := newApprovalExpr(c)
+		if err != nil {
+			return nil, err
+		}
+		e.children = append(e.children, ce)
+	}
+	return &e, nil
+}
+
+func (e *approvalExpr) walk(fn func(*approvalExpr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	for _, c := range e.children {
+		c.walk(fn)
+	}
+}
+
+// without returns the expression without the skipped rules. Like evaluation,
+// it ignores skipped children of "and" and "or" and returns nil if every rule
+// in the expression is skipped.
+func (e *approvalExpr) without(skipped map[string]bool) *approvalExpr {
+	if e == nil || (e.op == "" && skipped[e.rule]) {
+		return nil
+	}
+	if e.op == "" {
+		return e
+	}
+
+	var children []*approvalExpr
+	for _, c := range e.children {
+		if c := c.without(skipped); c != nil {
+			children = append(children, c)
+		}
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	return &approvalExpr{op: e.op, children: children}
+}
+
+// approvalSets returns the sets of rules that approve the expression. Every
+// set of rules that approves the expression contains at least one of these
+// sets. If there are too many sets, ok is false.
+func (e *approvalExpr) approvalSets() (sets []map[string]bool, ok bool) {
+	switch e.op {
+	case "":
+		return []map[string]bool{{e.rule: true}}, true
+
+	case "or":
+		for _, c := range e.children {
+			childSets, ok := c.approvalSets()
+			if !ok || len(sets)+len(childSets) > maxApprovalSets {
+				return nil, false
+			}
+			sets = append(sets, childSets...)
+		}
+		return sets, true
+
+	default:
+		sets = []map[string]bool{{}}
+		for _, c := range e.children {
+			childSets, ok := c.approvalSets()
+			if !ok || len(sets)*len(childSets) > maxApprovalSets {
+				return nil, false
+			}
+
+			var combined []map[string]bool
+			for _, s := range sets {
+				for _, cs := range childSets {
+					set := maps.Clone(s)
+					maps.Copy(set, cs)
+					combined = append(combined, set)
+				}
+			}
+			sets = combined
+		}
+		return sets, true
+	}
+}
+
+// approvedBy returns true if the approval of the rules in the set approves
+// the expression.
+func (e *approvalExpr) approvedBy(set map[string]bool) bool {
+	switch e.op {
+	case "":
+		return set[e.rule]
+	case "or":
+		return slices.ContainsFunc(e.children, func(c *approvalExpr) bool { return c.approvedBy(set) })
+	default:
+		return !slices.ContainsFunc(e.children, func(c *approvalExpr) bool { return !c.approvedBy(set) })
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const basePolicy = `
+policy:
+  approval:
+    - or:
+      - the docs rule
+      - the review rule
+  disapproval:
+    requires:
+      teams: ["org/security"]
+approval_rules:
+  - name: the docs rule
+    if:
+      only_changed_files:
+        paths: ["^docs/"]
+    requires:
+      count: 1
+      permissions: ["write"]
+  - name: the review rule
+    options:
+      invalidate_on_push: true
+    requires:
+      count: 2
+      teams: ["org/reviewers"]
+      permissions: ["admin"]
+`
+
+func TestFindWeakenings(t *testing.T) {
+	tests := map[string]struct {
+		Head    string
+		Changes []string
+	}{
+		"unchanged": {
+			Head: basePolicy,
+		},
+		"stricter": {
+			Head: `
+policy:
+  approval:
+    - or:
+      - the docs rule
+      - the review rule
+  disapproval:
+    requires:
+      teams: ["org/security"]
+approval_rules:
+  - name: the docs rule
+    if:
+      only_changed_files:
+        paths: ["^docs/"]
+    requires:
+      count: 2
+      permissions: ["admin"]
+  - name: the review rule
+    options:
+      invalidate_on_push: true
+    requires:
+      count: 3
+      teams: ["org/reviewers"]
+  - name: an unused rule
+    requires:
+      count: 1
+`,
+		},
+		"weaker": {
+			Head: `
+policy:
+  approval:
+    - or:
+      - the review rule
+  override:
+    requires:
+      users: ["mhaypenny"]
+approval_rules:
+  - name: the review rule
+    options:
+      allow_author: true
+    requires:
+      count: 1
+      teams: ["org/reviewers", "org/everyone"]
+      permissions: ["write"]
+`,
+			Changes: []string{
+				`Rule "the docs rule" was removed`,
+				`Rule "the review rule" requires fewer approvals (1 instead of 2)`,
+				`Rule "the review rule" allows additional approvers`,
+				`Rule "the review rule" allows approval by the author`,
+				`Rule "the review rule" no longer invalidates approvals on push`,
+				"The disapproval policy was removed",
+				"An override policy was added",
+			},
+		},
+		"modifiedConditions": {
+			Head: `
+policy:
+  approval:
+    - or:
+      - the docs rule
+      - the review rule
+  disapproval:
+    requires:
+      teams: ["org/security"]
+approval_rules:
+  - name: the docs rule
+    if:
+      only_changed_files:
+        paths: ["^docs/", "^src/"]
+    requires:
+      count: 1
+      permissions: ["write"]
+  - name: the review rule
+    options:
+      invalidate_on_push: true
+    requires:
+      count: 2
+      teams: ["org/reviewers"]
+      permissions: ["admin"]
+`,
+			Changes: []string{
+				`Rule "the docs rule" has modified conditions`,
+			},
+		},
+	}
+
+	base := parseConfig(t, basePolicy)
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			changes := FindWeakenings(base, parseConfig(t, test.Head))
+			assert.Equal(t, test.Changes, changes)
+		})
+	}
+
+	t.Run("removed", func(t *testing.T) {
+		assert.Equal(t, []string{"The policy was removed"}, FindWeakenings(base, nil))
+	})
+}
+
+func TestFindApprovalWeakenings(t *testing.T) {
+	const rules = `
+approval_rules:
+  - name: a
+  - name: b
+  - name: c
+  - name: conditional
+    if:
+      has_labels: ["x"]
+`
+
+	tests := map[string]struct {
+		Base   string
+		Head   string
+		Weaker bool
+	}{
+		"addRuleToAnd": {
+			Base: "[a, b]",
+			Head: "[a, b, c]",
+		},
+		"orToAnd": {
+			Base: "[or: [a, b]]",
+			Head: "[and: [a, b]]",
+		},
+		"removeRuleFromOr": {
+			Base: "[or: [a, b, c]]",
+			Head: "[or: [a, b]]",
+		},
+		"reorder": {
+			Base: "[a, or: [b, c]]",
+			Head: "[or: [c, b], a]",
+		},
+		"addRuleUnderAndToConditional": {
+			Base: "[conditional]",
+			Head: "[conditional, a]",
+		},
+		"removeRuleFromAnd": {
+			Base:   "[a, b]",
+			Head:   "[a]",
+			Weaker: true,
+		},
+		"andToOr": {
+			Base:   "[and: [a, b]]",
+			Head:   "[or: [a, b]]",
+			Weaker: true,
+		},
+		"moveRuleUnderOr": {
+			Base:   "[a, b]",
+			Head:   "[a, or: [b, c]]",
+			Weaker: true,
+		},
+		"replaceRule": {
+			Base:   "[a]",
+			Head:   "[b]",
+			Weaker: true,
+		},
+		"skippedRuleReplacesOr": {
+			Base:   "[a, or: [conditional, b]]",
+			Head:   "[a, conditional]",
+			Weaker: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			base := parseConfig(t, "policy:\n  approval: "+test.Base+"\n"+rules)
+			head := parseConfig(t, "policy:\n  approval: "+test.Head+"\n"+rules)
+
+			changes := FindWeakenings(base, head)
+			if test.Weaker {
+				assert.Equal(t, []string{"The approval policy was modified to require fewer rules"}, changes)
+			} else {
+				assert.Empty(t, changes)
+			}
+		})
+	}
+}
+
+func parseConfig(t *testing.T, s string) *Config {
+	var c Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(s), &c))
+	return &c
+}
@@ -0,0 +1,38 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"context"
+)
+
+// ContextBinder is implemented by types that make GitHub requests with a
+// context captured when they are created.
+type ContextBinder interface {
+	// BindContext uses ctx for requests until the returned function is
+	// called, which restores the previous context. This lets requests made
+	// during an operation inherit its tracing span and other values.
+	BindContext(ctx context.Context) (restore func())
+}
+
+// BindContext calls BindContext on v if it implements ContextBinder and
+// returns the function that restores the previous context. If v does not
+// implement ContextBinder, BindContext returns a function that does nothing.
+func BindContext(v any, ctx context.Context) (restore func()) {
+	if b, ok := v.(ContextBinder); ok {
+		return b.BindContext(ctx)
+	}
+	return func() {}
+}
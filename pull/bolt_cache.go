@@ -0,0 +1,324 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// DefaultBoltCacheMaxEntries is the default maximum number of push times
+	// stored by a BoltGlobalCache. Each entry uses roughly 150 bytes on disk.
+	DefaultBoltCacheMaxEntries = 1_000_000
+
+	// boltCacheCompactRatio is the fraction of the database file that must be
+	// free space before the file is compacted when it is opened.
+	boltCacheCompactRatio = 0.5
+)
+
+var (
+	// boltCacheCompactMinSize is the minimum size of a database file that is
+	// compacted when it is opened.
+	boltCacheCompactMinSize int64 = 16 << 20
+
+	pushedAtBucket      = []byte("pushedAt")
+	pushedAtOrderBucket = []byte("pushedAtOrder")
+)
+
+// BoltGlobalCache is a GlobalCache that stores commit push times in an
+// embedded BoltDB database so that they persist across restarts. Push times
+// never change for a given repository and commit, so they are safe to keep
+// indefinitely. All other values and lookups are first handled by the wrapped
+// GlobalCache, which is usually an LRUGlobalCache.
+//
+// New push times are written to the database in the background so that
+// evaluations do not wait for disk writes. The database stores at most
+// maxEntries push times. When it is full, the oldest entries are deleted so
+// that it is 90% full. Space from deleted entries is reused by later entries,
+// and the file is compacted when it is opened if most of it is unused.
+type BoltGlobalCache struct {
+	GlobalCache
+
+	db         *bolt.DB
+	maxEntries int
+
+	mu      sync.Mutex
+	entries int
+	pending []boltPushedAt
+	closed  bool
+
+	notify chan struct{}
+	done   chan struct{}
+}
+
+type boltPushedAt struct {
+	key []byte
+	t   time.Time
+}
+
+// NewBoltGlobalCache opens or creates a database at path that stores up to
+// maxEntries push times. If maxEntries is zero, DefaultBoltCacheMaxEntries is
+// used. Values not found in the database are looked up in cache. Callers must
+// call Close to write pending values and close the database.
+func NewBoltGlobalCache(path string, maxEntries int, cache GlobalCache) (*BoltGlobalCache, error) {
+	if maxEntries <= 0 {
+		maxEntries = DefaultBoltCacheMaxEntries
+	}
+
+	if err := compactBoltCache(path); err != nil {
+		return nil, err
+	}
+
+	db, err := openBoltCache(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries int
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{pushedAtBucket, pushedAtOrderBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		entries = tx.Bucket(pushedAtBucket).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "failed to initialize cache database")
+	}
+
+	c := &BoltGlobalCache{
+		GlobalCache: cache,
+		db:          db,
+		maxEntries:  maxEntries,
+		entries:     entries,
+		notify:      make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	go c.writeLoop()
+
+	return c, nil
+}
+
+func (c *BoltGlobalCache) GetPushedAt(repoID int64, sha string) (time.Time, bool) {
+	if t, ok := c.GlobalCache.GetPushedAt(repoID, sha); ok {
+		return t, true
+	}
+
+	var t time.Time
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(pushedAtBucket).Get(boltPushedAtKey(repoID, sha)); len(v) == 16 {
+			t = time.Unix(0, int64(binary.BigEndian.Uint64(v[8:]))).UTC()
+		}
+		return nil
+	})
+	if t.IsZero() {
+		return time.Time{}, false
+	}
+
+	c.GlobalCache.SetPushedAt(repoID, sha, t)
+	return t, true
+}
+
+func (c *BoltGlobalCache) SetPushedAt(repoID int64, sha string, t time.Time) {
+	c.GlobalCache.SetPushedAt(repoID, sha, t)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.pending = append(c.pending, boltPushedAt{key: boltPushedAtKey(repoID, sha), t: t})
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Entries returns the number of push times stored in the database.
+func (c *BoltGlobalCache) Entries() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries
+}
+
+// Close writes any pending push times and closes the database.
+func (c *BoltGlobalCache) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.notify)
+	}
+	c.mu.Unlock()
+
+	<-c.done
+	return c.db.Close()
+}
+
+func (c *BoltGlobalCache) writeLoop() {
+	defer close(c.done)
+	for range c.notify {
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = nil
+		c.mu.Unlock()
+
+		// Errors are ignored because a failed write only means the value is
+		// loaded from GitHub again after a restart.
+		_ = c.write(pending)
+	}
+}
+
+func (c *BoltGlobalCache) write(pending []boltPushedAt) error {
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var entries int
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		values := tx.Bucket(pushedAtBucket)
+		order := tx.Bucket(pushedAtOrderBucket)
+
+		entries = c.Entries()
+		for _, p := range pending {
+			if values.Get(p.key) != nil {
+				continue
+			}
+
+			seq, err := order.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			value := make([]byte, 16)
+			binary.BigEndian.PutUint64(value[:8], seq)
+			binary.BigEndian.PutUint64(value[8:], uint64(p.t.UnixNano()))
+
+			if err := values.Put(p.key, value); err != nil {
+				return err
+			}
+			if err := order.Put(value[:8], p.key); err != nil {
+				return err
+			}
+			entries++
+		}
+
+		if entries > c.maxEntries {
+			n, err := evictOldest(values, order, entries-c.maxEntries*9/10)
+			if err != nil {
+				return err
+			}
+			entries -= n
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.entries = entries
+	c.mu.Unlock()
+	return nil
+}
+
+func evictOldest(values, order *bolt.Bucket, n int) (int, error) {
+	var keys [][]byte
+	cur := order.Cursor()
+	for k, v := cur.First(); k != nil && len(keys) < n; k, v = cur.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+		if err := values.Delete(v); err != nil {
+			return 0, err
+		}
+	}
+	for _, k := range keys {
+		if err := order.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+func boltPushedAtKey(repoID int64, sha string) []byte {
+	key := make([]byte, 8, 8+len(sha))
+	binary.BigEndian.PutUint64(key, uint64(repoID))
+	return append(key, sha...)
+}
+
+func openBoltCache(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open cache database: %s", path)
+	}
+	return db, nil
+}
+
+// compactBoltCache rewrites the database at path if it is large and mostly
+// free space. BoltDB reuses free pages but never shrinks the file, so this
+// reclaims space after many entries are evicted.
+func compactBoltCache(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to stat cache database: %s", path)
+	}
+	if info.Size() < boltCacheCompactMinSize {
+		return nil
+	}
+
+	src, err := openBoltCache(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	free := int64(src.Stats().FreePageN) * int64(src.Info().PageSize)
+	if float64(free) < float64(info.Size())*boltCacheCompactRatio {
+		return nil
+	}
+
+	tmpPath := path + ".compact"
+	_ = os.Remove(tmpPath)
+
+	dst, err := openBoltCache(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(dst, src, 1<<20); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "failed to compact cache database")
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "failed to compact cache database")
+	}
+	if err := src.Close(); err != nil {
+		return errors.Wrap(err, "failed to close cache database")
+	}
+	return errors.Wrap(os.Rename(tmpPath, path), "failed to replace cache database")
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltGlobalCache(t *testing.T) {
+	newCache := func(t *testing.T, path string, maxEntries int) *BoltGlobalCache {
+		lru, err := NewLRUGlobalCache(16)
+		require.NoError(t, err)
+
+		gc, err := NewBoltGlobalCache(path, maxEntries, lru)
+		require.NoError(t, err)
+		return gc
+	}
+
+	t.Run("persistsAcrossRestarts", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.db")
+		now := time.Now().UTC()
+
+		gc := newCache(t, path, 0)
+		gc.SetPushedAt(1, "abc", now)
+		require.NoError(t, gc.Close())
+
+		gc = newCache(t, path, 0)
+		defer func() { _ = gc.Close() }()
+
+		pushedAt, ok := gc.GetPushedAt(1, "abc")
+		assert.True(t, ok, "push time was not persisted")
+		assert.True(t, now.Equal(pushedAt), "incorrect push time: %s", pushedAt)
+		assert.Equal(t, 1, gc.Entries())
+
+		_, ok = gc.GetPushedAt(2, "abc")
+		assert.False(t, ok)
+	})
+
+	t.Run("evictsOldest", func(t *testing.T) {
+		gc := newCache(t, filepath.Join(t.TempDir(), "cache.db"), 20)
+		defer func() { _ = gc.Close() }()
+
+		now := time.Now()
+		for i := 0; i < 20; i++ {
+			gc.SetPushedAt(1, fmt.Sprintf("sha%d", i), now)
+		}
+		waitForEntries(t, gc, 20)
+
+		gc.SetPushedAt(1, "sha20", now)
+		waitForEntries(t, gc, 18)
+
+		// bypass the in-memory cache to check the database
+		gc.GlobalCache, _ = NewLRUGlobalCache(16)
+
+		_, ok := gc.GetPushedAt(1, "sha0")
+		assert.False(t, ok, "oldest entry was not evicted")
+
+		_, ok = gc.GetPushedAt(1, "sha20")
+		assert.True(t, ok, "newest entry was evicted")
+	})
+
+	t.Run("compacts", func(t *testing.T) {
+		defer func(size int64) { boltCacheCompactMinSize = size }(boltCacheCompactMinSize)
+		boltCacheCompactMinSize = 0
+
+		path := filepath.Join(t.TempDir(), "cache.db")
+
+		now := time.Now()
+
+		gc := newCache(t, path, 5000)
+		for i := 0; i < 5000; i++ {
+			gc.SetPushedAt(int64(i), fmt.Sprintf("%040d", i), now)
+		}
+		require.NoError(t, gc.Close())
+
+		gc = newCache(t, path, 100)
+		gc.SetPushedAt(5000, fmt.Sprintf("%040d", 5000), now)
+		require.NoError(t, gc.Close())
+
+		before, err := os.Stat(path)
+		require.NoError(t, err)
+
+		gc = newCache(t, path, 100)
+		defer func() { _ = gc.Close() }()
+
+		after, err := os.Stat(path)
+		require.NoError(t, err)
+
+		assert.Less(t, after.Size(), before.Size(), "database was not compacted")
+		assert.Equal(t, 90, gc.Entries())
+
+		pushedAt, ok := gc.GetPushedAt(5000, fmt.Sprintf("%040d", 5000))
+		assert.True(t, ok, "newest entry was lost during compaction")
+		assert.True(t, now.Equal(pushedAt), "incorrect push time: %s", pushedAt)
+	})
+}
+
+func waitForEntries(t *testing.T, gc *BoltGlobalCache, n int) {
+	assert.Eventually(t, func() bool { return gc.Entries() == n }, time.Second, time.Millisecond, "incorrect number of entries")
+}
@@ -126,6 +126,11 @@ type Context interface {
 
 	// Labels returns a list of labels applied on the Pull Request
 	Labels() ([]string, error)
+
+	// LabelActors returns a map from label name to the login of the user who
+	// most recently applied that label to the Pull Request. Label names are
+	// lowercase, to match the values returned by Labels.
+	LabelActors() (map[string]string, error)
 }
 
 type FileStatus int
@@ -0,0 +1,84 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/pkg/errors"
+)
+
+// TemporaryError is an error that may not happen if the operation that
+// caused it is retried later.
+type TemporaryError struct {
+	error string
+}
+
+func NewTemporaryError(msg string) *TemporaryError {
+	return &TemporaryError{error: msg}
+}
+
+func (te *TemporaryError) Error() string {
+	return te.error
+}
+
+// IsTemporaryError returns true if err or any error it wraps is likely to
+// succeed if retried later. This includes TemporaryError, primary and
+// secondary rate limit errors, and server errors from the REST and GraphQL
+// APIs.
+func IsTemporaryError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var tempErr *TemporaryError
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var responseErr *github.ErrorResponse
+
+	switch {
+	case errors.As(err, &tempErr), errors.As(err, &rateLimitErr), errors.As(err, &abuseErr):
+		return true
+	case errors.As(err, &responseErr):
+		return responseErr.Response != nil && responseErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+
+	// The GraphQL client does not return typed errors for HTTP failures, so
+	// check the message instead. These errors look like:
+	//
+	//   non-200 OK status code: 502 Bad Gateway body: "..."
+	msg := err.Error()
+	if i := strings.Index(msg, "non-200 OK status code: "); i >= 0 {
+		status := msg[i+len("non-200 OK status code: "):]
+		if strings.HasPrefix(status, "5") || strings.Contains(status, "secondary rate limit") {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimitReset returns the time when the primary rate limit that caused err
+// resets and true, or false if err was not caused by a primary rate limit
+// with a known reset time. Retrying before this time always fails.
+func RateLimitReset(err error) (time.Time, bool) {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) && !rateLimitErr.Rate.Reset.IsZero() {
+		return rateLimitErr.Rate.Reset.Time, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTemporaryError(t *testing.T) {
+	tests := map[string]struct {
+		Err       error
+		Temporary bool
+	}{
+		"nil": {
+			Err: nil,
+		},
+		"plain": {
+			Err: errors.New("failed to parse policy"),
+		},
+		"temporary": {
+			Err:       errors.Wrap(NewTemporaryError("try again"), "failed to load"),
+			Temporary: true,
+		},
+		"secondaryRateLimit": {
+			Err:       errors.Wrap(&github.AbuseRateLimitError{Message: "slow down"}, "failed to list reviews"),
+			Temporary: true,
+		},
+		"primaryRateLimit": {
+			Err:       &github.RateLimitError{Message: "rate limit exceeded"},
+			Temporary: true,
+		},
+		"serverError": {
+			Err:       errors.WithStack(&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}),
+			Temporary: true,
+		},
+		"clientError": {
+			Err: &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}},
+		},
+		"graphqlServerError": {
+			Err:       errors.Wrap(fmt.Errorf("non-200 OK status code: 502 Bad Gateway body: %q", "{}"), "failed to load pull request details"),
+			Temporary: true,
+		},
+		"graphqlSecondaryRateLimit": {
+			Err:       fmt.Errorf("non-200 OK status code: 403 Forbidden body: %q", "You have exceeded a secondary rate limit"),
+			Temporary: true,
+		},
+		"graphqlClientError": {
+			Err: fmt.Errorf("non-200 OK status code: 401 Unauthorized body: %q", "Bad credentials"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Temporary, IsTemporaryError(test.Err))
+		})
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	reset := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	at, ok := RateLimitReset(errors.Wrap(&github.RateLimitError{
+		Rate: github.Rate{Reset: github.Timestamp{Time: reset}},
+	}, "failed to list reviews"))
+	assert.True(t, ok)
+	assert.Equal(t, reset, at)
+
+	_, ok = RateLimitReset(&github.AbuseRateLimitError{Message: "slow down"})
+	assert.False(t, ok, "secondary rate limit has a reset time")
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/google/go-github/v59/github"
 	"github.com/pkg/errors"
 	"github.com/shurcooL/githubv4"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -45,14 +46,6 @@ type Locator struct {
 	Value *github.PullRequest
 }
 
-type TemporaryError struct {
-	error string
-}
-
-func (te *TemporaryError) Error() string {
-	return te.error
-}
-
 // IsComplete returns true if the locator contains a pull request object with
 // all required fields.
 func (loc Locator) IsComplete() bool {
@@ -140,6 +133,7 @@ type GitHubContext struct {
 	membership    map[string]bool
 	statuses      map[string]string
 	labels        []string
+	labelActors   map[string]string
 	pushedAt      map[string]time.Time
 }
 
@@ -181,6 +175,18 @@ func NewGitHubContext(
 	}, nil
 }
 
+// BindContext uses ctx for requests made by this context and its membership
+// context until the returned function is called.
+func (ghc *GitHubContext) BindContext(ctx context.Context) func() {
+	prev := ghc.ctx
+	ghc.ctx = ctx
+	restoreMembership := BindContext(ghc.MembershipContext, ctx)
+	return func() {
+		ghc.ctx = prev
+		restoreMembership()
+	}
+}
+
 func (ghc *GitHubContext) EvaluationTimestamp() time.Time {
 	return ghc.evalTimestamp
 }
@@ -209,6 +215,9 @@ type v4PullRequestWithEditedAt struct {
 }
 
 func (ghc *GitHubContext) Body() (*Body, error) {
+	ctx, span := startSpan(ghc.ctx, "GitHubContext.Body")
+	defer span.End()
+
 	var q struct {
 		Repository struct {
 			PullRequest v4PullRequestWithEditedAt `graphql:"pullRequest(number: $number)"`
@@ -219,7 +228,7 @@ func (ghc *GitHubContext) Body() (*Body, error) {
 		"name":   githubv4.String(ghc.repo),
 		"number": githubv4.Int(ghc.number),
 	}
-	if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+	if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
 		return nil, errors.Wrap(err, "failed to load pull request details")
 	}
 	graphqlResponse := &q.Repository.PullRequest
@@ -270,13 +279,16 @@ func (ghc *GitHubContext) Branches() (base string, head string) {
 
 func (ghc *GitHubContext) ChangedFiles() ([]*File, error) {
 	if ghc.files == nil {
+		ctx, span := startSpan(ghc.ctx, "GitHubContext.ChangedFiles")
+		defer span.End()
+
 		opt := github.ListOptions{
 			PerPage: 100,
 		}
 
 		var allFiles []*github.CommitFile
 		for {
-			files, res, err := ghc.client.PullRequests.ListFiles(ghc.ctx, ghc.owner, ghc.repo, ghc.number, &opt)
+			files, res, err := ghc.client.PullRequests.ListFiles(ctx, ghc.owner, ghc.repo, ghc.number, &opt)
 			if err != nil {
 				return nil, errors.Wrap(err, "failed to list pull request files")
 			}
@@ -349,6 +361,12 @@ func (ghc *GitHubContext) PushedAt(sha string) (time.Time, error) {
 	// timestamp. This list lets us cache the times for all of the commits in
 	// the batch that we considered while looking for the head of the batch.
 	candidateSHAs := []string{sha}
+	if t, ok := ghc.pushedAt[sha]; ok {
+		return t, nil
+	}
+
+	ctx, span := startSpan(ghc.ctx, "GitHubContext.PushedAt", attribute.String("sha", sha))
+	defer span.End()
 
 	var pushedAt time.Time
 	var err error
@@ -359,7 +377,7 @@ func (ghc *GitHubContext) PushedAt(sha string) (time.Time, error) {
 		// batch containing the initial commit.
 		sha := candidateSHAs[len(candidateSHAs)-1]
 
-		pushedAt, err = ghc.tryPushedAt(repoID, sha)
+		pushedAt, err = ghc.tryPushedAt(ctx, repoID, sha)
 		if err != nil {
 			return time.Time{}, err
 		}
@@ -402,7 +420,7 @@ func (ghc *GitHubContext) PushedAt(sha string) (time.Time, error) {
 // entries during the lifetime of the context.
 //
 // The local cache must be initialized before calling tryPushedAt.
-func (ghc *GitHubContext) tryPushedAt(repoID int64, sha string) (time.Time, error) {
+func (ghc *GitHubContext) tryPushedAt(ctx context.Context, repoID int64, sha string) (time.Time, error) {
 	if t, ok := ghc.pushedAt[sha]; ok {
 		return t, nil
 	}
@@ -412,7 +430,7 @@ func (ghc *GitHubContext) tryPushedAt(repoID int64, sha string) (time.Time, erro
 			return t, nil
 		}
 	}
-	return ghc.loadPushedAt(sha)
+	return ghc.loadPushedAt(ctx, sha)
 }
 
 // nextChildCommit returns the child commit for the given SHA or nil if the SHA
@@ -459,6 +477,9 @@ func (ghc *GitHubContext) Reviews() ([]*Review, error) {
 
 func (ghc *GitHubContext) RepositoryCollaborators() ([]*Collaborator, error) {
 	if ghc.collaborators == nil {
+		ctx, span := startSpan(ghc.ctx, "GitHubContext.RepositoryCollaborators")
+		defer span.End()
+
 		// For reviewer assignment, we need to figure out how each collaborator
 		// gets permissions on the repository. We _should_ be able to do this
 		// by examining the permission sources for each collaborator, but this
@@ -507,7 +528,7 @@ func (ghc *GitHubContext) RepositoryCollaborators() ([]*Collaborator, error) {
 		var collaborators []*Collaborator
 		for {
 			complete := 0
-			if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+			if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
 				return nil, errors.Wrap(err, "failed to load repository collaborators")
 			}
 
@@ -613,6 +634,17 @@ func (ghc *GitHubContext) CollaboratorPermission(user string) (Permission, error
 		return p, nil
 	}
 
+	repoID := ghc.pr.BaseRepository.DatabaseID
+	if gc := ghc.globalCache; gc != nil {
+		if p, ok := gc.GetPermission(repoID, user); ok {
+			ghc.permissions[user] = p
+			return p, nil
+		}
+	}
+
+	ctx, span := startSpan(ghc.ctx, "GitHubContext.CollaboratorPermission", attribute.String("user", user))
+	defer span.End()
+
 	// Use GraphQL because the v3 API to get collaborator permissions does not
 	// support maintain and triage permissions as of 2021-05-07.
 	var q struct {
@@ -637,7 +669,7 @@ func (ghc *GitHubContext) CollaboratorPermission(user string) (Permission, error
 	// iterate through multiple users before we find the one we're looking for.
 	var perm Permission
 	for {
-		if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+		if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
 			return PermissionNone, errors.Wrap(err, "failed to get collaborator permission")
 		}
 		if idx := findUserIndex(user, q.Repository.Collaborators.Nodes); idx >= 0 {
@@ -654,6 +686,9 @@ func (ghc *GitHubContext) CollaboratorPermission(user string) (Permission, error
 	}
 
 	ghc.permissions[user] = perm
+	if gc := ghc.globalCache; gc != nil {
+		gc.SetPermission(repoID, user, perm)
+	}
 	return perm, nil
 }
 
@@ -676,6 +711,9 @@ func (ghc *GitHubContext) RequestedReviewers() ([]*Reviewer, error) {
 }
 
 func (ghc *GitHubContext) loadRequestedReviewers() error {
+	ctx, span := startSpan(ghc.ctx, "GitHubContext.RequestedReviewers")
+	defer span.End()
+
 	var q struct {
 		Repository struct {
 			PullRequest struct {
@@ -710,7 +748,7 @@ func (ghc *GitHubContext) loadRequestedReviewers() error {
 	reviewers := []*Reviewer{}
 	for {
 		complete := 0
-		if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+		if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
 			return errors.Wrap(err, "failed to load requested reviewers data")
 		}
 
@@ -738,13 +776,16 @@ func (ghc *GitHubContext) loadRequestedReviewers() error {
 
 func (ghc *GitHubContext) Teams() (map[string]Permission, error) {
 	if ghc.teams == nil {
+		ctx, span := startSpan(ghc.ctx, "GitHubContext.Teams")
+		defer span.End()
+
 		opt := &github.ListOptions{
 			PerPage: 100,
 		}
 
 		allTeams := make(map[string]Permission)
 		for {
-			teams, resp, err := listTeams(ghc.ctx, ghc.client, ghc.owner, ghc.repo, opt)
+			teams, resp, err := listTeams(ctx, ghc.client, ghc.owner, ghc.repo, opt)
 			if err != nil {
 				return nil, errors.Wrapf(err, "failed to list teams page %d", opt.Page)
 			}
@@ -763,12 +804,15 @@ func (ghc *GitHubContext) Teams() (map[string]Permission, error) {
 
 func (ghc *GitHubContext) LatestStatuses() (map[string]string, error) {
 	if ghc.statuses == nil {
-		statuses, err := ghc.getStatuses()
+		ctx, span := startSpan(ghc.ctx, "GitHubContext.LatestStatuses")
+		defer span.End()
+
+		statuses, err := ghc.getStatuses(ctx)
 		if err != nil {
 			return nil, err
 		}
 
-		checkStatuses, err := ghc.getCheckStatuses()
+		checkStatuses, err := ghc.getCheckStatuses(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -783,14 +827,14 @@ func (ghc *GitHubContext) LatestStatuses() (map[string]string, error) {
 	return ghc.statuses, nil
 }
 
-func (ghc *GitHubContext) getStatuses() (map[string]string, error) {
+func (ghc *GitHubContext) getStatuses(ctx context.Context) (map[string]string, error) {
 	opt := &github.ListOptions{
 		PerPage: 100,
 	}
 	// get all pages of results
 	statuses := make(map[string]string)
 	for {
-		combinedStatus, resp, err := ghc.client.Repositories.GetCombinedStatus(ghc.ctx, ghc.owner, ghc.repo, ghc.HeadSHA(), opt)
+		combinedStatus, resp, err := ghc.client.Repositories.GetCombinedStatus(ctx, ghc.owner, ghc.repo, ghc.HeadSHA(), opt)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to get statuses for page %d", opt.Page)
 		}
@@ -805,7 +849,7 @@ func (ghc *GitHubContext) getStatuses() (map[string]string, error) {
 	return statuses, nil
 }
 
-func (ghc *GitHubContext) getCheckStatuses() (map[string]string, error) {
+func (ghc *GitHubContext) getCheckStatuses(ctx context.Context) (map[string]string, error) {
 	opt := &github.ListCheckRunsOptions{
 		ListOptions: github.ListOptions{
 			PerPage: 100,
@@ -814,7 +858,7 @@ func (ghc *GitHubContext) getCheckStatuses() (map[string]string, error) {
 	// get all pages of results
 	statuses := make(map[string]string)
 	for {
-		checkRuns, resp, err := ghc.client.Checks.ListCheckRunsForRef(ghc.ctx, ghc.owner, ghc.repo, ghc.HeadSHA(), opt)
+		checkRuns, resp, err := ghc.client.Checks.ListCheckRunsForRef(ctx, ghc.owner, ghc.repo, ghc.HeadSHA(), opt)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to get check runs for page %d", opt.Page)
 		}
@@ -831,7 +875,10 @@ func (ghc *GitHubContext) getCheckStatuses() (map[string]string, error) {
 
 func (ghc *GitHubContext) Labels() ([]string, error) {
 	if ghc.labels == nil {
-		issueLabels, _, err := ghc.client.Issues.ListLabelsByIssue(ghc.ctx, ghc.owner, ghc.repo, ghc.number, &github.ListOptions{
+		ctx, span := startSpan(ghc.ctx, "GitHubContext.Labels")
+		defer span.End()
+
+		issueLabels, _, err := ghc.client.Issues.ListLabelsByIssue(ctx, ghc.owner, ghc.repo, ghc.number, &github.ListOptions{
 			Page:    0,
 			PerPage: 100,
 		})
@@ -848,7 +895,65 @@ func (ghc *GitHubContext) Labels() ([]string, error) {
 	return ghc.labels, nil
 }
 
+func (ghc *GitHubContext) LabelActors() (map[string]string, error) {
+	if ghc.labelActors == nil {
+		if err := ghc.loadLabelActors(); err != nil {
+			return nil, err
+		}
+	}
+	return ghc.labelActors, nil
+}
+
+func (ghc *GitHubContext) loadLabelActors() error {
+	ctx, span := startSpan(ghc.ctx, "GitHubContext.LabelActors")
+	defer span.End()
+
+	var q struct {
+		Repository struct {
+			PullRequest struct {
+				TimelineItems struct {
+					PageInfo v4PageInfo
+					Nodes    []struct {
+						LabeledEvent struct {
+							Actor v4Actor
+							Label struct {
+								Name string
+							}
+						} `graphql:"... on LabeledEvent"`
+					}
+				} `graphql:"timelineItems(first: 100, after: $cursor, itemTypes: [LABELED_EVENT])"`
+			} `graphql:"pullRequest(number: $number)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	qvars := map[string]interface{}{
+		"owner":  githubv4.String(ghc.owner),
+		"name":   githubv4.String(ghc.repo),
+		"number": githubv4.Int(ghc.number),
+		"cursor": (*githubv4.String)(nil),
+	}
+
+	// timeline items are in chronological order, so later events for the
+	// same label overwrite earlier ones
+	actors := make(map[string]string)
+	for {
+		if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
+			return errors.Wrap(err, "failed to load label events")
+		}
+		for _, n := range q.Repository.PullRequest.TimelineItems.Nodes {
+			actors[strings.ToLower(n.LabeledEvent.Label.Name)] = n.LabeledEvent.Actor.GetV3Login()
+		}
+		if !q.Repository.PullRequest.TimelineItems.PageInfo.UpdateCursor(qvars, "cursor") {
+			break
+		}
+	}
+	ghc.labelActors = actors
+	return nil
+}
+
 func (ghc *GitHubContext) loadPagedData() error {
+	ctx, span := startSpan(ghc.ctx, "GitHubContext.CommentsAndReviews")
+	defer span.End()
+
 	// this is a minor optimization: make max(c,r) requests instead of c+r
 	var q struct {
 		Repository struct {
@@ -878,7 +983,7 @@ func (ghc *GitHubContext) loadPagedData() error {
 	reviews := []*Review{}
 	for {
 		complete := 0
-		if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+		if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
 			return errors.Wrap(err, "failed to load pull request data")
 		}
 
@@ -938,6 +1043,9 @@ func (ghc *GitHubContext) loadCommits() ([]*Commit, error) {
 }
 
 func (ghc *GitHubContext) loadRawCommits() ([]*v4PullRequestCommit, error) {
+	ctx, span := startSpan(ghc.ctx, "GitHubContext.Commits")
+	defer span.End()
+
 	var q struct {
 		Repository struct {
 			PullRequest struct {
@@ -957,7 +1065,7 @@ func (ghc *GitHubContext) loadRawCommits() ([]*v4PullRequestCommit, error) {
 
 	commits := []*v4PullRequestCommit{}
 	for {
-		if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+		if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
 			return nil, errors.Wrap(err, "failed to load commits")
 		}
 		commits = append(commits, q.Repository.PullRequest.Commits.Nodes...)
@@ -968,7 +1076,7 @@ func (ghc *GitHubContext) loadRawCommits() ([]*v4PullRequestCommit, error) {
 	return commits, nil
 }
 
-func (ghc *GitHubContext) loadPushedAt(sha string) (time.Time, error) {
+func (ghc *GitHubContext) loadPushedAt(ctx context.Context, sha string) (time.Time, error) {
 	opt := &github.ListOptions{
 		PerPage: 100,
 	}
@@ -977,7 +1085,7 @@ func (ghc *GitHubContext) loadPushedAt(sha string) (time.Time, error) {
 	// last item on the last page is the oldest status, which must have been
 	// posted after someone pushed the commit.
 	for {
-		statuses, resp, err := ghc.client.Repositories.ListStatuses(ghc.ctx, ghc.owner, ghc.repo, sha, opt)
+		statuses, resp, err := ghc.client.Repositories.ListStatuses(ctx, ghc.owner, ghc.repo, sha, opt)
 		if err != nil {
 			return time.Time{}, errors.Wrapf(err, "failed to list statuses for page %d", opt.Page)
 		}
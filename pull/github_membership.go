@@ -20,27 +20,45 @@ import (
 
 	"github.com/google/go-github/v59/github"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type GitHubMembershipContext struct {
-	ctx    context.Context
-	client *github.Client
+	ctx      context.Context
+	client   *github.Client
+	cache    GlobalCache
+	cacheOrg string
 
 	membership  map[string]bool
 	orgMembers  map[string][]string
 	teamMembers map[string][]string
 }
 
-func NewGitHubMembershipContext(ctx context.Context, client *github.Client) *GitHubMembershipContext {
+// NewGitHubMembershipContext creates a MembershipContext that uses client
+// to look up membership. If cache is not nil, values for the organization org
+// and its teams are also read from and stored in the cache so they can be
+// shared between evaluations. The client must be for an installation owned by
+// org: other installations may not see secret teams or private members, so
+// their values are never cached.
+func NewGitHubMembershipContext(ctx context.Context, client *github.Client, org string, cache GlobalCache) *GitHubMembershipContext {
 	return &GitHubMembershipContext{
 		ctx:         ctx,
 		client:      client,
+		cache:       cache,
+		cacheOrg:    org,
 		membership:  make(map[string]bool),
 		orgMembers:  make(map[string][]string),
 		teamMembers: make(map[string][]string),
 	}
 }
 
+// BindContext uses ctx for requests until the returned function is called.
+func (mc *GitHubMembershipContext) BindContext(ctx context.Context) func() {
+	prev := mc.ctx
+	mc.ctx = ctx
+	return func() { mc.ctx = prev }
+}
+
 func membershipKey(group, user string) string {
 	return group + ":" + user
 }
@@ -54,49 +72,57 @@ func splitTeam(team string) (org, slug string, err error) {
 }
 
 func (mc *GitHubMembershipContext) IsTeamMember(team, user string) (bool, error) {
-	key := membershipKey(team, user)
-
 	org, slug, err := splitTeam(team)
 	if err != nil {
 		return false, err
 	}
 
-	isMember, ok := mc.membership[key]
+	isMember, ok := mc.getMembership(team, user)
 	if ok {
 		return isMember, nil
 	}
 
-	membership, _, err := mc.client.Teams.GetTeamMembershipBySlug(mc.ctx, org, slug, user)
+	ctx, span := startSpan(mc.ctx, "MembershipContext.IsTeamMember", attribute.String("team", team), attribute.String("user", user))
+	defer span.End()
+
+	membership, _, err := mc.client.Teams.GetTeamMembershipBySlug(ctx, org, slug, user)
 	if err != nil && !isNotFound(err) {
 		return false, errors.Wrap(err, "failed to get team membership")
 	}
 
 	isMember = membership != nil && membership.GetState() == "active"
-	mc.membership[key] = isMember
+	mc.setMembership(team, user, isMember)
 
 	return isMember, nil
 }
 
 func (mc *GitHubMembershipContext) IsOrgMember(org, user string) (bool, error) {
-	key := membershipKey(org, user)
-
-	isMember, ok := mc.membership[key]
+	isMember, ok := mc.getMembership(org, user)
 	if ok {
 		return isMember, nil
 	}
 
-	isMember, _, err := mc.client.Organizations.IsMember(mc.ctx, org, user)
+	ctx, span := startSpan(mc.ctx, "MembershipContext.IsOrgMember", attribute.String("org", org), attribute.String("user", user))
+	defer span.End()
+
+	isMember, _, err := mc.client.Organizations.IsMember(ctx, org, user)
 	if err != nil {
 		return false, errors.Wrap(err, "failed to get organization membership")
 	}
 
-	mc.membership[key] = isMember
+	mc.setMembership(org, user, isMember)
 	return isMember, nil
 }
 
 func (mc *GitHubMembershipContext) OrganizationMembers(org string) ([]string, error) {
 	members, ok := mc.orgMembers[org]
+	if !ok && mc.usesCache(org) {
+		members, ok = mc.cache.GetMembers(org)
+	}
 	if !ok {
+		ctx, span := startSpan(mc.ctx, "MembershipContext.OrganizationMembers", attribute.String("org", org))
+		defer span.End()
+
 		opt := &github.ListMembersOptions{
 			ListOptions: github.ListOptions{
 				PerPage: 100,
@@ -104,7 +130,7 @@ func (mc *GitHubMembershipContext) OrganizationMembers(org string) ([]string, er
 		}
 
 		for {
-			users, resp, err := mc.client.Organizations.ListMembers(mc.ctx, org, opt)
+			users, resp, err := mc.client.Organizations.ListMembers(ctx, org, opt)
 			if err != nil {
 				return nil, errors.Wrapf(err, "failed to list members of org %s page %d", org, opt.Page)
 			}
@@ -118,14 +144,23 @@ func (mc *GitHubMembershipContext) OrganizationMembers(org string) ([]string, er
 			}
 			opt.Page = resp.NextPage
 		}
-		mc.orgMembers[org] = members
+		if mc.usesCache(org) {
+			mc.cache.SetMembers(org, members)
+		}
 	}
+	mc.orgMembers[org] = members
 	return members, nil
 }
 
 func (mc *GitHubMembershipContext) TeamMembers(team string) ([]string, error) {
 	members, ok := mc.teamMembers[team]
+	if !ok && mc.usesCache(team) {
+		members, ok = mc.cache.GetMembers(team)
+	}
 	if !ok {
+		ctx, span := startSpan(mc.ctx, "MembershipContext.TeamMembers", attribute.String("team", team))
+		defer span.End()
+
 		opt := &github.TeamListTeamMembersOptions{
 			ListOptions: github.ListOptions{
 				PerPage: 100,
@@ -138,7 +173,7 @@ func (mc *GitHubMembershipContext) TeamMembers(team string) ([]string, error) {
 		}
 
 		for {
-			users, resp, err := mc.client.Teams.ListTeamMembersBySlug(mc.ctx, org, slug, opt)
+			users, resp, err := mc.client.Teams.ListTeamMembersBySlug(ctx, org, slug, opt)
 			if err != nil {
 				return nil, errors.Wrapf(err, "failed to list team %s members page %d", team, opt.Page)
 			}
@@ -152,7 +187,40 @@ func (mc *GitHubMembershipContext) TeamMembers(team string) ([]string, error) {
 			}
 			opt.Page = resp.NextPage
 		}
-		mc.teamMembers[team] = members
+		if mc.usesCache(team) {
+			mc.cache.SetMembers(team, members)
+		}
 	}
+	mc.teamMembers[team] = members
 	return members, nil
 }
+
+func (mc *GitHubMembershipContext) getMembership(group, user string) (bool, bool) {
+	if isMember, ok := mc.membership[membershipKey(group, user)]; ok {
+		return isMember, true
+	}
+	if mc.usesCache(group) {
+		if isMember, ok := mc.cache.GetMembership(group, user); ok {
+			mc.membership[membershipKey(group, user)] = isMember
+			return isMember, true
+		}
+	}
+	return false, false
+}
+
+func (mc *GitHubMembershipContext) setMembership(group, user string, isMember bool) {
+	mc.membership[membershipKey(group, user)] = isMember
+	if mc.usesCache(group) {
+		mc.cache.SetMembership(group, user, isMember)
+	}
+}
+
+// usesCache returns true if values for group are read from and stored in the
+// global cache. Groups are organizations ("org") or teams ("org/team-slug").
+func (mc *GitHubMembershipContext) usesCache(group string) bool {
+	if mc.cache == nil || mc.cacheOrg == "" {
+		return false
+	}
+	org, _, _ := strings.Cut(group, "/")
+	return strings.EqualFold(org, mc.cacheOrg)
+}
@@ -285,6 +285,30 @@ func TestNoComments(t *testing.T) {
 	assert.Equal(t, 1, dataRule.Count, "cached comments were not used")
 }
 
+func TestLabelActors(t *testing.T) {
+	rp := &ResponsePlayer{}
+	dataRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.timelineItems"),
+		"testdata/responses/pull_label_events.yml",
+	)
+
+	ctx := makeContext(t, rp, nil, nil)
+
+	actors, err := ctx.LabelActors()
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, dataRule.Count, "no http request was made")
+	assert.Equal(t, map[string]string{
+		"skip-review": "labeler[bot]",
+		"bug":         "mhaypenny",
+	}, actors)
+
+	// verify that the actors are cached
+	_, err = ctx.LabelActors()
+	require.NoError(t, err)
+	assert.Equal(t, 2, dataRule.Count, "cached label actors were not used")
+}
+
 func TestIsTeamMember(t *testing.T) {
 	rp := &ResponsePlayer{}
 	yesRule1 := rp.AddRule(
@@ -340,6 +364,43 @@ func TestIsTeamMember(t *testing.T) {
 	assert.Equal(t, 1, yesRule1.Count, "cached membership was not used")
 }
 
+func TestMembershipGlobalCache(t *testing.T) {
+	rp := &ResponsePlayer{}
+	ownRule := rp.AddRule(
+		ExactPathMatcher("/orgs/testorg/teams/yes-team/memberships/mhaypenny"),
+		"testdata/responses/membership_team123_mhaypenny.yml",
+	)
+	otherRule := rp.AddRule(
+		ExactPathMatcher("/orgs/otherorg/teams/secret-team/memberships/mhaypenny"),
+		"testdata/responses/membership_team456_mhaypenny.yml",
+	)
+
+	gc := NewMockGlobalCache()
+
+	ctx := makeContext(t, rp, nil, gc)
+
+	_, err := ctx.IsTeamMember("testorg/yes-team", "mhaypenny")
+	require.NoError(t, err)
+	_, err = ctx.IsTeamMember("otherorg/secret-team", "mhaypenny")
+	require.NoError(t, err)
+
+	assert.Contains(t, gc.Membership, "testorg/yes-team:mhaypenny", "membership in the installation org was not cached")
+	assert.NotContains(t, gc.Membership, "otherorg/secret-team:mhaypenny", "membership in a different org was cached")
+
+	// a new context only loads values for the installation org from the cache
+	ctx = makeContext(t, rp, nil, gc)
+	gc.Membership["otherorg/secret-team:mhaypenny"] = true
+
+	_, err = ctx.IsTeamMember("testorg/yes-team", "mhaypenny")
+	require.NoError(t, err)
+	isMember, err := ctx.IsTeamMember("otherorg/secret-team", "mhaypenny")
+	require.NoError(t, err)
+
+	assert.False(t, isMember, "membership in a different org was read from the cache")
+	assert.Equal(t, 1, ownRule.Count, "cached membership was not used")
+	assert.Equal(t, 2, otherRule.Count, "no http request was made")
+}
+
 func TestMixedReviewCommentPaging(t *testing.T) {
 	rp := &ResponsePlayer{}
 	rp.AddRule(
@@ -397,6 +458,60 @@ func TestIsOrgMember(t *testing.T) {
 	assert.Equal(t, 1, yesRule.Count, "cached membership was not used")
 }
 
+func TestBindContext(t *testing.T) {
+	type requestCounterKey struct{}
+
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		countingMatcher{ExactPathMatcher("/repos/testorg/testrepo/pulls/123/files"), requestCounterKey{}},
+		"testdata/responses/pull_files.yml",
+	)
+	rp.AddRule(
+		countingMatcher{ExactPathMatcher("/orgs/testorg/members/mhaypenny"), requestCounterKey{}},
+		"testdata/responses/membership_testorg_mhaypenny.yml",
+	)
+	rp.AddRule(
+		countingMatcher{ExactPathMatcher("/orgs/testorg/members/ttest"), requestCounterKey{}},
+		"testdata/responses/membership_testorg_ttest.yml",
+	)
+
+	prctx := makeContext(t, rp, nil, nil)
+
+	var bound int
+	restore := BindContext(prctx, context.WithValue(context.Background(), requestCounterKey{}, &bound))
+
+	_, err := prctx.ChangedFiles()
+	require.NoError(t, err)
+	_, err = prctx.IsOrgMember("testorg", "mhaypenny")
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, bound, "requests did not use the bound context")
+
+	restore()
+
+	_, err = prctx.IsOrgMember("testorg", "ttest")
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, bound, "requests used the bound context after it was restored")
+}
+
+// countingMatcher increments the counter stored in the request context at
+// key, if there is one, for each request that matches.
+type countingMatcher struct {
+	RequestMatcher
+	key any
+}
+
+func (m countingMatcher) Matches(r *http.Request, body []byte) bool {
+	if !m.RequestMatcher.Matches(r, body) {
+		return false
+	}
+	if n, ok := r.Context().Value(m.key).(*int); ok {
+		*n++
+	}
+	return true
+}
+
 func TestBranches(t *testing.T) {
 	rp := &ResponsePlayer{}
 	ctx := makeContext(t, rp, nil, nil)
@@ -619,7 +734,7 @@ func makeContext(t *testing.T, rp *ResponsePlayer, pr *github.PullRequest, gc Gl
 	base, _ := url.Parse("http://github.localhost/")
 	client.BaseURL = base
 
-	mbrCtx := NewGitHubMembershipContext(ctx, client)
+	mbrCtx := NewGitHubMembershipContext(ctx, client, "testorg", gc)
 	if pr == nil {
 		pr = defaultTestPR()
 	}
@@ -674,12 +789,18 @@ func newTime(t time.Time) *time.Time {
 }
 
 type MockGlobalCache struct {
-	PushedAt map[string]time.Time
+	PushedAt    map[string]time.Time
+	Membership  map[string]bool
+	Members     map[string][]string
+	Permissions map[string]Permission
 }
 
 func NewMockGlobalCache() *MockGlobalCache {
 	return &MockGlobalCache{
-		PushedAt: make(map[string]time.Time),
+		PushedAt:    make(map[string]time.Time),
+		Membership:  make(map[string]bool),
+		Members:     make(map[string][]string),
+		Permissions: make(map[string]Permission),
 	}
 }
 
@@ -691,3 +812,36 @@ func (c *MockGlobalCache) GetPushedAt(repoID int64, sha string) (time.Time, bool
 func (c *MockGlobalCache) SetPushedAt(repoID int64, sha string, t time.Time) {
 	c.PushedAt[fmt.Sprintf("%d:%s", repoID, sha)] = t
 }
+
+func (c *MockGlobalCache) GetMembership(group, user string) (bool, bool) {
+	isMember, ok := c.Membership[group+":"+user]
+	return isMember, ok
+}
+
+func (c *MockGlobalCache) SetMembership(group, user string, isMember bool) {
+	c.Membership[group+":"+user] = isMember
+}
+
+func (c *MockGlobalCache) GetMembers(group string) ([]string, bool) {
+	members, ok := c.Members[group]
+	return members, ok
+}
+
+func (c *MockGlobalCache) SetMembers(group string, members []string) {
+	c.Members[group] = members
+}
+
+func (c *MockGlobalCache) GetPermission(repoID int64, user string) (Permission, bool) {
+	p, ok := c.Permissions[fmt.Sprintf("%d:%s", repoID, user)]
+	return p, ok
+}
+
+func (c *MockGlobalCache) SetPermission(repoID int64, user string, perm Permission) {
+	c.Permissions[fmt.Sprintf("%d:%s", repoID, user)] = perm
+}
+
+func (c *MockGlobalCache) InvalidateGroup(group string) {}
+
+func (c *MockGlobalCache) InvalidateRepository(repoID int64) {}
+
+func (c *MockGlobalCache) InvalidateUser(user string) {}
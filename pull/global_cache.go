@@ -16,18 +16,55 @@ package pull
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 )
 
 // GlobalCache implementations provide a way to cache values that are safe to
-// cache at the application level. Values in the global cache should not become
-// stale due to external changes and should only expire to prevent the cache
-// from becoming infinitely large.
+// cache at the application level.
+//
+// Commit push times never become stale and only expire to prevent the cache
+// from becoming infinitely large. Membership and permission values can become
+// stale due to external changes, so implementations keep them for a limited
+// time and discard them when the Invalidate methods are called. Groups are
+// either organizations ("org") or teams ("org/team-slug"). Group and user
+// names are not case-sensitive. Membership values are only valid if they were
+// loaded by the app installation of the group's organization, so callers must
+// not store values loaded by other installations.
 type GlobalCache interface {
 	GetPushedAt(repoID int64, sha string) (time.Time, bool)
 	SetPushedAt(repoID int64, sha string, t time.Time)
+
+	// GetMembership returns whether user is a member of the group and true
+	// if the value is in the cache.
+	GetMembership(group, user string) (bool, bool)
+	SetMembership(group, user string, isMember bool)
+
+	// GetMembers returns the members of the group and true if the value is
+	// in the cache.
+	GetMembers(group string) ([]string, bool)
+	SetMembers(group string, members []string)
+
+	// GetPermission returns the permission of a collaborator on the
+	// repository and true if the value is in the cache.
+	GetPermission(repoID int64, user string) (Permission, bool)
+	SetPermission(repoID int64, user string, perm Permission)
+
+	// InvalidateGroup discards all membership values for the group. If the
+	// group is an organization, it also discards the values for all teams in
+	// the organization.
+	InvalidateGroup(group string)
+
+	// InvalidateRepository discards all permission values for the
+	// repository.
+	InvalidateRepository(repoID int64)
+
+	// InvalidateUser discards all permission values for the user.
+	InvalidateUser(user string)
 }
 
 // LRUGlobalCache is a GlobalCache where each data type is stored in a separate
@@ -35,14 +72,48 @@ type GlobalCache interface {
 // frequently used data of a different type.
 type LRUGlobalCache struct {
 	pushedAt *lru.Cache
+
+	// membership stores membership and permission values, which expire
+	// after ttl. If ttl is zero, these values are not cached.
+	membership *lru.Cache
+	ttl        time.Duration
+
+	mu          sync.Mutex
+	generations map[string]uint64
 }
 
+type ttlEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewLRUGlobalCache creates an LRUGlobalCache that only caches commit push
+// times.
 func NewLRUGlobalCache(pushedAtSize int) (*LRUGlobalCache, error) {
+	return NewLRUGlobalCacheWithMembership(pushedAtSize, 0, 0)
+}
+
+// NewLRUGlobalCacheWithMembership creates an LRUGlobalCache that also caches
+// up to membershipSize membership and permission values for the given TTL.
+func NewLRUGlobalCacheWithMembership(pushedAtSize, membershipSize int, ttl time.Duration) (*LRUGlobalCache, error) {
 	pushedAt, err := lru.New(pushedAtSize)
 	if err != nil {
 		return nil, err
 	}
-	return &LRUGlobalCache{pushedAt: pushedAt}, nil
+
+	c := &LRUGlobalCache{
+		pushedAt:    pushedAt,
+		generations: make(map[string]uint64),
+	}
+	if membershipSize > 0 && ttl > 0 {
+		membership, err := lru.New(membershipSize)
+		if err != nil {
+			return nil, err
+		}
+		c.membership = membership
+		c.ttl = ttl
+	}
+	return c, nil
 }
 
 func (c *LRUGlobalCache) GetPushedAt(repoID int64, sha string) (time.Time, bool) {
@@ -58,6 +129,128 @@ func (c *LRUGlobalCache) SetPushedAt(repoID int64, sha string, t time.Time) {
 	c.pushedAt.Add(pushedAtKey(repoID, sha), t)
 }
 
+func (c *LRUGlobalCache) GetMembership(group, user string) (bool, bool) {
+	if val, ok := c.get(membershipCacheKey(c.groupGeneration(group), group, user)); ok {
+		isMember, ok := val.(bool)
+		return isMember, ok
+	}
+	return false, false
+}
+
+func (c *LRUGlobalCache) SetMembership(group, user string, isMember bool) {
+	c.set(membershipCacheKey(c.groupGeneration(group), group, user), isMember)
+}
+
+func (c *LRUGlobalCache) GetMembers(group string) ([]string, bool) {
+	if val, ok := c.get(membersCacheKey(c.groupGeneration(group), group)); ok {
+		members, ok := val.([]string)
+		return members, ok
+	}
+	return nil, false
+}
+
+func (c *LRUGlobalCache) SetMembers(group string, members []string) {
+	c.set(membersCacheKey(c.groupGeneration(group), group), members)
+}
+
+func (c *LRUGlobalCache) GetPermission(repoID int64, user string) (Permission, bool) {
+	if val, ok := c.get(c.permissionKey(repoID, user)); ok {
+		perm, ok := val.(Permission)
+		return perm, ok
+	}
+	return PermissionNone, false
+}
+
+func (c *LRUGlobalCache) SetPermission(repoID int64, user string, perm Permission) {
+	c.set(c.permissionKey(repoID, user), perm)
+}
+
+func (c *LRUGlobalCache) InvalidateGroup(group string) {
+	c.invalidate(groupGeneration(group))
+}
+
+func (c *LRUGlobalCache) InvalidateRepository(repoID int64) {
+	c.invalidate(repoGeneration(repoID))
+}
+
+func (c *LRUGlobalCache) InvalidateUser(user string) {
+	c.invalidate(userGeneration(user))
+}
+
+// groupGeneration returns the generation of the values for a group. Team
+// values also depend on the generation of the organization.
+func (c *LRUGlobalCache) groupGeneration(group string) string {
+	org, _, isTeam := strings.Cut(group, "/")
+	gen := strconv.FormatUint(c.generation(groupGeneration(org)), 10)
+	if isTeam {
+		gen += "." + strconv.FormatUint(c.generation(groupGeneration(group)), 10)
+	}
+	return gen
+}
+
+func (c *LRUGlobalCache) permissionKey(repoID int64, user string) string {
+	return permissionCacheKey(c.generation(repoGeneration(repoID)), c.generation(userGeneration(user)), repoID, user)
+}
+
+func (c *LRUGlobalCache) get(key string) (interface{}, bool) {
+	if c.membership == nil {
+		return nil, false
+	}
+	if val, ok := c.membership.Get(key); ok {
+		if e, ok := val.(ttlEntry); ok && time.Now().Before(e.expires) {
+			return e.value, true
+		}
+		c.membership.Remove(key)
+	}
+	return nil, false
+}
+
+func (c *LRUGlobalCache) set(key string, value interface{}) {
+	if c.membership == nil {
+		return
+	}
+	c.membership.Add(key, ttlEntry{value: value, expires: time.Now().Add(c.ttl)})
+}
+
+// generation returns the current generation of a set of values. Keys include
+// the generation, so incrementing it makes all existing values unreachable.
+// The old values are eventually evicted from the LRU cache.
+func (c *LRUGlobalCache) generation(name string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[name]
+}
+
+func (c *LRUGlobalCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[name]++
+}
+
 func pushedAtKey(repoID int64, sha string) string {
 	return fmt.Sprintf("%d:%s", repoID, sha)
 }
+
+func groupGeneration(group string) string {
+	return "group:" + strings.ToLower(group)
+}
+
+func repoGeneration(repoID int64) string {
+	return fmt.Sprintf("repo:%d", repoID)
+}
+
+func userGeneration(user string) string {
+	return "user:" + strings.ToLower(user)
+}
+
+func membershipCacheKey(gen, group, user string) string {
+	return fmt.Sprintf("membership:%s:%s:%s", gen, strings.ToLower(group), strings.ToLower(user))
+}
+
+func membersCacheKey(gen, group string) string {
+	return fmt.Sprintf("members:%s:%s", gen, strings.ToLower(group))
+}
+
+func permissionCacheKey(repoGen, userGen uint64, repoID int64, user string) string {
+	return fmt.Sprintf("permission:%d:%d:%d:%s", repoGen, userGen, repoID, strings.ToLower(user))
+}
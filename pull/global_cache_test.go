@@ -0,0 +1,236 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUGlobalCache(t *testing.T) {
+	t.Run("membershipDisabled", func(t *testing.T) {
+		gc, err := NewLRUGlobalCache(16)
+		require.NoError(t, err)
+
+		gc.SetMembership("org/team", "mhaypenny", true)
+		_, ok := gc.GetMembership("org/team", "mhaypenny")
+		assert.False(t, ok, "membership was cached when disabled")
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		gc, err := NewLRUGlobalCacheWithMembership(16, 16, 10*time.Millisecond)
+		require.NoError(t, err)
+
+		gc.SetMembership("org/team", "mhaypenny", true)
+		isMember, ok := gc.GetMembership("org/team", "mhaypenny")
+		assert.True(t, ok)
+		assert.True(t, isMember)
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, ok = gc.GetMembership("org/team", "mhaypenny")
+		assert.False(t, ok, "membership was not expired")
+	})
+
+	gc, err := NewLRUGlobalCacheWithMembership(16, 16, time.Hour)
+	require.NoError(t, err)
+	testGlobalCache(t, gc)
+}
+
+func TestNetworkGlobalCache(t *testing.T) {
+	t.Run("membershipDisabled", func(t *testing.T) {
+		gc := NewNetworkGlobalCache(newLocalNetworkCache(), 0)
+
+		gc.SetMembers("org", []string{"mhaypenny"})
+		_, ok := gc.GetMembers("org")
+		assert.False(t, ok, "members were cached when disabled")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		nc := newLocalNetworkCache()
+		nc.err = errors.New("connection refused")
+
+		var reported int
+		gc := NewNetworkGlobalCache(nc, time.Hour)
+		gc.OnError = func(err error) { reported++ }
+
+		gc.SetPushedAt(1, "abc", time.Now())
+		_, ok := gc.GetPushedAt(1, "abc")
+		assert.False(t, ok)
+		assert.Equal(t, 2, reported, "incorrect number of reported errors")
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		nc := newLocalNetworkCache()
+		gc1 := NewNetworkGlobalCache(nc, time.Hour)
+		gc2 := NewNetworkGlobalCache(nc, time.Hour)
+
+		gc1.SetPermission(1, "mhaypenny", PermissionAdmin)
+		perm, ok := gc2.GetPermission(1, "mhaypenny")
+		assert.True(t, ok)
+		assert.Equal(t, PermissionAdmin, perm)
+
+		gc2.InvalidateRepository(1)
+		_, ok = gc1.GetPermission(1, "mhaypenny")
+		assert.False(t, ok, "permission was not invalidated on other server")
+	})
+
+	testGlobalCache(t, NewNetworkGlobalCache(newLocalNetworkCache(), time.Hour))
+}
+
+func testGlobalCache(t *testing.T, gc GlobalCache) {
+	t.Run("pushedAt", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		gc.SetPushedAt(1, "abc", now)
+
+		pushedAt, ok := gc.GetPushedAt(1, "abc")
+		assert.True(t, ok)
+		assert.True(t, now.Equal(pushedAt), "incorrect push time: %s", pushedAt)
+
+		_, ok = gc.GetPushedAt(2, "abc")
+		assert.False(t, ok)
+	})
+
+	t.Run("membership", func(t *testing.T) {
+		gc.SetMembership("Org/Team", "MHaypenny", true)
+		gc.SetMembership("org", "mhaypenny", false)
+
+		isMember, ok := gc.GetMembership("org/team", "mhaypenny")
+		assert.True(t, ok)
+		assert.True(t, isMember, "names should not be case-sensitive")
+
+		isMember, ok = gc.GetMembership("org", "mhaypenny")
+		assert.True(t, ok)
+		assert.False(t, isMember)
+
+		gc.InvalidateGroup("org/team")
+
+		_, ok = gc.GetMembership("org/team", "mhaypenny")
+		assert.False(t, ok, "team membership was not invalidated")
+
+		_, ok = gc.GetMembership("org", "mhaypenny")
+		assert.True(t, ok, "org membership was incorrectly invalidated")
+	})
+
+	t.Run("organization", func(t *testing.T) {
+		gc.SetMembership("org", "mhaypenny", true)
+		gc.SetMembership("org/team", "mhaypenny", true)
+		gc.SetMembers("org/team", []string{"mhaypenny"})
+		gc.SetMembership("other/team", "mhaypenny", true)
+
+		gc.InvalidateGroup("Org")
+
+		_, ok := gc.GetMembership("org", "mhaypenny")
+		assert.False(t, ok, "org membership was not invalidated")
+
+		_, ok = gc.GetMembership("org/team", "mhaypenny")
+		assert.False(t, ok, "team membership was not invalidated with the org")
+
+		_, ok = gc.GetMembers("org/team")
+		assert.False(t, ok, "team members were not invalidated with the org")
+
+		_, ok = gc.GetMembership("other/team", "mhaypenny")
+		assert.True(t, ok, "membership in another org was incorrectly invalidated")
+	})
+
+	t.Run("members", func(t *testing.T) {
+		gc.SetMembers("org/team", []string{"mhaypenny", "ttest"})
+
+		members, ok := gc.GetMembers("org/team")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"mhaypenny", "ttest"}, members)
+
+		gc.InvalidateGroup("org/team")
+
+		_, ok = gc.GetMembers("org/team")
+		assert.False(t, ok, "team members were not invalidated")
+	})
+
+	t.Run("permission", func(t *testing.T) {
+		gc.SetPermission(1, "mhaypenny", PermissionWrite)
+		gc.SetPermission(2, "mhaypenny", PermissionRead)
+
+		perm, ok := gc.GetPermission(1, "mhaypenny")
+		assert.True(t, ok)
+		assert.Equal(t, PermissionWrite, perm)
+
+		gc.InvalidateRepository(1)
+
+		_, ok = gc.GetPermission(1, "mhaypenny")
+		assert.False(t, ok, "permission was not invalidated")
+
+		perm, ok = gc.GetPermission(2, "mhaypenny")
+		assert.True(t, ok, "permission was incorrectly invalidated")
+		assert.Equal(t, PermissionRead, perm)
+
+		gc.InvalidateUser("MHaypenny")
+
+		_, ok = gc.GetPermission(2, "mhaypenny")
+		assert.False(t, ok, "user permission was not invalidated")
+	})
+}
+
+// localNetworkCache is an in-memory stand-in for a network cache
+type localNetworkCache struct {
+	mu     sync.Mutex
+	values map[string]localNetworkValue
+	err    error
+}
+
+type localNetworkValue struct {
+	value   []byte
+	expires time.Time
+}
+
+func newLocalNetworkCache() *localNetworkCache {
+	return &localNetworkCache{values: make(map[string]localNetworkValue)}
+}
+
+func (c *localNetworkCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, false, c.err
+	}
+
+	v, ok := c.values[key]
+	if !ok || (!v.expires.IsZero() && time.Now().After(v.expires)) {
+		return nil, false, nil
+	}
+	return v.value, true, nil
+}
+
+func (c *localNetworkCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	v := localNetworkValue{value: value}
+	if ttl > 0 {
+		v.expires = time.Now().Add(ttl)
+	}
+	c.values[key] = v
+	return nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultNetworkCacheTimeout is the default timeout for network cache
+	// operations.
+	DefaultNetworkCacheTimeout = 500 * time.Millisecond
+
+	// networkPushedAtTTL is the TTL for commit push times. These values never
+	// become stale, but setting a TTL lets the network cache reclaim space.
+	networkPushedAtTTL = 30 * 24 * time.Hour
+
+	// networkGenerationTTL is the TTL for generation values. It must be longer
+	// than the TTL of any value that includes the generation in its key.
+	networkGenerationTTL = 90 * 24 * time.Hour
+)
+
+// NetworkCache is a key-value store that is shared by multiple policy-bot
+// servers, like Redis or Memcached. Implementations must be safe for
+// concurrent use.
+type NetworkCache interface {
+	// Get returns the value for key and true if the key exists.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set stores the value for key. If ttl is positive, the value expires
+	// after the TTL.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// NetworkGlobalCache is a GlobalCache that stores values in a NetworkCache so
+// they are shared by all policy-bot servers. Because cache failures only cause
+// additional GitHub requests, errors are reported to OnError and otherwise
+// treated as cache misses.
+type NetworkGlobalCache struct {
+	cache   NetworkCache
+	ttl     time.Duration
+	timeout time.Duration
+
+	// OnError, if set, is called with any error returned by the network
+	// cache.
+	OnError func(err error)
+}
+
+// NewNetworkGlobalCache creates a NetworkGlobalCache. Membership and permission
+// values expire after ttl; if ttl is zero, these values are not cached.
+func NewNetworkGlobalCache(cache NetworkCache, ttl time.Duration) *NetworkGlobalCache {
+	return &NetworkGlobalCache{
+		cache:   cache,
+		ttl:     ttl,
+		timeout: DefaultNetworkCacheTimeout,
+	}
+}
+
+func (c *NetworkGlobalCache) GetPushedAt(repoID int64, sha string) (time.Time, bool) {
+	var t time.Time
+	ok := c.get("pushedAt:"+pushedAtKey(repoID, sha), &t)
+	return t, ok
+}
+
+func (c *NetworkGlobalCache) SetPushedAt(repoID int64, sha string, t time.Time) {
+	c.set("pushedAt:"+pushedAtKey(repoID, sha), t, networkPushedAtTTL)
+}
+
+func (c *NetworkGlobalCache) GetMembership(group, user string) (bool, bool) {
+	if c.ttl <= 0 {
+		return false, false
+	}
+	gen, ok := c.groupGeneration(group)
+	if !ok {
+		return false, false
+	}
+	var isMember bool
+	ok = c.get(membershipCacheKey(gen, group, user), &isMember)
+	return isMember, ok
+}
+
+func (c *NetworkGlobalCache) SetMembership(group, user string, isMember bool) {
+	if c.ttl <= 0 {
+		return
+	}
+	if gen, ok := c.groupGeneration(group); ok {
+		c.set(membershipCacheKey(gen, group, user), isMember, c.ttl)
+	}
+}
+
+func (c *NetworkGlobalCache) GetMembers(group string) ([]string, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	gen, ok := c.groupGeneration(group)
+	if !ok {
+		return nil, false
+	}
+	var members []string
+	ok = c.get(membersCacheKey(gen, group), &members)
+	return members, ok
+}
+
+func (c *NetworkGlobalCache) SetMembers(group string, members []string) {
+	if c.ttl <= 0 {
+		return
+	}
+	if gen, ok := c.groupGeneration(group); ok {
+		c.set(membersCacheKey(gen, group), members, c.ttl)
+	}
+}
+
+func (c *NetworkGlobalCache) GetPermission(repoID int64, user string) (Permission, bool) {
+	if c.ttl <= 0 {
+		return PermissionNone, false
+	}
+	key, ok := c.permissionKey(repoID, user)
+	if !ok {
+		return PermissionNone, false
+	}
+	var perm Permission
+	ok = c.get(key, &perm)
+	return perm, ok
+}
+
+func (c *NetworkGlobalCache) SetPermission(repoID int64, user string, perm Permission) {
+	if c.ttl <= 0 {
+		return
+	}
+	if key, ok := c.permissionKey(repoID, user); ok {
+		c.set(key, perm, c.ttl)
+	}
+}
+
+func (c *NetworkGlobalCache) InvalidateGroup(group string) {
+	c.invalidate(groupGeneration(group))
+}
+
+func (c *NetworkGlobalCache) InvalidateRepository(repoID int64) {
+	c.invalidate(repoGeneration(repoID))
+}
+
+func (c *NetworkGlobalCache) InvalidateUser(user string) {
+	c.invalidate(userGeneration(user))
+}
+
+// groupGeneration returns the generation of the values for a group and true
+// if it could be read. Team values also depend on the generation of the
+// organization.
+func (c *NetworkGlobalCache) groupGeneration(group string) (string, bool) {
+	org, _, isTeam := strings.Cut(group, "/")
+	orgGen, ok := c.generation(groupGeneration(org))
+	if !ok {
+		return "", false
+	}
+	gen := strconv.FormatUint(orgGen, 10)
+	if isTeam {
+		teamGen, ok := c.generation(groupGeneration(group))
+		if !ok {
+			return "", false
+		}
+		gen += "." + strconv.FormatUint(teamGen, 10)
+	}
+	return gen, true
+}
+
+func (c *NetworkGlobalCache) permissionKey(repoID int64, user string) (string, bool) {
+	repoGen, ok := c.generation(repoGeneration(repoID))
+	if !ok {
+		return "", false
+	}
+	userGen, ok := c.generation(userGeneration(user))
+	if !ok {
+		return "", false
+	}
+	return permissionCacheKey(repoGen, userGen, repoID, user), true
+}
+
+// generation returns the current generation of a set of values and true if
+// the generation could be read. Servers cannot coordinate increments, so
+// generations are random values instead of counters. A missing generation is
+// zero.
+func (c *NetworkGlobalCache) generation(name string) (uint64, bool) {
+	var gen uint64
+	if ok, err := c.load("gen:"+name, &gen); err != nil {
+		return 0, false
+	} else if !ok {
+		return 0, true
+	}
+	return gen, true
+}
+
+func (c *NetworkGlobalCache) invalidate(name string) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		c.reportError(err)
+		return
+	}
+	c.set("gen:"+name, binary.BigEndian.Uint64(b[:]), networkGenerationTTL)
+}
+
+func (c *NetworkGlobalCache) get(key string, v interface{}) bool {
+	ok, err := c.load(key, v)
+	return ok && err == nil
+}
+
+func (c *NetworkGlobalCache) load(key string, v interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	b, ok, err := c.cache.Get(ctx, networkCacheKey(key))
+	if err != nil {
+		c.reportError(err)
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		c.reportError(err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *NetworkGlobalCache) set(key string, v interface{}, ttl time.Duration) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.reportError(err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if err := c.cache.Set(ctx, networkCacheKey(key), b, ttl); err != nil {
+		c.reportError(err)
+	}
+}
+
+func (c *NetworkGlobalCache) reportError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+// networkCacheKey adds a prefix to keys so that policy-bot can share a network
+// cache with other applications. Keys are hex-encoded if they contain
+// characters that some caches do not allow, like spaces.
+func networkCacheKey(key string) string {
+	for _, r := range key {
+		if r <= ' ' || r > '~' {
+			return "policy-bot:x:" + hex.EncodeToString([]byte(key))
+		}
+	}
+	return "policy-bot:" + key
+}
@@ -74,6 +74,9 @@ type Context struct {
 	LabelsValue []string
 	LabelsError error
 
+	LabelActorsValue map[string]string
+	LabelActorsError error
+
 	Draft bool
 }
 
@@ -258,5 +261,9 @@ func (c *Context) Labels() ([]string, error) {
 	return c.LabelsValue, c.LabelsError
 }
 
+func (c *Context) LabelActors() (map[string]string, error) {
+	return c.LabelActorsValue, c.LabelActorsError
+}
+
 // assert that the test object implements the full interface
 var _ pull.Context = &Context{}
@@ -0,0 +1,17 @@
+(function() {
+  const graph = document.getElementById('policy-graph');
+  if (graph) {
+    // Mermaid is large, so only load it when a user first opens the graph
+    let rendered = false;
+    graph.addEventListener('toggle', async () => {
+      if (!graph.open || rendered) {
+        return;
+      }
+      rendered = true;
+
+      const { default: mermaid } = await import(/* webpackIgnore: true */ graph.dataset.mermaidUrl);
+      mermaid.initialize({ startOnLoad: false, securityLevel: 'strict' });
+      await mermaid.run({ nodes: graph.querySelectorAll('.mermaid') });
+    });
+  }
+})();
@@ -0,0 +1,157 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package attestation creates and verifies signed statements that a commit
+// was merged after evaluation by policy-bot. Attestations are in-toto
+// statements wrapped in DSSE envelopes.
+package attestation
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/server/history"
+)
+
+const (
+	StatementType = "https://in-toto.io/Statement/v1"
+	PredicateType = "https://github.com/palantir/policy-bot/attestation/approval/v1"
+	PayloadType   = "application/vnd.in-toto+json"
+)
+
+// Statement is an in-toto statement about a merge commit.
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Predicate describes the evaluation of the pull request that produced the
+// merge commit.
+type Predicate struct {
+	Repository  string    `json:"repository"`
+	PullRequest int       `json:"pull_request"`
+	BaseRef     string    `json:"base_ref"`
+	HeadSHA     string    `json:"head_sha"`
+	MergedBy    string    `json:"merged_by"`
+	MergedAt    time.Time `json:"merged_at"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+
+	Policy history.Policy `json:"policy"`
+
+	Status            string          `json:"status"`
+	StatusDescription string          `json:"status_description"`
+	Approvers         []Approver      `json:"approvers"`
+	Result            *history.Result `json:"result"`
+}
+
+// Approver is a user whose approval satisfied a rule.
+type Approver struct {
+	User      string    `json:"user"`
+	Type      string    `json:"type"`
+	Rule      string    `json:"rule"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MergeInfo identifies a merged pull request.
+type MergeInfo struct {
+	Owner    string
+	Repo     string
+	Number   int
+	BaseRef  string
+	HeadSHA  string
+	MergeSHA string
+	MergedBy string
+	MergedAt time.Time
+}
+
+// NewStatement creates a statement for a merge commit from the final
+// evaluation result of its pull request.
+func NewStatement(m MergeInfo, policy history.Policy, evaluatedAt time.Time, result *common.Result) *Statement {
+	repository := fmt.Sprintf("%s/%s", m.Owner, m.Repo)
+
+	return &Statement{
+		Type: StatementType,
+		Subject: []Subject{
+			{
+				Name:   repository,
+				Digest: map[string]string{"gitCommit": m.MergeSHA},
+			},
+		},
+		PredicateType: PredicateType,
+		Predicate: Predicate{
+			Repository:        repository,
+			PullRequest:       m.Number,
+			BaseRef:           m.BaseRef,
+			HeadSHA:           m.HeadSHA,
+			MergedBy:          m.MergedBy,
+			MergedAt:          m.MergedAt,
+			EvaluatedAt:       evaluatedAt,
+			Policy:            policy,
+			Status:            result.Status.String(),
+			StatusDescription: result.StatusDescription,
+			Approvers:         collectApprovers(result),
+			Result:            history.NewResult(result),
+		},
+	}
+}
+
+// CommitSHA returns the merge commit SHA that is the subject of the
+// statement, or an empty string if the statement has no commit subject.
+func (s *Statement) CommitSHA() string {
+	for _, subject := range s.Subject {
+		if sha := subject.Digest["gitCommit"]; sha != "" {
+			return sha
+		}
+	}
+	return ""
+}
+
+func collectApprovers(result *common.Result) []Approver {
+	approvers := []Approver{}
+
+	var collect func(*common.Result)
+	collect = func(r *common.Result) {
+		if len(r.Children) == 0 && r.Status == common.StatusApproved {
+			for _, c := range r.Approvers {
+				approvers = append(approvers, Approver{
+					User:      c.User,
+					Type:      string(c.Type),
+					Rule:      r.Name,
+					CreatedAt: c.CreatedAt,
+				})
+			}
+		}
+		for _, c := range r.Children {
+			collect(c)
+		}
+	}
+	collect(result)
+
+	sort.SliceStable(approvers, func(i, j int) bool {
+		if approvers[i].Rule == approvers[j].Rule {
+			return approvers[i].CreatedAt.Before(approvers[j].CreatedAt)
+		}
+		return approvers[i].Rule < approvers[j].Rule
+	})
+	return approvers
+}
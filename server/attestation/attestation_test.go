@@ -0,0 +1,195 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attestation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mergeSHA = "0123456789abcdef0123456789abcdef01234567"
+
+func TestNewStatement(t *testing.T) {
+	approvedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	result := &common.Result{
+		Name:   "policy",
+		Status: common.StatusApproved,
+		Children: []*common.Result{
+			{
+				Name:   "review",
+				Status: common.StatusApproved,
+				Approvers: []*common.Candidate{
+					{User: "mhaypenny", Type: common.ReviewCandidate, CreatedAt: approvedAt.Add(time.Hour)},
+					{User: "bkeyes", Type: common.CommentCandidate, CreatedAt: approvedAt},
+				},
+			},
+			{
+				Name:   "unused",
+				Status: common.StatusPending,
+				Approvers: []*common.Candidate{
+					{User: "ignored", Type: common.ReviewCandidate, CreatedAt: approvedAt},
+				},
+			},
+		},
+	}
+
+	st := NewStatement(MergeInfo{
+		Owner:    "palantir",
+		Repo:     "policy-bot",
+		Number:   42,
+		MergeSHA: mergeSHA,
+	}, history.Policy{Path: ".policy.yml"}, approvedAt, result)
+
+	assert.Equal(t, StatementType, st.Type)
+	assert.Equal(t, PredicateType, st.PredicateType)
+	assert.Equal(t, mergeSHA, st.CommitSHA())
+	assert.Equal(t, "palantir/policy-bot", st.Predicate.Repository)
+	assert.Equal(t, "approved", st.Predicate.Status)
+	assert.Equal(t, []Approver{
+		{User: "bkeyes", Type: string(common.CommentCandidate), Rule: "review", CreatedAt: approvedAt},
+		{User: "mhaypenny", Type: string(common.ReviewCandidate), Rule: "review", CreatedAt: approvedAt.Add(time.Hour)},
+	}, st.Predicate.Approvers)
+}
+
+func TestSignAndVerify(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	keys := map[string]struct {
+		Private crypto.PrivateKey
+		Public  crypto.PublicKey
+	}{
+		"ed25519": {edKey, edPub},
+		"ecdsa":   {ecKey, &ecKey.PublicKey},
+	}
+
+	st := testStatement()
+	for name, key := range keys {
+		t.Run(name, func(t *testing.T) {
+			signer, err := NewSigner(encodePrivateKey(t, key.Private))
+			require.NoError(t, err)
+
+			env, err := signer.Sign(st)
+			require.NoError(t, err)
+			assert.Equal(t, PayloadType, env.PayloadType)
+			require.Len(t, env.Signatures, 1)
+
+			pub, err := ParsePublicKey(encodePublicKey(t, key.Public))
+			require.NoError(t, err)
+
+			verified, err := Verify(env, pub)
+			require.NoError(t, err)
+			assert.Equal(t, mergeSHA, verified.CommitSHA())
+			assert.Equal(t, st.Predicate.Status, verified.Predicate.Status)
+		})
+	}
+
+	t.Run("tamperedPayload", func(t *testing.T) {
+		signer, err := NewSigner(encodePrivateKey(t, edKey))
+		require.NoError(t, err)
+
+		env, err := signer.Sign(st)
+		require.NoError(t, err)
+
+		other := testStatement()
+		other.Predicate.Status = "approved"
+		payload, err := json.Marshal(other)
+		require.NoError(t, err)
+		env.Payload = base64.StdEncoding.EncodeToString(payload)
+
+		_, err = Verify(env, edPub)
+		assert.Error(t, err)
+	})
+
+	t.Run("wrongKey", func(t *testing.T) {
+		signer, err := NewSigner(encodePrivateKey(t, edKey))
+		require.NoError(t, err)
+
+		env, err := signer.Sign(st)
+		require.NoError(t, err)
+
+		otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		_, err = Verify(env, otherPub)
+		assert.EqualError(t, err, "no valid signature for the public key")
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+
+	env := &Envelope{
+		PayloadType: PayloadType,
+		Payload:     "e30=",
+		Signatures:  []Signature{{KeyID: "key", Sig: "c2ln"}},
+	}
+	require.NoError(t, store.Save("Palantir", "policy-bot", mergeSHA, env))
+
+	loaded, err := store.Load("palantir", "Policy-Bot", mergeSHA)
+	require.NoError(t, err)
+	assert.Equal(t, env, loaded)
+
+	missing, err := store.Load("palantir", "policy-bot", "fedcba9876543210fedcba9876543210fedcba98")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	_, err = store.Load("..", "policy-bot", mergeSHA)
+	assert.Error(t, err)
+
+	_, err = store.Load("palantir", "policy-bot", "../../etc/passwd")
+	assert.Error(t, err)
+}
+
+func testStatement() *Statement {
+	return NewStatement(MergeInfo{
+		Owner:    "palantir",
+		Repo:     "policy-bot",
+		Number:   42,
+		MergeSHA: mergeSHA,
+	}, history.Policy{Path: ".policy.yml"}, time.Now(), &common.Result{
+		Name:   "policy",
+		Status: common.StatusPending,
+	})
+}
+
+func encodePrivateKey(t *testing.T, key crypto.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func encodePublicKey(t *testing.T, key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
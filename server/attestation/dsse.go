@@ -0,0 +1,196 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attestation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Envelope is a DSSE envelope containing a signed statement.
+// See https://github.com/secure-systems-lab/dsse/blob/master/envelope.md
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Signer signs statements with an Ed25519 or ECDSA private key.
+type Signer struct {
+	key   crypto.Signer
+	keyID string
+}
+
+// NewSigner creates a Signer from a PEM-encoded PKCS #8 private key.
+func NewSigner(pemKey []byte) (*Signer, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse private key")
+	}
+
+	var signer crypto.Signer
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		signer = k
+	case *ecdsa.PrivateKey:
+		signer = k
+	default:
+		return nil, errors.Errorf("unsupported private key type %T, must be Ed25519 or ECDSA", key)
+	}
+
+	keyID, err := KeyID(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{key: signer, keyID: keyID}, nil
+}
+
+// KeyID returns the ID of a public key, which is the hex-encoded SHA-256
+// hash of its PKIX encoding.
+func KeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal public key")
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sign creates a signed envelope for the statement.
+func (s *Signer) Sign(st *Statement) (*Envelope, error) {
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal statement")
+	}
+
+	msg := pae(PayloadType, payload)
+
+	var sig []byte
+	switch k := s.key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, msg)
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(msg)
+		sig, err = ecdsa.SignASN1(rand.Reader, k, digest[:])
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign statement")
+	}
+
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []Signature{
+			{KeyID: s.keyID, Sig: base64.StdEncoding.EncodeToString(sig)},
+		},
+	}, nil
+}
+
+// ParsePublicKey parses a PEM-encoded PKIX public key.
+func ParsePublicKey(pemKey []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM public key")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse public key")
+	}
+	return pub, nil
+}
+
+// Verify checks that the envelope has a valid signature from the public key
+// and returns the statement it contains.
+func Verify(env *Envelope, pub crypto.PublicKey) (*Statement, error) {
+	if env.PayloadType != PayloadType {
+		return nil, errors.Errorf("unsupported payload type %q", env.PayloadType)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode payload")
+	}
+	msg := pae(env.PayloadType, payload)
+
+	keyID, err := KeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	verified := false
+	for _, s := range env.Signatures {
+		if s.KeyID != "" && s.KeyID != keyID {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		if verifySignature(pub, msg, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("no valid signature for the public key")
+	}
+
+	var st Statement
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, errors.Wrap(err, "failed to parse statement")
+	}
+	if st.Type != StatementType || st.PredicateType != PredicateType {
+		return nil, errors.Errorf("unsupported statement type %q with predicate type %q", st.Type, st.PredicateType)
+	}
+	return &st, nil
+}
+
+func verifySignature(pub crypto.PublicKey, msg, sig []byte) bool {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, msg, sig)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(msg)
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	}
+	return false
+}
+
+// pae returns the DSSE pre-authentication encoding of a payload.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
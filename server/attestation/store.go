@@ -0,0 +1,105 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attestation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	shaPattern  = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+)
+
+// FileStore saves attestations as JSON files in a local directory, using the
+// path <owner>/<repo>/<sha>.json.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (s *FileStore) Save(owner, repo, sha string, env *Envelope) error {
+	path, err := s.path(owner, repo, sha)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(env)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal attestation")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return errors.Wrap(err, "failed to create attestation directory")
+	}
+
+	// write to a temporary file and rename so readers never see partial data
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o640); err != nil {
+		return errors.Wrap(err, "failed to write attestation")
+	}
+	return errors.Wrap(os.Rename(tmp, path), "failed to write attestation")
+}
+
+// Load returns the attestation for a commit. It returns a nil envelope and a
+// nil error if no attestation exists.
+func (s *FileStore) Load(owner, repo, sha string) (*Envelope, error) {
+	path, err := s.path(owner, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read attestation")
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, errors.Wrap(err, "failed to parse attestation")
+	}
+	return &env, nil
+}
+
+func isValidName(name string) bool {
+	return namePattern.MatchString(name) && name != "." && name != ".."
+}
+
+// IsCommitSHA returns true if sha is a full, lowercase commit SHA.
+func IsCommitSHA(sha string) bool {
+	return shaPattern.MatchString(sha)
+}
+
+func (s *FileStore) path(owner, repo, sha string) (string, error) {
+	if !isValidName(owner) || !isValidName(repo) {
+		return "", errors.Errorf("invalid repository: %s/%s", owner, repo)
+	}
+	if !IsCommitSHA(sha) {
+		return "", errors.Errorf("invalid commit SHA: %s", sha)
+	}
+	return filepath.Join(s.dir, strings.ToLower(owner), strings.ToLower(repo), sha+".json"), nil
+}
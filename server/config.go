@@ -24,6 +24,7 @@ import (
 	"github.com/palantir/go-baseapp/baseapp/datadog"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/server/tracing"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
@@ -42,6 +43,13 @@ type Config struct {
 	Files    handler.FilesConfig           `yaml:"files"`
 	Datadog  datadog.Config                `yaml:"datadog"`
 	Workers  WorkerConfig                  `yaml:"workers"`
+	History  HistoryConfig                 `yaml:"history"`
+
+	Attestations AttestationConfig `yaml:"attestations"`
+	Reconcile    ReconcileConfig   `yaml:"reconcile"`
+	Prometheus   PrometheusConfig  `yaml:"prometheus"`
+	Tracing      tracing.Config    `yaml:"tracing"`
+	Admin        AdminConfig       `yaml:"admin"`
 }
 
 type LoggingConfig struct {
@@ -69,12 +77,105 @@ type CachingConfig struct {
 	// The size of the global cache for commit push times. Each entry uses
 	// roughly 100 bytes of memory.
 	PushedAtSize int `yaml:"pushed_at_size"`
+
+	// If set, commit push times are also stored in an embedded database at
+	// this path so they persist across restarts. The database holds at most
+	// PushedAtMaxEntries values.
+	PushedAtPath       string `yaml:"pushed_at_path"`
+	PushedAtMaxEntries int    `yaml:"pushed_at_max_entries"`
+
+	// How long to cache organization membership, team membership, and
+	// collaborator permissions across evaluations. If zero, these values are
+	// only cached during a single evaluation.
+	MembershipTTL time.Duration `yaml:"membership_ttl"`
+
+	// The size of the global cache for membership and permission values.
+	MembershipSize int `yaml:"membership_size"`
 }
 
 type WorkerConfig struct {
 	Workers       int           `yaml:"workers"`
 	QueueSize     int           `yaml:"queue_size"`
 	GithubTimeout time.Duration `yaml:"github_timeout"`
+
+	// How long to wait for additional events before evaluating a pull
+	// request after a pull_request, status, or check_run event. Events for
+	// the same pull request within this window cause a single evaluation. If
+	// zero, pull requests are evaluated immediately. Debouncing cannot be
+	// used with the durable queue.
+	DebounceWindow time.Duration `yaml:"debounce_window"`
+
+	DurableQueue DurableQueueConfig `yaml:"durable_queue"`
+}
+
+type DurableQueueConfig struct {
+	// The path to the database file that stores accepted webhook deliveries
+	// until they are processed. If empty, deliveries are queued in memory and
+	// are lost on restart.
+	Path string `yaml:"path"`
+
+	// The maximum number of attempts for deliveries that fail with temporary
+	// errors before they are moved to dead-letter storage.
+	MaxAttempts int `yaml:"max_attempts"`
+
+	// The delay before the first retry of a delivery. The delay doubles with
+	// each attempt, up to the maximum.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+type HistoryConfig struct {
+	// The path to the database file that stores evaluation history. If empty,
+	// evaluation history is not recorded.
+	Path string `yaml:"path"`
+
+	// How long to keep evaluation history. If zero, history is kept forever.
+	Retention time.Duration `yaml:"retention"`
+}
+
+type AttestationConfig struct {
+	// The PEM-encoded PKCS #8 Ed25519 or ECDSA private key used to sign
+	// attestations. If empty, attestations are not created.
+	SigningKey string `yaml:"signing_key"`
+
+	// The directory that stores attestations.
+	Path string `yaml:"path"`
+
+	// If true, post a status on each merge commit that links to the
+	// attestation.
+	PostStatus bool `yaml:"post_status"`
+}
+
+type ReconcileConfig struct {
+	// How often to evaluate all open pull requests and repair missing or
+	// stale statuses. If zero, reconciliation is disabled.
+	Interval time.Duration `yaml:"interval"`
+
+	// The maximum number of pull requests to evaluate at the same time in
+	// each installation.
+	Concurrency int `yaml:"concurrency"`
+
+	// The number of remaining GitHub API requests below which reconciliation
+	// stops for an installation until the next interval.
+	MinRateLimit int `yaml:"min_rate_limit"`
+}
+
+type PrometheusConfig struct {
+	// If true, expose metrics in the Prometheus text format at /metrics.
+	Enabled bool `yaml:"enabled"`
+
+	// If set, scrape requests must include this value as a bearer token.
+	Token string `yaml:"token"`
+}
+
+type AdminConfig struct {
+	// If set, requests to the admin API may include this value as a bearer
+	// token instead of a token for an organization admin.
+	Token string `yaml:"token"`
+
+	// The maximum number of pull requests evaluated at the same time by each
+	// admin evaluation job.
+	Concurrency int `yaml:"concurrency"`
 }
 
 type SessionsConfig struct {
@@ -98,6 +199,33 @@ func ParseConfig(bytes []byte) (*Config, error) {
 	c.Logging.SetValuesFromEnv(envPrefix)
 	c.Github.SetValuesFromEnv("")
 
+	if v, ok := os.LookupEnv(envPrefix + "CACHE_PUSHED_AT_PATH"); ok {
+		c.Cache.PushedAtPath = v
+	}
+
+	if v, ok := os.LookupEnv(envPrefix + "HISTORY_PATH"); ok {
+		c.History.Path = v
+	}
+
+	if v, ok := os.LookupEnv(envPrefix + "ATTESTATIONS_SIGNING_KEY"); ok {
+		c.Attestations.SigningKey = v
+	}
+	if v, ok := os.LookupEnv(envPrefix + "ATTESTATIONS_PATH"); ok {
+		c.Attestations.Path = v
+	}
+
+	if v, ok := os.LookupEnv(envPrefix + "PROMETHEUS_TOKEN"); ok {
+		c.Prometheus.Token = v
+	}
+
+	if v, ok := os.LookupEnv(envPrefix + "ADMIN_TOKEN"); ok {
+		c.Admin.Token = v
+	}
+
+	if v, ok := os.LookupEnv(envPrefix + "TRACING_ENDPOINT"); ok {
+		c.Tracing.Endpoint = v
+	}
+
 	if v, ok := os.LookupEnv(envPrefix + "SESSIONS_KEY"); ok {
 		c.Sessions.Key = v
 	}
@@ -0,0 +1,153 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package debounce coalesces bursts of evaluations for the same pull request
+// into a single evaluation.
+package debounce
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+)
+
+const (
+	MetricsKeyScheduled = "policybot.debounce.scheduled"
+	MetricsKeyCoalesced = "policybot.debounce.coalesced"
+	MetricsKeyDropped   = "policybot.debounce.dropped"
+
+	// EventType is the event type of the dispatches created by a Debouncer.
+	EventType = "debounced_evaluation"
+)
+
+// Func evaluates a pull request for a trigger.
+type Func func(ctx context.Context, trigger common.Trigger, loc pull.Locator) error
+
+// Debouncer delays evaluations of pull requests for a fixed window. If more
+// evaluations of the same pull request are requested during the window, they
+// are merged with the pending evaluation by combining their triggers. When
+// the window ends, the Debouncer submits a single evaluation to a scheduler.
+type Debouncer struct {
+	window    time.Duration
+	scheduler githubapp.Scheduler
+	registry  metrics.Registry
+
+	mu      sync.Mutex
+	pending map[string]*evaluation
+}
+
+type evaluation struct {
+	ctx     context.Context
+	trigger common.Trigger
+	loc     pull.Locator
+	fn      Func
+	count   int
+}
+
+// New creates a Debouncer that submits evaluations to the scheduler. If
+// registry is non-nil, the Debouncer records metrics in it.
+func New(window time.Duration, scheduler githubapp.Scheduler, registry metrics.Registry) *Debouncer {
+	return &Debouncer{
+		window:    window,
+		scheduler: scheduler,
+		registry:  registry,
+		pending:   make(map[string]*evaluation),
+	}
+}
+
+// Add requests an evaluation of the pull request identified by loc. If an
+// evaluation of the pull request is already pending, the trigger is added to
+// the pending evaluation and the locator replaces the pending locator.
+// Otherwise, fn is called with the combined trigger when the window ends.
+func (d *Debouncer) Add(ctx context.Context, trigger common.Trigger, loc pull.Locator, fn Func) {
+	key := fmt.Sprintf("%s/%s#%d", strings.ToLower(loc.Owner), strings.ToLower(loc.Repo), loc.Number)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e, ok := d.pending[key]; ok {
+		e.trigger |= trigger
+		e.loc = loc
+		e.count++
+		d.incCounter(MetricsKeyCoalesced)
+		return
+	}
+
+	d.pending[key] = &evaluation{
+		ctx:     ctx,
+		trigger: trigger,
+		loc:     loc,
+		fn:      fn,
+		count:   1,
+	}
+	time.AfterFunc(d.window, func() { d.flush(key) })
+}
+
+// Pending returns the number of pull requests with pending evaluations.
+func (d *Debouncer) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
+
+func (d *Debouncer) flush(key string) {
+	d.mu.Lock()
+	e := d.pending[key]
+	delete(d.pending, key)
+	d.mu.Unlock()
+
+	if e == nil {
+		return
+	}
+
+	logger := zerolog.Ctx(e.ctx)
+	logger.Debug().Msgf("Evaluating %s for %s after coalescing %d requests", key, e.trigger, e.count)
+
+	dispatch := githubapp.Dispatch{
+		Handler:   &handler{e: e},
+		EventType: EventType,
+	}
+	if err := d.scheduler.Schedule(e.ctx, dispatch); err != nil {
+		logger.Error().Err(err).Msgf("Failed to schedule evaluation of %s", key)
+		d.incCounter(MetricsKeyDropped)
+		return
+	}
+	d.incCounter(MetricsKeyScheduled)
+}
+
+func (d *Debouncer) incCounter(name string) {
+	if d.registry != nil {
+		metrics.GetOrRegisterCounter(name, d.registry).Inc(1)
+	}
+}
+
+// handler adapts a pending evaluation to the githubapp.EventHandler interface
+// so it can run on the same workers as webhook handlers.
+type handler struct {
+	e *evaluation
+}
+
+func (h *handler) Handles() []string { return []string{EventType} }
+
+func (h *handler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	return h.e.fn(ctx, h.e.trigger, h.e.loc)
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debounce
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebouncer(t *testing.T) {
+	registry := metrics.NewRegistry()
+	d := New(50*time.Millisecond, githubapp.DefaultScheduler(), registry)
+
+	var mu sync.Mutex
+	calls := make(map[int][]common.Trigger)
+	titles := make(map[int]string)
+
+	done := make(chan struct{}, 2)
+	fn := func(ctx context.Context, trigger common.Trigger, loc pull.Locator) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[loc.Number] = append(calls[loc.Number], trigger)
+		titles[loc.Number] = loc.Value.GetTitle()
+		done <- struct{}{}
+		return nil
+	}
+
+	ctx := context.Background()
+	d.Add(ctx, common.TriggerStatus, locator("Palantir", 1, "first"), fn)
+	d.Add(ctx, common.TriggerCommit, locator("palantir", 1, "second"), fn)
+	d.Add(ctx, common.TriggerStatus, locator("palantir", 1, "third"), fn)
+	d.Add(ctx, common.TriggerLabel, locator("palantir", 2, "other"), fn)
+
+	assert.Equal(t, 2, d.Pending())
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for evaluations")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, 0, d.Pending())
+	assert.Equal(t, []common.Trigger{common.TriggerStatus | common.TriggerCommit}, calls[1])
+	assert.Equal(t, "third", titles[1], "evaluation did not use the latest locator")
+	assert.Equal(t, []common.Trigger{common.TriggerLabel}, calls[2])
+
+	assert.Equal(t, int64(2), metrics.GetOrRegisterCounter(MetricsKeyCoalesced, registry).Count())
+
+	// the scheduler runs evaluations before the debouncer counts them
+	assert.Eventually(t, func() bool {
+		return metrics.GetOrRegisterCounter(MetricsKeyScheduled, registry).Count() == 2
+	}, time.Second, time.Millisecond, "incorrect number of scheduled evaluations")
+}
+
+func locator(owner string, number int, title string) pull.Locator {
+	return pull.Locator{
+		Owner:  owner,
+		Repo:   "policy-bot",
+		Number: number,
+		Value:  &github.PullRequest{Title: github.String(title)},
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+	"goji.io/pattern"
+)
+
+const (
+	DefaultAdminConcurrency = 4
+	DefaultAdminJobLimit    = 100
+)
+
+const (
+	AdminJobRunning   = "running"
+	AdminJobCompleted = "completed"
+	AdminJobFailed    = "failed"
+
+	AdminOutcomeEvaluated = "evaluated"
+	AdminOutcomeQueued    = "queued"
+	AdminOutcomeFailed    = "failed"
+)
+
+// AdminEvaluate is an API handler that starts a job to evaluate a pull
+// request, all open pull requests in a repository, or all open pull requests
+// in every repository of an installation. Evaluations use the same process as
+// webhook-driven evaluations with all triggers enabled.
+//
+// Requests must include the configured admin token or a GitHub token for a
+// user who is an admin of the organization that owns the pull requests.
+type AdminEvaluate struct {
+	Base
+
+	Jobs  *AdminJobs
+	Token string
+
+	// Concurrency is the maximum number of pull requests evaluated at the
+	// same time by each job.
+	Concurrency int
+}
+
+// AdminJobStatus is an API handler that reports the progress of a job started
+// by AdminEvaluate. It uses the same authentication as AdminEvaluate.
+type AdminJobStatus struct {
+	Base
+
+	Jobs  *AdminJobs
+	Token string
+}
+
+// AdminJob is the state of an evaluation job. All fields are safe to read
+// from a value returned by AdminJobs.Get.
+type AdminJob struct {
+	ID     string `json:"id"`
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo,omitempty"`
+	Number int    `json:"number,omitempty"`
+
+	State       string     `json:"state"`
+	Error       string     `json:"error,omitempty"`
+	RequestedBy string     `json:"requested_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+
+	// Total is the number of pull requests found so far. It increases while
+	// a repository or installation job lists pull requests.
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+
+	Results []AdminPullResult `json:"results"`
+}
+
+type AdminPullResult struct {
+	Repo    string `json:"repo"`
+	Number  int    `json:"number"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Target returns a description of the pull requests evaluated by the job.
+func (j *AdminJob) Target() string {
+	switch {
+	case j.Number > 0:
+		return fmt.Sprintf("%s/%s#%d", j.Owner, j.Repo, j.Number)
+	case j.Repo != "":
+		return fmt.Sprintf("%s/%s", j.Owner, j.Repo)
+	default:
+		return j.Owner
+	}
+}
+
+// AdminJobs stores the state of evaluation jobs in memory. Only the most
+// recent jobs are kept.
+type AdminJobs struct {
+	limit int
+
+	mu    sync.Mutex
+	jobs  map[string]*AdminJob
+	order []string
+}
+
+// NewAdminJobs creates a store that keeps up to limit jobs. If limit is zero,
+// DefaultAdminJobLimit is used.
+func NewAdminJobs(limit int) *AdminJobs {
+	if limit <= 0 {
+		limit = DefaultAdminJobLimit
+	}
+	return &AdminJobs{
+		limit: limit,
+		jobs:  make(map[string]*AdminJob),
+	}
+}
+
+// Get returns a copy of the job with the given ID.
+func (s *AdminJobs) Get(id string) (AdminJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return AdminJob{}, false
+	}
+
+	cp := *job
+	cp.Results = append([]AdminPullResult{}, job.Results...)
+	return cp, true
+}
+
+func (s *AdminJobs) create(job *AdminJob) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return errors.Wrap(err, "failed to generate job ID")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job.ID = hex.EncodeToString(id)
+	job.State = AdminJobRunning
+	job.CreatedAt = time.Now()
+	job.Results = []AdminPullResult{}
+
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+	for len(s.order) > s.limit {
+		delete(s.jobs, s.order[0])
+		s.order = s.order[1:]
+	}
+	return nil
+}
+
+func (s *AdminJobs) update(job *AdminJob, fn func(job *AdminJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(job)
+}
+
+func (h *AdminEvaluate) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	job := &AdminJob{
+		Owner: pat.Param(r, "owner"),
+		Repo:  optionalParam(r, "repo"),
+	}
+	if n := optionalParam(r, "number"); n != "" {
+		number, err := strconv.Atoi(n)
+		if err != nil || number <= 0 {
+			return writeAPIError(w, http.StatusBadRequest, "invalid pull request number")
+		}
+		job.Number = number
+	}
+
+	actor, status, err := authorizeAdmin(ctx, r, &h.Base, h.Token, job.Owner)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return writeAPIError(w, status, http.StatusText(status))
+	}
+	job.RequestedBy = actor
+
+	installation, err := h.Installations.GetByOwner(ctx, job.Owner)
+	if err != nil {
+		return writeAPIError(w, http.StatusNotFound, "not installed in org")
+	}
+
+	if err := h.Jobs.create(job); err != nil {
+		return err
+	}
+
+	logger := zerolog.Ctx(ctx).With().
+		Str("admin_job_id", job.ID).
+		Int64(githubapp.LogKeyInstallationID, installation.ID).
+		Logger()
+
+	logger.Info().
+		Str(LogKeyAudit, "admin_evaluate").
+		Msgf("Entity %s requested evaluation of %s", actor, job.Target())
+
+	// The job outlives the request, so it uses a new context
+	go h.run(logger.WithContext(context.Background()), installation.ID, job)
+
+	cp, _ := h.Jobs.Get(job.ID)
+	baseapp.WriteJSON(w, http.StatusAccepted, &cp)
+	return nil
+}
+
+func (h *AdminEvaluate) run(ctx context.Context, installationID int64, job *AdminJob) {
+	logger := zerolog.Ctx(ctx)
+
+	err := h.evaluateTarget(ctx, installationID, job)
+
+	h.Jobs.update(job, func(job *AdminJob) {
+		finishedAt := time.Now()
+		job.FinishedAt = &finishedAt
+		job.State = AdminJobCompleted
+		if err != nil {
+			job.State = AdminJobFailed
+			job.Error = err.Error()
+		}
+	})
+
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to evaluate %s", job.Target())
+		return
+	}
+	logger.Info().Msgf("Finished evaluating %s", job.Target())
+}
+
+func (h *AdminEvaluate) evaluateTarget(ctx context.Context, installationID int64, job *AdminJob) error {
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create installation client")
+	}
+
+	if job.Number > 0 {
+		pr, _, err := client.PullRequests.Get(ctx, job.Owner, job.Repo, job.Number)
+		if err != nil {
+			return errors.Wrap(err, "failed to get pull request")
+		}
+		h.evaluatePullRequests(ctx, installationID, job, []*github.PullRequest{pr})
+		return nil
+	}
+
+	repos := []string{job.Repo}
+	if job.Repo == "" {
+		all, err := listInstallationRepositories(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		repos = repos[:0]
+		for _, repo := range all {
+			if !repo.GetArchived() {
+				repos = append(repos, repo.GetName())
+			}
+		}
+	}
+
+	for _, repo := range repos {
+		prs, err := listOpenPullRequests(ctx, client, job.Owner, repo)
+		if err != nil {
+			return err
+		}
+		h.evaluatePullRequests(ctx, installationID, job, prs)
+	}
+	return nil
+}
+
+func (h *AdminEvaluate) evaluatePullRequests(ctx context.Context, installationID int64, job *AdminJob, prs []*github.PullRequest) {
+	h.Jobs.update(job, func(job *AdminJob) { job.Total += len(prs) })
+
+	concurrency := h.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultAdminConcurrency
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, pr := range prs {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(pr *github.PullRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			prCtx, logger := h.PreparePRContext(ctx, installationID, pr)
+
+			err := h.Evaluate(prCtx, installationID, common.TriggerAll, pull.Locator{
+				Owner:  pr.GetBase().GetRepo().GetOwner().GetLogin(),
+				Repo:   pr.GetBase().GetRepo().GetName(),
+				Number: pr.GetNumber(),
+				Value:  pr,
+			})
+
+			res := AdminPullResult{
+				Repo:    pr.GetBase().GetRepo().GetName(),
+				Number:  pr.GetNumber(),
+				Outcome: AdminOutcomeEvaluated,
+			}
+			switch {
+			case err != nil:
+				logger.Error().Err(err).Msg("Failed to evaluate pull request")
+				res.Outcome = AdminOutcomeFailed
+				res.Error = err.Error()
+			case h.Debouncer != nil:
+				res.Outcome = AdminOutcomeQueued
+			}
+
+			h.Jobs.update(job, func(job *AdminJob) {
+				job.Completed++
+				if err != nil {
+					job.Failed++
+				}
+				job.Results = append(job.Results, res)
+			})
+		}(pr)
+	}
+	wg.Wait()
+}
+
+func (h *AdminJobStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	if getToken(r) == "" {
+		return writeAPIError(w, http.StatusUnauthorized, "missing token")
+	}
+
+	job, ok := h.Jobs.Get(pat.Param(r, "id"))
+	if !ok {
+		return writeAPIError(w, http.StatusNotFound, "failed to find job")
+	}
+
+	_, status, err := authorizeAdmin(ctx, r, &h.Base, h.Token, job.Owner)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		// Hide jobs for other organizations
+		if status == http.StatusForbidden {
+			status = http.StatusNotFound
+		}
+		return writeAPIError(w, status, http.StatusText(status))
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, &job)
+	return nil
+}
+
+// authorizeAdmin checks that a request includes the admin token or a token
+// for a user who is an admin of the owner organization. It returns the name
+// of the authorized entity or an HTTP status code if the request is not
+// authorized.
+func authorizeAdmin(ctx context.Context, r *http.Request, b *Base, adminToken, owner string) (string, int, error) {
+	token := getToken(r)
+	if token == "" {
+		return "", http.StatusUnauthorized, nil
+	}
+	if adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+		return "admin token", 0, nil
+	}
+
+	client, err := b.NewTokenClient(token)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "failed to create token client")
+	}
+
+	membership, _, err := client.Organizations.GetOrgMembership(ctx, "", owner)
+	if err != nil {
+		var rerr *github.ErrorResponse
+		if errors.As(err, &rerr) {
+			switch rerr.Response.StatusCode {
+			case http.StatusUnauthorized:
+				return "", http.StatusUnauthorized, nil
+			case http.StatusForbidden, http.StatusNotFound:
+				return "", http.StatusForbidden, nil
+			}
+		}
+		return "", 0, errors.Wrap(err, "failed to get organization membership")
+	}
+
+	if membership.GetState() != "active" || membership.GetRole() != "admin" {
+		return "", http.StatusForbidden, nil
+	}
+	return membership.GetUser().GetLogin(), 0, nil
+}
+
+// optionalParam returns the value of a path parameter or an empty string if
+// the route does not define the parameter.
+func optionalParam(r *http.Request, name string) string {
+	value, _ := r.Context().Value(pattern.Variable(name)).(string)
+	return value
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/server/attestation"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+)
+
+// Attestor signs and stores attestations for merged pull requests.
+type Attestor struct {
+	Signer *attestation.Signer
+	Store  *attestation.FileStore
+
+	// If true, post a status on the merge commit that links to the
+	// attestation.
+	PostStatus bool
+}
+
+// attest saves a signed attestation for the merge commit of a pull request
+// using the result of its final evaluation.
+func (h *PullRequest) attest(ctx context.Context, evalCtx *EvalContext, merge attestation.MergeInfo, result *common.Result) error {
+	logger := zerolog.Ctx(ctx)
+
+	policy := history.Policy{
+		Source: evalCtx.Config.Source,
+		Path:   evalCtx.Config.Path,
+		SHA:    evalCtx.Config.SHA,
+	}
+
+	st := attestation.NewStatement(merge, policy, evalCtx.PullContext.EvaluationTimestamp(), result)
+	env, err := h.Attestor.Signer.Sign(st)
+	if err != nil {
+		return err
+	}
+	if err := h.Attestor.Store.Save(merge.Owner, merge.Repo, merge.MergeSHA, env); err != nil {
+		return errors.Wrap(err, "failed to save attestation")
+	}
+
+	logger.Info().Msgf("Saved attestation for merge commit %s with policy status %s", merge.MergeSHA, result.Status)
+
+	if h.Attestor.PostStatus {
+		status := github.RepoStatus{
+			State:       github.String(attestationState(result)),
+			Context:     github.String(fmt.Sprintf("%s: attestation", h.PullOpts.StatusCheckContext)),
+			Description: github.String(fmt.Sprintf("Signed attestation of merge with policy status %s", result.Status)),
+			TargetURL:   github.String(AttestationURL(h.BaseConfig.PublicURL, merge.Owner, merge.Repo, merge.MergeSHA)),
+		}
+		if err := PostStatus(ctx, evalCtx.Client, merge.Owner, merge.Repo, merge.MergeSHA, &status); err != nil {
+			logger.Err(err).Msg("Failed to post attestation status")
+		}
+	}
+	return nil
+}
+
+// attestationState returns the state of the attestation status for a merge
+// commit. The pull request is already merged, so the policy cannot change and
+// any result other than approval is a failure instead of pending.
+func attestationState(result *common.Result) string {
+	switch {
+	case result.Error != nil:
+		return "error"
+	case result.Status == common.StatusApproved:
+		return "success"
+	default:
+		return "failure"
+	}
+}
+
+// AttestationURL returns the API URL of the attestation for a merge commit.
+func AttestationURL(publicURL, owner, repo, sha string) string {
+	return fmt.Sprintf("%s/api/attestations/%s/%s/%s", strings.TrimSuffix(publicURL, "/"), owner, repo, sha)
+}
+
+// Attestations is an API handler that returns the signed attestation for a
+// merge commit. The user who owns the provided token must be able to read the
+// repository.
+type Attestations struct {
+	Base
+}
+
+func (h *Attestations) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	token := getToken(r)
+	if token == "" {
+		return writeAPIError(w, http.StatusUnauthorized, "missing token")
+	}
+
+	if h.Attestor == nil {
+		return writeAPIError(w, http.StatusNotFound, "attestations are not enabled")
+	}
+
+	client, err := h.NewTokenClient(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create token client")
+	}
+
+	owner := pat.Param(r, "owner")
+	repo := pat.Param(r, "repo")
+	sha := pat.Param(r, "sha")
+	if !attestation.IsCommitSHA(sha) {
+		return writeAPIError(w, http.StatusBadRequest, "invalid commit SHA")
+	}
+
+	if _, _, err := client.Repositories.Get(ctx, owner, repo); err != nil {
+		if isNotFound(err) {
+			return writeAPIError(w, http.StatusNotFound, "failed to find repository")
+		}
+		return errors.Wrap(err, "failed to get repository")
+	}
+
+	env, err := h.Attestor.Store.Load(owner, repo, sha)
+	if err != nil {
+		return errors.Wrap(err, "failed to load attestation")
+	}
+	if env == nil {
+		return writeAPIError(w, http.StatusNotFound, "no attestation for commit")
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, env)
+	return nil
+}
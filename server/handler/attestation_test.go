@@ -0,0 +1,57 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttestationState(t *testing.T) {
+	tests := map[string]struct {
+		Result   common.Result
+		Expected string
+	}{
+		"approved": {
+			Result:   common.Result{Status: common.StatusApproved},
+			Expected: "success",
+		},
+		"pending": {
+			Result:   common.Result{Status: common.StatusPending},
+			Expected: "failure",
+		},
+		"disapproved": {
+			Result:   common.Result{Status: common.StatusDisapproved},
+			Expected: "failure",
+		},
+		"skipped": {
+			Result:   common.Result{Status: common.StatusSkipped},
+			Expected: "failure",
+		},
+		"error": {
+			Result:   common.Result{Status: common.StatusApproved, Error: errors.New("evaluation failed")},
+			Expected: "error",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, attestationState(&test.Result))
+		})
+	}
+}
@@ -22,7 +22,10 @@ import (
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/debounce"
+	"github.com/palantir/policy-bot/server/history"
 	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
 	"github.com/rs/zerolog"
 )
 
@@ -38,6 +41,15 @@ type Base struct {
 	ConfigFetcher *ConfigFetcher
 	BaseConfig    *baseapp.HTTPConfig
 	PullOpts      *PullEvaluationOptions
+	History       history.Store
+	Attestor      *Attestor
+	Registry      metrics.Registry
+	Retry         RetryPolicy
+
+	// Debouncer, if non-nil, delays and coalesces evaluations requested by
+	// Evaluate. Evaluations that run directly from an EvalContext are not
+	// affected.
+	Debouncer *debounce.Debouncer
 
 	AppName string
 }
@@ -69,7 +81,7 @@ func (b *Base) NewEvalContext(ctx context.Context, installationID int64, loc pul
 		return nil, err
 	}
 
-	mbrCtx := NewCrossOrgMembershipContext(ctx, client, loc.Owner, b.Installations, b.ClientCreator)
+	mbrCtx := NewCrossOrgMembershipContext(ctx, client, loc.Owner, b.Installations, b.ClientCreator, b.GlobalCache)
 	prctx, err := pull.NewGitHubContext(ctx, mbrCtx, b.GlobalCache, client, v4client, loc)
 	if err != nil {
 		return nil, err
@@ -88,15 +100,75 @@ func (b *Base) NewEvalContext(ctx context.Context, installationID int64, loc pul
 		Options:   b.PullOpts,
 		PublicURL: b.BaseConfig.PublicURL,
 
-		PullContext: prctx,
-		Config:      fetchedConfig,
+		PullContext:   prctx,
+		Config:        fetchedConfig,
+		ConfigFetcher: b.ConfigFetcher,
+
+		History:  b.History,
+		Retry:    b.Retry,
+		Registry: b.Registry,
 	}, nil
 }
 
+// Evaluate evaluates a pull request for a trigger. If the Debouncer is set,
+// the evaluation happens asynchronously after the debounce window and
+// Evaluate always returns nil.
 func (b *Base) Evaluate(ctx context.Context, installationID int64, trigger common.Trigger, loc pull.Locator) error {
-	evalCtx, err := b.NewEvalContext(ctx, installationID, loc)
+	if b.Debouncer != nil {
+		b.Debouncer.Add(ctx, trigger, loc, func(ctx context.Context, trigger common.Trigger, loc pull.Locator) error {
+			return b.evaluate(ctx, installationID, trigger, loc)
+		})
+		return nil
+	}
+	return b.evaluate(ctx, installationID, trigger, loc)
+}
+
+// evaluateIf is like Evaluate, but first calls check with the evaluation
+// context and skips the evaluation if check returns false. The check always
+// runs for each request, even if the evaluation is debounced.
+func (b *Base) evaluateIf(ctx context.Context, installationID int64, trigger common.Trigger, loc pull.Locator, check func(context.Context, *EvalContext) bool) error {
+	evalCtx, err := b.newEvalContextWithRetry(ctx, installationID, loc)
 	if err != nil {
-		return errors.Wrap(err, "failed to create evaluation context")
+		return err
+	}
+	if !check(ctx, evalCtx) {
+		return nil
+	}
+	if b.Debouncer != nil {
+		return b.Evaluate(ctx, installationID, trigger, loc)
 	}
 	return evalCtx.Evaluate(ctx, trigger)
 }
+
+func (b *Base) evaluate(ctx context.Context, installationID int64, trigger common.Trigger, loc pull.Locator) error {
+	evalCtx, err := b.newEvalContextWithRetry(ctx, installationID, loc)
+	if err != nil {
+		return err
+	}
+	return evalCtx.Evaluate(ctx, trigger)
+}
+
+// newEvalContextWithRetry creates an evaluation context, retrying temporary
+// failures to load the policies. It only returns an error if it could not
+// create the context.
+func (b *Base) newEvalContextWithRetry(ctx context.Context, installationID int64, loc pull.Locator) (*EvalContext, error) {
+	var evalCtx *EvalContext
+	err := b.Retry.Do(ctx, func() error {
+		ec, err := b.NewEvalContext(ctx, installationID, loc)
+		if err != nil {
+			return err
+		}
+		evalCtx = ec
+
+		// Retry temporary failures to load policies here, because ParseConfig
+		// reports load errors without retrying
+		if pull.IsTemporaryError(ec.Config.LoadError) {
+			return ec.Config.LoadError
+		}
+		return ec.EnforcedConfig(ctx).LoadError
+	})
+	if evalCtx == nil {
+		return nil, errors.Wrap(err, "failed to create evaluation context")
+	}
+	return evalCtx, nil
+}
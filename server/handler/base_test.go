@@ -0,0 +1,131 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/debounce"
+	"github.com/shurcooL/githubv4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateIfDebounced(t *testing.T) {
+	loc := pull.Locator{
+		Owner:  "testorg",
+		Repo:   "testrepo",
+		Number: 1,
+		Value:  newTestPullRequest(),
+	}
+
+	tests := map[string][]bool{
+		"rejectedThenAccepted": {false, true},
+		"acceptedThenRejected": {true, false},
+		"rejected":             {false},
+	}
+	for name, results := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := newTestBase(t)
+			b.Debouncer = debounce.New(time.Hour, githubapp.DefaultScheduler(), nil)
+
+			checks := 0
+			accepted := false
+			for _, result := range results {
+				result := result
+				err := b.evaluateIf(context.Background(), 1, 0, loc, func(ctx context.Context, evalCtx *EvalContext) bool {
+					checks++
+					return result
+				})
+				require.NoError(t, err)
+				accepted = accepted || result
+			}
+
+			assert.Equal(t, len(results), checks, "check did not run for every request")
+			if accepted {
+				assert.Equal(t, 1, b.Debouncer.Pending(), "accepted request did not start an evaluation")
+			} else {
+				assert.Zero(t, b.Debouncer.Pending(), "rejected request started an evaluation")
+			}
+		})
+	}
+}
+
+// newTestPullRequest returns a pull request with all of the fields that
+// pull.Locator requires to avoid loading it.
+func newTestPullRequest() *github.PullRequest {
+	repo := &github.Repository{
+		ID:    github.Int64(1),
+		Name:  github.String("testrepo"),
+		Owner: &github.User{Login: github.String("testorg")},
+	}
+	return &github.PullRequest{
+		Number:    github.Int(1),
+		Title:     github.String("Test pull request"),
+		Draft:     github.Bool(false),
+		State:     github.String("open"),
+		CreatedAt: &github.Timestamp{Time: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		User:      &github.User{Login: github.String("mhaypenny")},
+		Base:      &github.PullRequestBranch{Ref: github.String("develop"), Repo: repo},
+		Head:      &github.PullRequestBranch{Ref: github.String("feature"), SHA: github.String("abc123"), Repo: repo},
+	}
+}
+
+// newTestBase returns a Base with clients for a GitHub server that does not
+// find any resources.
+func newTestBase(t *testing.T) *Base {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := &PullEvaluationOptions{}
+	opts.fillDefaults()
+
+	return &Base{
+		ClientCreator: &testClientCreator{baseURL: srv.URL + "/"},
+		ConfigFetcher: NewConfigFetcher(opts),
+		BaseConfig:    &baseapp.HTTPConfig{},
+		PullOpts:      opts,
+	}
+}
+
+// testClientCreator creates clients for a test server. Only installation
+// clients are supported.
+type testClientCreator struct {
+	githubapp.ClientCreator
+	baseURL string
+}
+
+func (cc *testClientCreator) NewInstallationClient(installationID int64) (*github.Client, error) {
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(cc.baseURL)
+	return client, nil
+}
+
+func (cc *testClientCreator) NewInstallationV4Client(installationID int64) (*githubv4.Client, error) {
+	return githubv4.NewEnterpriseClient(cc.baseURL+"graphql", nil), nil
+}
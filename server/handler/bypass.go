@@ -0,0 +1,103 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/pkg/errors"
+	"goji.io/pat"
+)
+
+// Bypasses is an API handler that reports pull requests in a repository that
+// were merged without approval. It uses the evaluation history, so history
+// must be enabled. The user who owns the provided token must be able to read
+// the repository.
+type Bypasses struct {
+	Base
+}
+
+type BypassesResponse struct {
+	Bypasses []*BypassedMerge `json:"bypasses"`
+}
+
+type BypassedMerge struct {
+	Number            int       `json:"number"`
+	HeadSHA           string    `json:"head_sha"`
+	MergeSHA          string    `json:"merge_sha"`
+	MergedBy          string    `json:"merged_by"`
+	MergedAt          time.Time `json:"merged_at"`
+	Status            string    `json:"status"`
+	StatusDescription string    `json:"status_description"`
+	Approvers         []string  `json:"approvers,omitempty"`
+}
+
+func (h *Bypasses) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	token := getToken(r)
+	if token == "" {
+		return writeAPIError(w, http.StatusUnauthorized, "missing token")
+	}
+
+	if h.History == nil {
+		return writeAPIError(w, http.StatusNotFound, "evaluation history is not enabled")
+	}
+
+	client, err := h.NewTokenClient(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create token client")
+	}
+
+	q := history.Query{
+		Owner:    pat.Param(r, "owner"),
+		Repo:     pat.Param(r, "repo"),
+		Bypassed: true,
+	}
+	if _, _, err := client.Repositories.Get(ctx, q.Owner, q.Repo); err != nil {
+		if isNotFound(err) {
+			return writeAPIError(w, http.StatusNotFound, "failed to find repository")
+		}
+		return errors.Wrap(err, "failed to get repository")
+	}
+
+	if err := parseHistoryQuery(r, &q); err != nil {
+		return writeAPIError(w, http.StatusBadRequest, err.Error())
+	}
+
+	records, err := h.History.List(ctx, q)
+	if err != nil {
+		return errors.Wrap(err, "failed to list evaluation history")
+	}
+
+	bypasses := make([]*BypassedMerge, 0, len(records))
+	for _, r := range records {
+		bypasses = append(bypasses, &BypassedMerge{
+			Number:            r.Number,
+			HeadSHA:           r.HeadSHA,
+			MergeSHA:          r.Merge.SHA,
+			MergedBy:          r.Merge.MergedBy,
+			MergedAt:          r.Merge.MergedAt,
+			Status:            r.Status,
+			StatusDescription: r.StatusDescription,
+			Approvers:         r.Approvers,
+		})
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, &BypassesResponse{Bypasses: bypasses})
+	return nil
+}
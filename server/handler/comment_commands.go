@@ -0,0 +1,236 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	CommandPrefix = "/policy-bot"
+
+	CommandExplain        = "explain"
+	CommandReevaluate     = "reevaluate"
+	CommandRequestReviews = "request-reviews"
+)
+
+// commandPermissions is the minimum collaborator permission required to run
+// each command. Commands that are not in this map are not handled by the
+// IssueComment handler (e.g. overrides, which are part of the policy.)
+var commandPermissions = map[string]pull.Permission{
+	CommandExplain:        pull.PermissionRead,
+	CommandReevaluate:     pull.PermissionTriage,
+	CommandRequestReviews: pull.PermissionWrite,
+}
+
+// Command is a request for policy-bot to take an action, parsed from the
+// first line of a pull request comment.
+type Command struct {
+	Name string
+	Args string
+}
+
+// ParseCommand returns the command in a comment body, if the comment starts
+// with the command prefix. The prefix and command name are case-sensitive. If
+// the arguments are wrapped in double quotes or backticks, like a rule name
+// that contains spaces, the quotes are removed.
+func ParseCommand(body string) (Command, bool) {
+	line, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != CommandPrefix {
+		return Command{}, false
+	}
+
+	args := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), CommandPrefix))
+	args = strings.TrimSpace(strings.TrimPrefix(args, fields[1]))
+
+	return Command{Name: fields[1], Args: unquote(args)}, true
+}
+
+func unquote(s string) string {
+	for _, q := range []string{`"`, "`"} {
+		if len(s) >= 2 && strings.HasPrefix(s, q) && strings.HasSuffix(s, q) {
+			return strings.TrimSpace(s[1 : len(s)-1])
+		}
+	}
+	return s
+}
+
+// IsHandled returns true if the command is implemented by the comment handler.
+func (c Command) IsHandled() bool {
+	_, ok := commandPermissions[c.Name]
+	return ok
+}
+
+func (h *IssueComment) handleCommand(ctx context.Context, evalCtx *EvalContext, event github.IssueCommentEvent, cmd Command) error {
+	logger := zerolog.Ctx(ctx).With().Str("command", cmd.Name).Logger()
+	ctx = logger.WithContext(ctx)
+
+	sender := event.GetSender().GetLogin()
+	perm, err := evalCtx.PullContext.CollaboratorPermission(sender)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get permission for %s", sender)
+	}
+	if required := commandPermissions[cmd.Name]; perm < required {
+		logger.Info().Msgf("Ignoring command from %s with permission %s, %s is required", sender, perm, required)
+		return nil
+	}
+
+	logger.Info().Msgf("Running command requested by %s", sender)
+
+	switch cmd.Name {
+	case CommandExplain:
+		return h.explain(ctx, evalCtx, event)
+	case CommandReevaluate:
+		return h.reevaluate(ctx, evalCtx, event)
+	case CommandRequestReviews:
+		return h.requestReviewsForRule(ctx, evalCtx, event, cmd.Args)
+	}
+	return nil
+}
+
+func (h *IssueComment) explain(ctx context.Context, evalCtx *EvalContext, event github.IssueCommentEvent) error {
+	result, err := h.evaluateForCommand(ctx, evalCtx)
+	if result == nil {
+		return err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "@%s here is the current evaluation of the policy in `%s` at `%s`:\n\n", event.GetSender().GetLogin(), evalCtx.Config.Source, evalCtx.Config.Path)
+	writeResultMarkdown(&body, result, 0)
+	fmt.Fprintf(&body, "\nSee the [details page](%s) for more information.\n", evalCtx.DetailsURL())
+
+	return postComment(ctx, evalCtx, body.String())
+}
+
+func (h *IssueComment) reevaluate(ctx context.Context, evalCtx *EvalContext, event github.IssueCommentEvent) error {
+	if err := evalCtx.Evaluate(ctx, common.TriggerAll); err != nil {
+		return err
+	}
+
+	owner := evalCtx.PullContext.RepositoryOwner()
+	repo := evalCtx.PullContext.RepositoryName()
+	if _, _, err := evalCtx.Client.Reactions.CreateIssueCommentReaction(ctx, owner, repo, event.GetComment().GetID(), "+1"); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to acknowledge command")
+	}
+	return nil
+}
+
+func (h *IssueComment) requestReviewsForRule(ctx context.Context, evalCtx *EvalContext, event github.IssueCommentEvent, ruleName string) error {
+	if ruleName == "" {
+		return postComment(ctx, evalCtx, fmt.Sprintf("@%s please specify the name of a rule: `%s %s <rule>`", event.GetSender().GetLogin(), CommandPrefix, CommandRequestReviews))
+	}
+
+	result, err := h.evaluateForCommand(ctx, evalCtx)
+	if result == nil {
+		return err
+	}
+
+	rule := findRuleResult(result, ruleName)
+	switch {
+	case rule == nil:
+		return postComment(ctx, evalCtx, fmt.Sprintf("@%s the policy does not contain a rule named `%s`", event.GetSender().GetLogin(), ruleName))
+	case rule.Status != common.StatusPending || rule.Error != nil:
+		return postComment(ctx, evalCtx, fmt.Sprintf("@%s the rule `%s` is %s and does not need reviews", event.GetSender().GetLogin(), ruleName, rule.Status))
+	}
+
+	req := *rule
+	if req.ReviewRequestRule == nil {
+		req.ReviewRequestRule = &common.ReviewRequestRule{
+			Users:          rule.Requires.Actors.Users,
+			Teams:          rule.Requires.Actors.Teams,
+			Organizations:  rule.Requires.Actors.Organizations,
+			Permissions:    rule.Requires.Actors.GetPermissions(),
+			RequiredCount:  rule.Requires.Count,
+			RequestedCount: rule.Requires.Count,
+			Mode:           common.RequestModeRandomUsers,
+		}
+	}
+	return evalCtx.requestReviews(ctx, []*common.Result{&req})
+}
+
+// evaluateForCommand evaluates the full policy, returning a nil result if the
+// policy does not exist or could not be evaluated.
+func (h *IssueComment) evaluateForCommand(ctx context.Context, evalCtx *EvalContext) (*common.Result, error) {
+	evaluator, err := evalCtx.ParseConfig(ctx, common.TriggerAll)
+	if err != nil || evaluator == nil {
+		return nil, err
+	}
+
+	result, err := evalCtx.EvaluatePolicy(ctx, evaluator)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func postComment(ctx context.Context, evalCtx *EvalContext, body string) error {
+	owner := evalCtx.PullContext.RepositoryOwner()
+	repo := evalCtx.PullContext.RepositoryName()
+	number := evalCtx.PullContext.Number()
+
+	comment := github.IssueComment{Body: &body}
+	_, _, err := evalCtx.Client.Issues.CreateComment(ctx, owner, repo, number, &comment)
+	return errors.Wrap(err, "failed to create comment")
+}
+
+// findRuleResult returns the first leaf result with the given name.
+func findRuleResult(result *common.Result, name string) *common.Result {
+	if len(result.Children) == 0 && result.Name == name {
+		return result
+	}
+	for _, c := range result.Children {
+		if r := findRuleResult(c, name); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// writeResultMarkdown renders a result tree as a nested markdown list.
+func writeResultMarkdown(b *strings.Builder, result *common.Result, depth int) {
+	status := result.Status.String()
+	desc := result.StatusDescription
+	if result.Error != nil {
+		status = "error"
+		desc = result.Error.Error()
+	}
+
+	fmt.Fprintf(b, "%s- **%s** (%s)", strings.Repeat("  ", depth), result.Name, status)
+	if desc != "" {
+		fmt.Fprintf(b, ": %s", desc)
+	}
+	b.WriteString("\n")
+
+	children := make([]*common.Result, len(result.Children))
+	copy(children, result.Children)
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Status > children[j].Status
+	})
+
+	for _, c := range children {
+		writeResultMarkdown(b, c, depth+1)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := map[string]struct {
+		Body     string
+		Command  Command
+		Handled  bool
+		NotFound bool
+	}{
+		"explain": {
+			Body:    "/policy-bot explain",
+			Command: Command{Name: CommandExplain},
+			Handled: true,
+		},
+		"extraWhitespace": {
+			Body:    "  \n/policy-bot    reevaluate   \t\n",
+			Command: Command{Name: CommandReevaluate},
+			Handled: true,
+		},
+		"ruleName": {
+			Body:    "/policy-bot request-reviews security",
+			Command: Command{Name: CommandRequestReviews, Args: "security"},
+			Handled: true,
+		},
+		"ruleNameWithSpaces": {
+			Body:    "/policy-bot request-reviews   two  reviewers  ",
+			Command: Command{Name: CommandRequestReviews, Args: "two  reviewers"},
+			Handled: true,
+		},
+		"doubleQuotedRuleName": {
+			Body:    `/policy-bot request-reviews "two reviewers"`,
+			Command: Command{Name: CommandRequestReviews, Args: "two reviewers"},
+			Handled: true,
+		},
+		"backtickQuotedRuleName": {
+			Body:    "/policy-bot request-reviews `two reviewers`",
+			Command: Command{Name: CommandRequestReviews, Args: "two reviewers"},
+			Handled: true,
+		},
+		"unmatchedQuote": {
+			Body:    `/policy-bot request-reviews "two reviewers`,
+			Command: Command{Name: CommandRequestReviews, Args: `"two reviewers`},
+			Handled: true,
+		},
+		"argsOnFirstLineOnly": {
+			Body:    "/policy-bot request-reviews security\nplease take a look",
+			Command: Command{Name: CommandRequestReviews, Args: "security"},
+			Handled: true,
+		},
+		"unknownCommand": {
+			Body:    "/policy-bot approve",
+			Command: Command{Name: "approve"},
+		},
+		"override": {
+			Body:    "/policy-bot override INC-1234",
+			Command: Command{Name: "override", Args: "INC-1234"},
+		},
+		"uppercaseCommand": {
+			Body:    "/policy-bot EXPLAIN",
+			Command: Command{Name: "EXPLAIN"},
+		},
+		"uppercasePrefix": {
+			Body:     "/Policy-Bot explain",
+			NotFound: true,
+		},
+		"prefixOnly": {
+			Body:     "/policy-bot",
+			NotFound: true,
+		},
+		"prefixWithoutSpace": {
+			Body:     "/policy-botexplain",
+			NotFound: true,
+		},
+		"notFirstLine": {
+			Body:     "thanks!\n/policy-bot explain",
+			NotFound: true,
+		},
+		"notStartOfLine": {
+			Body:     "please /policy-bot explain",
+			NotFound: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd, ok := ParseCommand(test.Body)
+			if test.NotFound {
+				assert.False(t, ok, "command was parsed")
+				return
+			}
+
+			assert.True(t, ok, "command was not parsed")
+			assert.Equal(t, test.Command, cmd)
+			assert.Equal(t, test.Handled, cmd.IsHandled())
+		})
+	}
+}
+
+func TestWriteResultMarkdown(t *testing.T) {
+	result := &common.Result{
+		Name:              "policy",
+		Status:            common.StatusPending,
+		StatusDescription: "1/2 rules approved",
+		Children: []*common.Result{
+			{
+				Name:              "approval",
+				Status:            common.StatusPending,
+				StatusDescription: "1/2 rules approved",
+				Children: []*common.Result{
+					{
+						Name:   "docs",
+						Status: common.StatusSkipped,
+					},
+					{
+						Name:              "security",
+						Status:            common.StatusPending,
+						StatusDescription: "0/1 required approvals",
+					},
+					{
+						Name:   "or",
+						Status: common.StatusApproved,
+						Children: []*common.Result{
+							{
+								Name:              "owners",
+								Status:            common.StatusApproved,
+								StatusDescription: "Approved by alice",
+							},
+							{
+								Name:   "broken",
+								Status: common.StatusPending,
+								Error:  errors.New("failed to list members"),
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:              "disapproval",
+				Status:            common.StatusDisapproved,
+				StatusDescription: "Disapproved by bob",
+			},
+		},
+	}
+
+	var b strings.Builder
+	writeResultMarkdown(&b, result, 0)
+
+	expected := strings.Join([]string{
+		"- **policy** (pending): 1/2 rules approved",
+		"  - **disapproval** (disapproved): Disapproved by bob",
+		"  - **approval** (pending): 1/2 rules approved",
+		"    - **or** (approved)",
+		"      - **owners** (approved): Approved by alice",
+		"      - **broken** (error): failed to list members",
+		"    - **security** (pending): 0/1 required approvals",
+		"    - **docs** (skipped)",
+		"",
+	}, "\n")
+	assert.Equal(t, expected, b.String())
+}
@@ -0,0 +1,456 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/policy"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+)
+
+const (
+	DefaultCoverageConcurrency = 8
+)
+
+// Coverage finding codes. Codes are stable and may be used to filter reports.
+const (
+	FindingNoPolicy               = "no_policy"
+	FindingInvalidPolicy          = "invalid_policy"
+	FindingMissingRemotePolicy    = "missing_remote_policy"
+	FindingPolicyLoadError        = "policy_load_error"
+	FindingInvalidEnforcedPolicy  = "invalid_enforced_policy"
+	FindingBranchNotProtected     = "branch_not_protected"
+	FindingMissingRequiredStatus  = "missing_required_status"
+	FindingProtectionUnknown      = "protection_unknown"
+	FindingRepositoryError        = "repository_error"
+	FindingRepositoryInaccessible = "repository_inaccessible"
+)
+
+// CoverageReporter reports which repositories in an installation have a
+// valid policy and require the policy-bot status on their protected branches.
+type CoverageReporter struct {
+	ClientCreator githubapp.ClientCreator
+	ConfigFetcher *ConfigFetcher
+	PullOpts      *PullEvaluationOptions
+
+	// Concurrency is the maximum number of repositories checked at the same
+	// time.
+	Concurrency int
+}
+
+type CoverageReport struct {
+	Owner        string                `json:"owner"`
+	GeneratedAt  time.Time             `json:"generated_at"`
+	Repositories []*RepositoryCoverage `json:"repositories"`
+}
+
+type RepositoryCoverage struct {
+	Name          string            `json:"name"`
+	DefaultBranch string            `json:"default_branch"`
+	Branches      []*BranchCoverage `json:"branches"`
+	Findings      []CoverageFinding `json:"findings,omitempty"`
+}
+
+type BranchCoverage struct {
+	Name            string            `json:"name"`
+	Protected       bool              `json:"protected"`
+	PolicySource    string            `json:"policy_source,omitempty"`
+	PolicyPath      string            `json:"policy_path,omitempty"`
+	RequiredContext string            `json:"required_context"`
+	Findings        []CoverageFinding `json:"findings,omitempty"`
+}
+
+type CoverageFinding struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// HasFindings returns true if any repository or branch in the report has a
+// finding.
+func (r *CoverageReport) HasFindings() bool {
+	for _, repo := range r.Repositories {
+		if len(repo.Findings) > 0 {
+			return true
+		}
+		for _, b := range repo.Branches {
+			if len(b.Findings) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *CoverageReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(r), "failed to write report")
+}
+
+// WriteCSV writes the report as CSV with one row for each finding. Branches
+// without findings have a single row with an empty code.
+func (r *CoverageReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"repository", "branch", "protected", "policy_source", "policy_path", "code", "message"})
+
+	for _, repo := range r.Repositories {
+		for _, f := range repo.Findings {
+			_ = cw.Write([]string{repo.Name, "", "", "", "", f.Code, f.Message})
+		}
+		for _, b := range repo.Branches {
+			row := []string{repo.Name, b.Name, strconv.FormatBool(b.Protected), b.PolicySource, b.PolicyPath}
+			if len(b.Findings) == 0 {
+				_ = cw.Write(append(row, "", ""))
+			}
+			for _, f := range b.Findings {
+				_ = cw.Write(append(row, f.Code, f.Message))
+			}
+		}
+	}
+
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "failed to write report")
+}
+
+// Report checks every repository that the installation can access. Archived
+// repositories are skipped. Failures to check individual repositories are
+// recorded as findings instead of returned as errors.
+func (cr *CoverageReporter) Report(ctx context.Context, installationID int64, owner string) (*CoverageReport, error) {
+	client, err := cr.ClientCreator.NewInstallationClient(installationID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create installation client")
+	}
+
+	repos, err := listInstallationRepositories(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CoverageReport{
+		Owner:       owner,
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	enforced := cr.ConfigFetcher.EnforcedConfig(ctx, client, owner)
+
+	concurrency := cr.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultCoverageConcurrency
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, concurrency)
+	)
+	for _, repo := range repos {
+		if repo.GetArchived() {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(repo *github.Repository) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			rc := cr.checkRepository(ctx, client, repo, enforced)
+
+			mu.Lock()
+			report.Repositories = append(report.Repositories, rc)
+			mu.Unlock()
+		}(repo)
+	}
+	wg.Wait()
+
+	sort.Slice(report.Repositories, func(i, j int) bool {
+		return report.Repositories[i].Name < report.Repositories[j].Name
+	})
+	return report, nil
+}
+
+func (cr *CoverageReporter) checkRepository(ctx context.Context, client *github.Client, repo *github.Repository, enforced FetchedConfig) *RepositoryCoverage {
+	owner := repo.GetOwner().GetLogin()
+	logger := zerolog.Ctx(ctx).With().Str(githubapp.LogKeyRepositoryName, repo.GetName()).Logger()
+
+	rc := &RepositoryCoverage{
+		Name:          repo.GetName(),
+		DefaultBranch: repo.GetDefaultBranch(),
+	}
+
+	protected, err := listProtectedBranches(ctx, client, owner, rc.Name)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to list protected branches")
+		rc.Findings = append(rc.Findings, repositoryErrorFinding(err))
+		return rc
+	}
+
+	branches := []string{rc.DefaultBranch}
+	for _, b := range protected {
+		if b != rc.DefaultBranch {
+			branches = append(branches, b)
+		}
+	}
+	sort.Strings(branches[1:])
+
+	isProtected := make(map[string]bool)
+	for _, b := range protected {
+		isProtected[b] = true
+	}
+
+	for _, branch := range branches {
+		bc := &BranchCoverage{
+			Name:            branch,
+			Protected:       isProtected[branch],
+			RequiredContext: fmt.Sprintf("%s: %s", cr.PullOpts.StatusCheckContext, branch),
+		}
+
+		fc := cr.ConfigFetcher.ConfigForRepositoryBranch(ctx, client, owner, rc.Name, branch)
+		bc.PolicySource, bc.PolicyPath = fc.Source, fc.Path
+		bc.Findings = append(bc.Findings, checkPolicy(fc, enforced)...)
+		bc.Findings = append(bc.Findings, cr.checkProtection(ctx, client, owner, rc.Name, bc)...)
+
+		rc.Branches = append(rc.Branches, bc)
+	}
+	return rc
+}
+
+// checkPolicy returns findings for the policy that applies to a branch,
+// matching the checks made by EvalContext.ParseConfig.
+func checkPolicy(fc, efc FetchedConfig) []CoverageFinding {
+	switch {
+	case fc.LoadError != nil:
+		var missingErr *MissingRemotePolicyError
+		if errors.As(fc.LoadError, &missingErr) {
+			return []CoverageFinding{{
+				Code:    FindingMissingRemotePolicy,
+				Message: fmt.Sprintf("Remote policy %s in %s does not exist", fc.Path, fc.Source),
+			}}
+		}
+		return []CoverageFinding{{
+			Code:    FindingPolicyLoadError,
+			Message: fmt.Sprintf("Failed to load policy from %s: %v", fc.Source, fc.LoadError),
+		}}
+
+	case fc.ParseError != nil:
+		return []CoverageFinding{{
+			Code:    FindingInvalidPolicy,
+			Message: fmt.Sprintf("Invalid policy in %s: %s: %v", fc.Source, fc.Path, fc.ParseError),
+		}}
+
+	case efc.LoadError != nil || efc.ParseError != nil:
+		err := efc.LoadError
+		if err == nil {
+			err = efc.ParseError
+		}
+		return []CoverageFinding{{
+			Code:    FindingInvalidEnforcedPolicy,
+			Message: fmt.Sprintf("Invalid enforced policy in %s: %s: %v", efc.Source, efc.Path, err),
+		}}
+
+	case fc.Config == nil && efc.Config == nil:
+		return []CoverageFinding{{
+			Code:    FindingNoPolicy,
+			Message: "No policy is defined",
+		}}
+	}
+
+	var err error
+	if efc.Config != nil {
+		_, err = policy.ParseEnforcedPolicy(fc.Config, efc.Config)
+	} else {
+		_, err = policy.ParsePolicy(fc.Config)
+	}
+	if err != nil {
+		return []CoverageFinding{{
+			Code:    FindingInvalidPolicy,
+			Message: fmt.Sprintf("Invalid policy in %s: %s: %v", fc.Source, fc.Path, err),
+		}}
+	}
+	return nil
+}
+
+// checkProtection returns findings if the branch does not require the
+// policy-bot status using either branch protection or rulesets.
+func (cr *CoverageReporter) checkProtection(ctx context.Context, client *github.Client, owner, repo string, bc *BranchCoverage) []CoverageFinding {
+	if !bc.Protected {
+		return []CoverageFinding{{
+			Code:    FindingBranchNotProtected,
+			Message: fmt.Sprintf("Branch %s is not protected", bc.Name),
+		}}
+	}
+
+	contexts, known, err := requiredContexts(ctx, client, owner, repo, bc.Name)
+	if err != nil {
+		return []CoverageFinding{repositoryErrorFinding(err)}
+	}
+
+	for _, c := range contexts {
+		if c == bc.RequiredContext || (cr.PullOpts.PostInsecureStatusChecks && c == cr.PullOpts.StatusCheckContext) {
+			return nil
+		}
+	}
+
+	if !known {
+		return []CoverageFinding{{
+			Code:    FindingProtectionUnknown,
+			Message: fmt.Sprintf("The app cannot read branch protection for %s and no ruleset requires %q", bc.Name, bc.RequiredContext),
+		}}
+	}
+	return []CoverageFinding{{
+		Code:    FindingMissingRequiredStatus,
+		Message: fmt.Sprintf("Branch %s does not require the %q status", bc.Name, bc.RequiredContext),
+	}}
+}
+
+// requiredContexts returns the status contexts required by branch protection
+// and by rulesets that apply to the branch. The boolean is false if the app
+// does not have permission to read branch protection settings.
+func requiredContexts(ctx context.Context, client *github.Client, owner, repo, branch string) ([]string, bool, error) {
+	var contexts []string
+
+	rules, _, err := client.Repositories.GetRulesForBranch(ctx, owner, repo, branch)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to get rules for branch")
+	}
+	for _, rule := range rules {
+		if rule.Type != "required_status_checks" || rule.Parameters == nil {
+			continue
+		}
+		var params github.RequiredStatusChecksRuleParameters
+		if err := json.Unmarshal(*rule.Parameters, &params); err != nil {
+			return nil, false, errors.Wrap(err, "failed to parse required status checks rule")
+		}
+		for _, c := range params.RequiredStatusChecks {
+			contexts = append(contexts, c.Context)
+		}
+	}
+
+	checks, _, err := client.Repositories.GetRequiredStatusChecks(ctx, owner, repo, branch)
+	switch {
+	case errors.Is(err, github.ErrBranchNotProtected):
+		return contexts, true, nil
+	case isNotFound(err) || isForbidden(err):
+		return contexts, false, nil
+	case err != nil:
+		return nil, false, errors.Wrap(err, "failed to get required status checks")
+	}
+
+	contexts = append(contexts, checks.Contexts...)
+	for _, c := range checks.Checks {
+		contexts = append(contexts, c.Context)
+	}
+	return contexts, true, nil
+}
+
+func listProtectedBranches(ctx context.Context, client *github.Client, owner, repo string) ([]string, error) {
+	var branches []string
+	opts := &github.BranchListOptions{
+		Protected:   github.Bool(true),
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		res, resp, err := client.Repositories.ListBranches(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list protected branches")
+		}
+		for _, b := range res {
+			branches = append(branches, b.GetName())
+		}
+		if resp.NextPage == 0 {
+			return branches, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func repositoryErrorFinding(err error) CoverageFinding {
+	if isNotFound(err) || isForbidden(err) {
+		return CoverageFinding{Code: FindingRepositoryInaccessible, Message: err.Error()}
+	}
+	return CoverageFinding{Code: FindingRepositoryError, Message: err.Error()}
+}
+
+func isForbidden(err error) bool {
+	var rerr *github.ErrorResponse
+	return errors.As(err, &rerr) && rerr.Response.StatusCode == http.StatusForbidden
+}
+
+// Coverage is an API handler that returns a coverage report for the
+// repositories in an organization. It uses the same authentication as the
+// admin API. The report is JSON unless the "format" query parameter is
+// "csv".
+type Coverage struct {
+	Base
+
+	Reporter *CoverageReporter
+	Token    string
+}
+
+func (h *Coverage) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	owner := pat.Param(r, "owner")
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		return writeAPIError(w, http.StatusBadRequest, "format must be json or csv")
+	}
+
+	_, status, err := authorizeAdmin(ctx, r, &h.Base, h.Token, owner)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return writeAPIError(w, status, http.StatusText(status))
+	}
+
+	installation, err := h.Installations.GetByOwner(ctx, owner)
+	if err != nil {
+		return writeAPIError(w, http.StatusNotFound, "not installed in org")
+	}
+
+	report, err := h.Reporter.Report(ctx, installation.ID, owner)
+	if err != nil {
+		return err
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		return report.WriteCSV(w)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return report.WriteJSON(w)
+}
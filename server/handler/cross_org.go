@@ -29,22 +29,39 @@ type CrossOrgMembershipContext struct {
 	lookupClient  *github.Client
 	installations githubapp.InstallationsService
 	clientCreator githubapp.ClientCreator
+	globalCache   pull.GlobalCache
 
 	mbrCtxs map[string]pull.MembershipContext
 }
 
-func NewCrossOrgMembershipContext(ctx context.Context, client *github.Client, orgName string, installations githubapp.InstallationsService, clientCreator githubapp.ClientCreator) *CrossOrgMembershipContext {
+func NewCrossOrgMembershipContext(ctx context.Context, client *github.Client, orgName string, installations githubapp.InstallationsService, clientCreator githubapp.ClientCreator, globalCache pull.GlobalCache) *CrossOrgMembershipContext {
 	mbrCtx := &CrossOrgMembershipContext{
 		ctx:           ctx,
 		lookupClient:  client,
 		installations: installations,
 		clientCreator: clientCreator,
+		globalCache:   globalCache,
 		mbrCtxs:       make(map[string]pull.MembershipContext),
 	}
-	mbrCtx.mbrCtxs[orgName] = pull.NewGitHubMembershipContext(ctx, client)
+	mbrCtx.mbrCtxs[orgName] = pull.NewGitHubMembershipContext(ctx, client, orgName, globalCache)
 	return mbrCtx
 }
 
+// BindContext uses ctx for requests made by this context and the membership
+// contexts for each organization until the returned function is called.
+func (c *CrossOrgMembershipContext) BindContext(ctx context.Context) func() {
+	prev := c.ctx
+	c.setContext(ctx)
+	return func() { c.setContext(prev) }
+}
+
+func (c *CrossOrgMembershipContext) setContext(ctx context.Context) {
+	c.ctx = ctx
+	for _, mbrCtx := range c.mbrCtxs {
+		pull.BindContext(mbrCtx, ctx)
+	}
+}
+
 func (c *CrossOrgMembershipContext) getCtxForOrg(name string) (pull.MembershipContext, error) {
 	mbrCtx, ok := c.mbrCtxs[name]
 	if !ok {
@@ -63,7 +80,7 @@ func (c *CrossOrgMembershipContext) getCtxForOrg(name string) (pull.MembershipCo
 			return nil, err
 		}
 
-		mbrCtx = pull.NewGitHubMembershipContext(c.ctx, client)
+		mbrCtx = pull.NewGitHubMembershipContext(c.ctx, client, org.GetLogin(), c.globalCache)
 		c.mbrCtxs[name] = mbrCtx
 	}
 
@@ -29,13 +29,24 @@ import (
 	"github.com/bluekeyes/templatetree"
 	"github.com/google/go-github/v59/github"
 	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/policy"
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/graph"
+	"github.com/palantir/policy-bot/policy/override"
+	"github.com/palantir/policy-bot/policy/plan"
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/history"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"goji.io/pat"
 )
 
+const (
+	// DetailsHistoryLimit is the number of recent evaluations shown on the
+	// details page.
+	DetailsHistoryLimit = 20
+)
+
 type Details struct {
 	Base
 	Sessions  *scs.Manager
@@ -74,6 +85,23 @@ func (h *Details) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 
 		PullRequest *github.PullRequest
 		Result      *common.Result
+
+		// Override is the override result if an override approved the PR
+		Override *common.Result
+
+		// Enforced is the result of the organization's enforced policy, if
+		// one exists. It is not included in the children of Result.
+		Enforced *common.Result
+
+		// History contains the most recent recorded evaluations of the PR
+		History []*history.Record
+
+		// Plan contains the approvals that would satisfy a pending policy
+		Plan *plan.Analysis
+
+		// Graph is the approval policy, including any enforced policy, as a
+		// Mermaid flowchart
+		Graph string
 	}
 
 	data.BasePath = getBasePath(h.BaseConfig.PublicURL)
@@ -81,6 +109,10 @@ func (h *Details) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 	data.PolicyURL = getPolicyURL(state.PullRequest, evalCtx.Config)
 	data.ExpandRequiredReviewers = h.PullOpts.ExpandRequiredReviewers
 	data.PullRequest = state.PullRequest
+	data.History = h.loadHistory(ctx, state.PullRequest)
+
+	evalCtx.SkipHistory = true
+	evalCtx.SkipPolicyFileStatus = true
 
 	evaluator, err := evalCtx.ParseConfig(ctx, common.TriggerAll)
 	if err != nil {
@@ -95,10 +127,27 @@ func (h *Details) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 	result, err := evalCtx.EvaluatePolicy(ctx, evaluator)
 	data.Result = &result
 
-	if err != nil {
-		if _, ok := errors.Cause(err).(*pull.TemporaryError); ok {
-			data.IsTemporaryError = true
+	if result.Error == nil && result.Status == common.StatusPending {
+		analysis, err := h.analyzePlan(ctx, &result, evalCtx.PullContext)
+		if err != nil {
+			state.Logger.Warn().Err(err).Msg("Failed to analyze approval plans")
+		} else {
+			data.Plan = analysis
 		}
+	}
+
+	if o := findChildResult(&result, override.ResultName); o != nil && o.Status == common.StatusApproved {
+		data.Override = o
+	}
+	if e := findChildResult(&result, policy.EnforcedResultName); e != nil {
+		data.Enforced = e
+		data.Result = withoutChild(result, e)
+	}
+
+	data.Graph = policyGraph(ctx, evalCtx, &result)
+
+	if err != nil {
+		data.IsTemporaryError = pull.IsTemporaryError(err)
 		data.Error = err
 	}
 
@@ -110,6 +159,66 @@ func (h *Details) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 	return h.render(w, data)
 }
 
+// policyGraph returns the approval policy for the pull request as a Mermaid
+// flowchart or an empty string if the graph could not be built.
+func policyGraph(ctx context.Context, evalCtx *EvalContext, result *common.Result) string {
+	logger := zerolog.Ctx(ctx)
+
+	var root *graph.Node
+	var err error
+	switch config, enforced := evalCtx.Config.Config, evalCtx.EnforcedConfig(ctx).Config; {
+	case enforced != nil:
+		root, err = graph.BuildEnforced(config, enforced, result)
+	case config != nil:
+		root, err = graph.Build(config, result)
+	default:
+		return ""
+	}
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to build policy graph")
+		return ""
+	}
+
+	var b strings.Builder
+	if err := graph.WriteMermaid(&b, root); err != nil {
+		logger.Warn().Err(err).Msg("Failed to write policy graph")
+		return ""
+	}
+	return b.String()
+}
+
+// loadHistory returns the recent evaluations of the pull request or nil if
+// history is disabled or could not be loaded.
+func (h *Details) loadHistory(ctx context.Context, pr *github.PullRequest) []*history.Record {
+	if h.History == nil {
+		return nil
+	}
+
+	records, err := h.History.List(ctx, history.Query{
+		Owner:  pr.GetBase().GetRepo().GetOwner().GetLogin(),
+		Repo:   pr.GetBase().GetRepo().GetName(),
+		Number: pr.GetNumber(),
+		Limit:  DetailsHistoryLimit,
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to load evaluation history")
+		return nil
+	}
+	return records
+}
+
+// withoutChild returns a copy of the result that does not include the child.
+func withoutChild(result common.Result, child *common.Result) *common.Result {
+	children := make([]*common.Result, 0, len(result.Children))
+	for _, c := range result.Children {
+		if c != child {
+			children = append(children, c)
+		}
+	}
+	result.Children = children
+	return &result
+}
+
 // getStateIfAllowed creates a new DetailsState if the request is for a valid
 // pull request and the user has permissions.
 //
@@ -23,7 +23,9 @@ import (
 	"github.com/palantir/policy-bot/policy"
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/history"
 	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
 	"github.com/rs/zerolog"
 	"github.com/shurcooL/githubv4"
 )
@@ -39,14 +41,44 @@ type EvalContext struct {
 	Options   *PullEvaluationOptions
 	PublicURL string
 
-	PullContext pull.Context
-	Config      FetchedConfig
+	PullContext   pull.Context
+	Config        FetchedConfig
+	ConfigFetcher *ConfigFetcher
+
+	// History records the result of each evaluation, if non-nil.
+	History history.Store
+
+	// If true, do not record evaluations in History. Set this for
+	// evaluations that are only displayed, like on the details page.
+	SkipHistory bool
+
+	// Retry controls retries of evaluations that fail with temporary errors.
+	Retry RetryPolicy
+
+	// Registry records evaluation metrics, if non-nil.
+	Registry metrics.Registry
+
+	// Merge is set when evaluating a pull request after it is merged.
+	Merge *history.Merge
 
 	// If true, store statuses in the Status field instead of posting them to
 	// GitHub. Only the last status is saved, so when this option is enabled,
 	// callers should check for a non-nil status after each method call.
 	SkipPostStatus bool
 	Status         *github.RepoStatus
+
+	// If true, do not post the status that reports the validity of a policy
+	// file modified by the pull request. Set this for evaluations that are
+	// only displayed, like on the details page.
+	SkipPolicyFileStatus bool
+
+	// trigger is the trigger from the last call to ParseConfig
+	trigger common.Trigger
+
+	// enforcedConfig and shadowConfig cache the policies loaded by
+	// EnforcedConfig and ShadowConfig
+	enforcedConfig *FetchedConfig
+	shadowConfig   *FetchedConfig
 }
 
 // Evaluate runs the full process for evaluating a pull request.
@@ -71,16 +103,21 @@ func (ec *EvalContext) Evaluate(ctx context.Context, trigger common.Trigger) err
 // ParseConfig checks and validates the configuration in the EvalContext and
 // returns a non-nil Evaluator if the policy exists, is valid, and requires
 // evaluation for the trigger.
-func (ec *EvalContext) ParseConfig(ctx context.Context, trigger common.Trigger) (common.Evaluator, error) {
+func (ec *EvalContext) ParseConfig(ctx context.Context, trigger common.Trigger) (evaluator common.Evaluator, err error) {
+	ctx, span := common.StartSpan(ctx, "EvalContext.ParseConfig")
+	defer func() { common.EndSpan(span, err) }()
+	defer pull.BindContext(ec.PullContext, ctx)()
+
 	logger := zerolog.Ctx(ctx)
+	ec.trigger = trigger
 
-	fc := ec.Config
+	fc, efc := ec.Config, ec.EnforcedConfig(ctx)
 	switch {
 	case fc.LoadError != nil:
 		msg := fmt.Sprintf("Error loading policy from %s", fc.Source)
 		logger.Warn().Err(fc.LoadError).Msg(msg)
 
-		ec.PostStatus(ctx, "error", msg)
+		ec.postErrorStatus(ctx, fc.LoadError, msg)
 		return nil, errors.Wrapf(fc.LoadError, "failed to load policy: %s: %s", fc.Source, fc.Path)
 
 	case fc.ParseError != nil:
@@ -90,21 +127,44 @@ func (ec *EvalContext) ParseConfig(ctx context.Context, trigger common.Trigger)
 		ec.PostStatus(ctx, "error", msg)
 		return nil, errors.Wrapf(fc.ParseError, "failed to parse policy: %s: %s", fc.Source, fc.Path)
 
-	case fc.Config == nil:
+	case efc.LoadError != nil:
+		msg := fmt.Sprintf("Error loading enforced policy from %s", efc.Source)
+		logger.Warn().Err(efc.LoadError).Msg(msg)
+
+		ec.postErrorStatus(ctx, efc.LoadError, msg)
+		return nil, errors.Wrapf(efc.LoadError, "failed to load enforced policy: %s: %s", efc.Source, efc.Path)
+
+	case efc.ParseError != nil:
+		msg := fmt.Sprintf("Invalid enforced policy in %s: %s", efc.Source, efc.Path)
+		logger.Warn().Err(efc.ParseError).Msg(msg)
+
+		ec.PostStatus(ctx, "error", msg)
+		return nil, errors.Wrapf(efc.ParseError, "failed to parse enforced policy: %s: %s", efc.Source, efc.Path)
+
+	case fc.Config == nil && efc.Config == nil:
 		logger.Debug().Msg("No policy defined for repository")
 		return nil, nil
 	}
 
-	evaluator, err := policy.ParsePolicy(fc.Config)
+	if efc.Config != nil {
+		evaluator, err = policy.ParseEnforcedPolicy(fc.Config, efc.Config)
+	} else {
+		evaluator, err = policy.ParsePolicy(fc.Config)
+	}
 	if err != nil {
-		msg := fmt.Sprintf("Invalid policy in %s: %s", fc.Source, fc.Path)
+		source, path := fc.Source, fc.Path
+		if fc.Config == nil {
+			source, path = efc.Source, efc.Path
+		}
+
+		msg := fmt.Sprintf("Invalid policy in %s: %s", source, path)
 		logger.Warn().Err(err).Msg(msg)
 
 		ec.PostStatus(ctx, "error", msg)
-		return nil, errors.Wrapf(err, "failed to create evaluator: %s: %s", fc.Source, fc.Path)
+		return nil, errors.Wrapf(err, "failed to create evaluator: %s: %s", source, path)
 	}
 
-	policyTrigger := evaluator.Trigger()
+	policyTrigger := ec.protectedTrigger(evaluator)
 	if !trigger.Matches(policyTrigger) {
 		logger.Debug().
 			Str("event_trigger", trigger.String()).
@@ -113,21 +173,47 @@ func (ec *EvalContext) ParseConfig(ctx context.Context, trigger common.Trigger)
 		return nil, nil
 	}
 
+	evaluator, err = ec.protectPolicy(ctx, evaluator)
+	if err != nil {
+		msg := "Error checking changes to the policy file"
+		logger.Warn().Err(err).Msg(msg)
+
+		ec.postErrorStatus(ctx, err, msg)
+		return nil, err
+	}
+
 	return evaluator, nil
 }
 
 // EvaluatePolicy evaluates the policy for a PR and generates a result. The
 // evaluator must be non-nil, meaning callers should check the output of
 // ParseConfig before calling this method.
-func (ec *EvalContext) EvaluatePolicy(ctx context.Context, evaluator common.Evaluator) (common.Result, error) {
+func (ec *EvalContext) EvaluatePolicy(ctx context.Context, evaluator common.Evaluator) (result common.Result, err error) {
+	ctx, span := common.StartSpan(ctx, "EvalContext.EvaluatePolicy")
+	defer func() {
+		if err != nil && result.Error == nil {
+			common.EndSpan(span, err)
+			return
+		}
+		common.EndResultSpan(span, &result)
+	}()
+	defer pull.BindContext(ec.PullContext, ctx)()
+
 	logger := zerolog.Ctx(ctx)
 
-	result := evaluator.Evaluate(ctx, ec.PullContext)
+	_ = ec.Retry.Do(ctx, func() error {
+		result = ec.evaluateWithMetrics(ctx, evaluator)
+		return result.Error
+	})
+	shadow := ec.evaluateShadow(ctx, &result)
+	ec.recordHistory(ctx, &result, shadow)
+	ec.recordResultMetrics(&result)
+
 	if result.Error != nil {
 		msg := fmt.Sprintf("Error evaluating policy in %s: %s", ec.Config.Source, ec.Config.Path)
 		logger.Warn().Err(result.Error).Msg(msg)
 
-		ec.PostStatus(ctx, "error", msg)
+		ec.postErrorStatus(ctx, result.Error, msg)
 		return result, result.Error
 	}
 
@@ -160,6 +246,10 @@ func (ec *EvalContext) EvaluatePolicy(ctx context.Context, evaluator common.Eval
 // Post-evaluate actions are best effort, so this function logs failures
 // instead of returning an error.
 func (ec *EvalContext) RunPostEvaluateActions(ctx context.Context, result common.Result, trigger common.Trigger) {
+	ctx, span := common.StartSpan(ctx, "EvalContext.RunPostEvaluateActions")
+	defer span.End()
+	defer pull.BindContext(ec.PullContext, ctx)()
+
 	logger := zerolog.Ctx(ctx)
 
 	if err := ec.requestReviewsForResult(ctx, trigger, result); err != nil {
@@ -179,9 +269,7 @@ func (ec *EvalContext) PostStatus(ctx context.Context, state, message string) {
 	repo := ec.PullContext.RepositoryName()
 	sha := ec.PullContext.HeadSHA()
 	base, _ := ec.PullContext.Branches()
-
-	publicURL := strings.TrimSuffix(ec.PublicURL, "/")
-	detailsURL := fmt.Sprintf("%s/details/%s/%s/%d", publicURL, owner, repo, ec.PullContext.Number())
+	detailsURL := ec.DetailsURL()
 
 	status := github.RepoStatus{
 		State:       &state,
@@ -210,3 +298,100 @@ func (ec *EvalContext) PostStatus(ctx context.Context, state, message string) {
 		}
 	}
 }
+
+// postErrorStatus posts a status for an error. If the error is temporary, the
+// status is pending and says that evaluation will be retried. Otherwise, the
+// status is an error with the given message.
+func (ec *EvalContext) postErrorStatus(ctx context.Context, err error, msg string) {
+	if pull.IsTemporaryError(err) {
+		ec.PostStatus(ctx, "pending", ec.Retry.temporaryErrorDescription())
+		return
+	}
+	ec.PostStatus(ctx, "error", msg)
+}
+
+// recordHistory saves the result of an evaluation to the history store. It
+// logs failures instead of returning an error so that history problems do not
+// prevent status updates.
+func (ec *EvalContext) recordHistory(ctx context.Context, result *common.Result, shadow *history.Shadow) {
+	if ec.History == nil || ec.SkipHistory {
+		return
+	}
+
+	r := &history.Record{
+		Owner:   ec.PullContext.RepositoryOwner(),
+		Repo:    ec.PullContext.RepositoryName(),
+		Number:  ec.PullContext.Number(),
+		HeadSHA: ec.PullContext.HeadSHA(),
+		Policy: history.Policy{
+			Source: ec.Config.Source,
+			Path:   ec.Config.Path,
+			SHA:    ec.Config.SHA,
+		},
+		Trigger:     ec.trigger.String(),
+		EvaluatedAt: ec.PullContext.EvaluationTimestamp(),
+	}
+	r.SetResult(result)
+
+	if ec.Merge != nil {
+		merge := *ec.Merge
+		merge.Bypassed = IsBypassed(result)
+		r.Merge = &merge
+	}
+	r.Shadow = shadow
+
+	if err := ec.History.Add(ctx, r); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to record evaluation history")
+	}
+}
+
+// Configs returns the policies that apply to the evaluated PR: the repository
+// policy and the enforced policy, if they exist.
+func (ec *EvalContext) Configs(ctx context.Context) []*policy.Config {
+	var configs []*policy.Config
+	if ec.Config.Config != nil {
+		configs = append(configs, ec.Config.Config)
+	}
+	if efc := ec.EnforcedConfig(ctx); efc.Config != nil {
+		configs = append(configs, efc.Config)
+	}
+	return configs
+}
+
+// EnforcedConfig returns the organization-wide policy that applies in
+// addition to the repository policy. Its Config is nil if there is no such
+// policy. The policy is loaded on the first call.
+func (ec *EvalContext) EnforcedConfig(ctx context.Context) FetchedConfig {
+	if ec.enforcedConfig == nil {
+		var fc FetchedConfig
+		if ec.ConfigFetcher != nil {
+			fc = ec.ConfigFetcher.EnforcedConfig(ctx, ec.Client, ec.PullContext.RepositoryOwner())
+		}
+		ec.enforcedConfig = &fc
+	}
+	return *ec.enforcedConfig
+}
+
+// ShadowConfig returns a candidate policy that is evaluated after the real
+// policy, if its Config is non-nil. Shadow results are logged and recorded in
+// History but never posted as statuses. The policy is loaded on the first
+// call.
+func (ec *EvalContext) ShadowConfig(ctx context.Context) FetchedConfig {
+	if ec.shadowConfig == nil {
+		var fc FetchedConfig
+		if ec.ConfigFetcher != nil {
+			base, _ := ec.PullContext.Branches()
+			fc = ec.ConfigFetcher.ShadowConfig(ctx, ec.Client, ec.PullContext.RepositoryOwner(), ec.PullContext.RepositoryName(), base)
+		}
+		ec.shadowConfig = &fc
+	}
+	return *ec.shadowConfig
+}
+
+// DetailsURL returns the URL of the details page for the evaluated PR.
+func (ec *EvalContext) DetailsURL() string {
+	publicURL := strings.TrimSuffix(ec.PublicURL, "/")
+	owner := ec.PullContext.RepositoryOwner()
+	repo := ec.PullContext.RepositoryName()
+	return fmt.Sprintf("%s/details/%s/%s/%d", publicURL, owner, repo, ec.PullContext.Number())
+}
@@ -48,6 +48,7 @@ func (ec *EvalContext) dismissStaleReviewsForResult(ctx context.Context, result
 			return err
 		}
 		alreadyDismissed[d.Candidate.ReviewID] = true
+		ec.incCounter(MetricsKeyReviewsDismissed, 1)
 	}
 
 	return nil
@@ -128,8 +128,11 @@ func (ec *EvalContext) requestReviews(ctx context.Context, reqs []*common.Result
 		name := ec.PullContext.RepositoryName()
 		number := ec.PullContext.Number()
 
-		_, _, err = ec.Client.PullRequests.RequestReviewers(ctx, owner, name, number, req)
-		return errors.Wrap(err, "failed to request reviewers")
+		if _, _, err := ec.Client.PullRequests.RequestReviewers(ctx, owner, name, number, req); err != nil {
+			return errors.Wrap(err, "failed to request reviewers")
+		}
+		ec.incCounter(MetricsKeyReviewsRequested, len(req.Reviewers)+len(req.TeamReviewers))
+		return nil
 	}
 
 	logger.Debug().Msg("All selected reviewers are already assigned or were explicitly removed")
@@ -17,6 +17,8 @@ package handler
 import (
 	"os"
 	"strconv"
+
+	"github.com/palantir/policy-bot/policy/common"
 )
 
 const (
@@ -32,6 +34,20 @@ type PullEvaluationOptions struct {
 	SharedRepository string `yaml:"shared_repository"`
 	SharedPolicyPath string `yaml:"shared_policy_path"`
 
+	// EnforcedPolicyPath is the path to a policy in EnforcedPolicyRepository
+	// that applies to every repository in the organization, in addition to
+	// the repository's own policy. If empty, there is no enforced policy.
+	EnforcedPolicyRepository string `yaml:"enforced_policy_repository"`
+	EnforcedPolicyPath       string `yaml:"enforced_policy_path"`
+
+	// ShadowPolicyPath is the path to a candidate policy in each repository
+	// that is evaluated alongside the real policy without posting statuses.
+	// SharedShadowPolicyPath is the path to a candidate policy in
+	// SharedRepository that is used if a repository does not define its own
+	// shadow policy. If both are empty, shadow evaluation is disabled.
+	ShadowPolicyPath       string `yaml:"shadow_policy_path"`
+	SharedShadowPolicyPath string `yaml:"shared_shadow_policy_path"`
+
 	// StatusCheckContext will be used to create the status context. It will be used in the following
 	// pattern: <StatusCheckContext>: <Base Branch Name>
 	StatusCheckContext string `yaml:"status_check_context"`
@@ -42,6 +58,19 @@ type PullEvaluationOptions struct {
 	// is otherwise private. See the README for details.
 	ExpandRequiredReviewers bool `yaml:"expand_required_reviewers"`
 
+	// PolicyOwners enables protection of the policy file. If a pull request
+	// modifies the policy file in a way that makes it less strict, one of
+	// these actors must approve the pull request in addition to the existing
+	// policy. Pull requests that modify the policy file also get a separate
+	// status that reports if the new policy is valid.
+	PolicyOwners common.Actors `yaml:"policy_owners"`
+
+	// BypassNotification controls how policy-bot reports pull requests that
+	// are merged without approval. If "comment", it comments on the pull
+	// request. If "issue", it opens an issue in the repository. If empty, it
+	// only logs an audit event.
+	BypassNotification string `yaml:"bypass_notification"`
+
 	// PostInsecureStatusChecks enables the sending of a second status using just StatusCheckContext as the context,
 	// no templating. This is turned off by default. This is to support legacy workflows that depend on the original
 	// context behaviour, and will be removed in 2.0
@@ -70,6 +99,9 @@ func (p *PullEvaluationOptions) fillDefaults() {
 	if p.SharedPolicyPath == "" {
 		p.SharedPolicyPath = DefaultSharedPolicyPath
 	}
+	if p.EnforcedPolicyRepository == "" {
+		p.EnforcedPolicyRepository = p.SharedRepository
+	}
 	if p.StatusCheckContext == "" {
 		p.StatusCheckContext = DefaultStatusCheckContext
 	}
@@ -79,8 +111,13 @@ func (p *PullEvaluationOptions) SetValuesFromEnv(prefix string) {
 	setStringFromEnv("POLICY_PATH", prefix, &p.PolicyPath)
 	setStringFromEnv("SHARED_REPOSITORY", prefix, &p.SharedRepository)
 	setStringFromEnv("SHARED_POLICY_PATH", prefix, &p.SharedPolicyPath)
+	setStringFromEnv("ENFORCED_POLICY_REPOSITORY", prefix, &p.EnforcedPolicyRepository)
+	setStringFromEnv("ENFORCED_POLICY_PATH", prefix, &p.EnforcedPolicyPath)
+	setStringFromEnv("SHADOW_POLICY_PATH", prefix, &p.ShadowPolicyPath)
+	setStringFromEnv("SHARED_SHADOW_POLICY_PATH", prefix, &p.SharedShadowPolicyPath)
 	setStringFromEnv("STATUS_CHECK_CONTEXT", prefix, &p.StatusCheckContext)
 	setBoolFromEnv("EXPAND_REQUIRED_REVIEWERS", prefix, &p.ExpandRequiredReviewers)
+	setStringFromEnv("BYPASS_NOTIFICATION", prefix, &p.BypassNotification)
 	setBoolFromEnv("POST_INSECURE_STATUS_CHECKS", prefix, &p.PostInsecureStatusChecks)
 	p.fillDefaults()
 }
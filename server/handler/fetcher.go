@@ -16,10 +16,14 @@ package handler
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
 
 	"github.com/google/go-github/v59/github"
 	"github.com/palantir/go-githubapp/appconfig"
 	"github.com/palantir/policy-bot/policy"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
@@ -30,15 +34,97 @@ type FetchedConfig struct {
 
 	Source string
 	Path   string
+
+	// SHA is the git blob SHA of the policy file content, if it exists.
+	SHA string
+}
+
+// MissingRemotePolicyError is the LoadError of a FetchedConfig when the
+// policy file is a remote reference to a repository or file that does not
+// exist.
+type MissingRemotePolicyError struct {
+	Err error
+}
+
+func (e *MissingRemotePolicyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *MissingRemotePolicyError) Unwrap() error {
+	return e.Err
 }
 
 type ConfigFetcher struct {
 	Loader *appconfig.Loader
+
+	// EnforcedLoader loads the enforced policy from EnforcedRepository in the
+	// organization that owns each repository. If nil, there is no enforced
+	// policy.
+	EnforcedLoader     *appconfig.Loader
+	EnforcedRepository string
+
+	// ShadowLoader loads the shadow policy for a repository. If nil, there
+	// is no shadow policy.
+	ShadowLoader *appconfig.Loader
 }
 
-func (cf *ConfigFetcher) ConfigForRepositoryBranch(ctx context.Context, client *github.Client, owner, repository, branch string) FetchedConfig {
+// NewConfigFetcher creates a ConfigFetcher that loads policies from the
+// locations in the options.
+func NewConfigFetcher(opts *PullEvaluationOptions) *ConfigFetcher {
+	cf := &ConfigFetcher{
+		Loader: appconfig.NewLoader(
+			[]string{opts.PolicyPath},
+			appconfig.WithOwnerDefault(opts.SharedRepository, []string{
+				opts.SharedPolicyPath,
+			}),
+		),
+	}
+	if opts.EnforcedPolicyPath != "" {
+		cf.EnforcedLoader = appconfig.NewLoader([]string{opts.EnforcedPolicyPath})
+		cf.EnforcedRepository = opts.EnforcedPolicyRepository
+	}
+	if opts.ShadowPolicyPath != "" || opts.SharedShadowPolicyPath != "" {
+		var paths, sharedPaths []string
+		if opts.ShadowPolicyPath != "" {
+			paths = []string{opts.ShadowPolicyPath}
+		}
+		sharedRepository := ""
+		if opts.SharedShadowPolicyPath != "" {
+			sharedRepository = opts.SharedRepository
+			sharedPaths = []string{opts.SharedShadowPolicyPath}
+		}
+		cf.ShadowLoader = appconfig.NewLoader(paths, appconfig.WithOwnerDefault(sharedRepository, sharedPaths))
+	}
+	return cf
+}
 
+func (cf *ConfigFetcher) ConfigForRepositoryBranch(ctx context.Context, client *github.Client, owner, repository, branch string) FetchedConfig {
 	c, err := cf.Loader.LoadConfig(ctx, client, owner, repository, branch)
+	return parseFetchedConfig(c, err)
+}
+
+// EnforcedConfig returns the enforced policy for repositories in the owner's
+// organization. The enforced policy is always loaded from the default branch
+// of the enforced policy repository.
+func (cf *ConfigFetcher) EnforcedConfig(ctx context.Context, client *github.Client, owner string) FetchedConfig {
+	if cf.EnforcedLoader == nil {
+		return FetchedConfig{}
+	}
+	c, err := cf.EnforcedLoader.LoadConfig(ctx, client, owner, cf.EnforcedRepository, "")
+	return parseFetchedConfig(c, err)
+}
+
+// ShadowConfig returns the shadow policy for a repository branch. The Config
+// is nil if there is no shadow policy.
+func (cf *ConfigFetcher) ShadowConfig(ctx context.Context, client *github.Client, owner, repository, branch string) FetchedConfig {
+	if cf.ShadowLoader == nil {
+		return FetchedConfig{}
+	}
+	c, err := cf.ShadowLoader.LoadConfig(ctx, client, owner, repository, branch)
+	return parseFetchedConfig(c, err)
+}
+
+func parseFetchedConfig(c appconfig.Config, err error) FetchedConfig {
 	fc := FetchedConfig{
 		Source: c.Source,
 		Path:   c.Path,
@@ -47,11 +133,18 @@ func (cf *ConfigFetcher) ConfigForRepositoryBranch(ctx context.Context, client *
 	switch {
 	case err != nil:
 		fc.LoadError = err
+		// The loader wraps errors from GitHub requests, but returns an
+		// unwrapped error when a remote repository or file does not exist
+		if c.IsRemote && errors.Cause(err) == err {
+			fc.LoadError = &MissingRemotePolicyError{Err: err}
+		}
 		return fc
 	case c.IsUndefined():
 		return fc
 	}
 
+	fc.SHA = blobSHA(c.Content)
+
 	var pc policy.Config
 	if err := yaml.UnmarshalStrict(c.Content, &pc); err != nil {
 		fc.ParseError = err
@@ -60,3 +153,11 @@ func (cf *ConfigFetcher) ConfigForRepositoryBranch(ctx context.Context, client *
 	}
 	return fc
 }
+
+// blobSHA returns the SHA of a git blob with the given content.
+func blobSHA(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/pkg/errors"
+)
+
+// ErrTreeTruncated is returned by ListRepositoryFiles if the repository has
+// more files than GitHub returns in a single tree.
+var ErrTreeTruncated = errors.New("repository has too many files to list")
+
+// ListRepositoryFiles returns the paths of all files in a repository at a ref.
+// If ref is empty, it uses the default branch of the repository.
+func ListRepositoryFiles(ctx context.Context, client *github.Client, owner, repo, ref string) ([]string, error) {
+	if ref == "" {
+		r, _, err := client.Repositories.Get(ctx, owner, repo)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get repository")
+		}
+		ref = r.GetDefaultBranch()
+	}
+
+	tree, _, err := client.Git.GetTree(ctx, owner, repo, ref, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get tree for %s", ref)
+	}
+	if tree.GetTruncated() {
+		return nil, ErrTreeTruncated
+	}
+
+	files := make([]string, 0, len(tree.Entries))
+	for _, e := range tree.Entries {
+		if e.GetType() == "blob" {
+			files = append(files, e.GetPath())
+		}
+	}
+	return files, nil
+}
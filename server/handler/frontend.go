@@ -36,12 +36,18 @@ const (
 	DefaultTemplatesDir = "templates"
 	DefaultStaticDir    = "static"
 
+	// DefaultMermaidURL is the ES module used to render policy graphs on the
+	// details page. It is loaded by the browser only when a user opens a graph.
+	DefaultMermaidURL = "https://cdn.jsdelivr.net/npm/mermaid@10.9.0/dist/mermaid.esm.min.mjs"
+
 	ManifestFile = "manifest.json"
 )
 
 type FilesConfig struct {
 	Static    string `yaml:"static"`
 	Templates string `yaml:"templates"`
+
+	MermaidURL string `yaml:"mermaid_url"`
 }
 
 type Membership struct {
@@ -64,6 +70,11 @@ func LoadTemplates(c *FilesConfig, basePath string, githubURL string) (templatet
 		staticDir = DefaultStaticDir
 	}
 
+	mermaidURL := c.MermaidURL
+	if mermaidURL == "" {
+		mermaidURL = DefaultMermaidURL
+	}
+
 	githubURL = strings.TrimSuffix(githubURL, "/")
 
 	manifest, err := loadManifest(staticDir)
@@ -91,6 +102,9 @@ func LoadTemplates(c *FilesConfig, basePath string, githubURL string) (templatet
 				}
 				return path.Join(basePath, "static", r)
 			},
+			"mermaidURL": func() string {
+				return mermaidURL
+			},
 			"titlecase": strings.Title,
 			"sortByStatus": func(results []*common.Result) []*common.Result {
 				r := make([]*common.Result, len(results))
@@ -0,0 +1,112 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/pkg/errors"
+	"goji.io/pat"
+)
+
+const (
+	DefaultHistoryLimit = 100
+	MaxHistoryLimit     = 1000
+)
+
+// History is an API handler that returns the recorded evaluations of a
+// repository or a single pull request. The user who owns the provided token
+// must be able to read the repository.
+type History struct {
+	Base
+}
+
+type HistoryResponse struct {
+	Records []*history.Record `json:"records"`
+}
+
+func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	token := getToken(r)
+	if token == "" {
+		return writeAPIError(w, http.StatusUnauthorized, "missing token")
+	}
+
+	if h.History == nil {
+		return writeAPIError(w, http.StatusNotFound, "evaluation history is not enabled")
+	}
+
+	client, err := h.NewTokenClient(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create token client")
+	}
+
+	q := history.Query{
+		Owner: pat.Param(r, "owner"),
+		Repo:  pat.Param(r, "repo"),
+	}
+	if _, _, err := client.Repositories.Get(ctx, q.Owner, q.Repo); err != nil {
+		if isNotFound(err) {
+			return writeAPIError(w, http.StatusNotFound, "failed to find repository")
+		}
+		return errors.Wrap(err, "failed to get repository")
+	}
+
+	if _, _, number, ok := parsePullParams(r); ok {
+		q.Number = number
+	}
+	if err := parseHistoryQuery(r, &q); err != nil {
+		return writeAPIError(w, http.StatusBadRequest, err.Error())
+	}
+
+	records, err := h.History.List(ctx, q)
+	if err != nil {
+		return errors.Wrap(err, "failed to list evaluation history")
+	}
+	if records == nil {
+		records = []*history.Record{}
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, &HistoryResponse{Records: records})
+	return nil
+}
+
+func parseHistoryQuery(r *http.Request, q *history.Query) error {
+	values := r.URL.Query()
+
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := values.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return errors.Errorf("invalid %s time, must be in RFC 3339 format", name)
+			}
+			*t = parsed
+		}
+	}
+
+	q.Limit = DefaultHistoryLimit
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxHistoryLimit {
+			return errors.Errorf("invalid limit, must be between 1 and %d", MaxHistoryLimit)
+		}
+		q.Limit = limit
+	}
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/palantir/policy-bot/policy"
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/override"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -77,13 +78,21 @@ func (h *IssueComment) Handle(ctx context.Context, eventType, deliveryID string,
 	switch {
 	case evalCtx.Config.LoadError != nil || evalCtx.Config.ParseError != nil:
 		logger.Warn().Str(LogKeyAudit, "issue_comment").Msg("Skipping tampering check because the policy is not valid")
-	case evalCtx.Config.Config != nil:
+	case len(evalCtx.Configs(ctx)) > 0:
 		tampered := h.detectAndLogTampering(ctx, evalCtx, event)
 		if tampered {
 			return nil
 		}
 	}
 
+	if cmd, ok := ParseCommand(event.GetComment().GetBody()); ok && cmd.IsHandled() && event.GetAction() == "created" {
+		// Ignore commands in comments posted by policy-bot (e.g. explanations)
+		if event.GetSender().GetLogin() == h.AppName+"[bot]" {
+			return nil
+		}
+		return h.handleCommand(ctx, evalCtx, event, cmd)
+	}
+
 	evaluator, err := evalCtx.ParseConfig(ctx, common.TriggerComment)
 	if err != nil {
 		return err
@@ -92,7 +101,7 @@ func (h *IssueComment) Handle(ctx context.Context, eventType, deliveryID string,
 		return nil
 	}
 
-	if !h.affectsApproval(event, evalCtx.Config.Config) {
+	if !h.affectsApproval(event, evalCtx.Configs(ctx)) {
 		logger.Debug().Msg("Skipping evaluation because this comment does not impact approval")
 		return nil
 	}
@@ -103,6 +112,10 @@ func (h *IssueComment) Handle(ctx context.Context, eventType, deliveryID string,
 	}
 
 	evalCtx.RunPostEvaluateActions(ctx, result, common.TriggerComment)
+
+	if event.GetAction() == "created" {
+		evalCtx.handleOverrideComment(ctx, result, event.GetComment())
+	}
 	return nil
 }
 
@@ -119,7 +132,7 @@ func (h *IssueComment) detectAndLogTampering(ctx context.Context, evalCtx *EvalC
 		return false
 	}
 
-	if h.affectsApproval(event, evalCtx.Config.Config) {
+	if h.affectsApproval(event, evalCtx.Configs(ctx)) {
 		msg := fmt.Sprintf("Entity %s edited approval comment by %s", eventAuthor, commentAuthor)
 		logger.Warn().Str(LogKeyAudit, "issue_comment").Msg(msg)
 
@@ -131,7 +144,7 @@ func (h *IssueComment) detectAndLogTampering(ctx context.Context, evalCtx *EvalC
 	return true
 }
 
-func (h *IssueComment) affectsApproval(event github.IssueCommentEvent, config *policy.Config) bool {
+func (h *IssueComment) affectsApproval(event github.IssueCommentEvent, configs []*policy.Config) bool {
 	var body, originalBody string
 	switch event.GetAction() {
 	case "edited":
@@ -143,12 +156,18 @@ func (h *IssueComment) affectsApproval(event github.IssueCommentEvent, config *p
 	}
 
 	var methods []*common.Methods
-	for _, rule := range config.ApprovalRules {
-		methods = append(methods, rule.Options.GetMethods())
-	}
-	if disapproval := config.Policy.Disapproval; disapproval != nil {
-		methods = append(methods, disapproval.Options.GetDisapproveMethods())
-		methods = append(methods, disapproval.Options.GetRevokeMethods())
+	var hasOverride bool
+	for _, config := range configs {
+		for _, rule := range config.ApprovalRules {
+			methods = append(methods, rule.Options.GetMethods())
+		}
+		if disapproval := config.Policy.Disapproval; disapproval != nil {
+			methods = append(methods, disapproval.Options.GetDisapproveMethods())
+			methods = append(methods, disapproval.Options.GetRevokeMethods())
+		}
+		if config.Policy.Override != nil {
+			hasOverride = true
+		}
 	}
 
 	for _, m := range methods {
@@ -156,5 +175,14 @@ func (h *IssueComment) affectsApproval(event github.IssueCommentEvent, config *p
 			return true
 		}
 	}
+
+	if hasOverride {
+		if _, ok := override.ParseComment(body); ok {
+			return true
+		}
+		if _, ok := override.ParseComment(originalBody); ok {
+			return true
+		}
+	}
 	return false
 }
@@ -0,0 +1,140 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// MembershipChange invalidates cached membership and permission values when
+// organizations, teams, or repository collaborators change. It does not
+// evaluate pull requests.
+type MembershipChange struct {
+	Base
+}
+
+func (h *MembershipChange) Handles() []string {
+	return []string{"membership", "member", "organization", "team"}
+}
+
+// Handle membership, member, organization, and team
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads
+func (h *MembershipChange) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	if h.GlobalCache == nil {
+		return nil
+	}
+
+	switch eventType {
+	case "membership":
+		var event github.MembershipEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse membership event payload")
+		}
+		if event.GetScope() != "team" {
+			return nil
+		}
+
+		team := teamName(event.GetOrg(), event.GetTeam())
+		user := event.GetMember().GetLogin()
+
+		h.invalidateTeam(event.GetOrg(), event.GetTeam())
+		h.GlobalCache.InvalidateUser(user)
+		logInvalidation(ctx, eventType, event.GetAction()).Str("team", team).Str("user", user).Msg("Invalidated cached team membership")
+
+	case "member":
+		var event github.MemberEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse member event payload")
+		}
+
+		repo := event.GetRepo()
+		user := event.GetMember().GetLogin()
+
+		h.GlobalCache.InvalidateRepository(repo.GetID())
+		h.GlobalCache.InvalidateUser(user)
+		logInvalidation(ctx, eventType, event.GetAction()).Str("repository", repo.GetFullName()).Str("user", user).Msg("Invalidated cached collaborator permissions")
+
+	case "organization":
+		var event github.OrganizationEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse organization event payload")
+		}
+
+		switch event.GetAction() {
+		case "member_added", "member_removed":
+		default:
+			return nil
+		}
+
+		org := event.GetOrganization().GetLogin()
+		user := event.GetMembership().GetUser().GetLogin()
+
+		// Invalidating the organization also invalidates its teams, which
+		// lose the user when they are removed from the organization
+		h.GlobalCache.InvalidateGroup(org)
+		h.GlobalCache.InvalidateUser(user)
+		logInvalidation(ctx, eventType, event.GetAction()).Str("organization", org).Str("user", user).Msg("Invalidated cached organization membership")
+
+	case "team":
+		var event github.TeamEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse team event payload")
+		}
+
+		team := teamName(event.GetOrg(), event.GetTeam())
+		h.invalidateTeam(event.GetOrg(), event.GetTeam())
+		if event.GetAction() == "edited" {
+			// Edits may move the team, which changes the members of its old
+			// parent, but the event does not include the old parent
+			h.GlobalCache.InvalidateGroup(event.GetOrg().GetLogin())
+		}
+
+		// Changes to the repositories a team can access arrive with the
+		// repository that changed. Other changes, like deleting the team,
+		// may affect permissions on many repositories and rely on expiration.
+		if repo := event.GetRepo(); repo != nil {
+			h.GlobalCache.InvalidateRepository(repo.GetID())
+		}
+		logInvalidation(ctx, eventType, event.GetAction()).Str("team", team).Msg("Invalidated cached team membership")
+	}
+
+	return nil
+}
+
+// invalidateTeam invalidates the membership of a team. Members of a team are
+// also members of its parent teams, so if the team is nested, it invalidates
+// all teams in the organization instead. Events only include the immediate
+// parent of a team, so the other ancestors are not known.
+func (h *MembershipChange) invalidateTeam(org *github.Organization, team *github.Team) {
+	if team.GetParent() != nil {
+		h.GlobalCache.InvalidateGroup(org.GetLogin())
+		return
+	}
+	h.GlobalCache.InvalidateGroup(teamName(org, team))
+}
+
+func teamName(org *github.Organization, team *github.Team) string {
+	return org.GetLogin() + "/" + team.GetSlug()
+}
+
+func logInvalidation(ctx context.Context, eventType, action string) *zerolog.Event {
+	return zerolog.Ctx(ctx).Debug().Str(githubapp.LogKeyEventType, eventType).Str("action", action)
+}
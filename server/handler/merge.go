@@ -0,0 +1,150 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/attestation"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+)
+
+const (
+	BypassNotificationComment = "comment"
+	BypassNotificationIssue   = "issue"
+
+	MetricsKeyBypassedMerges = "policybot.merges.bypassed"
+)
+
+// handleMerge evaluates a merged pull request one final time. If the pull
+// request was not approved, it reports that the merge bypassed the policy.
+// If attestations are enabled, it also saves an attestation for the merge.
+func (h *PullRequest) handleMerge(ctx context.Context, installationID int64, event github.PullRequestEvent) error {
+	logger := zerolog.Ctx(ctx)
+
+	pr := event.GetPullRequest()
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+
+	evalCtx, err := h.NewEvalContext(ctx, installationID, pull.Locator{
+		Owner:  owner,
+		Repo:   repo,
+		Number: pr.GetNumber(),
+		Value:  pr,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create evaluation context")
+	}
+
+	evalCtx.SkipPostStatus = true
+	evalCtx.Merge = &history.Merge{
+		SHA:      pr.GetMergeCommitSHA(),
+		MergedBy: pr.GetMergedBy().GetLogin(),
+		MergedAt: pr.GetMergedAt().Time,
+	}
+
+	evaluator, err := evalCtx.ParseConfig(ctx, common.TriggerAll)
+	if err != nil {
+		return err
+	}
+	if evaluator == nil {
+		logger.Debug().Msg("No policy for merged pull request, skipping final evaluation")
+		return nil
+	}
+
+	result, err := evalCtx.EvaluatePolicy(ctx, evaluator)
+	if err != nil {
+		return errors.Wrap(err, "failed to evaluate merged pull request")
+	}
+
+	if IsBypassed(&result) {
+		h.reportBypass(ctx, evalCtx, event, &result)
+	}
+	evalCtx.recordTimeToApproval(&result)
+
+	if h.Attestor != nil {
+		base, _ := evalCtx.PullContext.Branches()
+		merge := attestation.MergeInfo{
+			Owner:    owner,
+			Repo:     repo,
+			Number:   pr.GetNumber(),
+			BaseRef:  base,
+			HeadSHA:  pr.GetHead().GetSHA(),
+			MergeSHA: evalCtx.Merge.SHA,
+			MergedBy: evalCtx.Merge.MergedBy,
+			MergedAt: evalCtx.Merge.MergedAt,
+		}
+		if err := h.attest(ctx, evalCtx, merge, &result); err != nil {
+			return errors.Wrap(err, "failed to create attestation")
+		}
+	}
+	return nil
+}
+
+// IsBypassed returns true if the final evaluation of a merged pull request
+// shows that it was merged without approval. Evaluation errors are not
+// considered bypasses, because the actual status at merge time is unknown.
+func IsBypassed(result *common.Result) bool {
+	return result.Error == nil && result.Status != common.StatusApproved
+}
+
+// reportBypass records a merge that bypassed the policy and notifies users
+// according to the BypassNotification option. Notifications are best effort,
+// so failures are logged instead of returned.
+func (h *PullRequest) reportBypass(ctx context.Context, evalCtx *EvalContext, event github.PullRequestEvent, result *common.Result) {
+	logger := zerolog.Ctx(ctx)
+
+	pr := event.GetPullRequest()
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	mergedBy := pr.GetMergedBy().GetLogin()
+
+	logger.Warn().
+		Str(LogKeyAudit, "pull_request").
+		Str("merged_by", mergedBy).
+		Str("merge_sha", pr.GetMergeCommitSHA()).
+		Msgf("Entity %s merged pull request without approval (status %s: %s)", mergedBy, result.Status, result.StatusDescription)
+
+	if h.Registry != nil {
+		metrics.GetOrRegisterCounter(MetricsKeyBypassedMerges, h.Registry).Inc(1)
+	}
+
+	body := fmt.Sprintf(
+		"@%s merged %s#%d without approval from `%s`.\n\nThe policy status at merge was **%s**: %s\n\nSee the [details](%s) for more information.",
+		mergedBy, owner+"/"+repo, pr.GetNumber(), h.AppName, result.Status, result.StatusDescription, evalCtx.DetailsURL(),
+	)
+
+	switch h.PullOpts.BypassNotification {
+	case BypassNotificationComment:
+		if _, _, err := evalCtx.Client.Issues.CreateComment(ctx, owner, repo, pr.GetNumber(), &github.IssueComment{Body: &body}); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Failed to comment on bypassed pull request")
+		}
+	case BypassNotificationIssue:
+		issue := github.IssueRequest{
+			Title: github.String(fmt.Sprintf("Pull request #%d was merged without policy approval", pr.GetNumber())),
+			Body:  &body,
+		}
+		if _, _, err := evalCtx.Client.Issues.Create(ctx, owner, repo, &issue); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Failed to open issue for bypassed pull request")
+		}
+	}
+}
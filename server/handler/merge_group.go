@@ -61,7 +61,7 @@ func (h *MergeGroup) Handle(ctx context.Context, eventType, devlieryID string, p
 	// If a PR is added to the merge queue, presumably the policy existed and was valid at the time of merge,
 	// so we're just checking for the existance of a policy here and don't care about its validity.
 	fetchedConfig := h.ConfigFetcher.ConfigForRepositoryBranch(ctx, client, owner, repository, baseBranch)
-	if fetchedConfig.Config == nil {
+	if fetchedConfig.Config == nil && h.ConfigFetcher.EnforcedConfig(ctx, client, owner).Config == nil {
 		return nil
 	}
 
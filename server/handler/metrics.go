@@ -0,0 +1,165 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Metric names use the "name[tag:value,...]" format supported by the Datadog
+// emitter and the Prometheus endpoint.
+const (
+	MetricsKeyEvaluationDuration       = "policybot.evaluation.duration"
+	MetricsKeyEvaluationGitHubRequests = "policybot.evaluation.github_requests"
+	MetricsKeyEvaluationResults        = "policybot.evaluation.results"
+	MetricsKeyPredicateDuration        = "policybot.predicate.duration"
+	MetricsKeyReviewsRequested         = "policybot.reviews.requested"
+	MetricsKeyReviewsDismissed         = "policybot.reviews.dismissed"
+	MetricsKeyTimeToApproval           = "policybot.rule.time_to_approval"
+)
+
+type requestCounterCtxKey struct{}
+
+// CountGitHubRequests is client middleware that counts the requests made
+// with contexts returned by withRequestCounter.
+func CountGitHubRequests(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if n, ok := r.Context().Value(requestCounterCtxKey{}).(*int64); ok {
+			atomic.AddInt64(n, 1)
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
+
+func withRequestCounter(ctx context.Context) (context.Context, *int64) {
+	var n int64
+	return context.WithValue(ctx, requestCounterCtxKey{}, &n), &n
+}
+
+// evaluateWithMetrics evaluates the policy and records the duration, the
+// GitHub requests, and the duration of each predicate.
+func (ec *EvalContext) evaluateWithMetrics(ctx context.Context, evaluator common.Evaluator) common.Result {
+	if ec.Registry == nil {
+		return evaluator.Evaluate(ctx, ec.PullContext)
+	}
+
+	ctx, requests := withRequestCounter(ctx)
+	ctx = predicate.WithObserver(ctx, func(name string, d time.Duration, err error) {
+		metrics.GetOrRegisterTimer(metricName(MetricsKeyPredicateDuration, "predicate", name), ec.Registry).Update(d)
+	})
+
+	// The pull request context makes requests with its own context, so bind
+	// the counter to it for the duration of the evaluation
+	defer pull.BindContext(ec.PullContext, ctx)()
+
+	start := time.Now()
+	result := evaluator.Evaluate(ctx, ec.PullContext)
+
+	metrics.GetOrRegisterTimer(MetricsKeyEvaluationDuration, ec.Registry).UpdateSince(start)
+	metrics.GetOrRegisterHistogram(MetricsKeyEvaluationGitHubRequests, ec.Registry, metrics.NewExpDecaySample(1028, 0.015)).Update(atomic.LoadInt64(requests))
+	return result
+}
+
+func (ec *EvalContext) recordResultMetrics(result *common.Result) {
+	if ec.Registry == nil {
+		return
+	}
+
+	status := "error"
+	if result.Error == nil {
+		status = result.Status.String()
+	}
+
+	repo := ec.PullContext.RepositoryOwner() + "/" + ec.PullContext.RepositoryName()
+	metrics.GetOrRegisterCounter(metricName(MetricsKeyEvaluationResults, "repository", repo, "status", status), ec.Registry).Inc(1)
+}
+
+func (ec *EvalContext) incCounter(name string, n int) {
+	if ec.Registry != nil && n > 0 {
+		metrics.GetOrRegisterCounter(name, ec.Registry).Inc(int64(n))
+	}
+}
+
+// recordTimeToApproval records the time between when the pull request was
+// opened and when each approved rule received its last approval. It is only
+// called once for each pull request, when it is merged.
+func (ec *EvalContext) recordTimeToApproval(result *common.Result) {
+	if ec.Registry == nil {
+		return
+	}
+
+	createdAt := ec.PullContext.CreatedAt()
+	forEachApprovedRule(result, func(r *common.Result) {
+		var approvedAt time.Time
+		for _, a := range r.Approvers {
+			if a.CreatedAt.After(approvedAt) {
+				approvedAt = a.CreatedAt
+			}
+		}
+		if approvedAt.After(createdAt) {
+			metrics.GetOrRegisterTimer(metricName(MetricsKeyTimeToApproval, "rule", r.Name), ec.Registry).Update(approvedAt.Sub(createdAt))
+		}
+	})
+}
+
+func forEachApprovedRule(result *common.Result, fn func(*common.Result)) {
+	if len(result.Children) == 0 {
+		if result.Status == common.StatusApproved && result.Error == nil && len(result.Approvers) > 0 {
+			fn(result)
+		}
+		return
+	}
+	for _, c := range result.Children {
+		forEachApprovedRule(c, fn)
+	}
+}
+
+// metricName adds tags to a metric name. Arguments after the name are
+// alternating tag names and values. Characters that are not allowed in tag
+// values are replaced with underscores.
+func metricName(name string, tags ...string) string {
+	if len(tags) == 0 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(tags)/2)
+	for i := 0; i+1 < len(tags); i += 2 {
+		value := strings.Map(func(r rune) rune {
+			switch r {
+			case ',', '[', ']':
+				return '_'
+			}
+			return r
+		}, tags[i+1])
+		pairs = append(pairs, fmt.Sprintf("%s:%s", tags[i], value))
+	}
+	return fmt.Sprintf("%s[%s]", name, strings.Join(pairs, ","))
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/override"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Override is an API handler that requests an emergency override on behalf of
+// the user who owns the provided token. The override is recorded as a comment
+// on the pull request, so it is evaluated exactly like a comment command.
+type Override struct {
+	Base
+}
+
+type OverrideRequest struct {
+	Reason string `json:"reason"`
+}
+
+type OverrideResponse struct {
+	CommentURL string `json:"comment_url"`
+}
+
+func (h *Override) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	token := getToken(r)
+	if token == "" {
+		return writeAPIError(w, http.StatusUnauthorized, "missing token")
+	}
+
+	client, err := h.NewTokenClient(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create token client")
+	}
+
+	owner, repo, number, ok := parsePullParams(r)
+	if !ok {
+		return writeAPIError(w, http.StatusBadRequest, "failed to parse pull request parameters from request")
+	}
+
+	var req OverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return writeAPIError(w, http.StatusBadRequest, "failed to parse override request")
+	}
+
+	reason := strings.Join(strings.Fields(req.Reason), " ")
+	if reason == "" {
+		return writeAPIError(w, http.StatusBadRequest, "override reason must not be empty")
+	}
+
+	if _, err := h.Installations.GetByOwner(ctx, owner); err != nil {
+		return writeAPIError(w, http.StatusNotFound, "not installed in org")
+	}
+
+	if _, _, err := client.PullRequests.Get(ctx, owner, repo, number); err != nil {
+		if isNotFound(err) {
+			return writeAPIError(w, http.StatusNotFound, "failed to find pull request")
+		}
+		return errors.Wrap(err, "failed to get pull request")
+	}
+
+	body := fmt.Sprintf("%s %s", override.Command, reason)
+	comment, _, err := client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &body})
+	if err != nil {
+		return errors.Wrap(err, "failed to create override comment")
+	}
+
+	zerolog.Ctx(ctx).Info().
+		Str(LogKeyAudit, "override").
+		Msgf("Entity %s requested an override of %s/%s#%d via the API", comment.GetUser().GetLogin(), owner, repo, number)
+
+	baseapp.WriteJSON(w, http.StatusCreated, &OverrideResponse{CommentURL: comment.GetHTMLURL()})
+	return nil
+}
+
+// handleOverrideComment logs an audit event and posts a follow-up comment if
+// the evaluation accepted an override requested by the given comment.
+func (ec *EvalContext) handleOverrideComment(ctx context.Context, result common.Result, comment *github.IssueComment) {
+	logger := zerolog.Ctx(ctx)
+
+	reason, ok := override.ParseComment(comment.GetBody())
+	if !ok {
+		return
+	}
+
+	author := comment.GetUser().GetLogin()
+	res := findChildResult(&result, override.ResultName)
+
+	if res == nil || res.Status != common.StatusApproved || len(res.Approvers) == 0 || res.Approvers[0].User != author {
+		logger.Warn().
+			Str(LogKeyAudit, "override").
+			Str("override_user", author).
+			Str("override_reason", reason).
+			Msgf("Entity %s requested an override that was not accepted", author)
+		return
+	}
+
+	logger.Warn().
+		Str(LogKeyAudit, "override").
+		Str("override_user", author).
+		Str("override_reason", reason).
+		Msgf("Entity %s overrode the policy for %.7s", author, ec.PullContext.HeadSHA())
+
+	if err := ec.postOverrideComment(ctx, res, author, reason); err != nil {
+		logger.Error().Err(err).Msg("Failed to post override comment")
+	}
+}
+
+func (ec *EvalContext) postOverrideComment(ctx context.Context, res *common.Result, author, reason string) error {
+	var body strings.Builder
+	fmt.Fprintf(&body, "@%s approved this pull request at %.7s with an emergency override, bypassing the normal approval policy.\n\n", author, ec.PullContext.HeadSHA())
+	fmt.Fprintf(&body, "> %s\n", reason)
+
+	for _, c := range res.Children {
+		fmt.Fprintf(&body, "\nThis override requires retroactive approval, which is currently **%s**. ", c.Status)
+		fmt.Fprintf(&body, "See the [details page](%s) for the required approvals.\n", ec.DetailsURL())
+	}
+
+	return postComment(ctx, ec, body.String())
+}
+
+// findChildResult returns the direct child of result with the given name or
+// nil if no such child exists.
+func findChildResult(result *common.Result, name string) *common.Result {
+	for _, c := range result.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
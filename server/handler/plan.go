@@ -0,0 +1,116 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/plan"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Plan returns the approvals that would satisfy the policy for a pull
+// request.
+type Plan struct {
+	Base
+}
+
+func (h *Plan) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	token := getToken(r)
+	if token == "" {
+		return writeAPIError(w, http.StatusUnauthorized, "missing token")
+	}
+
+	client, err := h.NewTokenClient(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create token client")
+	}
+
+	owner, repo, number, ok := parsePullParams(r)
+	if !ok {
+		return writeAPIError(w, http.StatusBadRequest, "failed to parse pull request parameters from request")
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		if isNotFound(err) {
+			return writeAPIError(w, http.StatusNotFound, "failed to find pull request")
+		}
+		return errors.Wrap(err, "failed to get pull request")
+	}
+
+	installation, err := h.Installations.GetByOwner(ctx, owner)
+	if err != nil {
+		return writeAPIError(w, http.StatusNotFound, "not installed in org")
+	}
+
+	ctx, _ = h.PreparePRContext(ctx, installation.ID, pr)
+	evalCtx, err := h.NewEvalContext(ctx, installation.ID, pull.Locator{
+		Owner:  owner,
+		Repo:   repo,
+		Number: number,
+		Value:  pr,
+	})
+	if err != nil {
+		return err
+	}
+	evalCtx.SkipHistory = true
+	evalCtx.SkipPostStatus = true
+
+	evaluator, err := evalCtx.ParseConfig(ctx, common.TriggerAll)
+	if err != nil {
+		return writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+	}
+	if evaluator == nil {
+		return writeAPIError(w, http.StatusNotFound, "no policy defined for pull request")
+	}
+
+	result, err := evalCtx.EvaluatePolicy(ctx, evaluator)
+	if err != nil && result.Error == nil {
+		return errors.Wrap(err, "failed to evaluate policy")
+	}
+
+	analysis, err := h.analyzePlan(ctx, &result, evalCtx.PullContext)
+	if err != nil {
+		return err
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, analysis)
+	return nil
+}
+
+// analyzePlan finds the approvals that would satisfy the result. If the
+// server expands required reviewers, plans include the users who can approve
+// each requirement, unless the users cannot be listed or a requirement
+// includes organizations.
+func (b *Base) analyzePlan(ctx context.Context, result *common.Result, prctx pull.Context) (*plan.Analysis, error) {
+	if b.PullOpts.ExpandRequiredReviewers {
+		analysis, err := plan.Analyze(result, plan.ContextUserLister(prctx))
+		if err == nil {
+			return analysis, nil
+		}
+		if errors.Is(err, plan.ErrOrganizationActors) {
+			return plan.Analyze(result, nil)
+		}
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to list users for approval plans, plans will not include users")
+	}
+	return plan.Analyze(result, nil)
+}
@@ -0,0 +1,235 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// PolicyOwnersResultName is the name of the result that requires approval
+	// from a policy owner when a pull request weakens the policy.
+	PolicyOwnersResultName = "policy owners"
+
+	policyOwnersPendingDescription = "Changes to the policy require approval from a policy owner"
+)
+
+// protectsPolicy returns true if changes to the policy file may require
+// approval from the policy owners.
+func (ec *EvalContext) protectsPolicy() bool {
+	return !ec.Options.PolicyOwners.IsEmpty() && ec.ConfigFetcher != nil
+}
+
+// protectedTrigger returns the trigger of the evaluator if a pull request
+// modifies the policy file and requires approval from the policy owners.
+func (ec *EvalContext) protectedTrigger(evaluator common.Evaluator) common.Trigger {
+	if !ec.protectsPolicy() {
+		return evaluator.Trigger()
+	}
+	return (&protectedPolicyEvaluator{evaluator: evaluator, owners: ec.policyOwnersRule(nil)}).Trigger()
+}
+
+// protectPolicy returns an evaluator that also requires approval from the
+// policy owners if the pull request modifies the policy file to make it less
+// strict or to a policy that cannot be loaded or parsed. If policy protection
+// is disabled or the policy file is unchanged, it returns the original
+// evaluator.
+//
+// As a side effect, protectPolicy posts a status reporting the validity of
+// the modified policy file.
+func (ec *EvalContext) protectPolicy(ctx context.Context, evaluator common.Evaluator) (common.Evaluator, error) {
+	logger := zerolog.Ctx(ctx)
+
+	if !ec.protectsPolicy() {
+		return evaluator, nil
+	}
+
+	files, err := ec.PullContext.ChangedFiles()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list changed files")
+	}
+	if !containsFile(files, ec.Options.PolicyPath) {
+		return evaluator, nil
+	}
+
+	owner := ec.PullContext.RepositoryOwner()
+	repo := ec.PullContext.RepositoryName()
+	head := ec.ConfigFetcher.ConfigForRepositoryBranch(ctx, ec.Client, owner, repo, ec.PullContext.HeadSHA())
+
+	// A policy that cannot be loaded or parsed might remove any rule, so it
+	// requires owner approval like any other weakening
+	var changes []string
+	switch {
+	case head.LoadError != nil:
+		logger.Warn().Err(head.LoadError).Msg("Failed to load the modified policy")
+		ec.postPolicyFileStatus(ctx, "error", fmt.Sprintf("Error loading policy from %s", head.Source))
+		changes = []string{"the modified policy could not be loaded"}
+
+	case head.ParseError != nil:
+		ec.postPolicyFileStatus(ctx, "failure", truncateDescription("Invalid policy: "+head.ParseError.Error()))
+		changes = []string{"the modified policy is invalid"}
+
+	case head.Config == nil:
+		ec.postPolicyFileStatus(ctx, "success", "This pull request removes the policy")
+		changes = policy.FindWeakenings(ec.Config.Config, head.Config)
+
+	default:
+		if _, err := policy.ParsePolicy(head.Config); err != nil {
+			ec.postPolicyFileStatus(ctx, "failure", truncateDescription("Invalid policy: "+err.Error()))
+			changes = []string{"the modified policy is invalid"}
+			break
+		}
+		ec.postPolicyFileStatus(ctx, "success", "The modified policy is valid")
+		changes = policy.FindWeakenings(ec.Config.Config, head.Config)
+	}
+
+	if len(changes) == 0 {
+		return evaluator, nil
+	}
+
+	logger.Info().Msgf("Pull request weakens the policy, requiring approval from a policy owner: %s", strings.Join(changes, "; "))
+
+	return &protectedPolicyEvaluator{
+		evaluator: evaluator,
+		owners:    ec.policyOwnersRule(changes),
+	}, nil
+}
+
+// policyOwnersRule returns the rule that requires approval from a policy
+// owner for changes that weaken the policy.
+func (ec *EvalContext) policyOwnersRule(changes []string) *approval.Rule {
+	return &approval.Rule{
+		Name:        PolicyOwnersResultName,
+		Description: "This pull request makes the policy less strict: " + strings.Join(changes, "; "),
+		Options: approval.Options{
+			InvalidateOnPush: true,
+		},
+		Requires: common.Requires{
+			Count:  1,
+			Actors: ec.Options.PolicyOwners,
+		},
+	}
+}
+
+// postPolicyFileStatus posts a status reporting the validity of the policy
+// file modified by the pull request. The policy file only changes with new
+// commits, so the status is only posted for commit triggers.
+func (ec *EvalContext) postPolicyFileStatus(ctx context.Context, state, message string) {
+	logger := zerolog.Ctx(ctx)
+
+	if ec.SkipPostStatus || ec.SkipPolicyFileStatus || !ec.trigger.Matches(common.TriggerCommit) {
+		return
+	}
+	if !ec.PullContext.IsOpen() {
+		logger.Info().Msg("Skipping policy file status update because PR state is not open")
+		return
+	}
+
+	owner := ec.PullContext.RepositoryOwner()
+	repo := ec.PullContext.RepositoryName()
+	base, _ := ec.PullContext.Branches()
+	detailsURL := ec.DetailsURL()
+
+	status := github.RepoStatus{
+		State:       &state,
+		Context:     github.String(fmt.Sprintf("%s: %s: %s", ec.Options.StatusCheckContext, base, ec.Options.PolicyPath)),
+		Description: &message,
+		TargetURL:   &detailsURL,
+	}
+
+	if err := PostStatus(ctx, ec.Client, owner, repo, ec.PullContext.HeadSHA(), &status); err != nil {
+		logger.Err(err).Msg("Failed to post policy file status")
+	}
+}
+
+// protectedPolicyEvaluator requires approval from a policy owner in addition
+// to approval by the policy from the base branch.
+type protectedPolicyEvaluator struct {
+	evaluator common.Evaluator
+	owners    common.Evaluator
+}
+
+// Trigger includes commits, because a commit can change the policy file.
+func (e *protectedPolicyEvaluator) Trigger() common.Trigger {
+	return e.evaluator.Trigger() | e.owners.Trigger() | common.TriggerCommit
+}
+
+func (e *protectedPolicyEvaluator) Evaluate(ctx context.Context, prctx pull.Context) common.Result {
+	res := e.evaluator.Evaluate(ctx, prctx)
+	owners := e.owners.Evaluate(ctx, prctx)
+
+	res.Children = append(res.Children, &owners)
+	if res.Error == nil && owners.Error != nil {
+		res.Error = owners.Error
+	}
+
+	if res.Status == common.StatusApproved && owners.Status != common.StatusApproved {
+		res.Status = common.StatusPending
+		res.StatusDescription = policyOwnersPendingDescription
+	}
+	return res
+}
+
+// withoutPolicyOwners returns a copy of a result produced by a
+// protectedPolicyEvaluator without the policy owners result and the changes
+// it made to the status, so the result can be compared with the result of a
+// different policy. The original status description is not restored. Other
+// results are returned unchanged.
+func withoutPolicyOwners(result *common.Result) *common.Result {
+	n := len(result.Children)
+	if n == 0 || result.Children[n-1].Name != PolicyOwnersResultName {
+		return result
+	}
+	owners := result.Children[n-1]
+
+	res := *result
+	res.Children = append([]*common.Result(nil), result.Children[:n-1]...)
+	if res.Error != nil && res.Error == owners.Error {
+		res.Error = nil
+	}
+	if res.Status == common.StatusPending && res.StatusDescription == policyOwnersPendingDescription {
+		res.Status = common.StatusApproved
+	}
+	return &res
+}
+
+func containsFile(files []*pull.File, name string) bool {
+	for _, f := range files {
+		if f.Filename == name {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateDescription shortens a message to fit the GitHub status
+// description, which is limited to 140 characters.
+func truncateDescription(s string) string {
+	const maxLength = 140
+	if len(s) > maxLength {
+		return s[:maxLength-3] + "..."
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticEvaluator common.Result
+
+func (e *staticEvaluator) Trigger() common.Trigger {
+	return common.TriggerStatic
+}
+
+func (e *staticEvaluator) Evaluate(ctx context.Context, prctx pull.Context) common.Result {
+	res := common.Result(*e)
+	res.Children = append([]*common.Result(nil), e.Children...)
+	return res
+}
+
+func TestWithoutPolicyOwners(t *testing.T) {
+	approval := &common.Result{Name: "approval", Status: common.StatusApproved}
+
+	tests := map[string]struct {
+		Policy common.Result
+		Owners common.Result
+	}{
+		"ownersPending": {
+			Policy: common.Result{Status: common.StatusApproved, StatusDescription: "All rules are approved", Children: []*common.Result{approval}},
+			Owners: common.Result{Name: PolicyOwnersResultName, Status: common.StatusPending},
+		},
+		"ownersApproved": {
+			Policy: common.Result{Status: common.StatusApproved, StatusDescription: "All rules are approved", Children: []*common.Result{approval}},
+			Owners: common.Result{Name: PolicyOwnersResultName, Status: common.StatusApproved},
+		},
+		"policyPending": {
+			Policy: common.Result{Status: common.StatusPending, StatusDescription: "0/1 rules approved", Children: []*common.Result{approval}},
+			Owners: common.Result{Name: PolicyOwnersResultName, Status: common.StatusPending},
+		},
+		"ownersError": {
+			Policy: common.Result{Status: common.StatusApproved, StatusDescription: "All rules are approved", Children: []*common.Result{approval}},
+			Owners: common.Result{Name: PolicyOwnersResultName, Status: common.StatusPending, Error: errors.New("failed to list team members")},
+		},
+		"policyError": {
+			Policy: common.Result{Status: common.StatusPending, Error: errors.New("failed to load files"), Children: []*common.Result{approval}},
+			Owners: common.Result{Name: PolicyOwnersResultName, Status: common.StatusPending, Error: errors.New("failed to list team members")},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			evaluator := &protectedPolicyEvaluator{
+				evaluator: (*staticEvaluator)(&test.Policy),
+				owners:    (*staticEvaluator)(&test.Owners),
+			}
+
+			protected := evaluator.Evaluate(context.Background(), &pulltest.Context{})
+			assert.Len(t, protected.Children, 2, "protected result does not include the policy owners")
+
+			stripped := withoutPolicyOwners(&protected)
+			assert.Equal(t, test.Policy.Status, stripped.Status, "incorrect status")
+			assert.Equal(t, test.Policy.Error, stripped.Error, "incorrect error")
+			assert.Equal(t, test.Policy.Children, stripped.Children, "incorrect children")
+			assert.Len(t, protected.Children, 2, "original result was modified")
+
+			shadow := history.NewShadow(history.Policy{}, &test.Policy, stripped)
+			assert.True(t, shadow.Agrees, "identical shadow policy does not agree")
+			assert.Empty(t, shadow.Differences)
+		})
+	}
+
+	t.Run("unprotected", func(t *testing.T) {
+		result := &common.Result{
+			Status:            common.StatusPending,
+			StatusDescription: policyOwnersPendingDescription,
+			Children:          []*common.Result{approval},
+		}
+		assert.Same(t, result, withoutPolicyOwners(result))
+	})
+}
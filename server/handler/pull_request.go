@@ -17,12 +17,16 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"github.com/google/go-github/v59/github"
 	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/policy"
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
 type PullRequest struct {
@@ -52,14 +56,87 @@ func (h *PullRequest) Handle(ctx context.Context, eventType, deliveryID string,
 		t = common.TriggerPullRequest
 	case "labeled", "unlabeled":
 		t = common.TriggerLabel
+	case "closed":
+		if event.GetPullRequest().GetMerged() {
+			return h.handleMerge(ctx, installationID, event)
+		}
+		return nil
 	default:
 		return nil
 	}
 
-	return h.Evaluate(ctx, installationID, t, pull.Locator{
+	loc := pull.Locator{
 		Owner:  event.GetRepo().GetOwner().GetLogin(),
 		Repo:   event.GetRepo().GetName(),
 		Number: event.GetPullRequest().GetNumber(),
 		Value:  event.GetPullRequest(),
-	})
+	}
+
+	if t == common.TriggerLabel {
+		return h.evaluateIf(ctx, installationID, t, loc, func(ctx context.Context, evalCtx *EvalContext) bool {
+			return !h.detectAndLogTampering(ctx, evalCtx, event)
+		})
+	}
+
+	return h.Evaluate(ctx, installationID, t, loc)
+}
+
+// detectAndLogTampering logs an audit event and posts a failure status if a
+// user who is not allowed to apply a protected label adds or removes it.
+// Predicates ignore labels applied by these users, but the change may
+// indicate an attempt to bypass the policy. It returns true if it detected
+// tampering.
+func (h *PullRequest) detectAndLogTampering(ctx context.Context, evalCtx *EvalContext, event github.PullRequestEvent) bool {
+	logger := zerolog.Ctx(ctx)
+
+	if evalCtx.Config.LoadError != nil || evalCtx.Config.ParseError != nil {
+		logger.Warn().Str(LogKeyAudit, "pull_request").Msg("Skipping tampering check because the policy is not valid")
+		return false
+	}
+
+	label := event.GetLabel().GetName()
+	sender := event.GetSender().GetLogin()
+
+	verb := "applied"
+	if event.GetAction() == "unlabeled" {
+		verb = "removed"
+	}
+
+	for _, pred := range protectedLabelPredicates(evalCtx.Configs(ctx), label) {
+		isActor, err := pred.AppliedBy.IsActor(ctx, evalCtx.PullContext, sender)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to check if %s may apply the protected label %s", sender, label)
+			return false
+		}
+		if !isActor {
+			msg := fmt.Sprintf("Entity %s %s protected label %s without permission", sender, verb, label)
+			logger.Warn().Str(LogKeyAudit, "pull_request").Str("label", label).Msg(msg)
+
+			evalCtx.PostStatus(ctx, "failure", msg)
+			return true
+		}
+	}
+	return false
+}
+
+// protectedLabelPredicates returns the label predicates in the policy that
+// restrict who may apply the label.
+func protectedLabelPredicates(configs []*policy.Config, label string) []*predicate.HasLabels {
+	var all []predicate.Predicates
+	for _, config := range configs {
+		for _, rule := range config.ApprovalRules {
+			all = append(all, rule.Predicates)
+		}
+		if disapproval := config.Policy.Disapproval; disapproval != nil {
+			all = append(all, disapproval.Predicates)
+		}
+	}
+
+	var preds []*predicate.HasLabels
+	for _, p := range all {
+		if p.HasLabels != nil && p.HasLabels.IsProtected(label) {
+			preds = append(preds, p.HasLabels)
+		}
+	}
+	return preds
 }
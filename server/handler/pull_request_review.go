@@ -72,7 +72,7 @@ func (h *PullRequestReview) Handle(ctx context.Context, eventType, deliveryID st
 	}
 
 	reviewState := pull.ReviewState(event.GetReview().GetState())
-	if !h.affectsApproval(reviewState, evalCtx.Config.Config) {
+	if !h.affectsApproval(reviewState, evalCtx.Configs(ctx)) {
 		logger.Debug().Msg("Skipping evaluation because this review does not impact approval")
 		return nil
 	}
@@ -86,14 +86,16 @@ func (h *PullRequestReview) Handle(ctx context.Context, eventType, deliveryID st
 	return nil
 }
 
-func (h *PullRequestReview) affectsApproval(reviewState pull.ReviewState, config *policy.Config) bool {
+func (h *PullRequestReview) affectsApproval(reviewState pull.ReviewState, configs []*policy.Config) bool {
 	states := make(map[pull.ReviewState]struct{})
-	for _, rule := range config.ApprovalRules {
-		states[rule.Options.GetMethods().GithubReviewState] = struct{}{}
-	}
-	if disapproval := config.Policy.Disapproval; disapproval != nil {
-		states[disapproval.Options.GetDisapproveMethods().GithubReviewState] = struct{}{}
-		states[disapproval.Options.GetRevokeMethods().GithubReviewState] = struct{}{}
+	for _, config := range configs {
+		for _, rule := range config.ApprovalRules {
+			states[rule.Options.GetMethods().GithubReviewState] = struct{}{}
+		}
+		if disapproval := config.Policy.Disapproval; disapproval != nil {
+			states[disapproval.Options.GetDisapproveMethods().GithubReviewState] = struct{}{}
+			states[disapproval.Options.GetRevokeMethods().GithubReviewState] = struct{}{}
+		}
 	}
 
 	for state := range states {
@@ -0,0 +1,354 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultReconcileConcurrency  = 2
+	DefaultReconcileMinRateLimit = 1000
+)
+
+// errRateLimited stops reconciliation of an installation that is close to
+// its GitHub rate limit.
+var errRateLimited = errors.New("installation is close to the GitHub rate limit")
+
+// Reconciler periodically evaluates all open pull requests and updates their
+// statuses if they differ from the result of the evaluation. This repairs
+// statuses that are missing or stale because webhooks were not delivered.
+type Reconciler struct {
+	Base
+
+	// Concurrency is the maximum number of pull requests evaluated at the
+	// same time for each installation.
+	Concurrency int
+
+	// MinRateLimit is the number of remaining REST or GraphQL requests below
+	// which the reconciler stops evaluating pull requests for an installation
+	// until the next sweep.
+	MinRateLimit int
+}
+
+// Run sweeps all installations at the given interval until the context is
+// canceled.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	logger := zerolog.Ctx(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		updated, err := r.Sweep(ctx)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to reconcile pull request statuses")
+		}
+		logger.Info().Msgf("Reconciled pull request statuses in %s, updated %d statuses", time.Since(start).Round(time.Millisecond), updated)
+	}
+}
+
+// Sweep evaluates the open pull requests in every installation and returns
+// the number of statuses it updated. Installations are processed in order;
+// failures in one installation do not stop processing of the others.
+func (r *Reconciler) Sweep(ctx context.Context) (int, error) {
+	installations, err := r.Installations.ListAll(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list installations")
+	}
+
+	total := 0
+	for _, inst := range installations {
+		logger := zerolog.Ctx(ctx).With().
+			Int64(githubapp.LogKeyInstallationID, inst.ID).
+			Str("github_owner", inst.Owner).
+			Logger()
+
+		updated, err := r.reconcileInstallation(logger.WithContext(ctx), inst.ID)
+		total += updated
+
+		switch {
+		case errors.Is(err, errRateLimited):
+			logger.Warn().Msg("Stopped reconciling installation because it is close to the GitHub rate limit")
+		case err != nil:
+			logger.Error().Err(err).Msg("Failed to reconcile installation")
+		}
+	}
+	return total, nil
+}
+
+func (r *Reconciler) reconcileInstallation(ctx context.Context, installationID int64) (int, error) {
+	client, err := r.NewInstallationClient(installationID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create installation client")
+	}
+
+	repos, err := listInstallationRepositories(ctx, client)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, repo := range repos {
+		if repo.GetArchived() {
+			continue
+		}
+		if err := r.checkRateLimit(ctx, client); err != nil {
+			return total, err
+		}
+
+		updated, err := r.reconcileRepository(ctx, installationID, client, repo)
+		total += updated
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (r *Reconciler) reconcileRepository(ctx context.Context, installationID int64, client *github.Client, repo *github.Repository) (int, error) {
+	owner := repo.GetOwner().GetLogin()
+	name := repo.GetName()
+
+	prs, err := listOpenPullRequests(ctx, client, owner, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return reconcilePullRequests(prs, r.Concurrency, func(pr *github.PullRequest) (bool, error) {
+		prCtx, logger := r.PreparePRContext(ctx, installationID, pr)
+
+		changed, err := r.ReconcilePullRequest(prCtx, installationID, pr)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to reconcile pull request status")
+		}
+		return changed, err
+	})
+}
+
+// reconcilePullRequests calls reconcile for each open pull request, with at
+// most concurrency calls running at the same time. It returns the number of
+// calls that updated a status. If a call fails because of a rate limit, it
+// stops starting new calls and returns errRateLimited.
+func reconcilePullRequests(prs []*github.PullRequest, concurrency int, reconcile func(*github.PullRequest) (bool, error)) (int, error) {
+	if concurrency < 1 {
+		concurrency = DefaultReconcileConcurrency
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		updated int
+		limited bool
+	)
+
+	sem := make(chan struct{}, concurrency)
+	for _, pr := range prs {
+		// Closed pull requests no longer need a status, so skip them even
+		// if the caller did not filter the list
+		if pr.GetState() != "open" {
+			continue
+		}
+
+		sem <- struct{}{}
+
+		mu.Lock()
+		stop := limited
+		mu.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+
+		go func(pr *github.PullRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			changed, err := reconcile(pr)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if changed {
+				updated++
+			}
+			if isRateLimitError(err) {
+				limited = true
+			}
+		}(pr)
+	}
+	wg.Wait()
+
+	if limited {
+		return updated, errRateLimited
+	}
+	return updated, nil
+}
+
+// ReconcilePullRequest evaluates a pull request and posts the resulting
+// status if it is different from the current status on the head commit. It
+// returns true if it posted a status.
+func (r *Reconciler) ReconcilePullRequest(ctx context.Context, installationID int64, pr *github.PullRequest) (bool, error) {
+	logger := zerolog.Ctx(ctx)
+
+	evalCtx, err := r.NewEvalContext(ctx, installationID, pull.Locator{
+		Owner:  pr.GetBase().GetRepo().GetOwner().GetLogin(),
+		Repo:   pr.GetBase().GetRepo().GetName(),
+		Number: pr.GetNumber(),
+		Value:  pr,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create evaluation context")
+	}
+
+	evalCtx.SkipPostStatus = true
+	evalCtx.SkipHistory = true
+
+	// Errors are reported by the saved status, if there is one
+	evaluator, err := evalCtx.ParseConfig(ctx, common.TriggerAll)
+	if err == nil && evaluator != nil {
+		_, err = evalCtx.EvaluatePolicy(ctx, evaluator)
+	}
+
+	status := evalCtx.Status
+	if status == nil {
+		return false, err
+	}
+
+	owner := evalCtx.PullContext.RepositoryOwner()
+	repo := evalCtx.PullContext.RepositoryName()
+	sha := evalCtx.PullContext.HeadSHA()
+
+	current, err := findStatus(ctx, evalCtx.Client, owner, repo, sha, status.GetContext())
+	if err != nil {
+		return false, err
+	}
+	if isStatusCurrent(current, status) {
+		return false, nil
+	}
+
+	logger.Info().Msgf("Status %q on %s is missing or stale, updating", status.GetContext(), sha)
+	if err := PostStatus(ctx, evalCtx.Client, owner, repo, sha, status); err != nil {
+		return false, errors.Wrap(err, "failed to post status")
+	}
+	return true, nil
+}
+
+// isStatusCurrent returns true if the current status on a commit, which may be
+// nil, has the same state and description as the desired status. The target
+// URL is not compared because it does not depend on the evaluation.
+func isStatusCurrent(current, desired *github.RepoStatus) bool {
+	return current != nil && current.GetState() == desired.GetState() && current.GetDescription() == desired.GetDescription()
+}
+
+// listInstallationRepositories returns all repositories that the
+// installation client can access.
+func listInstallationRepositories(ctx context.Context, client *github.Client) ([]*github.Repository, error) {
+	var repos []*github.Repository
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		res, resp, err := client.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list repositories")
+		}
+		repos = append(repos, res.Repositories...)
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listOpenPullRequests returns all open pull requests in a repository.
+func listOpenPullRequests(ctx context.Context, client *github.Client, owner, repo string) ([]*github.PullRequest, error) {
+	var prs []*github.PullRequest
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		res, resp, err := client.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list pull requests for %s/%s", owner, repo)
+		}
+		prs = append(prs, res...)
+		if resp.NextPage == 0 {
+			return prs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// findStatus returns the latest status with the given context on a commit or
+// nil if no such status exists.
+func findStatus(ctx context.Context, client *github.Client, owner, repo, ref, context string) (*github.RepoStatus, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		combined, resp, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, ref, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get commit statuses")
+		}
+		for _, s := range combined.Statuses {
+			if s.GetContext() == context {
+				return s, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (r *Reconciler) checkRateLimit(ctx context.Context, client *github.Client) error {
+	minRemaining := r.MinRateLimit
+	if minRemaining < 1 {
+		minRemaining = DefaultReconcileMinRateLimit
+	}
+
+	limits, _, err := client.RateLimit.Get(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get rate limits")
+	}
+	if limits.GetCore().Remaining < minRemaining || limits.GetGraphQL().Remaining < minRemaining {
+		return errRateLimited
+	}
+	return nil
+}
+
+func isRateLimitError(err error) bool {
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	return errors.As(err, &rateLimitErr) || errors.As(err, &abuseErr)
+}
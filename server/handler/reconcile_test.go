@@ -0,0 +1,208 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcilePullRequests(t *testing.T) {
+	newPullRequests := func(states ...string) []*github.PullRequest {
+		var prs []*github.PullRequest
+		for i, state := range states {
+			prs = append(prs, &github.PullRequest{
+				Number: github.Int(i + 1),
+				State:  github.String(state),
+			})
+		}
+		return prs
+	}
+
+	t.Run("skipsClosed", func(t *testing.T) {
+		prs := newPullRequests("open", "closed", "open", "closed")
+
+		var mu sync.Mutex
+		var reconciled []int
+		updated, err := reconcilePullRequests(prs, 1, func(pr *github.PullRequest) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reconciled = append(reconciled, pr.GetNumber())
+			return true, nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, updated)
+		assert.Equal(t, []int{1, 3}, reconciled)
+	})
+
+	t.Run("countsUpdated", func(t *testing.T) {
+		prs := newPullRequests("open", "open", "open", "open")
+
+		updated, err := reconcilePullRequests(prs, 2, func(pr *github.PullRequest) (bool, error) {
+			switch pr.GetNumber() {
+			case 1:
+				return false, nil
+			case 2:
+				return false, errors.New("evaluation failed")
+			}
+			return true, nil
+		})
+
+		assert.NoError(t, err, "non-rate limit errors should not be returned")
+		assert.Equal(t, 2, updated)
+	})
+
+	t.Run("boundsConcurrency", func(t *testing.T) {
+		prs := newPullRequests("open", "open", "open", "open", "open", "open", "open", "open")
+
+		var calls int32
+		var maxRunning concurrencyTracker
+		updated, err := reconcilePullRequests(prs, 3, func(pr *github.PullRequest) (bool, error) {
+			defer maxRunning.Start()()
+			atomic.AddInt32(&calls, 1)
+
+			time.Sleep(5 * time.Millisecond)
+			return false, nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, updated)
+		assert.Equal(t, int32(8), calls, "not all pull requests were reconciled")
+		assert.LessOrEqual(t, maxRunning.Max(), 3, "too many pull requests were reconciled at once")
+	})
+
+	t.Run("defaultConcurrency", func(t *testing.T) {
+		prs := newPullRequests("open", "open", "open", "open", "open", "open")
+
+		var maxRunning concurrencyTracker
+		_, err := reconcilePullRequests(prs, 0, func(pr *github.PullRequest) (bool, error) {
+			defer maxRunning.Start()()
+
+			time.Sleep(5 * time.Millisecond)
+			return false, nil
+		})
+
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, maxRunning.Max(), DefaultReconcileConcurrency, "too many pull requests were reconciled at once")
+	})
+
+	t.Run("stopsWhenRateLimited", func(t *testing.T) {
+		prs := newPullRequests("open", "open", "open", "open")
+
+		var reconciled []int
+		updated, err := reconcilePullRequests(prs, 1, func(pr *github.PullRequest) (bool, error) {
+			reconciled = append(reconciled, pr.GetNumber())
+			if pr.GetNumber() == 2 {
+				return false, &github.RateLimitError{Message: "API rate limit exceeded"}
+			}
+			return true, nil
+		})
+
+		assert.ErrorIs(t, err, errRateLimited)
+		assert.Equal(t, 1, updated)
+		assert.Equal(t, []int{1, 2}, reconciled, "pull requests were reconciled after reaching the rate limit")
+	})
+}
+
+// concurrencyTracker records the maximum number of concurrent calls.
+type concurrencyTracker struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+// Start records the start of a call and returns a function that records the
+// end of the call.
+func (c *concurrencyTracker) Start() func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.running++
+	if c.running > c.max {
+		c.max = c.running
+	}
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.running--
+	}
+}
+
+func (c *concurrencyTracker) Max() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max
+}
+
+func TestIsStatusCurrent(t *testing.T) {
+	desired := &github.RepoStatus{
+		State:       github.String("success"),
+		Description: github.String("All rules are approved"),
+		TargetURL:   github.String("https://policy-bot.example.com/details/org/repo/1"),
+	}
+
+	tests := map[string]struct {
+		Current  *github.RepoStatus
+		Expected bool
+	}{
+		"missing": {
+			Current:  nil,
+			Expected: false,
+		},
+		"same": {
+			Current: &github.RepoStatus{
+				State:       github.String("success"),
+				Description: github.String("All rules are approved"),
+				TargetURL:   github.String("https://policy-bot.example.com/details/org/repo/1"),
+			},
+			Expected: true,
+		},
+		"differentTargetURL": {
+			Current: &github.RepoStatus{
+				State:       github.String("success"),
+				Description: github.String("All rules are approved"),
+				TargetURL:   github.String("https://old.example.com/details/org/repo/1"),
+			},
+			Expected: true,
+		},
+		"differentState": {
+			Current: &github.RepoStatus{
+				State:       github.String("pending"),
+				Description: github.String("All rules are approved"),
+			},
+			Expected: false,
+		},
+		"differentDescription": {
+			Current: &github.RepoStatus{
+				State:       github.String("success"),
+				Description: github.String("0/1 rules approved"),
+			},
+			Expected: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, isStatusCurrent(test.Current, desired))
+		})
+	}
+}
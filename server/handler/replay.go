@@ -0,0 +1,182 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/server/replay"
+	"github.com/pkg/errors"
+	"goji.io/pat"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	DefaultReplayLimit = 50
+	MaxReplayLimit     = 500
+
+	maxReplayPolicySize = 1 << 20
+)
+
+// Replay evaluates a candidate policy from the request body against recently
+// merged pull requests in a repository. The request waits for all pull
+// requests to be evaluated, so the number of pull requests is limited. If
+// the installation is close to a GitHub rate limit, the request fails instead
+// of waiting for the limit to reset. Replays use the rate limit of the
+// installation, so the user who owns the provided token must be able to write
+// to the repository.
+type Replay struct {
+	Base
+}
+
+func (h *Replay) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	token := getToken(r)
+	if token == "" {
+		return writeAPIError(w, http.StatusUnauthorized, "missing token")
+	}
+
+	client, err := h.NewTokenClient(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create token client")
+	}
+
+	owner, repo := pat.Param(r, "owner"), pat.Param(r, "repo")
+	repository, _, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		if isNotFound(err) {
+			return writeAPIError(w, http.StatusNotFound, "failed to find repository")
+		}
+		return errors.Wrap(err, "failed to get repository")
+	}
+	if !canWriteRepository(repository) {
+		return writeAPIError(w, http.StatusForbidden, "replay requires write permission on the repository")
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" && format != "table" {
+		return writeAPIError(w, http.StatusBadRequest, "format must be json, csv, or table")
+	}
+
+	q, err := parseReplayQuery(r, owner, repo)
+	if err != nil {
+		return writeAPIError(w, http.StatusBadRequest, err.Error())
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxReplayPolicySize))
+	if err != nil {
+		return errors.Wrap(err, "failed to read request body")
+	}
+
+	var config policy.Config
+	if err := yaml.UnmarshalStrict(b, &config); err != nil {
+		return writeAPIError(w, http.StatusBadRequest, "failed to parse policy: "+err.Error())
+	}
+	evaluator, err := policy.ParsePolicy(&config)
+	if err != nil {
+		return writeAPIError(w, http.StatusBadRequest, "invalid policy: "+err.Error())
+	}
+
+	installation, err := h.Installations.GetByOwner(ctx, owner)
+	if err != nil {
+		return writeAPIError(w, http.StatusNotFound, "not installed in org")
+	}
+
+	installationClient, err := h.NewInstallationClient(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create installation client")
+	}
+	v4client, err := h.NewInstallationV4Client(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create installation v4 client")
+	}
+
+	replayer := &replay.Replayer{
+		Client:      installationClient,
+		V4Client:    v4client,
+		GlobalCache: h.GlobalCache,
+		Evaluator:   evaluator,
+
+		FailOnRateLimit: true,
+	}
+
+	report, err := replayer.Replay(ctx, q, nil)
+	if err != nil {
+		var rateLimitErr *replay.RateLimitedError
+		if errors.As(err, &rateLimitErr) {
+			retryAfter := int(math.Ceil(time.Until(rateLimitErr.Reset).Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+			return writeAPIError(w, http.StatusTooManyRequests, rateLimitErr.Error())
+		}
+		return errors.Wrap(err, "failed to replay policy")
+	}
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		return report.WriteCSV(w)
+	case "table":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		return report.WriteTable(w)
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, report)
+	return nil
+}
+
+func parseReplayQuery(r *http.Request, owner, repo string) (replay.Query, error) {
+	q := replay.Query{
+		Owner: owner,
+		Repo:  repo,
+		Limit: DefaultReplayLimit,
+	}
+
+	values := r.URL.Query()
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := values.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, errors.Errorf("invalid %s time, must be in RFC 3339 format", name)
+			}
+			*t = parsed
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxReplayLimit {
+			return q, errors.Errorf("invalid limit, must be between 1 and %d", MaxReplayLimit)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// canWriteRepository returns true if the permissions of the authenticated user
+// on a repository include write access. The maintain and admin permissions
+// also include write access.
+func canWriteRepository(repo *github.Repository) bool {
+	perms := repo.GetPermissions()
+	return perms["push"] || perms["maintain"] || perms["admin"]
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanWriteRepository(t *testing.T) {
+	tests := map[string]struct {
+		Permissions map[string]bool
+		Expected    bool
+	}{
+		"none": {
+			Permissions: nil,
+			Expected:    false,
+		},
+		"read": {
+			Permissions: map[string]bool{"pull": true},
+			Expected:    false,
+		},
+		"triage": {
+			Permissions: map[string]bool{"pull": true, "triage": true},
+			Expected:    false,
+		},
+		"write": {
+			Permissions: map[string]bool{"pull": true, "triage": true, "push": true},
+			Expected:    true,
+		},
+		"maintain": {
+			Permissions: map[string]bool{"maintain": true},
+			Expected:    true,
+		},
+		"admin": {
+			Permissions: map[string]bool{"admin": true},
+			Expected:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := &github.Repository{Permissions: test.Permissions}
+			assert.Equal(t, test.Expected, canWriteRepository(repo))
+		})
+	}
+}
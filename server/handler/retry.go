@@ -0,0 +1,116 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultRetryInitialBackoff = 500 * time.Millisecond
+	DefaultRetryMaxBackoff     = 5 * time.Second
+
+	// TemporaryErrorDescription is the status description for evaluations
+	// that failed with temporary errors after all retries, if the evaluation
+	// is retried later.
+	TemporaryErrorDescription = "Temporary error while contacting GitHub, evaluation will be retried later"
+
+	// TemporaryErrorRetryDescription is the status description for
+	// evaluations that failed with temporary errors after all retries, if
+	// the evaluation is not retried later.
+	TemporaryErrorRetryDescription = "Temporary error while contacting GitHub, comment \"" + CommandPrefix + " " + CommandReevaluate + "\" to retry"
+)
+
+// RetryPolicy controls how evaluations that fail with temporary errors are
+// retried. The zero value disables retries.
+type RetryPolicy struct {
+	// MaxElapsed is the maximum total time spent retrying an operation,
+	// including the time spent in attempts after the first.
+	MaxElapsed time.Duration
+
+	// InitialBackoff is the delay before the first retry. The delay doubles
+	// after each attempt, up to MaxBackoff. A random jitter of up to half of
+	// the delay is subtracted from each delay.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// RetryLater is true if evaluations that still fail with temporary
+	// errors are retried later, by the durable webhook queue or by
+	// reconciliation. It only changes the status posted for these failures.
+	RetryLater bool
+}
+
+// temporaryErrorDescription returns the status description for evaluations
+// that failed with temporary errors after all retries.
+func (p RetryPolicy) temporaryErrorDescription() string {
+	if p.RetryLater {
+		return TemporaryErrorDescription
+	}
+	return TemporaryErrorRetryDescription
+}
+
+// Do calls fn until it returns nil, returns an error that is not temporary,
+// or the retry budget is exhausted. It returns the last error from fn. If fn
+// fails because of a primary rate limit, Do waits until the limit resets
+// instead of using the backoff.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	logger := zerolog.Ctx(ctx)
+
+	deadline := time.Now().Add(p.MaxElapsed)
+	backoff := p.InitialBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !pull.IsTemporaryError(err) || p.MaxElapsed <= 0 {
+			return err
+		}
+
+		delay := backoff - time.Duration(rand.Int63n(int64(backoff)/2+1))
+		if reset, ok := pull.RateLimitReset(err); ok {
+			delay = time.Until(reset)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			logger.Warn().Err(err).Msgf("Temporary error persisted after %d attempts, giving up", attempt)
+			return err
+		}
+
+		logger.Info().Err(err).Msgf("Temporary error on attempt %d, retrying in %s", attempt, delay.Round(time.Millisecond))
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
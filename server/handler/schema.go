@@ -0,0 +1,36 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/policy-bot/policy/schema"
+	"github.com/rs/zerolog"
+)
+
+// Schema returns the JSON Schema for policy files.
+func Schema() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := schema.Generate()
+		if err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to generate policy schema")
+			baseapp.WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to generate schema"})
+			return
+		}
+		baseapp.WriteJSON(w, http.StatusOK, s)
+	})
+}
@@ -0,0 +1,269 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+)
+
+const (
+	MetricsKeyShadowEvaluations = "policybot.shadow.evaluations"
+)
+
+// evaluateShadow evaluates the shadow policy, if there is one, and compares
+// its result to the result of the real policy. The comparison ignores any
+// approval required from the policy owners, because the shadow policy does not
+// include it. Failures are logged and return a nil Shadow so that they never
+// affect the real evaluation.
+func (ec *EvalContext) evaluateShadow(ctx context.Context, result *common.Result) *history.Shadow {
+	if ec.SkipHistory {
+		return nil
+	}
+
+	sc := ec.ShadowConfig(ctx)
+	if sc.Config == nil && sc.LoadError == nil && sc.ParseError == nil {
+		return nil
+	}
+
+	ctx, span := common.StartSpan(ctx, "EvalContext.EvaluateShadowPolicy")
+	defer span.End()
+	defer pull.BindContext(ec.PullContext, ctx)()
+
+	logger := zerolog.Ctx(ctx)
+
+	if err := sc.LoadError; err != nil {
+		logger.Warn().Err(err).Msgf("Error loading shadow policy from %s", sc.Source)
+		return nil
+	}
+	if err := sc.ParseError; err != nil {
+		logger.Warn().Err(err).Msgf("Invalid shadow policy in %s: %s", sc.Source, sc.Path)
+		return nil
+	}
+
+	var evaluator common.Evaluator
+	var err error
+	if efc := ec.EnforcedConfig(ctx); efc.Config != nil {
+		evaluator, err = policy.ParseEnforcedPolicy(sc.Config, efc.Config)
+	} else {
+		evaluator, err = policy.ParsePolicy(sc.Config)
+	}
+	if err != nil {
+		logger.Warn().Err(err).Msgf("Invalid shadow policy in %s: %s", sc.Source, sc.Path)
+		return nil
+	}
+
+	result = withoutPolicyOwners(result)
+
+	shadowResult := evaluator.Evaluate(ctx, ec.PullContext)
+	shadow := history.NewShadow(history.Policy{
+		Source: sc.Source,
+		Path:   sc.Path,
+		SHA:    sc.SHA,
+	}, &shadowResult, result)
+
+	if shadow.Agrees {
+		ec.incCounter(metricName(MetricsKeyShadowEvaluations, "result", "agree"), 1)
+		return shadow
+	}
+	ec.incCounter(metricName(MetricsKeyShadowEvaluations, "result", "disagree"), 1)
+
+	event := logger.Info().
+		Str("shadow_status", shadow.Status).
+		Str("shadow_status_description", shadow.StatusDescription)
+	if shadow.Error != "" {
+		event = event.Str("shadow_error", shadow.Error)
+	}
+	differences := make([]string, len(shadow.Differences))
+	for i, d := range shadow.Differences {
+		differences[i] = fmt.Sprintf("%s: %s -> %s", d.Name, displayStatus(d.Status), displayStatus(d.Shadow))
+	}
+	event.Strs("shadow_differences", differences).Msgf("Shadow policy in %s: %s has status %s instead of %s", sc.Source, sc.Path, shadow.Status, result.Status)
+
+	return shadow
+}
+
+func displayStatus(s string) string {
+	if s == "" {
+		return "missing"
+	}
+	return s
+}
+
+// ShadowReport is an API handler that summarizes how the shadow policy would
+// change the status of pull requests in a repository. It uses the evaluation
+// history, so history must be enabled. The user who owns the provided token
+// must be able to read the repository.
+type ShadowReport struct {
+	Base
+}
+
+type ShadowReportResponse struct {
+	// Evaluations is the number of evaluations that included the shadow
+	// policy and Disagreements is the number of those evaluations where the
+	// shadow policy had a different status.
+	Evaluations   int `json:"evaluations"`
+	Disagreements int `json:"disagreements"`
+
+	// PullRequests is the number of pull requests evaluated with the shadow
+	// policy and Changed is the number of pull requests where the latest
+	// evaluation had a different status.
+	PullRequests int `json:"pull_requests"`
+	Changed      int `json:"changed"`
+
+	// Transitions counts the changed pull requests by their current and
+	// shadow statuses, like "pending -> approved".
+	Transitions map[string]int `json:"transitions"`
+
+	// Rules counts the changed pull requests by the rules that have a
+	// different status, ordered from most to least common.
+	Rules []*ShadowRuleCount `json:"rules"`
+
+	Changes []*ShadowChange `json:"changes"`
+}
+
+type ShadowRuleCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type ShadowChange struct {
+	Number            int                  `json:"number"`
+	HeadSHA           string               `json:"head_sha"`
+	EvaluatedAt       time.Time            `json:"evaluated_at"`
+	Status            string               `json:"status"`
+	ShadowStatus      string               `json:"shadow_status"`
+	ShadowDescription string               `json:"shadow_status_description"`
+	ShadowError       string               `json:"shadow_error,omitempty"`
+	Differences       []history.Difference `json:"differences"`
+}
+
+func (h *ShadowReport) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	token := getToken(r)
+	if token == "" {
+		return writeAPIError(w, http.StatusUnauthorized, "missing token")
+	}
+
+	if h.History == nil {
+		return writeAPIError(w, http.StatusNotFound, "evaluation history is not enabled")
+	}
+
+	client, err := h.NewTokenClient(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create token client")
+	}
+
+	q := history.Query{
+		Owner:  pat.Param(r, "owner"),
+		Repo:   pat.Param(r, "repo"),
+		Shadow: true,
+	}
+	if _, _, err := client.Repositories.Get(ctx, q.Owner, q.Repo); err != nil {
+		if isNotFound(err) {
+			return writeAPIError(w, http.StatusNotFound, "failed to find repository")
+		}
+		return errors.Wrap(err, "failed to get repository")
+	}
+
+	if err := parseHistoryQuery(r, &q); err != nil {
+		return writeAPIError(w, http.StatusBadRequest, err.Error())
+	}
+	// The report summarizes all evaluations in the time range
+	q.Limit = 0
+
+	records, err := h.History.List(ctx, q)
+	if err != nil {
+		return errors.Wrap(err, "failed to list evaluation history")
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, NewShadowReport(records))
+	return nil
+}
+
+// NewShadowReport summarizes records that include shadow results. Records
+// must be ordered from newest to oldest. Only the newest record for each pull
+// request is used to find changed pull requests.
+func NewShadowReport(records []*history.Record) *ShadowReportResponse {
+	report := &ShadowReportResponse{
+		Transitions: make(map[string]int),
+		Rules:       []*ShadowRuleCount{},
+		Changes:     []*ShadowChange{},
+	}
+
+	seen := make(map[int]bool)
+	rules := make(map[string]int)
+	for _, r := range records {
+		if r.Shadow == nil {
+			continue
+		}
+
+		report.Evaluations++
+		if !r.Shadow.Agrees {
+			report.Disagreements++
+		}
+
+		if seen[r.Number] {
+			continue
+		}
+		seen[r.Number] = true
+		report.PullRequests++
+
+		if r.Shadow.Agrees {
+			continue
+		}
+		report.Changed++
+		report.Transitions[fmt.Sprintf("%s -> %s", r.Status, r.Shadow.Status)]++
+		for _, d := range r.Shadow.Differences {
+			rules[d.Name]++
+		}
+
+		report.Changes = append(report.Changes, &ShadowChange{
+			Number:            r.Number,
+			HeadSHA:           r.HeadSHA,
+			EvaluatedAt:       r.EvaluatedAt,
+			Status:            r.Status,
+			ShadowStatus:      r.Shadow.Status,
+			ShadowDescription: r.Shadow.StatusDescription,
+			ShadowError:       r.Shadow.Error,
+			Differences:       r.Shadow.Differences,
+		})
+	}
+
+	for name, count := range rules {
+		report.Rules = append(report.Rules, &ShadowRuleCount{Name: name, Count: count})
+	}
+	sort.Slice(report.Rules, func(i, j int) bool {
+		if report.Rules[i].Count == report.Rules[j].Count {
+			return report.Rules[i].Name < report.Rules[j].Name
+		}
+		return report.Rules[i].Count > report.Rules[j].Count
+	})
+	sort.Slice(report.Changes, func(i, j int) bool { return report.Changes[i].Number < report.Changes[j].Number })
+
+	return report
+}
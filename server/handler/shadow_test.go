@@ -0,0 +1,90 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewShadowReport(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	agree := func(status string) *history.Shadow {
+		return &history.Shadow{Status: status, Agrees: true}
+	}
+	disagree := func(status string, differences ...history.Difference) *history.Shadow {
+		return &history.Shadow{Status: status, StatusDescription: "shadow " + status, Differences: differences}
+	}
+
+	docs := history.Difference{Name: "approval / docs", Status: "pending", Shadow: "approved"}
+	security := history.Difference{Name: "approval / security", Status: "approved", Shadow: ""}
+
+	// records are ordered from newest to oldest
+	records := []*history.Record{
+		{Number: 3, HeadSHA: "c2", EvaluatedAt: now, Status: "approved", Shadow: disagree("pending", security)},
+		{Number: 1, HeadSHA: "a2", EvaluatedAt: now.Add(-1 * time.Hour), Status: "pending", Shadow: disagree("approved", docs)},
+		{Number: 2, HeadSHA: "b1", EvaluatedAt: now.Add(-2 * time.Hour), Status: "pending", Shadow: agree("pending")},
+		{Number: 4, HeadSHA: "d1", EvaluatedAt: now.Add(-3 * time.Hour), Status: "pending"},
+		{Number: 3, HeadSHA: "c1", EvaluatedAt: now.Add(-4 * time.Hour), Status: "pending", Shadow: disagree("approved", docs)},
+		{Number: 2, HeadSHA: "b0", EvaluatedAt: now.Add(-5 * time.Hour), Status: "pending", Shadow: disagree("approved", docs, security)},
+		{Number: 5, HeadSHA: "e1", EvaluatedAt: now.Add(-6 * time.Hour), Status: "pending", Shadow: disagree("approved", docs, security)},
+	}
+
+	report := NewShadowReport(records)
+
+	assert.Equal(t, 6, report.Evaluations, "incorrect number of evaluations")
+	assert.Equal(t, 5, report.Disagreements, "incorrect number of disagreements")
+	assert.Equal(t, 4, report.PullRequests, "incorrect number of pull requests")
+	assert.Equal(t, 3, report.Changed, "incorrect number of changed pull requests")
+
+	assert.Equal(t, map[string]int{
+		"approved -> pending": 1,
+		"pending -> approved": 2,
+	}, report.Transitions)
+
+	assert.Equal(t, []*ShadowRuleCount{
+		{Name: "approval / docs", Count: 2},
+		{Name: "approval / security", Count: 2},
+	}, report.Rules)
+
+	if assert.Len(t, report.Changes, 3) {
+		assert.Equal(t, &ShadowChange{
+			Number:            1,
+			HeadSHA:           "a2",
+			EvaluatedAt:       now.Add(-1 * time.Hour),
+			Status:            "pending",
+			ShadowStatus:      "approved",
+			ShadowDescription: "shadow approved",
+			Differences:       []history.Difference{docs},
+		}, report.Changes[0])
+		assert.Equal(t, 3, report.Changes[1].Number)
+		assert.Equal(t, "c2", report.Changes[1].HeadSHA, "change does not use the newest record")
+		assert.Equal(t, 5, report.Changes[2].Number)
+	}
+}
+
+func TestNewShadowReportEmpty(t *testing.T) {
+	report := NewShadowReport(nil)
+
+	assert.Zero(t, report.Evaluations)
+	assert.Zero(t, report.PullRequests)
+	assert.NotNil(t, report.Transitions, "transitions should be empty, not nil")
+	assert.NotNil(t, report.Rules, "rules should be empty, not nil")
+	assert.NotNil(t, report.Changes, "changes should be empty, not nil")
+}
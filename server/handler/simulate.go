@@ -18,7 +18,9 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/google/go-github/v59/github"
 	"github.com/palantir/go-baseapp/baseapp"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/palantir/policy-bot/policy"
@@ -26,6 +28,7 @@ import (
 	"github.com/palantir/policy-bot/policy/simulated"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
 // Simulate provides a baseline for handlers to perform simulated pull request evaluations and
@@ -34,14 +37,41 @@ type Simulate struct {
 	Base
 }
 
-// SimulationResponse is the response returned from Simulate, this is a trimmed down version of common.Result with json
-// tags. This struct and the newSimulationResponse constructor can be extended to include extra content from common.Result.
+// SimulationResponse is the response returned from Simulate. It is a serializable version of the full common.Result
+// tree, including the results of all rules and predicates and the approvers and dismissals of each rule.
 type SimulationResponse struct {
 	Name              string `json:"name"`
-	Description       string `json:"description:"`
+	Description       string `json:"description"`
 	StatusDescription string `json:"status_description"`
 	Status            string `json:"status"`
 	Error             string `json:"error"`
+
+	PredicateResults []*SimulationPredicateResult `json:"predicate_results,omitempty"`
+	Approvers        []*SimulationCandidate       `json:"approvers,omitempty"`
+	Dismissals       []*SimulationDismissal       `json:"dismissals,omitempty"`
+	Children         []*SimulationResponse        `json:"children,omitempty"`
+}
+
+type SimulationPredicateResult struct {
+	Satisfied       bool                `json:"satisfied"`
+	Description     string              `json:"description"`
+	ValuePhrase     string              `json:"value_phrase"`
+	Values          []string            `json:"values"`
+	ConditionPhrase string              `json:"condition_phrase"`
+	ConditionValues []string            `json:"condition_values,omitempty"`
+	ConditionsMap   map[string][]string `json:"conditions_map,omitempty"`
+}
+
+type SimulationCandidate struct {
+	User         string    `json:"user"`
+	Type         string    `json:"type"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastEditedAt time.Time `json:"last_edited_at"`
+}
+
+type SimulationDismissal struct {
+	Candidate *SimulationCandidate `json:"candidate"`
+	Reason    string               `json:"reason"`
 }
 
 type ErrorResponse struct {
@@ -82,7 +112,16 @@ func (h *Simulate) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 	ctx, _ = h.PreparePRContext(ctx, installation.ID, pr)
 	options, err := simulated.NewOptionsFromRequest(r)
 	if err != nil {
-		return writeAPIError(w, http.StatusBadRequest, "failed to parse options from request")
+		return writeAPIError(w, http.StatusBadRequest, "failed to parse options from request: "+err.Error())
+	}
+
+	var inline *policy.Config
+	if options.Policy != "" {
+		var config policy.Config
+		if err := yaml.UnmarshalStrict([]byte(options.Policy), &config); err != nil {
+			return writeAPIError(w, http.StatusBadRequest, "failed to parse policy: "+err.Error())
+		}
+		inline = &config
 	}
 
 	result, err := h.getSimulatedResult(ctx, installation, pull.Locator{
@@ -90,9 +129,13 @@ func (h *Simulate) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 		Repo:   repo,
 		Number: number,
 		Value:  pr,
-	}, options)
+	}, options, inline)
 
 	if err != nil {
+		var invalidErr *invalidPolicyError
+		if errors.As(err, &invalidErr) {
+			return writeAPIError(w, http.StatusBadRequest, "invalid policy: "+invalidErr.Error())
+		}
 		return errors.Wrap(err, "failed to get approval result for pull request")
 	}
 
@@ -110,22 +153,60 @@ func getToken(r *http.Request) string {
 	return ""
 }
 
-func (h *Simulate) getSimulatedResult(ctx context.Context, installation githubapp.Installation, loc pull.Locator, options simulated.Options) (*common.Result, error) {
-	simulatedCtx, config, err := h.newSimulatedContext(ctx, installation.ID, loc, options)
-	switch {
-	case err != nil:
+// invalidPolicyError is returned by getSimulatedResult when an inline policy is invalid.
+type invalidPolicyError struct {
+	err error
+}
+
+func (e *invalidPolicyError) Error() string {
+	return e.err.Error()
+}
+
+// getSimulatedResult evaluates the policy for the simulated pull request. If inline is non-nil, it is used instead of the
+// policy from the base branch. The enforced policy, if any, is always included. If inline is invalid, alone or with the
+// enforced policy, the error is an *invalidPolicyError.
+func (h *Simulate) getSimulatedResult(ctx context.Context, installation githubapp.Installation, loc pull.Locator, options simulated.Options, inline *policy.Config) (*common.Result, error) {
+	client, err := h.NewInstallationClient(installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create installation client")
+	}
+
+	simulatedCtx, err := h.newSimulatedContext(ctx, client, installation.ID, loc, options)
+	if err != nil {
 		return nil, errors.Wrap(err, "failed to generate eval context")
+	}
+
+	config := FetchedConfig{Config: inline}
+	if inline == nil {
+		baseBranch, _ := simulatedCtx.Branches()
+		config = h.ConfigFetcher.ConfigForRepositoryBranch(ctx, client, loc.Owner, loc.Repo, baseBranch)
+	}
+	enforced := h.ConfigFetcher.EnforcedConfig(ctx, client, loc.Owner)
+
+	switch {
 	case config.LoadError != nil:
 		return nil, errors.Wrap(config.LoadError, "failed to load policy file")
 	case config.ParseError != nil:
 		return nil, errors.Wrap(config.ParseError, "failed to parse policy")
-	case config.Config == nil:
+	case enforced.LoadError != nil:
+		return nil, errors.Wrap(enforced.LoadError, "failed to load enforced policy file")
+	case enforced.ParseError != nil:
+		return nil, errors.Wrap(enforced.ParseError, "failed to parse enforced policy")
+	case config.Config == nil && enforced.Config == nil:
 		// no policy file found on base branch
 		return nil, nil
 	}
 
-	evaluator, err := policy.ParsePolicy(config.Config)
+	var evaluator common.Evaluator
+	if enforced.Config != nil {
+		evaluator, err = policy.ParseEnforcedPolicy(config.Config, enforced.Config)
+	} else {
+		evaluator, err = policy.ParsePolicy(config.Config)
+	}
 	if err != nil {
+		if inline != nil {
+			return nil, &invalidPolicyError{err: err}
+		}
 		return nil, errors.Wrap(err, "failed to get policy evaluator")
 	}
 
@@ -133,47 +214,72 @@ func (h *Simulate) getSimulatedResult(ctx context.Context, installation githubap
 	return &result, nil
 }
 
-func (h *Simulate) newSimulatedContext(ctx context.Context, installationID int64, loc pull.Locator, options simulated.Options) (*simulated.Context, *FetchedConfig, error) {
-	client, err := h.NewInstallationClient(installationID)
-	if err != nil {
-		return nil, nil, err
-	}
-
+func (h *Simulate) newSimulatedContext(ctx context.Context, client *github.Client, installationID int64, loc pull.Locator, options simulated.Options) (*simulated.Context, error) {
 	v4client, err := h.NewInstallationV4Client(installationID)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	mbrCtx := NewCrossOrgMembershipContext(ctx, client, loc.Owner, h.Installations, h.ClientCreator)
+	mbrCtx := NewCrossOrgMembershipContext(ctx, client, loc.Owner, h.Installations, h.ClientCreator, h.GlobalCache)
 	prctx, err := pull.NewGitHubContext(ctx, mbrCtx, h.GlobalCache, client, v4client, loc)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	simulatedPRCtx := simulated.NewContext(ctx, prctx, options)
-	baseBranch, _ := simulatedPRCtx.Branches()
-	owner := simulatedPRCtx.RepositoryOwner()
-	repository := simulatedPRCtx.RepositoryName()
-	fetchedConfig := h.ConfigFetcher.ConfigForRepositoryBranch(ctx, client, owner, repository, baseBranch)
-	return simulatedPRCtx, &fetchedConfig, nil
+	return simulated.NewContext(ctx, prctx, options), nil
 }
 
 func newSimulationResponse(result *common.Result) *SimulationResponse {
 	var response SimulationResponse
-	if result != nil {
-		if result.Error != nil {
-			response.Error = result.Error.Error()
-		}
+	if result == nil {
+		return &response
+	}
+
+	if result.Error != nil {
+		response.Error = result.Error.Error()
+	}
 
-		response.Name = result.Name
-		response.Description = result.Description
-		response.StatusDescription = result.StatusDescription
-		response.Status = result.Status.String()
+	response.Name = result.Name
+	response.Description = result.Description
+	response.StatusDescription = result.StatusDescription
+	response.Status = result.Status.String()
+
+	for _, p := range result.PredicateResults {
+		response.PredicateResults = append(response.PredicateResults, &SimulationPredicateResult{
+			Satisfied:       p.Satisfied,
+			Description:     p.Description,
+			ValuePhrase:     p.ValuePhrase,
+			Values:          p.Values,
+			ConditionPhrase: p.ConditionPhrase,
+			ConditionValues: p.ConditionValues,
+			ConditionsMap:   p.ConditionsMap,
+		})
+	}
+	for _, a := range result.Approvers {
+		response.Approvers = append(response.Approvers, newSimulationCandidate(a))
+	}
+	for _, d := range result.Dismissals {
+		response.Dismissals = append(response.Dismissals, &SimulationDismissal{
+			Candidate: newSimulationCandidate(d.Candidate),
+			Reason:    d.Reason,
+		})
+	}
+	for _, c := range result.Children {
+		response.Children = append(response.Children, newSimulationResponse(c))
 	}
 
 	return &response
 }
 
+func newSimulationCandidate(c *common.Candidate) *SimulationCandidate {
+	return &SimulationCandidate{
+		User:         c.User,
+		Type:         string(c.Type),
+		CreatedAt:    c.CreatedAt,
+		LastEditedAt: c.LastEditedAt,
+	}
+}
+
 func writeAPIError(w http.ResponseWriter, code int, message string) error {
 	baseapp.WriteJSON(w, code, ErrorResponse{Error: message})
 	return nil
@@ -22,14 +22,18 @@ import (
 	"github.com/palantir/go-baseapp/baseapp"
 	"github.com/palantir/go-githubapp/appconfig"
 	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/lint"
 	"github.com/palantir/policy-bot/version"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"goji.io/pat"
 	"gopkg.in/yaml.v2"
 )
 
 type ValidateCheck struct {
-	Message string `json:"message"`
-	Version string `json:"version"`
+	Message  string         `json:"message"`
+	Version  string         `json:"version"`
+	Warnings []lint.Warning `json:"warnings,omitempty"`
 }
 
 func Validate() http.Handler {
@@ -38,44 +42,101 @@ func Validate() http.Handler {
 		logger := zerolog.Ctx(ctx)
 
 		logger.Info().Msg("Attempting to validate policy file")
-		check := ValidateCheck{Version: version.GetVersion()}
 
 		requestPolicy, err := ioutil.ReadAll(r.Body)
 		if err != nil {
+			check := ValidateCheck{Version: version.GetVersion()}
 			check.Message = "Unable to read policy file buffer"
 			baseapp.WriteJSON(w, http.StatusInternalServerError, &check)
 			return
 		}
 
-		remoteRef, err := appconfig.YAMLRemoteRefParser("", requestPolicy)
-		if err != nil {
-			check.Message = fmt.Sprintf("Policy is invalid. '%s'.", err.Error())
-			baseapp.WriteJSON(w, http.StatusUnprocessableEntity, &check)
-			return
+		status, check := validatePolicy(requestPolicy, lint.Options{})
+		baseapp.WriteJSON(w, status, &check)
+	})
+}
+
+// ValidateRepository validates a policy like Validate and also checks the
+// file patterns in the policy against the files in a repository.
+type ValidateRepository struct {
+	Base
+}
+
+func (h *ValidateRepository) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	token := getToken(r)
+	if token == "" {
+		return writeAPIError(w, http.StatusUnauthorized, "missing token")
+	}
+
+	client, err := h.NewTokenClient(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create token client")
+	}
+
+	owner := pat.Param(r, "owner")
+	repo := pat.Param(r, "repo")
+	ref := r.URL.Query().Get("ref")
+
+	zerolog.Ctx(ctx).Info().Msgf("Attempting to validate policy file for %s/%s", owner, repo)
+
+	files, err := ListRepositoryFiles(ctx, client, owner, repo, ref)
+	switch {
+	case err == ErrTreeTruncated:
+		files = nil
+	case err != nil:
+		if isNotFound(errors.Cause(err)) {
+			return writeAPIError(w, http.StatusNotFound, "failed to find repository or ref")
 		}
+		return err
+	}
 
-		validLocal, localStrErr := isValidLocalPolicy(requestPolicy)
-		if validLocal || remoteRef != nil {
-			check.Message = "Policy file is valid"
-			baseapp.WriteJSON(w, http.StatusOK, &check)
-			return
+	requestPolicy, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read policy")
+	}
+
+	status, check := validatePolicy(requestPolicy, lint.Options{Files: files})
+	if status == http.StatusOK && files == nil {
+		check.Message += "; the repository has too many files to check file patterns"
+	}
+	baseapp.WriteJSON(w, status, &check)
+	return nil
+}
+
+// validatePolicy returns the status code and result of validating a policy.
+// Valid local policies include any lint warnings.
+func validatePolicy(requestPolicy []byte, opts lint.Options) (int, ValidateCheck) {
+	check := ValidateCheck{Version: version.GetVersion()}
+
+	remoteRef, err := appconfig.YAMLRemoteRefParser("", requestPolicy)
+	if err != nil {
+		check.Message = fmt.Sprintf("Policy is invalid. '%s'.", err.Error())
+		return http.StatusUnprocessableEntity, check
+	}
+
+	config, localStrErr := parseLocalPolicy(requestPolicy)
+	if config != nil || remoteRef != nil {
+		check.Message = "Policy file is valid"
+		if config != nil {
+			check.Warnings = lint.Lint(config, opts)
 		}
+		return http.StatusOK, check
+	}
 
-		check.Message = fmt.Sprintf("Policy is invalid. '%s'.", localStrErr)
-		baseapp.WriteJSON(w, http.StatusUnprocessableEntity, &check)
-		return
-	})
+	check.Message = fmt.Sprintf("Policy is invalid. '%s'.", localStrErr)
+	return http.StatusUnprocessableEntity, check
 }
 
-func isValidLocalPolicy(requestPolicy []byte) (bool, error) {
+func parseLocalPolicy(requestPolicy []byte) (*policy.Config, error) {
 	var policyConfig policy.Config
 	if err := yaml.UnmarshalStrict(requestPolicy, &policyConfig); err != nil {
-		return false, err
+		return nil, err
 	}
 
 	if _, err := policy.ParsePolicy(&policyConfig); err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return true, nil
+	return &policyConfig, nil
 }
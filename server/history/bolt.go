@@ -0,0 +1,178 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	recordsBucket = []byte("records")
+	timesBucket   = []byte("times")
+)
+
+// BoltStore is a Store backed by an embedded BoltDB database.
+//
+// Records are keyed by repository, pull request number, evaluation time, and
+// ID so that queries for a repository or pull request are prefix scans. A
+// second bucket indexes records by evaluation time for retention.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var _ Store = &BoltStore{}
+
+// NewBoltStore opens or creates a database at the given path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open history database: %s", path)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{recordsBucket, timesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "failed to initialize history database")
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Add(ctx context.Context, r *Record) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+
+		id, err := records.NextSequence()
+		if err != nil {
+			return errors.Wrap(err, "failed to allocate record ID")
+		}
+		r.ID = id
+
+		value, err := json.Marshal(r)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal record")
+		}
+
+		key := recordKey(r)
+		if err := records.Put(key, value); err != nil {
+			return errors.Wrap(err, "failed to store record")
+		}
+		if err := tx.Bucket(timesBucket).Put(timeKey(r), key); err != nil {
+			return errors.Wrap(err, "failed to index record")
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) List(ctx context.Context, q Query) ([]*Record, error) {
+	if q.Owner == "" || q.Repo == "" {
+		return nil, errors.New("query must include an owner and a repository")
+	}
+
+	prefix := repoPrefix(q.Owner, q.Repo)
+	if q.Number > 0 {
+		prefix = binary.BigEndian.AppendUint64(prefix, uint64(q.Number))
+	}
+
+	var records []*Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(recordsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return errors.Wrapf(err, "failed to unmarshal record %x", k)
+			}
+			if q.Matches(&r) {
+				records = append(records, &r)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].EvaluatedAt.Equal(records[j].EvaluatedAt) {
+			return records[i].ID > records[j].ID
+		}
+		return records[i].EvaluatedAt.After(records[j].EvaluatedAt)
+	})
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[:q.Limit]
+	}
+	return records, nil
+}
+
+func (s *BoltStore) DeleteBefore(ctx context.Context, t time.Time) (int, error) {
+	end := binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+
+	var deleted int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		times := tx.Bucket(timesBucket)
+
+		c := times.Cursor()
+		for k, v := c.First(); k != nil && bytes.Compare(k, end) < 0; k, v = c.First() {
+			if err := records.Delete(v); err != nil {
+				return errors.Wrap(err, "failed to delete record")
+			}
+			if err := c.Delete(); err != nil {
+				return errors.Wrap(err, "failed to delete record index")
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func repoPrefix(owner, repo string) []byte {
+	return []byte(strings.ToLower(owner) + "/" + strings.ToLower(repo) + "\x00")
+}
+
+func recordKey(r *Record) []byte {
+	key := repoPrefix(r.Owner, r.Repo)
+	key = binary.BigEndian.AppendUint64(key, uint64(r.Number))
+	key = binary.BigEndian.AppendUint64(key, uint64(r.EvaluatedAt.UnixNano()))
+	key = binary.BigEndian.AppendUint64(key, r.ID)
+	return key
+}
+
+func timeKey(r *Record) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(r.EvaluatedAt.UnixNano()))
+	key = binary.BigEndian.AppendUint64(key, r.ID)
+	return key
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltStore(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	records := []*Record{
+		{Owner: "palantir", Repo: "policy-bot", Number: 1, EvaluatedAt: date(1), Status: "pending"},
+		{Owner: "palantir", Repo: "policy-bot", Number: 1, EvaluatedAt: date(3), Status: "approved"},
+		{Owner: "palantir", Repo: "policy-bot", Number: 2, EvaluatedAt: date(2), Status: "pending"},
+		{Owner: "palantir", Repo: "policy-bot-docs", Number: 1, EvaluatedAt: date(4), Status: "pending"},
+		{Owner: "Palantir", Repo: "Policy-Bot", Number: 10, EvaluatedAt: date(5), Status: "pending"},
+	}
+	for _, r := range records {
+		require.NoError(t, store.Add(ctx, r))
+		assert.NotZero(t, r.ID, "record ID was not assigned")
+	}
+
+	t.Run("pullRequest", func(t *testing.T) {
+		rs, err := store.List(ctx, Query{Owner: "palantir", Repo: "policy-bot", Number: 1})
+		require.NoError(t, err)
+
+		if assert.Len(t, rs, 2) {
+			assert.Equal(t, "approved", rs[0].Status)
+			assert.Equal(t, "pending", rs[1].Status)
+		}
+	})
+
+	t.Run("repository", func(t *testing.T) {
+		rs, err := store.List(ctx, Query{Owner: "palantir", Repo: "policy-bot"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{10, 1, 2, 1}, numbers(rs))
+	})
+
+	t.Run("timeRange", func(t *testing.T) {
+		rs, err := store.List(ctx, Query{Owner: "palantir", Repo: "policy-bot", Since: date(2), Until: date(5)})
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{1, 2}, numbers(rs))
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		rs, err := store.List(ctx, Query{Owner: "palantir", Repo: "policy-bot", Limit: 1})
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{10}, numbers(rs))
+	})
+
+	t.Run("deleteBefore", func(t *testing.T) {
+		n, err := store.DeleteBefore(ctx, date(3))
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		rs, err := store.List(ctx, Query{Owner: "palantir", Repo: "policy-bot"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{10, 1}, numbers(rs))
+	})
+}
+
+func numbers(rs []*Record) []int {
+	var ns []int
+	for _, r := range rs {
+		ns = append(ns, r.Number)
+	}
+	return ns
+}
+
+func date(hour int) time.Time {
+	return time.Date(2024, 4, 1, hour, 0, 0, 0, time.UTC)
+}
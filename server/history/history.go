@@ -0,0 +1,306 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package history records the results of pull request evaluations so they
+// can be audited after the fact.
+package history
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+// Store saves and retrieves evaluation records. Implementations must be safe
+// for concurrent use.
+type Store interface {
+	// Add saves a record, assigning it a unique ID.
+	Add(ctx context.Context, r *Record) error
+
+	// List returns the records matching the query, ordered from newest to
+	// oldest.
+	List(ctx context.Context, q Query) ([]*Record, error)
+
+	// DeleteBefore deletes all records for evaluations that happened before
+	// the given time and returns the number of deleted records.
+	DeleteBefore(ctx context.Context, t time.Time) (int, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// Query selects records from a Store. Owner and Repo are required. If Number
+// is zero, the query matches all pull requests in the repository. If Since or
+// Until are non-zero, the query only matches evaluations in the time range
+// [Since, Until). If Bypassed is true, the query only matches the final
+// evaluations of pull requests that were merged without approval. If Shadow is
+// true, the query only matches evaluations that also evaluated a shadow
+// policy. If Limit is positive, at most Limit records are returned.
+type Query struct {
+	Owner  string
+	Repo   string
+	Number int
+
+	Since    time.Time
+	Until    time.Time
+	Bypassed bool
+	Shadow   bool
+	Limit    int
+}
+
+// Matches returns true if the record satisfies the time range and filters of
+// the query.
+func (q Query) Matches(r *Record) bool {
+	if q.Bypassed && (r.Merge == nil || !r.Merge.Bypassed) {
+		return false
+	}
+	if q.Shadow && r.Shadow == nil {
+		return false
+	}
+	if !q.Since.IsZero() && r.EvaluatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !r.EvaluatedAt.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Record is the outcome of a single evaluation of a pull request.
+type Record struct {
+	ID uint64 `json:"id"`
+
+	Owner   string `json:"owner"`
+	Repo    string `json:"repo"`
+	Number  int    `json:"number"`
+	HeadSHA string `json:"head_sha"`
+
+	Policy  Policy `json:"policy"`
+	Trigger string `json:"trigger"`
+
+	EvaluatedAt       time.Time `json:"evaluated_at"`
+	Status            string    `json:"status"`
+	StatusDescription string    `json:"status_description"`
+	Error             string    `json:"error,omitempty"`
+
+	Approvers  []string    `json:"approvers,omitempty"`
+	Dismissals []Dismissal `json:"dismissals,omitempty"`
+
+	Result *Result `json:"result"`
+
+	// Merge is set for the final evaluation of a merged pull request.
+	Merge *Merge `json:"merge,omitempty"`
+
+	// Shadow is set if a shadow policy was evaluated with the policy.
+	Shadow *Shadow `json:"shadow,omitempty"`
+}
+
+// Merge describes how a pull request was merged.
+type Merge struct {
+	SHA      string    `json:"sha"`
+	MergedBy string    `json:"merged_by"`
+	MergedAt time.Time `json:"merged_at"`
+
+	// Bypassed is true if the pull request was merged without approval.
+	Bypassed bool `json:"bypassed"`
+}
+
+// Policy identifies the policy file used for an evaluation.
+type Policy struct {
+	Source string `json:"source"`
+	Path   string `json:"path"`
+
+	// SHA is the git blob SHA of the policy file content.
+	SHA string `json:"sha"`
+}
+
+// Shadow is the result of evaluating a candidate policy alongside the real
+// policy. Shadow policies never post statuses.
+type Shadow struct {
+	Policy Policy `json:"policy"`
+
+	Status            string `json:"status"`
+	StatusDescription string `json:"status_description"`
+	Error             string `json:"error,omitempty"`
+
+	// Agrees is true if the shadow policy has the same status as the real
+	// policy and either both or neither evaluation failed.
+	Agrees bool `json:"agrees"`
+
+	// Differences lists the rules and policies with a different status in
+	// the shadow result. It is empty if the overall statuses are the same,
+	// even if individual rules differ.
+	Differences []Difference `json:"differences,omitempty"`
+
+	Result *Result `json:"result"`
+}
+
+// Difference is a rule or policy with a different status in two results. The
+// status is empty if the rule does not exist in one of the results.
+type Difference struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Shadow string `json:"shadow"`
+}
+
+// NewShadow creates a Shadow from the results of a shadow policy and the real
+// policy.
+func NewShadow(p Policy, shadow, actual *common.Result) *Shadow {
+	s := &Shadow{
+		Policy:            p,
+		Status:            shadow.Status.String(),
+		StatusDescription: shadow.StatusDescription,
+		Result:            NewResult(shadow),
+	}
+	if shadow.Error != nil {
+		s.Error = shadow.Error.Error()
+	}
+	s.Agrees = shadow.Status == actual.Status && (shadow.Error == nil) == (actual.Error == nil)
+	if !s.Agrees {
+		s.Differences = CompareResults(actual, shadow)
+	}
+	return s
+}
+
+// CompareResults returns the rules and policies that have a different status
+// in the two results, identified by their names joined with " / ". The root
+// results are not compared.
+func CompareResults(a, b *common.Result) []Difference {
+	as, bs := resultStatuses(a), resultStatuses(b)
+
+	var diffs []Difference
+	for name, status := range as {
+		if bs[name] != status {
+			diffs = append(diffs, Difference{Name: name, Status: status, Shadow: bs[name]})
+		}
+	}
+	for name, status := range bs {
+		if _, ok := as[name]; !ok {
+			diffs = append(diffs, Difference{Name: name, Shadow: status})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Name < diffs[j].Name })
+	return diffs
+}
+
+func resultStatuses(r *common.Result) map[string]string {
+	statuses := make(map[string]string)
+
+	var walk func(prefix string, r *common.Result)
+	walk = func(prefix string, r *common.Result) {
+		for _, c := range r.Children {
+			name := c.Name
+			if prefix != "" {
+				name = prefix + " / " + name
+			}
+
+			status := c.Status.String()
+			if c.Error != nil {
+				status = "error"
+			}
+			statuses[name] = status
+
+			walk(name, c)
+		}
+	}
+	walk("", r)
+
+	return statuses
+}
+
+type Dismissal struct {
+	User   string `json:"user"`
+	Reason string `json:"reason"`
+}
+
+// Result is a serializable version of common.Result that contains the fields
+// needed to understand an evaluation.
+type Result struct {
+	Name              string    `json:"name"`
+	Description       string    `json:"description,omitempty"`
+	Status            string    `json:"status"`
+	StatusDescription string    `json:"status_description,omitempty"`
+	Error             string    `json:"error,omitempty"`
+	Approvers         []string  `json:"approvers,omitempty"`
+	Children          []*Result `json:"children,omitempty"`
+}
+
+// NewResult converts a common.Result into a serializable Result.
+func NewResult(r *common.Result) *Result {
+	res := &Result{
+		Name:              r.Name,
+		Description:       r.Description,
+		Status:            r.Status.String(),
+		StatusDescription: r.StatusDescription,
+	}
+	if r.Error != nil {
+		res.Error = r.Error.Error()
+	}
+	for _, a := range r.Approvers {
+		res.Approvers = append(res.Approvers, a.User)
+	}
+	for _, c := range r.Children {
+		res.Children = append(res.Children, NewResult(c))
+	}
+	return res
+}
+
+// SetResult sets the result fields of the record, collecting the approvers
+// and dismissals from all rules in the result.
+func (r *Record) SetResult(result *common.Result) {
+	r.Status = result.Status.String()
+	r.StatusDescription = result.StatusDescription
+	if result.Error != nil {
+		r.Error = result.Error.Error()
+	}
+	r.Result = NewResult(result)
+
+	approvers := make(map[string]bool)
+	dismissals := make(map[Dismissal]bool)
+	walkResults(result, func(res *common.Result) {
+		for _, a := range res.Approvers {
+			approvers[a.User] = true
+		}
+		for _, d := range res.Dismissals {
+			dismissals[Dismissal{User: d.Candidate.User, Reason: d.Reason}] = true
+		}
+	})
+
+	r.Approvers = nil
+	for a := range approvers {
+		r.Approvers = append(r.Approvers, a)
+	}
+	sort.Strings(r.Approvers)
+
+	r.Dismissals = nil
+	for d := range dismissals {
+		r.Dismissals = append(r.Dismissals, d)
+	}
+	sort.Slice(r.Dismissals, func(i, j int) bool {
+		if r.Dismissals[i].User == r.Dismissals[j].User {
+			return r.Dismissals[i].Reason < r.Dismissals[j].Reason
+		}
+		return r.Dismissals[i].User < r.Dismissals[j].User
+	})
+}
+
+func walkResults(r *common.Result, fn func(*common.Result)) {
+	fn(r)
+	for _, c := range r.Children {
+		walkResults(c, fn)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetResult(t *testing.T) {
+	result := &common.Result{
+		Name:              "policy",
+		Status:            common.StatusApproved,
+		StatusDescription: "Approved by mhaypenny",
+		Children: []*common.Result{
+			{
+				Name:      "rule one",
+				Status:    common.StatusApproved,
+				Approvers: []*common.Candidate{{User: "mhaypenny"}},
+				Dismissals: []*common.Dismissal{
+					{Candidate: &common.Candidate{User: "ttest"}, Reason: "Invalidated by push"},
+				},
+			},
+			{
+				Name:   "rule two",
+				Status: common.StatusSkipped,
+				Error:  errors.New("rule failed"),
+			},
+			{
+				Name:      "rule three",
+				Status:    common.StatusApproved,
+				Approvers: []*common.Candidate{{User: "bkeyes"}, {User: "mhaypenny"}},
+			},
+		},
+	}
+
+	var r Record
+	r.SetResult(result)
+
+	assert.Equal(t, "approved", r.Status)
+	assert.Equal(t, "Approved by mhaypenny", r.StatusDescription)
+	assert.Equal(t, []string{"bkeyes", "mhaypenny"}, r.Approvers)
+	assert.Equal(t, []Dismissal{{User: "ttest", Reason: "Invalidated by push"}}, r.Dismissals)
+
+	if assert.Len(t, r.Result.Children, 3) {
+		assert.Equal(t, "rule two", r.Result.Children[1].Name)
+		assert.Equal(t, "skipped", r.Result.Children[1].Status)
+		assert.Equal(t, "rule failed", r.Result.Children[1].Error)
+		assert.Equal(t, []string{"bkeyes", "mhaypenny"}, r.Result.Children[2].Approvers)
+	}
+}
+
+func TestQueryMatches(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	approved := &Record{EvaluatedAt: start.Add(time.Hour), Status: "approved"}
+	merged := &Record{EvaluatedAt: start.Add(time.Hour), Merge: &Merge{SHA: "abc"}}
+	bypassed := &Record{EvaluatedAt: start.Add(time.Hour), Merge: &Merge{SHA: "def", Bypassed: true}}
+	shadowed := &Record{EvaluatedAt: start.Add(2 * time.Hour), Shadow: &Shadow{Status: "pending"}}
+
+	tests := map[string]struct {
+		Query   Query
+		Matches []bool
+	}{
+		"all": {
+			Query:   Query{},
+			Matches: []bool{true, true, true, true},
+		},
+		"timeRange": {
+			Query:   Query{Since: start, Until: start.Add(time.Hour)},
+			Matches: []bool{false, false, false, false},
+		},
+		"bypassed": {
+			Query:   Query{Since: start, Bypassed: true},
+			Matches: []bool{false, false, true, false},
+		},
+		"shadow": {
+			Query:   Query{Since: start, Shadow: true},
+			Matches: []bool{false, false, false, true},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for i, r := range []*Record{approved, merged, bypassed, shadowed} {
+				assert.Equal(t, test.Matches[i], test.Query.Matches(r), "incorrect match for record %d", i)
+			}
+		})
+	}
+}
+
+func TestNewShadow(t *testing.T) {
+	actual := &common.Result{
+		Name:   "policy",
+		Status: common.StatusApproved,
+		Children: []*common.Result{
+			{Name: "rule one", Status: common.StatusApproved},
+			{Name: "rule two", Status: common.StatusSkipped},
+		},
+	}
+
+	t.Run("agrees", func(t *testing.T) {
+		shadow := &common.Result{
+			Name:   "policy",
+			Status: common.StatusApproved,
+			Children: []*common.Result{
+				{Name: "rule one", Status: common.StatusApproved},
+				{Name: "rule two", Status: common.StatusPending},
+			},
+		}
+
+		s := NewShadow(Policy{Path: "shadow.yml"}, shadow, actual)
+		assert.True(t, s.Agrees)
+		assert.Empty(t, s.Differences, "differences are only recorded for disagreements")
+	})
+
+	t.Run("disagrees", func(t *testing.T) {
+		shadow := &common.Result{
+			Name:              "policy",
+			Status:            common.StatusPending,
+			StatusDescription: "0/1 rules approved",
+			Children: []*common.Result{
+				{
+					Name:   "and",
+					Status: common.StatusPending,
+					Children: []*common.Result{
+						{Name: "rule one", Status: common.StatusApproved},
+						{Name: "rule three", Status: common.StatusPending},
+					},
+				},
+				{Name: "rule two", Status: common.StatusSkipped, Error: errors.New("rule failed")},
+			},
+		}
+
+		s := NewShadow(Policy{Path: "shadow.yml"}, shadow, actual)
+		assert.False(t, s.Agrees)
+		assert.Equal(t, "pending", s.Status)
+		assert.Equal(t, "0/1 rules approved", s.StatusDescription)
+		assert.Equal(t, []Difference{
+			{Name: "and", Shadow: "pending"},
+			{Name: "and / rule one", Shadow: "approved"},
+			{Name: "and / rule three", Shadow: "pending"},
+			{Name: "rule one", Status: "approved"},
+			{Name: "rule two", Status: "skipped", Shadow: "error"},
+		}, s.Differences)
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// RunRetention deletes records that are older than the retention period once
+// per interval. It blocks until the context is canceled.
+func RunRetention(ctx context.Context, s Store, retention, interval time.Duration) {
+	logger := zerolog.Ctx(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.DeleteBefore(ctx, time.Now().Add(-retention))
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to delete expired evaluation history")
+		} else if n > 0 {
+			logger.Info().Msgf("Deleted %d expired evaluation history records", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prometheus exports metrics from a go-metrics registry in the
+// Prometheus text exposition format.
+//
+// Metric names may include tags using the "name[tag1:value1,tag2:value2]"
+// format supported by the Datadog emitter. Tags become labels and names are
+// converted to valid Prometheus names. Counters and meters are exported as
+// counters, gauges as gauges, and histograms and timers as summaries. Timers
+// are exported in seconds.
+package prometheus
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+// labelValueEscaper escapes the characters that the Prometheus text format
+// requires to be escaped in label values. Unlike Go string literals, other
+// characters, including non-ASCII characters, are written as-is.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Handler returns an http.Handler that writes all metrics in the registry. If
+// token is not empty, requests must include it as a bearer token.
+func Handler(registry metrics.Registry, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			auth := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		_ = Write(w, registry)
+	})
+}
+
+type sample struct {
+	labels string
+	metric interface{}
+}
+
+type family struct {
+	name    string
+	kind    string
+	samples []sample
+}
+
+// Write writes all metrics in the registry to w.
+func Write(w io.Writer, registry metrics.Registry) error {
+	families := make(map[string]*family)
+	registry.Each(func(name string, m interface{}) {
+		base, labels := parseName(name)
+
+		var kind string
+		switch m.(type) {
+		case metrics.Counter, metrics.Meter:
+			kind, base = "counter", base+"_total"
+		case metrics.Gauge, metrics.GaugeFloat64:
+			kind = "gauge"
+		case metrics.Histogram:
+			kind = "summary"
+		case metrics.Timer:
+			kind, base = "summary", base+"_seconds"
+		default:
+			return
+		}
+
+		f, ok := families[base]
+		if !ok {
+			f = &family{name: base, kind: kind}
+			families[base] = f
+		}
+		if f.kind != kind {
+			return
+		}
+		f.samples = append(f.samples, sample{labels: labels, metric: m})
+	})
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		sort.Slice(f.samples, func(i, j int) bool { return f.samples[i].labels < f.samples[j].labels })
+
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.kind)
+		for _, s := range f.samples {
+			writeSample(bw, f.name, s)
+		}
+	}
+	return bw.Flush()
+}
+
+func writeSample(w io.Writer, name string, s sample) {
+	switch m := s.metric.(type) {
+	case metrics.Counter:
+		writeValue(w, name, s.labels, float64(m.Count()))
+	case metrics.Meter:
+		writeValue(w, name, s.labels, float64(m.Count()))
+	case metrics.Gauge:
+		writeValue(w, name, s.labels, float64(m.Value()))
+	case metrics.GaugeFloat64:
+		writeValue(w, name, s.labels, m.Value())
+	case metrics.Histogram:
+		h := m.Snapshot()
+		writeSummary(w, name, s.labels, h.Percentiles(quantiles), float64(h.Sum()), h.Count(), 1)
+	case metrics.Timer:
+		t := m.Snapshot()
+		writeSummary(w, name, s.labels, t.Percentiles(quantiles), float64(t.Sum()), t.Count(), 1e-9)
+	}
+}
+
+func writeSummary(w io.Writer, name, labels string, values []float64, sum float64, count int64, scale float64) {
+	for i, q := range quantiles {
+		writeValue(w, name, joinLabels(labels, `quantile="`+formatFloat(q)+`"`), values[i]*scale)
+	}
+	writeValue(w, name+"_sum", labels, sum*scale)
+	writeValue(w, name+"_count", labels, float64(count))
+}
+
+func writeValue(w io.Writer, name, labels string, value float64) {
+	if labels != "" {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatFloat(value))
+	} else {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+	}
+}
+
+// parseName splits a metric name into a Prometheus name and a label string.
+func parseName(name string) (string, string) {
+	var tags []string
+	if start := strings.IndexByte(name, '['); start >= 0 && strings.HasSuffix(name, "]") {
+		tags = strings.Split(name[start+1:len(name)-1], ",")
+		name = name[:start]
+	}
+
+	labels := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			value = "true"
+		}
+		if key = sanitize(key); key != "" {
+			labels = append(labels, key+`="`+labelValueEscaper.Replace(value)+`"`)
+		}
+	}
+	sort.Strings(labels)
+
+	return sanitize(name), strings.Join(labels, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+// sanitize replaces characters that are not allowed in Prometheus names.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
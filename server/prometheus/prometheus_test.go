@@ -0,0 +1,90 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	metrics.GetOrRegisterCounter("policybot.evaluation.results[repository:palantir/policy-bot,status:approved]", registry).Inc(3)
+	metrics.GetOrRegisterCounter("policybot.evaluation.results[repository:palantir/policy-bot,status:pending]", registry).Inc(1)
+	metrics.GetOrRegisterGauge("policybot.queue.depth", registry).Update(7)
+	metrics.GetOrRegisterTimer("policybot.evaluation.duration", registry).Update(2 * time.Second)
+	metrics.GetOrRegisterHistogram("policybot.evaluation.github_requests", registry, metrics.NewUniformSample(10)).Update(4)
+
+	var b strings.Builder
+	require.NoError(t, Write(&b, registry))
+
+	expected := strings.Join([]string{
+		`# TYPE policybot_evaluation_duration_seconds summary`,
+		`policybot_evaluation_duration_seconds{quantile="0.5"} 2`,
+		`policybot_evaluation_duration_seconds{quantile="0.75"} 2`,
+		`policybot_evaluation_duration_seconds{quantile="0.95"} 2`,
+		`policybot_evaluation_duration_seconds{quantile="0.99"} 2`,
+		`policybot_evaluation_duration_seconds_sum 2`,
+		`policybot_evaluation_duration_seconds_count 1`,
+		`# TYPE policybot_evaluation_github_requests summary`,
+		`policybot_evaluation_github_requests{quantile="0.5"} 4`,
+		`policybot_evaluation_github_requests{quantile="0.75"} 4`,
+		`policybot_evaluation_github_requests{quantile="0.95"} 4`,
+		`policybot_evaluation_github_requests{quantile="0.99"} 4`,
+		`policybot_evaluation_github_requests_sum 4`,
+		`policybot_evaluation_github_requests_count 1`,
+		`# TYPE policybot_evaluation_results_total counter`,
+		`policybot_evaluation_results_total{repository="palantir/policy-bot",status="approved"} 3`,
+		`policybot_evaluation_results_total{repository="palantir/policy-bot",status="pending"} 1`,
+		`# TYPE policybot_queue_depth gauge`,
+		`policybot_queue_depth 7`,
+		``,
+	}, "\n")
+	assert.Equal(t, expected, b.String())
+}
+
+func TestHandler(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("policybot.test", registry).Inc(1)
+
+	h := Handler(registry, "secret")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "request without token was allowed")
+
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "policybot_test_total 1\n")
+}
+
+func TestParseName(t *testing.T) {
+	name, labels := parseName("policybot.rule.time_to_approval[rule:\"héllo\\world\"\nteam,flag]")
+	assert.Equal(t, "policybot_rule_time_to_approval", name)
+	assert.Equal(t, `flag="true",rule="\"héllo\\world\"\nteam"`, labels)
+}
@@ -0,0 +1,538 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package queue implements a durable scheduler for webhook events that stores
+// accepted deliveries on disk until they are processed.
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	DefaultWorkers        = 10
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = 10 * time.Second
+	DefaultMaxBackoff     = 10 * time.Minute
+
+	MetricsKeyDepth       = "policybot.queue.depth"
+	MetricsKeyRetries     = "policybot.queue.retries"
+	MetricsKeyDeadLetters = "policybot.queue.dead_letters"
+
+	// pollInterval is how often idle workers check for entries that are
+	// ready to retry.
+	pollInterval = time.Second
+)
+
+var (
+	entriesBucket    = []byte("entries")
+	deliveriesBucket = []byte("deliveries")
+	deadBucket       = []byte("dead")
+
+	// readyBucket indexes entries by the time of their next attempt so that
+	// workers can find the next entry without reading the entire queue.
+	readyBucket = []byte("ready")
+
+	errClosed = errors.New("queue is closed")
+)
+
+// Entry is a webhook delivery stored in the queue.
+type Entry struct {
+	Seq        uint64    `json:"seq"`
+	DeliveryID string    `json:"delivery_id"`
+	EventType  string    `json:"event_type"`
+	Payload    []byte    `json:"payload"`
+	ReceivedAt time.Time `json:"received_at"`
+
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+type Options struct {
+	// The number of workers that process entries.
+	Workers int
+
+	// The maximum number of times to run a handler that fails with a
+	// temporary error before moving the entry to dead-letter storage.
+	MaxAttempts int
+
+	// The delay before the first retry. The delay doubles after each attempt
+	// up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Fallback schedules dispatches for event types that do not have a
+	// registered handler, like internal events that cannot be stored.
+	Fallback githubapp.Scheduler
+
+	// OnError is called when a handler fails with a permanent error or when
+	// an entry moves to dead-letter storage.
+	OnError githubapp.AsyncErrorCallback
+
+	// Registry records queue metrics, if non-nil.
+	Registry metrics.Registry
+}
+
+// Queue is a githubapp.Scheduler that stores deliveries in an embedded
+// database before processing them, so that accepted deliveries survive
+// restarts. Each delivery is processed at least once. Deliveries are
+// identified by their delivery ID and duplicate deliveries that are already
+// in the queue are ignored.
+//
+// Handlers that fail with temporary errors, as defined by
+// pull.IsTemporaryError, are retried with exponential backoff, or after the
+// reset time if they hit a primary rate limit. Deliveries that still fail
+// after the maximum number of attempts are moved to dead-letter storage.
+type Queue struct {
+	db       *bolt.DB
+	handlers map[string]githubapp.EventHandler
+	opts     Options
+	logger   zerolog.Logger
+
+	mu       sync.Mutex
+	closed   bool
+	inflight map[uint64]bool
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+var _ githubapp.Scheduler = &Queue{}
+
+// Open opens or creates a queue database at the given path. Stored entries
+// are processed by the handler registered for their event type. Callers must
+// call Start to begin processing entries.
+func Open(path string, handlers []githubapp.EventHandler, logger zerolog.Logger, opts Options) (*Queue, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open queue database: %s", path)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{entriesBucket, readyBucket, deliveriesBucket, deadBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "failed to initialize queue database")
+	}
+
+	if opts.Workers < 1 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = DefaultInitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.OnError == nil {
+		opts.OnError = githubapp.DefaultAsyncErrorCallback
+	}
+
+	q := &Queue{
+		db:       db,
+		handlers: make(map[string]githubapp.EventHandler),
+		opts:     opts,
+		logger:   logger,
+		inflight: make(map[uint64]bool),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	for _, h := range handlers {
+		for _, event := range h.Handles() {
+			q.handlers[event] = h
+		}
+	}
+
+	q.updateDepth()
+	return q, nil
+}
+
+// Start starts the workers that process entries.
+func (q *Queue) Start() {
+	for i := 0; i < q.opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Schedule stores the dispatch in the queue. It returns an error if the
+// dispatch could not be stored, in which case the delivery is not accepted.
+func (q *Queue) Schedule(ctx context.Context, d githubapp.Dispatch) error {
+	if _, ok := q.handlers[d.EventType]; !ok {
+		if q.opts.Fallback == nil {
+			return errors.Errorf("no handler for event type %q", d.EventType)
+		}
+		return q.opts.Fallback.Schedule(ctx, d)
+	}
+
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return errClosed
+	}
+
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		deliveries := tx.Bucket(deliveriesBucket)
+		if d.DeliveryID != "" && deliveries.Get([]byte(d.DeliveryID)) != nil {
+			zerolog.Ctx(ctx).Info().Msgf("Ignoring duplicate delivery %s", d.DeliveryID)
+			return nil
+		}
+
+		entries := tx.Bucket(entriesBucket)
+		seq, err := entries.NextSequence()
+		if err != nil {
+			return errors.Wrap(err, "failed to allocate sequence number")
+		}
+
+		now := time.Now()
+		e := &Entry{
+			Seq:         seq,
+			DeliveryID:  d.DeliveryID,
+			EventType:   d.EventType,
+			Payload:     d.Payload,
+			ReceivedAt:  now,
+			NextAttempt: now,
+		}
+		if err := putEntry(entries, e); err != nil {
+			return err
+		}
+		if err := tx.Bucket(readyBucket).Put(readyKey(e.NextAttempt, seq), nil); err != nil {
+			return err
+		}
+		if d.DeliveryID != "" {
+			return deliveries.Put([]byte(d.DeliveryID), seqKey(seq))
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to store delivery")
+	}
+
+	q.updateDepth()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Drain stops accepting new deliveries, waits for in-progress deliveries to
+// finish, and closes the database. Entries that were not processed remain in
+// the database and are processed when the queue is next opened. If the
+// context expires before in-progress deliveries finish, Drain returns an
+// error without closing the database.
+func (q *Queue) Drain(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return errors.Wrap(q.db.Close(), "failed to close queue database")
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "failed to drain queue")
+	}
+}
+
+// Depth returns the number of entries waiting to be processed, including
+// entries waiting to retry.
+func (q *Queue) Depth() (int, error) {
+	var n int
+	err := q.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(entriesBucket).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// DeadLetters returns the entries that failed after the maximum number of
+// attempts, ordered from oldest to newest.
+func (q *Queue) DeadLetters() ([]*Entry, error) {
+	var entries []*Entry
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadBucket).ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return errors.Wrapf(err, "failed to unmarshal entry %x", k)
+			}
+			entries = append(entries, &e)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		e, err := q.claim()
+		if err != nil {
+			q.logger.Error().Err(err).Msg("Failed to read from webhook queue")
+		}
+		if e == nil {
+			select {
+			case <-q.stop:
+				return
+			case <-q.wake:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		q.process(e)
+		q.release(e)
+	}
+}
+
+// claim returns the oldest entry that is ready to process and is not being
+// processed by another worker, or nil if there are no such entries.
+func (q *Queue) claim() (*Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, nil
+	}
+
+	now := time.Now()
+
+	var claimed *Entry
+	err := q.db.View(func(tx *bolt.Tx) error {
+		// Entries in progress stay in the index until they finish, so at most
+		// one entry per worker is skipped
+		c := tx.Bucket(readyBucket).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			next, seq := parseReadyKey(k)
+			if next.After(now) {
+				return nil
+			}
+			if q.inflight[seq] {
+				continue
+			}
+
+			v := tx.Bucket(entriesBucket).Get(seqKey(seq))
+			if v == nil {
+				return errors.Errorf("missing entry %d in ready index", seq)
+			}
+
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return errors.Wrapf(err, "failed to unmarshal entry %d", seq)
+			}
+
+			claimed = &e
+			return nil
+		}
+		return nil
+	})
+	if claimed != nil {
+		q.inflight[claimed.Seq] = true
+	}
+	return claimed, err
+}
+
+func (q *Queue) release(e *Entry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, e.Seq)
+}
+
+func (q *Queue) process(e *Entry) {
+	logger := q.logger.With().
+		Str(githubapp.LogKeyEventType, e.EventType).
+		Str(githubapp.LogKeyDeliveryID, e.DeliveryID).
+		Logger()
+	ctx := githubapp.InitializeResponder(logger.WithContext(context.Background()))
+
+	d := githubapp.Dispatch{
+		Handler:    q.handlers[e.EventType],
+		EventType:  e.EventType,
+		DeliveryID: e.DeliveryID,
+		Payload:    e.Payload,
+	}
+
+	var err error
+	if d.Handler == nil {
+		err = errors.Errorf("no handler for event type %q", e.EventType)
+	} else {
+		err = execute(ctx, d)
+	}
+
+	e.Attempts++
+	switch {
+	case err == nil:
+		q.finish(e, nil)
+
+	case pull.IsTemporaryError(err) && e.Attempts < q.opts.MaxAttempts:
+		prev := e.NextAttempt
+		e.LastError = err.Error()
+		e.NextAttempt = time.Now().Add(q.backoff(e.Attempts))
+		if reset, ok := pull.RateLimitReset(err); ok && reset.After(e.NextAttempt) {
+			e.NextAttempt = reset
+		}
+
+		logger.Warn().Err(err).Msgf("Temporary failure processing delivery, retrying at %s (attempt %d of %d)", e.NextAttempt.Format(time.RFC3339), e.Attempts, q.opts.MaxAttempts)
+		if err := q.reschedule(e, prev); err != nil {
+			logger.Error().Err(err).Msg("Failed to update webhook queue entry")
+		}
+		q.incCounter(MetricsKeyRetries)
+
+	case pull.IsTemporaryError(err) || d.Handler == nil:
+		e.LastError = err.Error()
+		logger.Error().Err(err).Msgf("Moving delivery to dead-letter storage after %d attempts", e.Attempts)
+		q.finish(e, deadBucket)
+		q.incCounter(MetricsKeyDeadLetters)
+		q.opts.OnError(ctx, d, err)
+
+	default:
+		q.finish(e, nil)
+		q.opts.OnError(ctx, d, err)
+	}
+}
+
+// finish removes an entry from the queue. If bucket is non-nil, the entry is
+// also stored in that bucket.
+func (q *Queue) finish(e *Entry, bucket []byte) {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(entriesBucket).Delete(seqKey(e.Seq)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(readyBucket).Delete(readyKey(e.NextAttempt, e.Seq)); err != nil {
+			return err
+		}
+		if e.DeliveryID != "" {
+			if err := tx.Bucket(deliveriesBucket).Delete([]byte(e.DeliveryID)); err != nil {
+				return err
+			}
+		}
+		if bucket != nil {
+			return putEntry(tx.Bucket(bucket), e)
+		}
+		return nil
+	})
+	if err != nil {
+		q.logger.Error().Err(err).Msgf("Failed to remove delivery %s from webhook queue", e.DeliveryID)
+	}
+	q.updateDepth()
+}
+
+// reschedule stores an entry after its next attempt time changes from prev.
+func (q *Queue) reschedule(e *Entry, prev time.Time) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		if err := putEntry(tx.Bucket(entriesBucket), e); err != nil {
+			return err
+		}
+		ready := tx.Bucket(readyBucket)
+		if err := ready.Delete(readyKey(prev, e.Seq)); err != nil {
+			return err
+		}
+		return ready.Put(readyKey(e.NextAttempt, e.Seq), nil)
+	})
+}
+
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := float64(q.opts.InitialBackoff) * math.Pow(2, float64(attempts-1))
+	if d > float64(q.opts.MaxBackoff) {
+		return q.opts.MaxBackoff
+	}
+	return time.Duration(d)
+}
+
+func (q *Queue) updateDepth() {
+	if q.opts.Registry == nil {
+		return
+	}
+	if n, err := q.Depth(); err == nil {
+		metrics.GetOrRegisterGauge(MetricsKeyDepth, q.opts.Registry).Update(int64(n))
+	}
+}
+
+func (q *Queue) incCounter(name string) {
+	if q.opts.Registry != nil {
+		metrics.GetOrRegisterCounter(name, q.opts.Registry).Inc(1)
+	}
+}
+
+func execute(ctx context.Context, d githubapp.Dispatch) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return d.Execute(ctx)
+}
+
+func putEntry(b *bolt.Bucket, e *Entry) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal entry")
+	}
+	return b.Put(seqKey(e.Seq), value)
+}
+
+func seqKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+// readyKey returns the key of an entry in the ready index. Keys sort by the
+// time of the next attempt and then by sequence number.
+func readyKey(next time.Time, seq uint64) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(next.UnixNano()))
+	return binary.BigEndian.AppendUint64(key, seq)
+}
+
+func parseReadyKey(key []byte) (time.Time, uint64) {
+	next := time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+	return next, binary.BigEndian.Uint64(key[8:])
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+type testHandler struct {
+	mu         sync.Mutex
+	deliveries []string
+	err        error
+}
+
+func (h *testHandler) Handles() []string { return []string{"pull_request"} }
+
+func (h *testHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.deliveries = append(h.deliveries, deliveryID)
+	return h.err
+}
+
+func (h *testHandler) Deliveries() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.deliveries...)
+}
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	t.Run("processesDeliveries", func(t *testing.T) {
+		h := &testHandler{}
+		registry := metrics.NewRegistry()
+		q := openQueue(t, path, h, Options{Registry: registry})
+
+		ctx := context.Background()
+		require.NoError(t, q.Schedule(ctx, dispatch(h, "1")))
+		require.NoError(t, q.Schedule(ctx, dispatch(h, "1")))
+		require.NoError(t, q.Schedule(ctx, dispatch(h, "2")))
+
+		depth, err := q.Depth()
+		require.NoError(t, err)
+		assert.Equal(t, 2, depth, "duplicate delivery was not ignored")
+		assert.Equal(t, int64(2), metrics.GetOrRegisterGauge(MetricsKeyDepth, registry).Value())
+
+		q.Start()
+		waitFor(t, func() bool { return len(h.Deliveries()) == 2 })
+		require.NoError(t, q.Drain(ctx))
+
+		assert.Equal(t, []string{"1", "2"}, h.Deliveries())
+	})
+
+	t.Run("survivesRestart", func(t *testing.T) {
+		h := &testHandler{}
+		q := openQueue(t, path, h, Options{})
+
+		ctx := context.Background()
+		require.NoError(t, q.Schedule(ctx, dispatch(h, "3")))
+		require.NoError(t, q.Drain(ctx))
+		assert.Empty(t, h.Deliveries())
+
+		q = openQueue(t, path, h, Options{})
+		q.Start()
+		waitFor(t, func() bool { return len(h.Deliveries()) == 1 })
+		require.NoError(t, q.Drain(ctx))
+
+		assert.Equal(t, []string{"3"}, h.Deliveries())
+	})
+
+	t.Run("retriesTemporaryErrors", func(t *testing.T) {
+		h := &testHandler{err: &pull.TemporaryError{}}
+		registry := metrics.NewRegistry()
+
+		var callbackErrs int
+		q := openQueue(t, path, h, Options{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Registry:       registry,
+			OnError: func(ctx context.Context, d githubapp.Dispatch, err error) {
+				callbackErrs++
+			},
+		})
+
+		ctx := context.Background()
+		require.NoError(t, q.Schedule(ctx, dispatch(h, "4")))
+		q.Start()
+
+		var dead []*Entry
+		waitFor(t, func() bool {
+			var err error
+			dead, err = q.DeadLetters()
+			require.NoError(t, err)
+			return len(dead) == 1
+		})
+		require.NoError(t, q.Drain(ctx))
+
+		assert.Equal(t, []string{"4", "4", "4"}, h.Deliveries())
+		assert.Equal(t, "4", dead[0].DeliveryID)
+		assert.Equal(t, 3, dead[0].Attempts)
+		assert.Equal(t, 1, callbackErrs)
+		assert.Equal(t, int64(2), metrics.GetOrRegisterCounter(MetricsKeyRetries, registry).Count())
+		assert.Equal(t, int64(1), metrics.GetOrRegisterCounter(MetricsKeyDeadLetters, registry).Count())
+	})
+
+	t.Run("waitsForRateLimitReset", func(t *testing.T) {
+		reset := time.Now().Add(time.Hour).Truncate(time.Second)
+		h := &testHandler{err: &github.RateLimitError{
+			Rate:     github.Rate{Reset: github.Timestamp{Time: reset}},
+			Response: &http.Response{Request: httptest.NewRequest(http.MethodGet, "/repos", nil)},
+		}}
+		// The entry stays in the queue, so use a separate database
+		path := filepath.Join(t.TempDir(), "queue.db")
+		q := openQueue(t, path, h, Options{InitialBackoff: time.Millisecond})
+
+		ctx := context.Background()
+		require.NoError(t, q.Schedule(ctx, dispatch(h, "8")))
+		q.Start()
+		waitFor(t, func() bool { return len(h.Deliveries()) == 1 })
+		require.NoError(t, q.Drain(ctx))
+
+		q = openQueue(t, path, h, Options{})
+		var next time.Time
+		err := q.db.View(func(tx *bolt.Tx) error {
+			k, _ := tx.Bucket(readyBucket).Cursor().First()
+			next, _ = parseReadyKey(k)
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, q.Drain(ctx))
+
+		assert.True(t, reset.Equal(next), "entry was not delayed until the reset: %s", next)
+	})
+
+	t.Run("dropsPermanentErrors", func(t *testing.T) {
+		h := &testHandler{err: errors.New("invalid policy")}
+
+		var callbackErrs int
+		q := openQueue(t, path, h, Options{
+			OnError: func(ctx context.Context, d githubapp.Dispatch, err error) {
+				callbackErrs++
+			},
+		})
+
+		ctx := context.Background()
+		require.NoError(t, q.Schedule(ctx, dispatch(h, "5")))
+		q.Start()
+		waitFor(t, func() bool {
+			depth, err := q.Depth()
+			require.NoError(t, err)
+			return depth == 0
+		})
+		require.NoError(t, q.Drain(ctx))
+
+		assert.Equal(t, []string{"5"}, h.Deliveries())
+		assert.Equal(t, 1, callbackErrs)
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		h := &testHandler{}
+		q := openQueue(t, path, h, Options{Fallback: githubapp.DefaultScheduler()})
+
+		other := &testHandler{}
+		err := q.Schedule(context.Background(), githubapp.Dispatch{
+			Handler:    other,
+			EventType:  "internal",
+			DeliveryID: "6",
+		})
+		require.NoError(t, err)
+		require.NoError(t, q.Drain(context.Background()))
+
+		assert.Equal(t, []string{"6"}, other.Deliveries())
+	})
+}
+
+func openQueue(t *testing.T, path string, h githubapp.EventHandler, opts Options) *Queue {
+	q, err := Open(path, []githubapp.EventHandler{h}, zerolog.Nop(), opts)
+	require.NoError(t, err)
+	return q
+}
+
+func dispatch(h githubapp.EventHandler, deliveryID string) githubapp.Dispatch {
+	return githubapp.Dispatch{
+		Handler:    h,
+		EventType:  "pull_request",
+		DeliveryID: deliveryID,
+		Payload:    []byte(`{}`),
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
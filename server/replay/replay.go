@@ -0,0 +1,355 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replay evaluates a candidate policy against pull requests that
+// were already merged to estimate how the policy would have affected them.
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/shurcooL/githubv4"
+)
+
+const (
+	DefaultMinRateLimit = 500
+	DefaultMaxAttempts  = 3
+
+	// abuseBackoff is the delay after a secondary rate limit error that does
+	// not say when to retry.
+	abuseBackoff = time.Minute
+)
+
+// Query selects the merged pull requests to replay. Owner and Repo are
+// required. If Since or Until are non-zero, only pull requests merged in the
+// range [Since, Until) are replayed. If Limit is positive, at most Limit of
+// the most recently merged pull requests are replayed.
+type Query struct {
+	Owner string
+	Repo  string
+
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// Replayer evaluates a policy against merged pull requests.
+//
+// Pull requests are evaluated one at a time. Before each evaluation, the
+// Replayer checks the rate limits of the client and waits for them to reset
+// if fewer than MinRateLimit requests remain. Evaluations that fail with
+// temporary errors are retried.
+type Replayer struct {
+	Client   *github.Client
+	V4Client *githubv4.Client
+
+	// GlobalCache, if non-nil, stores values loaded from GitHub between
+	// evaluations of different pull requests. Membership values are only
+	// cached for the owner of the repository, so if Client is for an app
+	// installation, it must be the installation of that owner.
+	GlobalCache pull.GlobalCache
+
+	Evaluator common.Evaluator
+
+	// MinRateLimit is the number of remaining REST or GraphQL requests below
+	// which the Replayer waits for the rate limit to reset.
+	MinRateLimit int
+
+	// MaxAttempts is the maximum number of times to evaluate a pull request
+	// that fails with temporary errors.
+	MaxAttempts int
+
+	// OnResult, if non-nil, is called after each pull request is evaluated.
+	// Use it to save results so that an interrupted replay can resume.
+	OnResult func(*PullResult) error
+
+	// FailOnRateLimit, if true, makes the Replayer return a RateLimitedError
+	// instead of waiting for a rate limit to reset.
+	FailOnRateLimit bool
+
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// RateLimitedError is returned when a Replayer with FailOnRateLimit must wait
+// for a rate limit. Reset is the time after which the replay can continue.
+type RateLimitedError struct {
+	Reset time.Time
+}
+
+func (e *RateLimitedError) Error() string {
+	return "GitHub rate limit reached, retry after " + e.Reset.Format(time.RFC3339)
+}
+
+// Replay evaluates the policy against the pull requests that match the query,
+// in the order they were merged. Pull requests with results in previous are
+// not evaluated again; their existing results are used instead.
+func (r *Replayer) Replay(ctx context.Context, q Query, previous map[int]*PullResult) (*Report, error) {
+	logger := zerolog.Ctx(ctx)
+
+	prs, err := r.listMerged(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*PullResult
+	for i, pr := range prs {
+		if res, ok := previous[pr.GetNumber()]; ok {
+			results = append(results, res)
+			continue
+		}
+
+		logger.Debug().Msgf("Replaying pull request %d of %d: #%d", i+1, len(prs), pr.GetNumber())
+
+		res, err := r.evaluate(ctx, q, pr)
+		if err != nil {
+			return nil, err
+		}
+		if r.OnResult != nil {
+			if err := r.OnResult(res); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, res)
+	}
+
+	return NewReport(results), nil
+}
+
+func (r *Replayer) evaluate(ctx context.Context, q Query, pr *github.PullRequest) (*PullResult, error) {
+	maxAttempts := r.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	var result common.Result
+	for attempt := 1; ; attempt++ {
+		if err := r.waitForRateLimit(ctx); err != nil {
+			return nil, err
+		}
+
+		mbrCtx := pull.NewGitHubMembershipContext(ctx, r.Client, q.Owner, r.GlobalCache)
+		prctx, err := pull.NewGitHubContext(ctx, mbrCtx, r.GlobalCache, r.Client, r.V4Client, pull.Locator{
+			Owner:  q.Owner,
+			Repo:   q.Repo,
+			Number: pr.GetNumber(),
+			Value:  pr,
+		})
+		if err == nil {
+			result = r.Evaluator.Evaluate(ctx, prctx)
+			err = result.Error
+		} else {
+			result = common.Result{Status: common.StatusSkipped, Error: err}
+		}
+
+		if !pull.IsTemporaryError(err) || attempt >= maxAttempts {
+			break
+		}
+		if err := r.backoff(ctx, err, attempt); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewPullResult(pr, &result), nil
+}
+
+// backoff waits before retrying an evaluation that failed with a temporary
+// error. Primary rate limits are handled by waitForRateLimit before the next
+// attempt.
+func (r *Replayer) backoff(ctx context.Context, err error, attempt int) error {
+	zerolog.Ctx(ctx).Info().Err(err).Msgf("Temporary error on attempt %d, retrying", attempt)
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		d := abuseErr.GetRetryAfter()
+		if d <= 0 {
+			d = abuseBackoff
+		}
+		return r.waitForReset(ctx, time.Now().Add(d))
+	}
+
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return nil
+	}
+	return r.wait(ctx, time.Duration(attempt)*time.Second)
+}
+
+// waitForRateLimit waits until the REST and GraphQL rate limits reset if
+// either has fewer than MinRateLimit requests remaining.
+func (r *Replayer) waitForRateLimit(ctx context.Context) error {
+	minRemaining := r.MinRateLimit
+	if minRemaining < 1 {
+		minRemaining = DefaultMinRateLimit
+	}
+
+	limits, _, err := r.Client.RateLimit.Get(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get rate limits")
+	}
+
+	var reset time.Time
+	for _, rate := range []*github.Rate{limits.GetCore(), limits.GetGraphQL()} {
+		if rate != nil && rate.Remaining < minRemaining && rate.Reset.After(reset) {
+			reset = rate.Reset.Time
+		}
+	}
+	if reset.IsZero() {
+		return nil
+	}
+
+	zerolog.Ctx(ctx).Info().Msgf("Close to the GitHub rate limit, waiting until it resets at %s", reset.Format(time.RFC3339))
+	return r.waitForReset(ctx, reset.Add(time.Second))
+}
+
+func (r *Replayer) waitForReset(ctx context.Context, reset time.Time) error {
+	if r.FailOnRateLimit {
+		return &RateLimitedError{Reset: reset}
+	}
+	return r.wait(ctx, time.Until(reset))
+}
+
+func (r *Replayer) wait(ctx context.Context, d time.Duration) error {
+	if r.sleep != nil {
+		return r.sleep(ctx, d)
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// listMerged returns the pull requests that match the query, ordered by the
+// time they were merged.
+func (r *Replayer) listMerged(ctx context.Context, q Query) ([]*github.PullRequest, error) {
+	var prs []*github.PullRequest
+
+	opts := &github.PullRequestListOptions{
+		State:       "closed",
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	// cutoff is the merge time of the oldest pull request once there are
+	// Limit pull requests. Newer pull requests replace older ones, so it only
+	// moves forward.
+	var cutoff time.Time
+	byMergedAt := func() {
+		sort.SliceStable(prs, func(i, j int) bool {
+			return prs[i].GetMergedAt().After(prs[j].GetMergedAt().Time)
+		})
+		if q.Limit > 0 && len(prs) >= q.Limit {
+			prs = prs[:q.Limit]
+			cutoff = prs[len(prs)-1].GetMergedAt().Time
+		}
+	}
+
+list:
+	for {
+		res, resp, err := r.Client.PullRequests.List(ctx, q.Owner, q.Repo, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list pull requests for %s/%s", q.Owner, q.Repo)
+		}
+
+		for _, pr := range res {
+			// A pull request is always updated when it is merged, so no
+			// later pull requests can be in the time range
+			if !q.Since.IsZero() && pr.GetUpdatedAt().Before(q.Since) {
+				break list
+			}
+
+			// For the same reason, once there are enough pull requests, no
+			// later pull request can be merged after the oldest of them
+			if !cutoff.IsZero() && pr.GetUpdatedAt().Before(cutoff) {
+				break list
+			}
+
+			mergedAt := pr.GetMergedAt().Time
+			switch {
+			case mergedAt.IsZero():
+			case !q.Since.IsZero() && mergedAt.Before(q.Since):
+			case !q.Until.IsZero() && !mergedAt.Before(q.Until):
+			default:
+				prs = append(prs, pr)
+			}
+		}
+		byMergedAt()
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	byMergedAt()
+
+	// replay from oldest to newest
+	for i, j := 0, len(prs)-1; i < j; i, j = i+1, j-1 {
+		prs[i], prs[j] = prs[j], prs[i]
+	}
+	return prs, nil
+}
+
+// ReadResults reads results written by WriteResult, for use as the previous
+// results of a resumed replay. If a pull request appears more than once, the
+// last result is used.
+func ReadResults(r io.Reader) (map[int]*PullResult, error) {
+	results := make(map[int]*PullResult)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var res PullResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			return nil, errors.Wrap(err, "failed to parse replay result")
+		}
+		results[res.Number] = &res
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read replay results")
+	}
+	return results, nil
+}
+
+// WriteResult writes a result as a single line of JSON.
+func WriteResult(w io.Writer, res *PullResult) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal replay result")
+	}
+	_, err = w.Write(append(b, '\n'))
+	return errors.Wrap(err, "failed to write replay result")
+}
@@ -0,0 +1,267 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/policy-bot/policy"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/githubv4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const testPolicy = `
+policy:
+  approval:
+    - or:
+      - feature
+      - docs
+
+approval_rules:
+  - name: feature
+    if:
+      title:
+        matches: ["^feat"]
+  - name: docs
+    if:
+      changed_files:
+        paths: ["^docs/"]
+`
+
+func TestReplay(t *testing.T) {
+	rp := newResponsePlayer(t, map[string]string{
+		"/repos/testorg/testrepo/pulls":         "testdata/responses/pulls_closed.yml",
+		"/repos/testorg/testrepo/pulls/2/files": "testdata/responses/pull_2_files.yml",
+		"/repos/testorg/testrepo/pulls/3/files": "testdata/responses/pull_3_files.yml",
+		"/repos/testorg/testrepo/pulls/5/files": "testdata/responses/pull_5_files.yml",
+		"/rate_limit":                           "testdata/responses/rate_limit.yml",
+		"/graphql":                              "testdata/responses/graphql_pull_comments_reviews.yml",
+	})
+
+	var waits []time.Duration
+	var saved bytes.Buffer
+
+	r := newTestReplayer(t, rp)
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	r.OnResult = func(res *PullResult) error {
+		return WriteResult(&saved, res)
+	}
+
+	q := Query{
+		Owner: "testorg",
+		Repo:  "testrepo",
+		Since: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Until: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+	}
+
+	report, err := r.Replay(context.Background(), q, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, rp.count["/repos/testorg/testrepo/pulls"], "listing did not stop at the start of the time range")
+	assert.Len(t, waits, 1, "replay did not wait for the rate limit to reset")
+
+	require.Len(t, report.Pulls, 3)
+	assert.Equal(t, []int{2, 3, 5}, []int{report.Pulls[0].Number, report.Pulls[1].Number, report.Pulls[2].Number})
+
+	assert.Equal(t, "approved", report.Pulls[0].Status)
+	assert.Equal(t, "approved", report.Pulls[1].Status)
+	assert.Equal(t, "skipped", report.Pulls[2].Status)
+	assert.Equal(t, "ttest", report.Pulls[2].Author)
+	assert.True(t, report.Pulls[2].Blocked())
+
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 1, report.Blocked)
+	assert.Equal(t, 0, report.Errors)
+
+	assert.Equal(t, []*RuleSummary{
+		{Name: "approval", Approved: 2, Skipped: 1},
+		{Name: "approval / or", Approved: 2, Skipped: 1},
+		{Name: "approval / or / docs", Approved: 1, Skipped: 2},
+		{Name: "approval / or / feature", Approved: 1, Skipped: 2},
+		{Name: "disapproval", Skipped: 3},
+	}, report.Rules)
+
+	t.Run("resume", func(t *testing.T) {
+		previous, err := ReadResults(&saved)
+		require.NoError(t, err)
+		require.Len(t, previous, 3)
+		delete(previous, 5)
+
+		for path := range rp.count {
+			rp.count[path] = 0
+		}
+
+		resumed, err := r.Replay(context.Background(), q, previous)
+		require.NoError(t, err)
+
+		assert.Equal(t, report, resumed)
+		assert.Zero(t, rp.count["/repos/testorg/testrepo/pulls/2/files"], "replay evaluated a completed pull request")
+		assert.Zero(t, rp.count["/repos/testorg/testrepo/pulls/3/files"], "replay evaluated a completed pull request")
+		assert.Equal(t, 1, rp.count["/repos/testorg/testrepo/pulls/5/files"])
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		for path := range rp.count {
+			rp.count[path] = 0
+		}
+
+		q := q
+		q.Since = time.Time{}
+		q.Limit = 1
+
+		limited, err := r.Replay(context.Background(), q, nil)
+		require.NoError(t, err)
+		require.Len(t, limited.Pulls, 1)
+		assert.Equal(t, 5, limited.Pulls[0].Number, "limit did not select the most recent pull request")
+		assert.Equal(t, 2, rp.count["/repos/testorg/testrepo/pulls"], "listing did not stop after finding enough pull requests")
+	})
+	t.Run("failOnRateLimit", func(t *testing.T) {
+		for path := range rp.count {
+			rp.count[path] = 0
+		}
+
+		r := *r
+		r.FailOnRateLimit = true
+
+		_, err := r.Replay(context.Background(), q, nil)
+
+		var rateLimitErr *RateLimitedError
+		require.True(t, errors.As(err, &rateLimitErr), "expected rate limit error, got %v", err)
+		assert.True(t, time.Unix(1709290801, 0).Equal(rateLimitErr.Reset), "incorrect reset time: %s", rateLimitErr.Reset)
+		assert.Zero(t, rp.count["/repos/testorg/testrepo/pulls/2/files"], "replay evaluated a pull request")
+	})
+}
+
+func TestReportWriters(t *testing.T) {
+	report := NewReport([]*PullResult{
+		{
+			Number:   1,
+			Author:   "mhaypenny",
+			MergedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			Status:   "approved",
+			Rules:    map[string]string{"policy": "approved"},
+		},
+		{
+			Number:   2,
+			Author:   "ttest",
+			MergedAt: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+			Status:   "pending",
+			Rules:    map[string]string{"policy": "pending"},
+		},
+	})
+
+	var table strings.Builder
+	require.NoError(t, report.WriteTable(&table))
+	assert.Contains(t, table.String(), "#2      2024-03-02  ttest      pending")
+	assert.Contains(t, table.String(), "1 of 2 pull requests would have been blocked (0 errors)")
+
+	var csv strings.Builder
+	require.NoError(t, report.WriteCSV(&csv))
+	assert.Equal(t, strings.Join([]string{
+		"number,title,author,head_sha,merged_at,status,status_description,error,policy",
+		"1,,mhaypenny,,2024-03-01T00:00:00Z,approved,,,approved",
+		"2,,ttest,,2024-03-02T00:00:00Z,pending,,,pending",
+		"",
+	}, "\n"), csv.String())
+}
+
+func newTestReplayer(t *testing.T, rp *responsePlayer) *Replayer {
+	client := github.NewClient(&http.Client{Transport: rp})
+	client.BaseURL, _ = url.Parse("http://github.localhost/")
+
+	var config policy.Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(testPolicy), &config))
+
+	evaluator, err := policy.ParsePolicy(&config)
+	require.NoError(t, err)
+
+	return &Replayer{
+		Client:    client,
+		V4Client:  githubv4.NewClient(&http.Client{Transport: rp}),
+		Evaluator: evaluator,
+	}
+}
+
+// responsePlayer returns recorded responses for requests by path. Responses
+// are returned in order and the last response repeats.
+type responsePlayer struct {
+	t         *testing.T
+	responses map[string][]savedResponse
+	count     map[string]int
+}
+
+type savedResponse struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+}
+
+func newResponsePlayer(t *testing.T, files map[string]string) *responsePlayer {
+	rp := &responsePlayer{
+		t:         t,
+		responses: make(map[string][]savedResponse),
+		count:     make(map[string]int),
+	}
+	for path, file := range files {
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		var responses []savedResponse
+		require.NoError(t, yaml.Unmarshal(b, &responses), "failed to parse %s", file)
+		rp.responses[path] = responses
+	}
+	return rp
+}
+
+func (rp *responsePlayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := req.URL.Path
+	responses := rp.responses[path]
+	if len(responses) == 0 {
+		rp.t.Errorf("unexpected request: %s %s", req.Method, path)
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	}
+
+	i := rp.count[path]
+	if i >= len(responses) {
+		i = len(responses) - 1
+	}
+	rp.count[path]++
+
+	header := make(http.Header)
+	for k, v := range responses[i].Headers {
+		header.Add(k, v)
+	}
+	return &http.Response{
+		StatusCode: responses[i].Status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(responses[i].Body)),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/pkg/errors"
+)
+
+// PullResult is the result of replaying a policy against a pull request.
+type PullResult struct {
+	Number   int       `json:"number"`
+	Title    string    `json:"title"`
+	Author   string    `json:"author"`
+	HeadSHA  string    `json:"head_sha"`
+	MergedAt time.Time `json:"merged_at"`
+
+	Status            string `json:"status"`
+	StatusDescription string `json:"status_description"`
+	Error             string `json:"error,omitempty"`
+
+	// Rules contains the status of each rule and policy in the result,
+	// identified by their names joined with " / ".
+	Rules map[string]string `json:"rules,omitempty"`
+}
+
+// Blocked returns true if the policy would have prevented the merge.
+func (r *PullResult) Blocked() bool {
+	return r.Error != "" || r.Status != common.StatusApproved.String()
+}
+
+// NewPullResult creates a PullResult from the result of evaluating a pull
+// request.
+func NewPullResult(pr *github.PullRequest, result *common.Result) *PullResult {
+	res := &PullResult{
+		Number:            pr.GetNumber(),
+		Title:             pr.GetTitle(),
+		Author:            pr.GetUser().GetLogin(),
+		HeadSHA:           pr.GetHead().GetSHA(),
+		MergedAt:          pr.GetMergedAt().Time,
+		Status:            result.Status.String(),
+		StatusDescription: result.StatusDescription,
+		Rules:             make(map[string]string),
+	}
+	if result.Error != nil {
+		res.Error = result.Error.Error()
+	}
+
+	var walk func(prefix string, r *common.Result)
+	walk = func(prefix string, r *common.Result) {
+		for _, c := range r.Children {
+			name := c.Name
+			if prefix != "" {
+				name = prefix + " / " + name
+			}
+
+			status := c.Status.String()
+			if c.Error != nil {
+				status = "error"
+			}
+			res.Rules[name] = status
+
+			walk(name, c)
+		}
+	}
+	walk("", result)
+
+	return res
+}
+
+// Report summarizes the results of a replay.
+type Report struct {
+	Total   int `json:"total"`
+	Blocked int `json:"blocked"`
+	Errors  int `json:"errors"`
+
+	Pulls []*PullResult  `json:"pulls"`
+	Rules []*RuleSummary `json:"rules"`
+}
+
+// RuleSummary counts the results of a rule or policy across all pull
+// requests.
+type RuleSummary struct {
+	Name        string `json:"name"`
+	Approved    int    `json:"approved"`
+	Pending     int    `json:"pending"`
+	Disapproved int    `json:"disapproved"`
+	Skipped     int    `json:"skipped"`
+	Errors      int    `json:"errors"`
+}
+
+// NewReport creates a report from a list of results.
+func NewReport(results []*PullResult) *Report {
+	report := &Report{
+		Pulls: results,
+		Rules: []*RuleSummary{},
+	}
+	if report.Pulls == nil {
+		report.Pulls = []*PullResult{}
+	}
+
+	rules := make(map[string]*RuleSummary)
+	for _, res := range results {
+		report.Total++
+		if res.Blocked() {
+			report.Blocked++
+		}
+		if res.Error != "" {
+			report.Errors++
+		}
+
+		for name, status := range res.Rules {
+			s, ok := rules[name]
+			if !ok {
+				s = &RuleSummary{Name: name}
+				rules[name] = s
+				report.Rules = append(report.Rules, s)
+			}
+
+			switch status {
+			case common.StatusApproved.String():
+				s.Approved++
+			case common.StatusPending.String():
+				s.Pending++
+			case common.StatusDisapproved.String():
+				s.Disapproved++
+			case common.StatusSkipped.String():
+				s.Skipped++
+			default:
+				s.Errors++
+			}
+		}
+	}
+
+	sort.Slice(report.Rules, func(i, j int) bool { return report.Rules[i].Name < report.Rules[j].Name })
+	return report
+}
+
+// WriteTable writes the report as text tables: one row for each pull request
+// followed by one row for each rule.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NUMBER\tMERGED\tAUTHOR\tSTATUS\tDESCRIPTION")
+	for _, res := range r.Pulls {
+		status, description := res.Status, res.StatusDescription
+		if res.Error != "" {
+			status, description = "error", res.Error
+		}
+		fmt.Fprintf(tw, "#%d\t%s\t%s\t%s\t%s\n", res.Number, res.MergedAt.Format(time.DateOnly), res.Author, status, description)
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "RULE\tAPPROVED\tPENDING\tDISAPPROVED\tSKIPPED\tERRORS")
+	for _, s := range r.Rules {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\n", s.Name, s.Approved, s.Pending, s.Disapproved, s.Skipped, s.Errors)
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "%d of %d pull requests would have been blocked (%d errors)\n", r.Blocked, r.Total, r.Errors)
+
+	return errors.Wrap(tw.Flush(), "failed to write report")
+}
+
+// WriteCSV writes one row for each pull request with a column for the status
+// of each rule.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"number", "title", "author", "head_sha", "merged_at", "status", "status_description", "error"}
+	for _, s := range r.Rules {
+		header = append(header, s.Name)
+	}
+	_ = cw.Write(header)
+
+	for _, res := range r.Pulls {
+		row := []string{
+			strconv.Itoa(res.Number),
+			res.Title,
+			res.Author,
+			res.HeadSHA,
+			res.MergedAt.Format(time.RFC3339),
+			res.Status,
+			res.StatusDescription,
+			res.Error,
+		}
+		for _, s := range r.Rules {
+			row = append(row, res.Rules[s.Name])
+		}
+		_ = cw.Write(row)
+	}
+
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "failed to write report")
+}
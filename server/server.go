@@ -29,11 +29,16 @@ import (
 	"github.com/gregjones/httpcache"
 	"github.com/palantir/go-baseapp/baseapp"
 	"github.com/palantir/go-baseapp/baseapp/datadog"
-	"github.com/palantir/go-githubapp/appconfig"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/palantir/go-githubapp/oauth2"
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/attestation"
+	"github.com/palantir/policy-bot/server/debounce"
 	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/palantir/policy-bot/server/prometheus"
+	"github.com/palantir/policy-bot/server/queue"
+	"github.com/palantir/policy-bot/server/tracing"
 	"github.com/palantir/policy-bot/version"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -48,18 +53,52 @@ const (
 	DefaultWebhookWorkers   = 10
 	DefaultWebhookQueueSize = 100
 
-	DefaultHTTPCacheSize     = 50 * datasize.MB
-	DefaultPushedAtCacheSize = 100_000
+	DefaultHTTPCacheSize       = 50 * datasize.MB
+	DefaultPushedAtCacheSize   = 100_000
+	DefaultMembershipCacheSize = 100_000
+
+	HistoryRetentionInterval = time.Hour
+	DefaultQueueDrainTime    = 30 * time.Second
+	DefaultTracingFlushTime  = 10 * time.Second
 )
 
 type Server struct {
-	config *Config
-	base   *baseapp.Server
+	config     *Config
+	base       *baseapp.Server
+	history    history.Store
+	queue      *queue.Queue
+	reconciler *handler.Reconciler
+
+	pushedAtCache   *pull.BoltGlobalCache
+	shutdownTracing func(context.Context) error
+}
+
+// Param configures optional Server dependencies that are not set by the
+// configuration file.
+type Param func(p *params)
+
+type params struct {
+	networkCache pull.NetworkCache
+}
+
+// WithNetworkCache stores global cache values in a cache that is shared by all
+// servers instead of in memory. Use this when running multiple servers so that
+// membership and permission values are only loaded once and invalidation
+// webhooks apply to all servers.
+func WithNetworkCache(nc pull.NetworkCache) Param {
+	return func(p *params) {
+		p.networkCache = nc
+	}
 }
 
 // New instantiates a new Server.
 // Callers must then invoke Start to run the Server.
-func New(c *Config) (*Server, error) {
+func New(c *Config, ps ...Param) (*Server, error) {
+	var opts params
+	for _, p := range ps {
+		p(&opts)
+	}
+
 	logger := baseapp.NewLogger(baseapp.LoggingConfig{
 		Level:  c.Logging.Level,
 		Pretty: c.Logging.Text,
@@ -88,6 +127,11 @@ func New(c *Config) (*Server, error) {
 	sessions.HttpOnly(true)
 	sessions.Secure(forceTLS)
 
+	shutdownTracing, err := tracing.Setup(context.Background(), c.Tracing, version.GetVersion())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize tracing")
+	}
+
 	base, err := baseapp.NewServer(c.Server, baseapp.DefaultParams(logger, "policybot.")...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to initialize base server")
@@ -122,6 +166,8 @@ func New(c *Config) (*Server, error) {
 				githubapp.LogRequestBody("^"+v4URL.Path+"$"),
 			),
 			githubapp.ClientMetrics(base.Registry()),
+			handler.CountGitHubRequests,
+			tracing.ClientMiddleware,
 		),
 	)
 	if err != nil {
@@ -143,30 +189,60 @@ func New(c *Config) (*Server, error) {
 		pushedAtSize = DefaultPushedAtCacheSize
 	}
 
-	globalCache, err := pull.NewLRUGlobalCache(pushedAtSize)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to initialize global cache")
+	membershipSize := c.Cache.MembershipSize
+	if membershipSize == 0 {
+		membershipSize = DefaultMembershipCacheSize
 	}
 
-	basePolicyHandler := handler.Base{
-		ClientCreator: cc,
-		BaseConfig:    &c.Server,
-		Installations: githubapp.NewInstallationsService(appClient),
-		GlobalCache:   globalCache,
+	var globalCache pull.GlobalCache
+	if opts.networkCache != nil {
+		networkCache := pull.NewNetworkGlobalCache(opts.networkCache, c.Cache.MembershipTTL)
+		networkCache.OnError = func(err error) {
+			logger.Warn().Err(err).Msg("Network cache operation failed")
+		}
+		globalCache = networkCache
+	} else {
+		globalCache, err = pull.NewLRUGlobalCacheWithMembership(pushedAtSize, membershipSize, c.Cache.MembershipTTL)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize global cache")
+		}
+	}
 
-		PullOpts: &c.Options,
-		ConfigFetcher: &handler.ConfigFetcher{
-			Loader: appconfig.NewLoader(
-				[]string{c.Options.PolicyPath},
-				appconfig.WithOwnerDefault(c.Options.SharedRepository, []string{
-					c.Options.SharedPolicyPath,
-				}),
-			),
-		},
+	var pushedAtCache *pull.BoltGlobalCache
+	if c.Cache.PushedAtPath != "" {
+		pushedAtCache, err = pull.NewBoltGlobalCache(c.Cache.PushedAtPath, c.Cache.PushedAtMaxEntries, globalCache)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize persistent global cache")
+		}
+		globalCache = pushedAtCache
+	}
 
-		AppName: app.GetSlug(),
+	var historyStore history.Store
+	if c.History.Path != "" {
+		historyStore, err = history.NewBoltStore(c.History.Path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize evaluation history")
+		}
+	}
+
+	var attestor *handler.Attestor
+	if c.Attestations.SigningKey != "" {
+		if c.Attestations.Path == "" {
+			return nil, errors.New("attestations require a storage path")
+		}
+		signer, err := attestation.NewSigner([]byte(c.Attestations.SigningKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize attestation signer")
+		}
+		attestor = &handler.Attestor{
+			Signer:     signer,
+			Store:      attestation.NewFileStore(c.Attestations.Path),
+			PostStatus: c.Attestations.PostStatus,
+		}
 	}
 
+	configFetcher := handler.NewConfigFetcher(&c.Options)
+
 	queueSize := c.Workers.QueueSize
 	if queueSize < 1 {
 		queueSize = DefaultWebhookQueueSize
@@ -177,25 +253,76 @@ func New(c *Config) (*Server, error) {
 		workers = DefaultWebhookWorkers
 	}
 
-	dispatcher := githubapp.NewEventDispatcher(
-		[]githubapp.EventHandler{
-			&handler.Installation{Base: basePolicyHandler},
-			&handler.MergeGroup{Base: basePolicyHandler},
-			&handler.PullRequest{Base: basePolicyHandler},
-			&handler.PullRequestReview{Base: basePolicyHandler},
-			&handler.IssueComment{Base: basePolicyHandler},
-			&handler.Status{Base: basePolicyHandler},
-			&handler.CheckRun{Base: basePolicyHandler},
+	scheduler := githubapp.QueueAsyncScheduler(
+		queueSize, workers,
+		githubapp.WithSchedulingMetrics(base.Registry()),
+		githubapp.WithAsyncErrorCallback(githubapp.MetricsAsyncErrorCallback(base.Registry())),
+	)
+
+	var debouncer *debounce.Debouncer
+	if c.Workers.DebounceWindow > 0 {
+		// Debounced evaluations are only held in memory, so the durable
+		// queue could not guarantee that they survive a restart
+		if c.Workers.DurableQueue.Path != "" {
+			return nil, errors.New("workers.debounce_window cannot be used with workers.durable_queue")
+		}
+		debouncer = debounce.New(c.Workers.DebounceWindow, scheduler, base.Registry())
+	}
+
+	basePolicyHandler := handler.Base{
+		ClientCreator: cc,
+		BaseConfig:    &c.Server,
+		Installations: githubapp.NewInstallationsService(appClient),
+		GlobalCache:   globalCache,
+
+		PullOpts:      &c.Options,
+		ConfigFetcher: configFetcher,
+		History:       historyStore,
+		Attestor:      attestor,
+		Registry:      base.Registry(),
+		Debouncer:     debouncer,
+		Retry: handler.RetryPolicy{
+			MaxElapsed: githubTimeout,
+			RetryLater: c.Workers.DurableQueue.Path != "" || c.Reconcile.Interval > 0,
 		},
+
+		AppName: app.GetSlug(),
+	}
+
+	eventHandlers := tracing.EventHandlers([]githubapp.EventHandler{
+		&handler.Installation{Base: basePolicyHandler},
+		&handler.MergeGroup{Base: basePolicyHandler},
+		&handler.PullRequest{Base: basePolicyHandler},
+		&handler.PullRequestReview{Base: basePolicyHandler},
+		&handler.IssueComment{Base: basePolicyHandler},
+		&handler.Status{Base: basePolicyHandler},
+		&handler.CheckRun{Base: basePolicyHandler},
+		&handler.MembershipChange{Base: basePolicyHandler},
+	})
+
+	var webhookQueue *queue.Queue
+	webhookScheduler := scheduler
+	if qc := c.Workers.DurableQueue; qc.Path != "" {
+		webhookQueue, err = queue.Open(qc.Path, eventHandlers, logger, queue.Options{
+			Workers:        workers,
+			MaxAttempts:    qc.MaxAttempts,
+			InitialBackoff: qc.InitialBackoff,
+			MaxBackoff:     qc.MaxBackoff,
+			Fallback:       scheduler,
+			OnError:        githubapp.MetricsAsyncErrorCallback(base.Registry()),
+			Registry:       base.Registry(),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize webhook queue")
+		}
+		webhookScheduler = webhookQueue
+	}
+
+	dispatcher := githubapp.NewEventDispatcher(
+		eventHandlers,
 		c.Github.App.WebhookSecret,
 		githubapp.WithErrorCallback(githubapp.MetricsErrorCallback(base.Registry())),
-		githubapp.WithScheduler(
-			githubapp.QueueAsyncScheduler(
-				queueSize, workers,
-				githubapp.WithSchedulingMetrics(base.Registry()),
-				githubapp.WithAsyncErrorCallback(githubapp.MetricsAsyncErrorCallback(base.Registry())),
-			),
-		),
+		githubapp.WithScheduler(webhookScheduler),
 	)
 
 	templates, err := handler.LoadTemplates(&c.Files, basePath, c.Github.WebURL)
@@ -220,8 +347,47 @@ func New(c *Config) (*Server, error) {
 
 	// additional API routes
 	mux.Handle(pat.Get("/api/health"), handler.Health())
+	if c.Prometheus.Enabled {
+		mux.Handle(pat.Get("/metrics"), prometheus.Handler(base.Registry(), c.Prometheus.Token))
+	}
 	mux.Handle(pat.Put("/api/validate"), handler.Validate())
+	mux.Handle(pat.Get("/api/schema"), handler.Schema())
+	mux.Handle(pat.Put("/api/validate/:owner/:repo"), hatpear.Try(&handler.ValidateRepository{Base: basePolicyHandler}))
 	mux.Handle(pat.Post("/api/simulate/:owner/:repo/:number"), hatpear.Try(simulateHandler))
+	mux.Handle(pat.Get("/api/plan/:owner/:repo/:number"), hatpear.Try(&handler.Plan{Base: basePolicyHandler}))
+	mux.Handle(pat.Post("/api/override/:owner/:repo/:number"), hatpear.Try(&handler.Override{Base: basePolicyHandler}))
+	mux.Handle(pat.Get("/api/history/:owner/:repo"), hatpear.Try(&handler.History{Base: basePolicyHandler}))
+	mux.Handle(pat.Get("/api/history/:owner/:repo/:number"), hatpear.Try(&handler.History{Base: basePolicyHandler}))
+	mux.Handle(pat.Get("/api/bypasses/:owner/:repo"), hatpear.Try(&handler.Bypasses{Base: basePolicyHandler}))
+	mux.Handle(pat.Get("/api/shadow/:owner/:repo"), hatpear.Try(&handler.ShadowReport{Base: basePolicyHandler}))
+	mux.Handle(pat.Post("/api/replay/:owner/:repo"), hatpear.Try(&handler.Replay{Base: basePolicyHandler}))
+	mux.Handle(pat.Get("/api/attestations/:owner/:repo/:sha"), hatpear.Try(&handler.Attestations{Base: basePolicyHandler}))
+
+	adminJobs := handler.NewAdminJobs(handler.DefaultAdminJobLimit)
+	adminEvaluate := hatpear.Try(&handler.AdminEvaluate{
+		Base:        basePolicyHandler,
+		Jobs:        adminJobs,
+		Token:       c.Admin.Token,
+		Concurrency: c.Admin.Concurrency,
+	})
+	mux.Handle(pat.Post("/api/admin/evaluate/:owner"), adminEvaluate)
+	mux.Handle(pat.Post("/api/admin/evaluate/:owner/:repo"), adminEvaluate)
+	mux.Handle(pat.Post("/api/admin/evaluate/:owner/:repo/:number"), adminEvaluate)
+	mux.Handle(pat.Get("/api/admin/jobs/:id"), hatpear.Try(&handler.AdminJobStatus{
+		Base:  basePolicyHandler,
+		Jobs:  adminJobs,
+		Token: c.Admin.Token,
+	}))
+	mux.Handle(pat.Get("/api/coverage/:owner"), hatpear.Try(&handler.Coverage{
+		Base: basePolicyHandler,
+		Reporter: &handler.CoverageReporter{
+			ClientCreator: cc,
+			ConfigFetcher: configFetcher,
+			PullOpts:      &c.Options,
+		},
+		Token: c.Admin.Token,
+	}))
+
 	mux.Handle(pat.Get(oauth2.DefaultRoute), oauth2.NewHandler(
 		oauth2.GetConfig(c.Github, nil),
 		oauth2.ForceTLS(forceTLS),
@@ -255,8 +421,17 @@ func New(c *Config) (*Server, error) {
 	mux.Handle(pat.New("/details/*"), details)
 
 	return &Server{
-		config: c,
-		base:   base,
+		config:  c,
+		base:    base,
+		history: historyStore,
+		queue:   webhookQueue,
+		reconciler: &handler.Reconciler{
+			Base:         basePolicyHandler,
+			Concurrency:  c.Reconcile.Concurrency,
+			MinRateLimit: c.Reconcile.MinRateLimit,
+		},
+		pushedAtCache:   pushedAtCache,
+		shutdownTracing: shutdownTracing,
 	}, nil
 }
 
@@ -267,5 +442,54 @@ func (s *Server) Start() error {
 			return err
 		}
 	}
-	return s.base.Start()
+	if s.history != nil && s.config.History.Retention > 0 {
+		logger := s.base.Logger()
+		go history.RunRetention(logger.WithContext(context.Background()), s.history, s.config.History.Retention, HistoryRetentionInterval)
+	}
+	if s.config.Reconcile.Interval > 0 {
+		logger := s.base.Logger()
+		go s.reconciler.Run(logger.WithContext(context.Background()), s.config.Reconcile.Interval)
+	}
+	if s.queue != nil {
+		s.queue.Start()
+	}
+
+	err := s.base.Start()
+
+	if s.queue != nil {
+		// The HTTP server has stopped accepting deliveries, so finish the
+		// deliveries in progress. Unprocessed deliveries stay in the queue.
+		drainTime := DefaultQueueDrainTime
+		if t := s.config.Server.ShutdownWaitTime; t != nil {
+			drainTime = *t
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), drainTime)
+		defer cancel()
+		if drainErr := s.queue.Drain(ctx); drainErr != nil {
+			logger := s.base.Logger()
+			logger.Error().Err(drainErr).Msg("Failed to drain webhook queue")
+		}
+	}
+	if s.pushedAtCache != nil {
+		if closeErr := s.pushedAtCache.Close(); closeErr != nil {
+			logger := s.base.Logger()
+			logger.Error().Err(closeErr).Msg("Failed to close push time cache")
+		}
+	}
+	if s.history != nil {
+		// Deliveries in progress may record evaluations, so close the store
+		// after draining the queue
+		if closeErr := s.history.Close(); closeErr != nil {
+			logger := s.base.Logger()
+			logger.Error().Err(closeErr).Msg("Failed to close evaluation history")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTracingFlushTime)
+	defer cancel()
+	if traceErr := s.shutdownTracing(ctx); traceErr != nil {
+		logger := s.base.Logger()
+		logger.Error().Err(traceErr).Msg("Failed to flush traces")
+	}
+	return err
 }
@@ -0,0 +1,237 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing configures OpenTelemetry tracing for the server and
+// provides wrappers that add spans for webhooks and GitHub requests.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultServiceName = "policy-bot"
+
+	// DeliveryIDKey is the attribute that contains the GitHub webhook
+	// delivery ID. It is added to every span created while handling a
+	// delivery.
+	DeliveryIDKey = attribute.Key("github.delivery_id")
+
+	// EventTypeKey is the attribute that contains the GitHub webhook event
+	// type.
+	EventTypeKey = attribute.Key("github.event")
+)
+
+var tracer = otel.Tracer("github.com/palantir/policy-bot/server")
+
+type Config struct {
+	// If true, export traces using the OpenTelemetry protocol (OTLP) over
+	// HTTP.
+	Enabled bool `yaml:"enabled"`
+
+	// The collector endpoint, as a URL or as a host and port. If empty, the
+	// standard OTEL_EXPORTER_OTLP_* environment variables are used.
+	Endpoint string `yaml:"endpoint"`
+
+	// If true, connect to the endpoint with HTTP instead of HTTPS. This only
+	// applies when the endpoint is a host and port.
+	Insecure bool `yaml:"insecure"`
+
+	// Additional headers sent with each export request.
+	Headers map[string]string `yaml:"headers"`
+
+	// The service name reported with each trace. Defaults to "policy-bot".
+	ServiceName string `yaml:"service_name"`
+
+	// The fraction of traces to sample, between 0 and 1. Defaults to 1.
+	// Traces that continue a sampled parent are always sampled.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Setup configures the global tracer provider to export spans as described by
+// the configuration. It returns a function that flushes pending spans and
+// stops exporting. If tracing is not enabled, Setup does nothing and spans are
+// discarded.
+func Setup(ctx context.Context, c Config, version string) (func(context.Context) error, error) {
+	if !c.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	switch {
+	case strings.Contains(c.Endpoint, "://"):
+		opts = append(opts, otlptracehttp.WithEndpointURL(c.Endpoint))
+	case c.Endpoint != "":
+		opts = append(opts, otlptracehttp.WithEndpoint(c.Endpoint))
+		if c.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+	}
+	if len(c.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(c.Headers))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create trace exporter")
+	}
+
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create trace resource")
+	}
+
+	ratio := c.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithSpanProcessor(DeliveryIDProcessor{}),
+		sdktrace.WithBatcher(exporter),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+type deliveryIDCtxKey struct{}
+
+// WithDeliveryID returns a context that adds the delivery ID to all spans
+// started with the context or its children.
+func WithDeliveryID(ctx context.Context, deliveryID string) context.Context {
+	return context.WithValue(ctx, deliveryIDCtxKey{}, deliveryID)
+}
+
+// DeliveryID returns the delivery ID stored in the context, if any.
+func DeliveryID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(deliveryIDCtxKey{}).(string)
+	return id, ok && id != ""
+}
+
+// DeliveryIDProcessor is a span processor that adds the delivery ID from the
+// parent context to each span when it starts.
+type DeliveryIDProcessor struct{}
+
+func (DeliveryIDProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if id, ok := DeliveryID(ctx); ok {
+		s.SetAttributes(DeliveryIDKey.String(id))
+	}
+}
+
+func (DeliveryIDProcessor) OnEnd(s sdktrace.ReadOnlySpan)        {}
+func (DeliveryIDProcessor) Shutdown(ctx context.Context) error   { return nil }
+func (DeliveryIDProcessor) ForceFlush(ctx context.Context) error { return nil }
+
+// EventHandler wraps an event handler so that each call to Handle runs in a
+// span that includes the event type and delivery ID.
+func EventHandler(h githubapp.EventHandler) githubapp.EventHandler {
+	return &eventHandler{EventHandler: h}
+}
+
+// EventHandlers wraps each handler with EventHandler.
+func EventHandlers(hs []githubapp.EventHandler) []githubapp.EventHandler {
+	wrapped := make([]githubapp.EventHandler, len(hs))
+	for i, h := range hs {
+		wrapped[i] = EventHandler(h)
+	}
+	return wrapped
+}
+
+type eventHandler struct {
+	githubapp.EventHandler
+}
+
+func (h *eventHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	ctx = WithDeliveryID(ctx, deliveryID)
+	ctx, span := tracer.Start(ctx, "webhook "+eventType,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(EventTypeKey.String(eventType)),
+	)
+	defer span.End()
+
+	err := h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// ClientMiddleware is client middleware that creates a span for each request
+// to GitHub. Requests must use a context that contains the current span for
+// the span to have the correct parent.
+func ClientMiddleware(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		u := *r.URL
+		u.RawQuery = ""
+		u.User = nil
+
+		ctx, span := tracer.Start(r.Context(), "github "+r.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLFull(u.String()),
+				semconv.ServerAddress(r.URL.Hostname()),
+			),
+		)
+		defer span.End()
+
+		res, err := next.RoundTrip(r.WithContext(ctx))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return res, err
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+		if res.StatusCode >= 500 {
+			span.SetStatus(codes.Error, res.Status)
+		}
+		return res, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
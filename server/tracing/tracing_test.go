@@ -0,0 +1,99 @@
+// Copyright 2024 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var recorder = tracetest.NewSpanRecorder()
+
+func init() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(DeliveryIDProcessor{}),
+		sdktrace.WithSpanProcessor(recorder),
+	))
+}
+
+type testHandler struct {
+	client *http.Client
+	url    string
+}
+
+func (h *testHandler) Handles() []string { return []string{"pull_request"} }
+
+func (h *testHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	return errors.New("evaluation failed")
+}
+
+func TestEventHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	h := EventHandlers([]githubapp.EventHandler{&testHandler{
+		client: &http.Client{Transport: ClientMiddleware(http.DefaultTransport)},
+		url:    srv.URL + "/repos/palantir/policy-bot?token=secret",
+	}})[0]
+
+	assert.Equal(t, []string{"pull_request"}, h.Handles())
+
+	err := h.Handle(context.Background(), "pull_request", "delivery-1", nil)
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2, "incorrect number of spans")
+
+	client, webhook := spans[0], spans[1]
+	assert.Equal(t, "webhook pull_request", webhook.Name())
+	assert.Equal(t, codes.Error, webhook.Status().Code)
+	assert.Contains(t, webhook.Attributes(), EventTypeKey.String("pull_request"))
+	assert.Contains(t, webhook.Attributes(), DeliveryIDKey.String("delivery-1"))
+
+	assert.Equal(t, "github GET", client.Name())
+	assert.Equal(t, webhook.SpanContext().SpanID(), client.Parent().SpanID(), "request span has incorrect parent")
+	assert.Contains(t, client.Attributes(), DeliveryIDKey.String("delivery-1"))
+	assert.Contains(t, client.Attributes(), attribute.Int("http.response.status_code", http.StatusNotFound))
+	assert.Contains(t, client.Attributes(), attribute.String("url.full", srv.URL+"/repos/palantir/policy-bot"))
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{}, "1.0.0")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}